@@ -1,15 +1,35 @@
 package main
 
 import (
+	"context"
 	"github.com/emicklei/go-restful"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	ceServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/certificates/server"
+	cServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/checkin/server"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/jobs"
+	mServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/mail/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
 	oServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	obServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/push"
+	rServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/reports/server"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/server"
+	shServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
 	sServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/sites/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/subscriptions"
+	subServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/subscriptions/server"
+	suServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions/server"
+	tServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/teams/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
 	uServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/users/server"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/webhooks"
+	whServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/webhooks/server"
+	wServer "github.com/klaital/volunteer-savvy-backend/internal/pkg/worklogs/server"
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 	"time"
@@ -57,17 +77,71 @@ func main() {
 		}
 	}
 
+	// Record site changes in the outbox, for their subscribers to be notified
+	sites.OnChange(subscriptions.EnqueueSiteChange)
+
+	// Process outbox events in the background. Real push providers plug in
+	// here; until then, messages are written to the log.
+	pushSender := push.NewSender(push.LogProvider{})
+	pushSender.MaxAttempts = cfg.PushMaxAttempts
+	pushSender.MaxFailures = cfg.PushMaxFailures
+	worker := outbox.NewWorker(db)
+	worker.Concurrency = cfg.OutboxWorkers
+	worker.PollInterval = cfg.GetOutboxPollInterval()
+	worker.MaxAttempts = cfg.OutboxMaxAttempts
+	reminders := subscriptions.NewReminders(db, cfg.GetReminderOffsets())
+	subscriptions.RegisterHandlers(worker, subscriptions.NewDeliverer(db, pushSender, cfg.GetMailer()), reminders)
+	dispatcher := webhooks.NewDispatcher(db)
+	webhooks.RegisterHandlers(worker, dispatcher)
+	go worker.Run(context.Background())
+
+	// Run scheduled jobs in the background
+	runner := jobs.NewRunner(db)
+	runner.Every("shift-reminders", time.Minute, reminders.SendDue)
+	runner.Every("notification-digests", time.Minute, subscriptions.NewDigests(db).BuildDue)
+	runner.Every("organization-purge", time.Hour, organizations.NewPurger(db).PurgeDue)
+	runner.Every("webhook-deliveries", 10*time.Second, dispatcher.SendDue)
+	go runner.Run(context.Background())
+
 	// Initialize the server
 	orgServer := oServer.New(cfg)
 	sitesServer := sServer.New(cfg)
 	authServer := uServer.New(cfg)
 	usersServer := uServer.New(cfg)
+	shiftsServer := shServer.New(cfg)
+	workLogsServer := wServer.New(cfg)
+	checkinServer := cServer.New(cfg)
+	reportsServer := rServer.New(cfg)
+	certificatesServer := ceServer.New(cfg)
+	suggestionsServer := suServer.New(cfg)
+	subscriptionsServer := subServer.New(cfg)
+	mailServer := mServer.New(cfg)
+	outboxServer := obServer.New(cfg)
+	teamsServer := tServer.New(cfg)
+	webhooksServer := whServer.New(cfg)
 
 	services := []*restful.WebService{
 		orgServer.GetOrganizationsAPI(),
 		sitesServer.GetSitesAPI(),
 		authServer.GetAuthAPI(),
 		usersServer.GetUsersAPI(),
+		shiftsServer.GetShiftsAPI(),
+		workLogsServer.GetWorkLogsAPI(),
+		checkinServer.GetCheckinAPI(),
+		reportsServer.GetReportsAPI(),
+		certificatesServer.GetCertificatesAPI(),
+		suggestionsServer.GetSuggestionsAPI(),
+		subscriptionsServer.GetSubscriptionsAPI(),
+		subscriptionsServer.GetDevicesAPI(),
+		subscriptionsServer.GetBroadcastsAPI(),
+		mailServer.GetMailAPI(),
+		outboxServer.GetOutboxAPI(),
+		teamsServer.GetTeamsAPI(),
+		webhooksServer.GetWebhooksAPI(),
+	}
+	auditor := users.NewImpersonationAuditor(db)
+	for i := range services {
+		services[i].Filter(auditor.Filter)
 	}
 	s, err := server.New(cfg, services)
 	if err != nil {
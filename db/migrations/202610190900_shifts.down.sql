@@ -0,0 +1,10 @@
+-- Shift Signups
+DROP INDEX IF EXISTS shift_signups_active_unique_index;
+DROP INDEX IF EXISTS shift_signups_user_index;
+DROP INDEX IF EXISTS shift_signups_shift_index;
+DROP TABLE IF EXISTS shift_signups;
+
+-- Shifts
+DROP INDEX IF EXISTS shifts_site_index;
+DROP INDEX IF EXISTS shifts_org_starts_index;
+DROP TABLE IF EXISTS shifts;
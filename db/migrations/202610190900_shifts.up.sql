@@ -0,0 +1,30 @@
+-- Shifts
+
+CREATE TABLE shifts (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  site_id INTEGER NOT NULL REFERENCES sites(id),
+  role INTEGER NOT NULL, -- the RoleType a volunteer must hold to fill this shift
+  starts_at TIMESTAMPTZ NOT NULL,
+  ends_at TIMESTAMPTZ NOT NULL,
+  slots INTEGER NOT NULL DEFAULT 1,
+  CHECK (ends_at > starts_at),
+  CHECK (slots > 0)
+);
+CREATE INDEX shifts_org_starts_index ON shifts(organization_id, starts_at);
+CREATE INDEX shifts_site_index ON shifts(site_id);
+
+-- Shift Signups
+
+CREATE TABLE shift_signups (
+  id SERIAL PRIMARY KEY,
+  shift_id INTEGER NOT NULL REFERENCES shifts(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  source VARCHAR(16) NOT NULL DEFAULT 'self', -- 'self' or 'auto'
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  cancelled_at TIMESTAMPTZ
+);
+CREATE INDEX shift_signups_shift_index ON shift_signups(shift_id);
+CREATE INDEX shift_signups_user_index ON shift_signups(user_id);
+-- A user may only hold one active signup per shift
+CREATE UNIQUE INDEX shift_signups_active_unique_index ON shift_signups(shift_id, user_id) WHERE cancelled_at IS NULL;
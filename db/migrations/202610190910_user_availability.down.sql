@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS user_preferred_sites_unique_index;
+DROP TABLE IF EXISTS user_preferred_sites;
+
+DROP INDEX IF EXISTS user_blackout_dates_unique_index;
+DROP TABLE IF EXISTS user_blackout_dates;
+
+DROP INDEX IF EXISTS user_availability_windows_user_index;
+DROP TABLE IF EXISTS user_availability_windows;
+
+ALTER TABLE users DROP COLUMN IF EXISTS max_hours_per_week;
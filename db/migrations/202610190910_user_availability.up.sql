@@ -0,0 +1,26 @@
+-- Volunteer availability preferences
+
+ALTER TABLE users ADD COLUMN max_hours_per_week FLOAT NOT NULL DEFAULT 0; -- 0 means no cap
+
+CREATE TABLE user_availability_windows (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  dotw dotw_type NOT NULL,
+  start_time VARCHAR(6) NOT NULL, -- HH:MM
+  end_time VARCHAR(6) NOT NULL -- HH:MM, '24:00' for end of day
+);
+CREATE INDEX user_availability_windows_user_index ON user_availability_windows(user_id);
+
+CREATE TABLE user_blackout_dates (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  blackout_date DATE NOT NULL
+);
+CREATE UNIQUE INDEX user_blackout_dates_unique_index ON user_blackout_dates(user_id, blackout_date);
+
+CREATE TABLE user_preferred_sites (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  site_id INTEGER NOT NULL REFERENCES sites(id)
+);
+CREATE UNIQUE INDEX user_preferred_sites_unique_index ON user_preferred_sites(user_id, site_id);
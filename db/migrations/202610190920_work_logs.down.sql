@@ -0,0 +1,8 @@
+-- Work Logs
+DROP INDEX IF EXISTS work_logs_open_unique_index;
+DROP INDEX IF EXISTS work_logs_user_clock_in_index;
+DROP INDEX IF EXISTS work_logs_site_clock_in_index;
+DROP TABLE IF EXISTS work_logs;
+
+-- Site time zones
+ALTER TABLE sites DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,24 @@
+-- Site time zones, used to interpret open hours
+
+ALTER TABLE sites ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+-- Work Logs
+
+CREATE TABLE work_logs (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  site_id INTEGER NOT NULL REFERENCES sites(id),
+  shift_id INTEGER REFERENCES shifts(id), -- optional
+  clock_in TIMESTAMPTZ NOT NULL,
+  clock_out TIMESTAMPTZ, -- null while the volunteer is still on the clock
+  is_manual BOOLEAN NOT NULL DEFAULT false, -- entered after the fact rather than punched
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (clock_out IS NULL OR clock_out > clock_in)
+);
+CREATE INDEX work_logs_site_clock_in_index ON work_logs(site_id, clock_in);
+CREATE INDEX work_logs_user_clock_in_index ON work_logs(user_id, clock_in);
+-- A user may only be clocked in once at a time
+CREATE UNIQUE INDEX work_logs_open_unique_index ON work_logs(user_id) WHERE clock_out IS NULL;
@@ -0,0 +1,8 @@
+-- Work Log audit trail
+DROP INDEX IF EXISTS work_log_events_work_log_index;
+DROP TABLE IF EXISTS work_log_events;
+
+-- Work Log review status
+DROP INDEX IF EXISTS work_logs_status_index;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS rejection_reason;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS status;
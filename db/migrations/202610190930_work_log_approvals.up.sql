@@ -0,0 +1,17 @@
+-- Work Log review status
+
+ALTER TABLE work_logs ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'submitted'; -- 'submitted', 'approved', 'rejected' or 'amended'
+ALTER TABLE work_logs ADD COLUMN rejection_reason TEXT NOT NULL DEFAULT '';
+CREATE INDEX work_logs_status_index ON work_logs(status);
+
+-- Work Log audit trail
+
+CREATE TABLE work_log_events (
+  id SERIAL PRIMARY KEY,
+  work_log_id INTEGER NOT NULL REFERENCES work_logs(id),
+  actor_id INTEGER NOT NULL REFERENCES users(id),
+  action VARCHAR(16) NOT NULL, -- 'approved', 'rejected', 'amended' or 'reopened'
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX work_log_events_work_log_index ON work_log_events(work_log_id);
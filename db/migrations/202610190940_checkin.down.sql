@@ -0,0 +1,6 @@
+-- Kiosk devices
+DROP INDEX IF EXISTS kiosk_devices_site_index;
+DROP TABLE IF EXISTS kiosk_devices;
+
+-- Site check-in keys
+DROP TABLE IF EXISTS site_checkin_keys;
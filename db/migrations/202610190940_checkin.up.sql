@@ -0,0 +1,21 @@
+-- Per-site secrets for rotating check-in codes
+
+CREATE TABLE site_checkin_keys (
+  site_id INTEGER PRIMARY KEY REFERENCES sites(id),
+  secret BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Kiosk devices, each bound to a single site
+
+CREATE TABLE kiosk_devices (
+  id SERIAL PRIMARY KEY,
+  site_id INTEGER NOT NULL REFERENCES sites(id),
+  name VARCHAR(128) NOT NULL,
+  secret_hash BYTEA NOT NULL, -- SHA-256 of the device's credential secret
+  created_by INTEGER NOT NULL REFERENCES users(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+CREATE INDEX kiosk_devices_site_index ON kiosk_devices(site_id);
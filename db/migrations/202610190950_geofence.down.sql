@@ -0,0 +1,9 @@
+-- Geofencing for clock-ins
+DROP INDEX IF EXISTS work_logs_geofence_flagged_index;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS geofence_flagged;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS clock_in_distance_m;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS clock_in_lon;
+ALTER TABLE work_logs DROP COLUMN IF EXISTS clock_in_lat;
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS geofence_policy;
+ALTER TABLE sites DROP COLUMN IF EXISTS geofence_radius_m;
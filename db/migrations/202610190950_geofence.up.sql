@@ -0,0 +1,10 @@
+-- Geofencing for clock-ins
+
+ALTER TABLE sites ADD COLUMN geofence_radius_m INTEGER NOT NULL DEFAULT 200;
+ALTER TABLE organizations ADD COLUMN geofence_policy VARCHAR(16) NOT NULL DEFAULT 'flag'; -- 'reject', 'flag' or 'allow'
+
+ALTER TABLE work_logs ADD COLUMN clock_in_lat FLOAT;
+ALTER TABLE work_logs ADD COLUMN clock_in_lon FLOAT;
+ALTER TABLE work_logs ADD COLUMN clock_in_distance_m FLOAT; -- from the site, if both locations were known
+ALTER TABLE work_logs ADD COLUMN geofence_flagged BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX work_logs_geofence_flagged_index ON work_logs(organization_id, clock_in) WHERE geofence_flagged;
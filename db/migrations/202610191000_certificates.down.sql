@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS certificates_user_index;
+DROP TABLE IF EXISTS certificates;
@@ -0,0 +1,18 @@
+-- Service certificates issued to volunteers. The totals are recorded as they
+-- stood when the certificate was issued, so that a verifier sees the same
+-- figures that were printed.
+
+CREATE TABLE certificates (
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(16) UNIQUE NOT NULL,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  issued_by INTEGER NOT NULL REFERENCES users(id),
+  period_start DATE NOT NULL,
+  period_end DATE NOT NULL, -- inclusive
+  total_hours NUMERIC(10, 2) NOT NULL,
+  work_logs INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (period_end >= period_start)
+);
+CREATE INDEX certificates_user_index ON certificates(user_id);
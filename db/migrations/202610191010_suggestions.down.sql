@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS suggestions_org_status_index;
+DROP TABLE IF EXISTS suggestions;
@@ -0,0 +1,18 @@
+-- Feedback left by volunteers or anonymous visitors for an organization, or
+-- for one of its sites.
+
+CREATE TABLE suggestions (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  site_id INTEGER REFERENCES sites(id),
+  submitted_by INTEGER REFERENCES users(id), -- NULL when anonymous
+  contact_email VARCHAR(128) NOT NULL DEFAULT '',
+  body TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'new',
+  assignee_id INTEGER REFERENCES users(id),
+  internal_notes TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (status IN ('new', 'in-progress', 'resolved'))
+);
+CREATE INDEX suggestions_org_status_index ON suggestions(organization_id, status, created_at);
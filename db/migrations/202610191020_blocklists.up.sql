@@ -0,0 +1,7 @@
+-- Terms an organization will not accept in anonymous submissions
+
+CREATE TABLE organization_blocked_terms (
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  term VARCHAR(64) NOT NULL, -- stored in lower case
+  PRIMARY KEY (organization_id, term)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS notifications_unsent_index;
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS site_subscriptions_site_index;
+DROP TABLE IF EXISTS site_subscriptions;
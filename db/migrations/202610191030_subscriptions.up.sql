@@ -0,0 +1,24 @@
+-- Users subscribe to a site to hear about changes to its hours, open days or
+-- location, on one or more channels.
+
+CREATE TABLE site_subscriptions (
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  site_id INTEGER NOT NULL REFERENCES sites(id),
+  channel VARCHAR(16) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, site_id, channel),
+  CHECK (channel IN ('push', 'email'))
+);
+CREATE INDEX site_subscriptions_site_index ON site_subscriptions(site_id);
+
+-- Notification events waiting to be delivered to a user on a channel.
+CREATE TABLE notifications (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  channel VARCHAR(16) NOT NULL,
+  event_type VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  sent_at TIMESTAMPTZ -- NULL until delivered
+);
+CREATE INDEX notifications_unsent_index ON notifications(created_at) WHERE sent_at IS NULL;
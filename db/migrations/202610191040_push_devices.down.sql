@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS push_devices_user_index;
+DROP TABLE IF EXISTS push_devices;
@@ -0,0 +1,15 @@
+-- Devices registered to receive push notifications. A token belongs to one
+-- device, so registering it again moves it to the new user.
+
+CREATE TABLE push_devices (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  platform VARCHAR(16) NOT NULL,
+  token TEXT NOT NULL UNIQUE,
+  failure_count INTEGER NOT NULL DEFAULT 0, -- consecutive failed deliveries
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_delivered_at TIMESTAMPTZ,
+  CHECK (platform IN ('ios', 'android', 'web'))
+);
+CREATE INDEX push_devices_user_index ON push_devices(user_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS undeliverable_emails;
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS logo_url;
+ALTER TABLE organizations DROP COLUMN IF EXISTS brand_color;
+ALTER TABLE organizations DROP COLUMN IF EXISTS email_from_name;
+ALTER TABLE organizations DROP COLUMN IF EXISTS email_from_address;
+ALTER TABLE organizations DROP COLUMN IF EXISTS default_locale;
@@ -0,0 +1,14 @@
+-- Email notifications: each organization's locale and branding, and the
+-- addresses mail can no longer be delivered to.
+
+ALTER TABLE organizations ADD COLUMN default_locale VARCHAR(16) NOT NULL DEFAULT 'en';
+ALTER TABLE organizations ADD COLUMN email_from_address VARCHAR(128) NOT NULL DEFAULT ''; -- '' for the service default
+ALTER TABLE organizations ADD COLUMN email_from_name VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN brand_color VARCHAR(7) NOT NULL DEFAULT ''; -- #rrggbb
+ALTER TABLE organizations ADD COLUMN logo_url VARCHAR(512) NOT NULL DEFAULT '';
+
+CREATE TABLE undeliverable_emails (
+  email VARCHAR(128) PRIMARY KEY, -- lower case
+  reason TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
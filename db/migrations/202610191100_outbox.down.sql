@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_events_status_index;
+DROP INDEX IF EXISTS outbox_events_pending_index;
+DROP TABLE IF EXISTS outbox_events;
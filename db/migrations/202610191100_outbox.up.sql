@@ -0,0 +1,18 @@
+-- Transactional outbox. Domain writes insert events in the same transaction,
+-- and background workers process them, retrying failures with backoff until
+-- they are dead-lettered.
+
+CREATE TABLE outbox_events (
+  id BIGSERIAL PRIMARY KEY,
+  event_type VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  available_at TIMESTAMPTZ NOT NULL DEFAULT now(), -- not retried before this
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  processed_at TIMESTAMPTZ,
+  CHECK (status IN ('pending', 'done', 'dead'))
+);
+CREATE INDEX outbox_events_pending_index ON outbox_events(available_at, id) WHERE status = 'pending';
+CREATE INDEX outbox_events_status_index ON outbox_events(status, id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notification_quiet_hours;
+DROP TABLE IF EXISTS notification_preferences;
+DROP INDEX IF EXISTS shift_reminders_pending_index;
+DROP TABLE IF EXISTS shift_reminders;
+DROP TABLE IF EXISTS scheduled_jobs;
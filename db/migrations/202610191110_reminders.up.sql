@@ -0,0 +1,41 @@
+-- Periodic jobs take a lease on their row, so that each run happens on only
+-- one replica.
+CREATE TABLE scheduled_jobs (
+  name VARCHAR(64) PRIMARY KEY,
+  next_run_at TIMESTAMPTZ NOT NULL,
+  last_run_at TIMESTAMPTZ,
+  last_error TEXT NOT NULL DEFAULT ''
+);
+
+-- One reminder per signup and offset before the shift starts. The unique key
+-- keeps retries and replicas from scheduling a reminder twice.
+CREATE TABLE shift_reminders (
+  id SERIAL PRIMARY KEY,
+  signup_id INTEGER NOT NULL REFERENCES shift_signups(id),
+  offset_minutes INTEGER NOT NULL,
+  send_at TIMESTAMPTZ NOT NULL, -- pushed back while the volunteer has quiet hours
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  sent_at TIMESTAMPTZ,
+  UNIQUE (signup_id, offset_minutes),
+  CHECK (status IN ('pending', 'sent', 'cancelled', 'skipped'))
+);
+CREATE INDEX shift_reminders_pending_index ON shift_reminders(send_at) WHERE status = 'pending';
+
+-- The channel a user wants each kind of notification on. Kinds without a row
+-- are sent on every channel.
+CREATE TABLE notification_preferences (
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  event_type VARCHAR(64) NOT NULL,
+  channel VARCHAR(16) NOT NULL,
+  PRIMARY KEY (user_id, event_type),
+  CHECK (channel IN ('push', 'email', 'none'))
+);
+
+-- Hours, in the user's time zone, during which reminders are held back.
+CREATE TABLE notification_quiet_hours (
+  user_id INTEGER PRIMARY KEY REFERENCES users(id),
+  timezone VARCHAR(64) NOT NULL,
+  starts_at VARCHAR(6) NOT NULL,
+  ends_at VARCHAR(6) NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS team_members_user_index;
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS site_features;
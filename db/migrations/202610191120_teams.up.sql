@@ -0,0 +1,27 @@
+-- Services offered at a site, such as tax preparation, keyed by normalized
+-- name.
+CREATE TABLE site_features (
+  site_id INTEGER NOT NULL REFERENCES sites(id),
+  feature VARCHAR(64) NOT NULL,
+  PRIMARY KEY (site_id, feature)
+);
+
+-- Teams of volunteers within an organization. A team whose feature_key
+-- matches a site feature hears about changes to the sites offering it.
+CREATE TABLE teams (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  name VARCHAR(64) NOT NULL,
+  feature_key VARCHAR(64) NOT NULL, -- name, normalized like a site feature
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (organization_id, feature_key)
+);
+
+CREATE TABLE team_members (
+  team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  notify BOOLEAN NOT NULL DEFAULT false, -- opted in to site change notifications
+  joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX team_members_user_index ON team_members(user_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS notifications_held_index;
+ALTER TABLE notifications DROP COLUMN IF EXISTS digest_id;
+ALTER TABLE notifications DROP COLUMN IF EXISTS held;
+DROP TABLE IF EXISTS notification_digests;
@@ -0,0 +1,17 @@
+-- Users who batch non-urgent notifications into a daily or weekly digest.
+CREATE TABLE notification_digests (
+  user_id INTEGER PRIMARY KEY REFERENCES users(id),
+  frequency VARCHAR(16) NOT NULL,
+  timezone VARCHAR(64) NOT NULL,
+  send_at VARCHAR(6) NOT NULL, -- HH:MM in the timezone
+  weekday VARCHAR(16) NOT NULL DEFAULT '', -- weekly digests only
+  next_run_at TIMESTAMPTZ NOT NULL,
+  CHECK (frequency IN ('daily', 'weekly'))
+);
+CREATE INDEX notification_digests_next_run_index ON notification_digests(next_run_at);
+
+-- Held notifications wait for the recipient's next digest instead of being
+-- delivered. Once it is built they are marked sent, pointing at the digest.
+ALTER TABLE notifications ADD COLUMN held BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE notifications ADD COLUMN digest_id INTEGER REFERENCES notifications(id);
+CREATE INDEX notifications_held_index ON notifications(user_id, created_at) WHERE held;
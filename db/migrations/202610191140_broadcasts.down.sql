@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS notifications_broadcast_index;
+ALTER TABLE notifications DROP COLUMN IF EXISTS broadcast_id;
+DROP TABLE IF EXISTS broadcast_recipients;
+DROP INDEX IF EXISTS broadcasts_org_index;
+DROP TABLE IF EXISTS broadcasts;
@@ -0,0 +1,28 @@
+-- Urgent messages from an organization's admins to a group of volunteers.
+-- They go out on every channel, ignoring preferences, quiet hours and digests.
+CREATE TABLE broadcasts (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  sent_by INTEGER NOT NULL REFERENCES users(id),
+  subject VARCHAR(200) NOT NULL,
+  body TEXT NOT NULL,
+  target_type VARCHAR(16) NOT NULL,
+  site_id INTEGER REFERENCES sites(id), -- signups targets only
+  shift_date DATE, -- signups targets only
+  team_id INTEGER REFERENCES teams(id) ON DELETE SET NULL, -- team targets only
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (target_type IN ('organization', 'signups', 'team'))
+);
+CREATE INDEX broadcasts_org_index ON broadcasts(organization_id, created_at);
+
+CREATE TABLE broadcast_recipients (
+  broadcast_id INTEGER NOT NULL REFERENCES broadcasts(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  acknowledged_at TIMESTAMPTZ,
+  PRIMARY KEY (broadcast_id, user_id)
+);
+
+-- Each recipient's notifications point back at the broadcast, so that its
+-- delivery can be tracked.
+ALTER TABLE notifications ADD COLUMN broadcast_id INTEGER REFERENCES broadcasts(id);
+CREATE INDEX notifications_broadcast_index ON notifications(broadcast_id) WHERE broadcast_id IS NOT NULL;
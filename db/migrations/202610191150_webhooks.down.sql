@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS webhook_deliveries_webhook_index;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS webhooks_org_index;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,30 @@
+-- Endpoints an organization's admins have asked to be sent events. Each
+-- delivery is signed with the webhook's secret.
+CREATE TABLE webhooks (
+  id SERIAL PRIMARY KEY,
+  organization_id INTEGER NOT NULL REFERENCES organizations(id),
+  url VARCHAR(2048) NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  event_types VARCHAR(64)[] NOT NULL,
+  active BOOL NOT NULL DEFAULT TRUE,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  disabled_at TIMESTAMPTZ, -- set when disabled after too many failures
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX webhooks_org_index ON webhooks(organization_id);
+
+CREATE TABLE webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_type VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  response_status INTEGER, -- of the last attempt, if the endpoint answered
+  last_error TEXT NOT NULL DEFAULT '',
+  next_attempt_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at TIMESTAMPTZ,
+  CHECK (status IN ('pending', 'succeeded', 'failed'))
+);
+CREATE INDEX webhook_deliveries_webhook_index ON webhook_deliveries(webhook_id, created_at);
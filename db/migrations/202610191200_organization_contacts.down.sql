@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS organization_emergency_contacts;
+ALTER TABLE organizations DROP COLUMN IF EXISTS contact_role;
+ALTER TABLE organizations DROP COLUMN IF EXISTS contact_email;
+ALTER TABLE organizations DROP COLUMN IF EXISTS contact_phone;
+ALTER TABLE organizations DROP COLUMN IF EXISTS contact_name;
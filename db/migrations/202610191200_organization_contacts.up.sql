@@ -0,0 +1,15 @@
+-- Who to call about an organization, and who to call in an emergency.
+ALTER TABLE organizations ADD COLUMN contact_name VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN contact_phone VARCHAR(16) NOT NULL DEFAULT ''; -- E.164
+ALTER TABLE organizations ADD COLUMN contact_email VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE organizations ADD COLUMN contact_role VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE organization_emergency_contacts (
+  organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL, -- the order to try them in
+  name VARCHAR(128) NOT NULL,
+  phone VARCHAR(16) NOT NULL, -- E.164
+  email VARCHAR(128) NOT NULL DEFAULT '',
+  role VARCHAR(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (organization_id, position)
+);
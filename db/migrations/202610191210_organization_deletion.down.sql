@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS organizations_purge_index;
+ALTER TABLE organizations DROP COLUMN IF EXISTS purge_after;
+ALTER TABLE organizations DROP COLUMN IF EXISTS deleted_at;
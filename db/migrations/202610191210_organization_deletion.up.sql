@@ -0,0 +1,5 @@
+-- Deleted organizations are kept, hidden, until purge_after, so that a site
+-- admin can restore them. A background job purges them after that.
+ALTER TABLE organizations ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE organizations ADD COLUMN purge_after TIMESTAMPTZ;
+CREATE INDEX organizations_purge_index ON organizations(purge_after) WHERE purge_after IS NOT NULL;
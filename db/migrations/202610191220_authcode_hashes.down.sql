@@ -0,0 +1,13 @@
+ALTER TABLE organizations DROP COLUMN IF EXISTS authcode_rotated_at;
+ALTER TABLE organizations DROP COLUMN IF EXISTS authcode_uses;
+ALTER TABLE organizations DROP COLUMN IF EXISTS authcode_max_uses;
+ALTER TABLE organizations DROP COLUMN IF EXISTS authcode_expires_at;
+
+-- The codes themselves cannot be recovered, so each organization gets its
+-- hash as a code, to be rotated.
+ALTER TABLE organizations ADD COLUMN authcode VARCHAR(64);
+UPDATE organizations SET authcode = encode(authcode_hash, 'hex');
+ALTER TABLE organizations ALTER COLUMN authcode SET NOT NULL;
+ALTER TABLE organizations ADD CONSTRAINT organizations_authcode_key UNIQUE (authcode);
+DROP INDEX IF EXISTS organizations_authcode_index;
+ALTER TABLE organizations DROP COLUMN IF EXISTS authcode_hash;
@@ -0,0 +1,12 @@
+-- Organization authcodes are stored as SHA-256 hashes, so that they cannot
+-- be read back, and may be limited to a number of uses or an expiry.
+ALTER TABLE organizations ADD COLUMN authcode_hash BYTEA;
+UPDATE organizations SET authcode_hash = sha256(convert_to(authcode, 'UTF8'));
+ALTER TABLE organizations ALTER COLUMN authcode_hash SET NOT NULL;
+CREATE UNIQUE INDEX organizations_authcode_index ON organizations(authcode_hash);
+ALTER TABLE organizations DROP COLUMN authcode;
+
+ALTER TABLE organizations ADD COLUMN authcode_expires_at TIMESTAMPTZ; -- NULL if it does not expire
+ALTER TABLE organizations ADD COLUMN authcode_max_uses INTEGER; -- NULL if it may be used any number of times
+ALTER TABLE organizations ADD COLUMN authcode_uses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE organizations ADD COLUMN authcode_rotated_at TIMESTAMPTZ NOT NULL DEFAULT now();
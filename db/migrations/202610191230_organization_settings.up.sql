@@ -0,0 +1,11 @@
+-- Per-organization settings that do not already live on organizations. An
+-- organization without a row uses the defaults.
+CREATE TABLE organization_settings (
+  organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+  version INTEGER NOT NULL DEFAULT 1, -- bumped by each change
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  self_signup BOOLEAN NOT NULL DEFAULT TRUE,
+  work_log_approval BOOLEAN NOT NULL DEFAULT TRUE,
+  max_weekly_hours FLOAT NOT NULL DEFAULT 0, -- 0 means no cap
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
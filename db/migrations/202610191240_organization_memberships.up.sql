@@ -0,0 +1,18 @@
+-- A user may belong to several organizations. Their roles in each are still
+-- kept in roles; this records whether, and since when, they are a member.
+CREATE TABLE organization_memberships (
+  organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status VARCHAR(16) NOT NULL DEFAULT 'active', -- 'active' or 'left'
+  joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  left_at TIMESTAMPTZ,
+  PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX organization_memberships_user_index ON organization_memberships(user_id);
+
+-- Everyone already in an organization, by the old single column or by a
+-- role in it, is a member of it.
+INSERT INTO organization_memberships (organization_id, user_id)
+  SELECT organization_id, id FROM users WHERE organization_id IS NOT NULL
+  UNION
+  SELECT org_id, user_id FROM roles;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS impersonation_requests;
+DROP TABLE IF EXISTS impersonation_sessions;
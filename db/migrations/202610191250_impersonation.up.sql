@@ -0,0 +1,22 @@
+-- Each impersonation token a site admin is issued, and every request made
+-- with it, including those refused.
+CREATE TABLE impersonation_sessions (
+  id VARCHAR(64) PRIMARY KEY, -- the token's jti
+  actor_user_id INTEGER NOT NULL REFERENCES users(id),
+  target_user_id INTEGER NOT NULL REFERENCES users(id),
+  reason VARCHAR(512) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX impersonation_sessions_created_index ON impersonation_sessions(created_at);
+CREATE INDEX impersonation_sessions_target_index ON impersonation_sessions(target_user_id);
+
+CREATE TABLE impersonation_requests (
+  id BIGSERIAL PRIMARY KEY,
+  session_id VARCHAR(64) NOT NULL REFERENCES impersonation_sessions(id) ON DELETE CASCADE,
+  method VARCHAR(16) NOT NULL,
+  path VARCHAR(512) NOT NULL,
+  status_code INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX impersonation_requests_session_index ON impersonation_requests(session_id);
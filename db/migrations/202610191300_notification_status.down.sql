@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS notifications_pending_index;
+CREATE INDEX notifications_unsent_index ON notifications(created_at) WHERE sent_at IS NULL;
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_status_check;
+ALTER TABLE notifications DROP COLUMN IF EXISTS last_error;
+ALTER TABLE notifications DROP COLUMN IF EXISTS status;
@@ -0,0 +1,10 @@
+-- A notification that reached no device or mailbox is settled as undelivered,
+-- with the reason, rather than counted as sent.
+ALTER TABLE notifications ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'pending';
+ALTER TABLE notifications ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE notifications ADD CONSTRAINT notifications_status_check
+  CHECK (status IN ('pending', 'sent', 'undelivered'));
+UPDATE notifications SET status = 'sent' WHERE sent_at IS NOT NULL;
+
+DROP INDEX IF EXISTS notifications_unsent_index;
+CREATE INDEX notifications_pending_index ON notifications(created_at) WHERE status = 'pending';
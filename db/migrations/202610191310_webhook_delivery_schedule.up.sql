@@ -0,0 +1,5 @@
+-- Deliveries are sent by a scheduled job, rather than by outbox events, so
+-- pending ones are due at once and the events that used to send them go.
+UPDATE webhook_deliveries SET next_attempt_at = now() WHERE status = 'pending' AND next_attempt_at IS NULL;
+DELETE FROM outbox_events WHERE event_type = 'webhook.deliver' AND status <> 'done';
+CREATE INDEX webhook_deliveries_due_index ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,135 @@
+package certificates
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+var ErrNoApprovedHours = errors.New("no approved hours in the date range")
+
+// Certificate records a volunteer's approved hours for an organization over a
+// range of dates, as they stood when it was issued.
+type Certificate struct {
+	Id               uint64    `json:"-" db:"id"`
+	Code             string    `json:"code" db:"code"`
+	OrganizationId   uint64    `json:"-" db:"organization_id"`
+	OrganizationName string    `json:"organization" db:"organization_name"`
+	UserId           uint64    `json:"-" db:"user_id"`
+	VolunteerEmail   string    `json:"volunteer" db:"volunteer_email"`
+	IssuedBy         uint64    `json:"-" db:"issued_by"`
+	IssuedByEmail    string    `json:"issued_by" db:"issued_by_email"`
+	PeriodStart      string    `json:"period_start" db:"period_start"` // YYYY-MM-DD
+	PeriodEnd        string    `json:"period_end" db:"period_end"`     // YYYY-MM-DD, inclusive
+	TotalHours       float64   `json:"total_hours" db:"total_hours"`
+	WorkLogs         int       `json:"work_logs" db:"work_logs"`
+	CreatedAt        time.Time `json:"issued_at" db:"created_at"`
+}
+
+// Verification codes avoid letters and digits that are easily misread from
+// paper, such as O and 0 or I and 1.
+const (
+	codeAlphabet = "ABCDEFGHJKMNPQRSTVWXYZ23456789"
+	codeLength   = 12
+)
+
+func generateCode() (string, error) {
+	buf := make([]byte, codeLength)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		// 256 is not a multiple of the alphabet's length, but the bias is
+		// small enough not to matter for a lookup key.
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// FormatCode splits a verification code into groups of four for printing.
+func FormatCode(code string) string {
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	groups = append(groups, code)
+	return strings.Join(groups, "-")
+}
+
+// NormalizeCode undoes FormatCode and forgives the case and spacing people
+// use when typing a code in.
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// Issue totals the volunteer's approved work in [from, to) and records a new
+// certificate for it. From and to are midnights in the time zone the dates
+// were given in.
+func Issue(ctx context.Context, db *sqlx.DB, orgId, userId, issuerId uint64, from, to time.Time) (*Certificate, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "IssueCertificate",
+		"OrganizationID": orgId,
+		"UserID":         userId,
+	})
+
+	var totals struct {
+		Hours    float64 `db:"hours"`
+		WorkLogs int     `db:"work_logs"`
+	}
+	err := db.GetContext(ctx, &totals, db.Rebind(sumApprovedHoursSql), orgId, userId, from, to)
+	if err != nil {
+		logger.WithError(err).Error("Failed to total approved hours")
+		return nil, err
+	}
+	if totals.WorkLogs == 0 {
+		return nil, ErrNoApprovedHours
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate verification code")
+		return nil, err
+	}
+	var id uint64
+	err = db.GetContext(ctx, &id, db.Rebind(insertCertificateSql),
+		code, orgId, userId, issuerId,
+		from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"),
+		totals.Hours, totals.WorkLogs)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert certificate")
+		return nil, err
+	}
+
+	// Read it back for the names and the rounded total
+	return FindCertificate(ctx, db, code)
+}
+
+// FindCertificate looks up a certificate by its verification code, in either
+// printed or normalized form. Returns nil if no such certificate exists.
+func FindCertificate(ctx context.Context, db *sqlx.DB, code string) (*Certificate, error) {
+	rows := make([]Certificate, 0, 1)
+	err := db.SelectContext(ctx, &rows, db.Rebind(selectCertificateByCodeSql), NormalizeCode(code))
+	if err != nil {
+		filters.GetContextLogger(ctx).WithError(err).Error("Failed to select certificate")
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// Success!
+	return &rows[0], nil
+}
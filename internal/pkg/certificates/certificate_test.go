@@ -0,0 +1,101 @@
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodes(t *testing.T) {
+	code, err := generateCode()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if len(code) != codeLength || strings.Trim(code, codeAlphabet) != "" {
+		t.Errorf("Unexpected code %q", code)
+	}
+
+	if formatted := FormatCode("ABCDEFGHJKMN"); formatted != "ABCD-EFGH-JKMN" {
+		t.Errorf("Expected ABCD-EFGH-JKMN, got %s", formatted)
+	}
+	if normalized := NormalizeCode(" abcd-efgh jkmn"); normalized != "ABCDEFGHJKMN" {
+		t.Errorf("Expected ABCDEFGHJKMN, got %s", normalized)
+	}
+}
+
+func TestPdfString(t *testing.T) {
+	testCases := map[string]string{
+		"Plain":          "(Plain)",
+		`Smith (Jr.) \o`: `(Smith \(Jr.\) \\o)`,
+		"Société":        `(Soci\351t\351)`,
+		"日本":             "(??)",
+	}
+	for in, expected := range testCases {
+		if out := pdfString(in); out != expected {
+			t.Errorf("pdfString(%q): expected %s, got %s", in, expected, out)
+		}
+	}
+}
+
+func TestCertificate_WritePDF(t *testing.T) {
+	c := Certificate{
+		Code:             "ABCDEFGHJKMN",
+		OrganizationName: "Tax Aide (North)",
+		VolunteerEmail:   "volunteer@example.com",
+		IssuedByEmail:    "admin@example.com",
+		PeriodStart:      "2020-01-01",
+		PeriodEnd:        "2020-04-15",
+		TotalHours:       42.5,
+		WorkLogs:         12,
+		CreatedAt:        time.Date(2020, time.April, 20, 0, 0, 0, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	err := c.WritePDF(&buf, "https://example.com/certificates/verify/ABCDEFGHJKMN")
+	if err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	pdf := buf.String()
+
+	if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatalf("Missing PDF header or trailer")
+	}
+	expectedText := []string{
+		"(Tax Aide \\(North\\))",
+		"(contributed 42.50 hours of volunteer service to)",
+		"(between January 1, 2020 and April 15, 2020)",
+		"(ABCD-EFGH-JKMN)",
+	}
+	for _, expected := range expectedText {
+		if !strings.Contains(pdf, expected) {
+			t.Errorf("Expected PDF to contain %s", expected)
+		}
+	}
+
+	// Every cross-reference entry must point at the start of its object
+	startxref := strings.LastIndex(pdf, "startxref\n")
+	xref, err := strconv.Atoi(strings.Fields(pdf[startxref+len("startxref\n"):])[0])
+	if err != nil || !strings.HasPrefix(pdf[xref:], "xref\n") {
+		t.Fatalf("startxref does not point at the xref table")
+	}
+	lines := strings.Split(pdf[xref:], "\n")
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	if count != 7 {
+		t.Errorf("Expected 7 xref entries, got %d", count)
+	}
+	for i := 1; i < count; i++ {
+		offset, _ := strconv.Atoi(lines[2+i][:10])
+		if !strings.HasPrefix(pdf[offset:], fmt.Sprintf("%d 0 obj\n", i)) {
+			t.Errorf("xref entry %d does not point at its object", i)
+		}
+	}
+
+	// The stream's length must match its content
+	stream := strings.Index(pdf, "stream\n") + len("stream\n")
+	end := strings.Index(pdf, "endstream")
+	if !strings.Contains(pdf, fmt.Sprintf("/Length %d >>", end-stream)) {
+		t.Errorf("Content stream length does not match")
+	}
+}
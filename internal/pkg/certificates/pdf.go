@@ -0,0 +1,180 @@
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The certificate is a single landscape US Letter page, laid out in PDF
+// points (1/72 inch) from the bottom-left corner. It only uses the standard
+// Helvetica fonts, which every PDF reader provides, so nothing needs to be
+// embedded.
+const (
+	pageWidth    = 792.0
+	pageHeight   = 612.0
+	maxLineWidth = 640.0 // widest a centered line may be
+)
+
+type font struct {
+	name     string // resource name used in the content stream
+	baseFont string
+	widths   [95]int // advance widths of ' ' through '~', in 1/1000 em
+}
+
+var helvetica = &font{
+	name:     "F1",
+	baseFont: "Helvetica",
+	widths: [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+}
+
+var helveticaBold = &font{
+	name:     "F2",
+	baseFont: "Helvetica-Bold",
+	widths: [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// textWidth measures s in points. Latin-1 letters outside ASCII are counted
+// at an average width.
+func (f *font) textWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			total += f.widths[r-' ']
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsiEncoding. Characters
+// the standard fonts cannot show are replaced with '?'.
+func pdfString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= ' ' && r <= '~':
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// page accumulates the drawing operators for a page's content stream.
+type page struct {
+	content bytes.Buffer
+}
+
+func (p *page) text(f *font, size, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", f.name, size, x, y, pdfString(s))
+}
+
+// centered draws s centered across the page, shrinking it if it would be
+// wider than maxLineWidth.
+func (p *page) centered(f *font, size, y float64, s string) {
+	if w := f.textWidth(s, size); w > maxLineWidth {
+		size = size * maxLineWidth / w
+	}
+	p.text(f, size, (pageWidth-f.textWidth(s, size))/2, y, s)
+}
+
+func (p *page) rect(x, y, w, h, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%.1f w %.2f %.2f %.2f %.2f re S\n", lineWidth, x, y, w, h)
+}
+
+func (p *page) line(x1, y1, x2, y2, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%.1f w %.2f %.2f m %.2f %.2f l S\n", lineWidth, x1, y1, x2, y2)
+}
+
+// writeDocument writes a one-page PDF with the given content stream.
+func writeDocument(w io.Writer, content []byte) error {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /%s 5 0 R /%s 6 0 R >> >> /Contents 4 0 R >>",
+			pageWidth, pageHeight, helvetica.name, helveticaBold.name),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+	}
+	for _, f := range []*font{helvetica, helveticaBold} {
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.baseFont))
+	}
+
+	var out bytes.Buffer
+	// The comment's high bytes mark the file as binary for transfer tools
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// longDate formats a YYYY-MM-DD date as e.g. "March 7, 2026".
+func longDate(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("January 2, 2006")
+}
+
+// WritePDF renders the printable certificate. verifyURL is where a reader
+// can check the certificate's code.
+func (c Certificate) WritePDF(w io.Writer, verifyURL string) error {
+	var p page
+	p.rect(30, 30, pageWidth-60, pageHeight-60, 3)
+	p.rect(40, 40, pageWidth-80, pageHeight-80, 1)
+
+	p.centered(helveticaBold, 30, 470, "Certificate of Volunteer Service")
+	p.centered(helvetica, 14, 420, "This certifies that")
+	p.centered(helveticaBold, 24, 380, c.VolunteerEmail)
+	p.centered(helvetica, 14, 340, fmt.Sprintf("contributed %.2f hours of volunteer service to", c.TotalHours))
+	p.centered(helveticaBold, 22, 300, c.OrganizationName)
+	p.centered(helvetica, 14, 262, fmt.Sprintf("between %s and %s", longDate(c.PeriodStart), longDate(c.PeriodEnd)))
+
+	// Signature block on the left, verification on the right
+	p.line(90, 170, 330, 170, 0.75)
+	p.text(helvetica, 12, 90, 152, c.IssuedByEmail)
+	p.text(helvetica, 10, 90, 136, "Issued "+c.CreatedAt.UTC().Format("January 2, 2006"))
+	p.text(helvetica, 10, 470, 170, "Verification code")
+	p.text(helveticaBold, 16, 470, 150, FormatCode(c.Code))
+	p.centered(helvetica, 9, 70, "Verify this certificate at "+verifyURL)
+
+	return writeDocument(w, p.content.Bytes())
+}
@@ -0,0 +1,35 @@
+package certificates
+
+// Totals the volunteer's approved work in [from, to).
+const sumApprovedHoursSql = `
+	SELECT
+		COALESCE(SUM(EXTRACT(EPOCH FROM (clock_out - clock_in))), 0) / 3600.0 AS hours,
+		COUNT(*) AS work_logs
+	FROM work_logs
+	WHERE organization_id = ? AND user_id = ? AND status = 'approved'
+		AND clock_in >= ? AND clock_in < ?
+`
+
+const insertCertificateSql = `
+	INSERT INTO certificates (
+		code, organization_id, user_id, issued_by, period_start, period_end, total_hours, work_logs
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+`
+
+const selectCertificateByCodeSql = `
+	SELECT
+		certificates.id, certificates.code,
+		certificates.organization_id, organizations.name AS organization_name,
+		certificates.user_id, volunteers.email AS volunteer_email,
+		certificates.issued_by, issuers.email AS issued_by_email,
+		to_char(certificates.period_start, 'YYYY-MM-DD') AS period_start,
+		to_char(certificates.period_end, 'YYYY-MM-DD') AS period_end,
+		certificates.total_hours::float8 AS total_hours, certificates.work_logs,
+		certificates.created_at
+	FROM certificates
+		JOIN organizations ON organizations.id = certificates.organization_id
+		JOIN users volunteers ON volunteers.id = certificates.user_id
+		JOIN users issuers ON issuers.id = certificates.issued_by
+	WHERE certificates.code = ?
+`
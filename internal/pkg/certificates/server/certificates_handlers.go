@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/certificates"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type CertificatesServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *CertificatesServer {
+	return &CertificatesServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+type IssueCertificateRequest struct {
+	OrganizationId uint64 `json:"organization_id"`
+	UserGuid       string `json:"user_guid"`
+	From           string `json:"from"` // YYYY-MM-DD
+	To             string `json:"to"`   // YYYY-MM-DD, inclusive
+	Timezone       string `json:"timezone"`
+}
+
+func (server *CertificatesServer) GetCertificatesAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/certificates").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.IssueCertificateHandler).
+			Doc("Issue a printable certificate of a volunteer's approved hours, signed by the logged-in OrgAdmin").
+			Consumes(restful.MIME_JSON).
+			Produces("application/pdf").
+			Reads(IssueCertificateRequest{}).
+			Returns(http.StatusOK, "Issued certificate", nil).
+			Returns(http.StatusBadRequest, "Invalid request, or no approved hours in the date range", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil))
+	// Anyone holding a certificate may check it, so there is no JWT filter
+	service.Route(
+		service.GET("/verify/{code}").
+			To(server.VerifyCertificateHandler).
+			Doc("Confirm that a certificate is genuine and show the totals it was issued with").
+			Param(restful.PathParameter("code", "Verification code printed on the certificate")).
+			Produces(restful.MIME_JSON).
+			Writes(certificates.Certificate{}).
+			Returns(http.StatusOK, "Certificate is genuine", certificates.Certificate{}).
+			Returns(http.StatusNotFound, "No certificate was issued with this code", nil))
+
+	return service
+}
+
+// verifyURL is the address printed on a certificate for checking its code.
+func (server *CertificatesServer) verifyURL(code string) string {
+	return fmt.Sprintf("%s%s/certificates/verify/%s",
+		server.Config.GetPublicBaseURL(), server.Config.BasePath, certificates.FormatCode(code))
+}
+
+func (server *CertificatesServer) IssueCertificateHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "IssueCertificateHandler",
+	})
+
+	var req IssueCertificateRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	logger = logger.WithFields(log.Fields{
+		"OrganizationID": req.OrganizationId,
+		"UserGuid":       req.UserGuid,
+	})
+
+	claims := users.GetRequestJWTClaims(request)
+	if req.OrganizationId == 0 || !claims.HasRole(req.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), req.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		loc, err = time.LoadLocation(req.Timezone)
+		if err != nil {
+			response.WriteErrorString(http.StatusBadRequest, "unknown timezone")
+			return
+		}
+	}
+	from, to, err := filters.ParseDateRange(req.From, req.To, loc)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "from and to must be given as YYYY-MM-DD")
+		return
+	}
+
+	db := server.Config.GetDbConn()
+	volunteer, err := users.GetUserByGuid(ctx, req.UserGuid, db)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if volunteer == nil {
+		response.WriteErrorString(http.StatusBadRequest, "user not found")
+		return
+	}
+	issuer, err := users.GetUserByGuid(ctx, claims.Subject, db)
+	if err != nil || issuer == nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	certificate, err := certificates.Issue(ctx, db, req.OrganizationId, volunteer.Id, issuer.Id, from, to)
+	if err != nil {
+		if err == certificates.ErrNoApprovedHours {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var pdf bytes.Buffer
+	err = certificate.WritePDF(&pdf, server.verifyURL(certificate.Code))
+	if err != nil {
+		logger.WithError(err).Error("Failed to render certificate")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response.AddHeader("Content-Type", "application/pdf")
+	response.AddHeader("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", "certificate-"+certificates.FormatCode(certificate.Code)+".pdf"))
+	_, err = pdf.WriteTo(response)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write certificate")
+	}
+}
+
+func (server *CertificatesServer) VerifyCertificateHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":  "VerifyCertificateHandler",
+		"Code.input": request.PathParameter("code"),
+	})
+
+	certificate, err := certificates.FindCertificate(ctx, server.Config.GetDbConn(), request.PathParameter("code"))
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if certificate == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = response.WriteEntity(certificate)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize certificate")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"testing"
+)
+
+func TestCertificatesServer_verifyURL(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.PublicBaseURL = "https://api.example.org/"
+	server := New(&cfg)
+
+	expected := "https://api.example.org/vs/certificates/verify/ABCD-EFGH-JKMN"
+	if got := server.verifyURL("ABCDEFGHJKMN"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
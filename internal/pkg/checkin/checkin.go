@@ -0,0 +1,177 @@
+package checkin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCredential = errors.New("invalid kiosk credential")
+
+const secretBytes = 32
+
+func randomSecret() ([]byte, error) {
+	secret := make([]byte, secretBytes)
+	_, err := rand.Read(secret)
+	return secret, err
+}
+
+// GetSiteSecret fetches the secret used to generate the site's check-in
+// codes, creating one the first time it is needed.
+func GetSiteSecret(ctx context.Context, db *sqlx.DB, siteId uint64) ([]byte, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "GetSiteSecret",
+		"SiteID":    siteId,
+	})
+
+	var secret []byte
+	err := db.GetContext(ctx, &secret, db.Rebind(selectSiteKeySql), siteId)
+	if err == nil {
+		return secret, nil
+	}
+	if err != sql.ErrNoRows {
+		logger.WithError(err).Error("Failed to select site secret")
+		return nil, err
+	}
+
+	secret, err = randomSecret()
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate site secret")
+		return nil, err
+	}
+	// If another request created the key first, use theirs
+	_, err = db.ExecContext(ctx, db.Rebind(insertSiteKeySql), siteId, secret)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert site secret")
+		return nil, err
+	}
+	err = db.GetContext(ctx, &secret, db.Rebind(selectSiteKeySql), siteId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select site secret")
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Device is a kiosk bound to a single site. Kiosks display the site's
+// rotating QR code without anyone needing to log in on them.
+type Device struct {
+	Id         uint64     `json:"id" db:"id"`
+	SiteId     uint64     `json:"-" db:"site_id"`
+	SiteSlug   string     `json:"site_slug" db:"site_slug"`
+	Name       string     `json:"name" db:"name"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty" db:"last_seen_at"`
+}
+
+func hashSecret(secret []byte) []byte {
+	sum := sha256.Sum256(secret)
+	return sum[:]
+}
+
+// Register creates the device and returns its credential. Only a hash of the
+// credential is stored, so it cannot be retrieved again.
+func (d *Device) Register(ctx context.Context, db *sqlx.DB, createdBy uint64) (string, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Device.Register",
+		"SiteID":    d.SiteId,
+	})
+
+	secret, err := randomSecret()
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate device secret")
+		return "", err
+	}
+	err = db.QueryRowxContext(ctx, db.Rebind(insertDeviceSql), d.SiteId, d.Name, hashSecret(secret), createdBy).Scan(&d.Id, &d.CreatedAt)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert device")
+		return "", err
+	}
+
+	// Success!
+	return fmt.Sprintf("%d.%s", d.Id, base64.RawURLEncoding.EncodeToString(secret)), nil
+}
+
+// Authenticate resolves a device credential to its device. Returns
+// ErrInvalidCredential if the credential is malformed, wrong, or revoked.
+func Authenticate(ctx context.Context, db *sqlx.DB, credential string) (*Device, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Authenticate",
+	})
+
+	parts := strings.SplitN(credential, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCredential
+	}
+	deviceId, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	var storedHash []byte
+	err = db.GetContext(ctx, &storedHash, db.Rebind(selectDeviceCredentialSql), deviceId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidCredential
+		}
+		logger.WithError(err).Error("Failed to select device credential")
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(storedHash, hashSecret(secret)) != 1 {
+		return nil, ErrInvalidCredential
+	}
+
+	var device Device
+	err = db.GetContext(ctx, &device, db.Rebind(selectDeviceColumns+` WHERE kiosk_devices.id = ?`), deviceId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select device")
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, db.Rebind(touchDeviceSql), deviceId)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to record device activity")
+	}
+	return &device, nil
+}
+
+// ListSiteDevices fetches the site's unrevoked kiosk devices.
+func ListSiteDevices(ctx context.Context, db *sqlx.DB, siteId uint64) ([]Device, error) {
+	devices := make([]Device, 0)
+	err := db.SelectContext(ctx, &devices, db.Rebind(listSiteDevicesSql), siteId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("SiteID", siteId).WithError(err).Error("Failed to select devices")
+		return nil, err
+	}
+	return devices, nil
+}
+
+// RevokeDevice stops the device's credential from working. Returns
+// sql.ErrNoRows if the site has no such active device.
+func RevokeDevice(ctx context.Context, db *sqlx.DB, siteId, deviceId uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(revokeDeviceSql), deviceId, siteId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("DeviceID", deviceId).WithError(err).Error("Failed to revoke device")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Success!
+	return nil
+}
@@ -0,0 +1,65 @@
+package checkin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// CodePeriod is how often a site's check-in code rotates.
+const CodePeriod = 60 * time.Second
+
+// CodeSkew is how many previous periods' codes are still accepted, to allow
+// for the time it takes to scan and submit. A code is therefore valid for at
+// most (CodeSkew+1)*CodePeriod, which keeps screenshots from being reused.
+const CodeSkew = 1
+
+const codeDigits = 8
+
+// GenerateCode computes the site's check-in code for the period containing
+// at. Like TOTP, it is an HMAC of the period number truncated to a short
+// numeric code, but keyed per-site and bound to the site's slug.
+func GenerateCode(secret []byte, siteSlug string, at time.Time) string {
+	return codeForStep(secret, siteSlug, at.Unix()/int64(CodePeriod/time.Second))
+}
+
+func codeForStep(secret []byte, siteSlug string, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(siteSlug))
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, as in RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", codeDigits, value%100000000)
+}
+
+// VerifyCode reports whether the code is the site's current code, or one of
+// the CodeSkew codes before it.
+func VerifyCode(secret []byte, siteSlug, code string, at time.Time) bool {
+	step := at.Unix() / int64(CodePeriod/time.Second)
+	for i := int64(0); i <= CodeSkew; i++ {
+		if hmac.Equal([]byte(codeForStep(secret, siteSlug, step-i)), []byte(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeExpiry is when the code generated at the given time stops being the
+// current code. Kiosks should refresh their QR code then.
+func CodeExpiry(at time.Time) time.Time {
+	period := int64(CodePeriod / time.Second)
+	return time.Unix((at.Unix()/period+1)*period, 0).UTC()
+}
+
+// CheckInURL is the payload encoded in a site's QR code. The volunteer app
+// recognises the scheme and posts the code to the check-in endpoint.
+func CheckInURL(siteSlug, code string) string {
+	return fmt.Sprintf("vsavvy://checkin?site=%s&code=%s", siteSlug, code)
+}
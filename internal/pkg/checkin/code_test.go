@@ -0,0 +1,39 @@
+package checkin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyCode(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	issued := time.Date(2020, time.February, 3, 9, 0, 10, 0, time.UTC)
+	code := GenerateCode(secret, "site", issued)
+	if len(code) != codeDigits {
+		t.Fatalf("Expected a %d digit code, got %q", codeDigits, code)
+	}
+
+	if !VerifyCode(secret, "site", code, issued) {
+		t.Error("Expected code to be valid when issued")
+	}
+	if !VerifyCode(secret, "site", code, issued.Add(CodePeriod)) {
+		t.Error("Expected code to be valid one period later")
+	}
+	if VerifyCode(secret, "site", code, issued.Add(time.Duration(CodeSkew+1)*CodePeriod)) {
+		t.Error("Expected code to have expired")
+	}
+	if VerifyCode(secret, "other-site", code, issued) {
+		t.Error("Expected code to be bound to its site")
+	}
+	if VerifyCode([]byte("another secret"), "site", code, issued) {
+		t.Error("Expected code to be bound to its secret")
+	}
+	if GenerateCode(secret, "site", issued.Add(CodePeriod)) == code {
+		t.Error("Expected code to rotate")
+	}
+
+	expected := time.Date(2020, time.February, 3, 9, 1, 0, 0, time.UTC)
+	if !CodeExpiry(issued).Equal(expected) {
+		t.Errorf("Expected code to expire at %s, got %s", expected, CodeExpiry(issued))
+	}
+}
@@ -0,0 +1,39 @@
+package checkin
+
+const insertSiteKeySql = `
+	INSERT INTO site_checkin_keys (site_id, secret) VALUES (?, ?)
+	ON CONFLICT (site_id) DO NOTHING
+`
+
+const selectSiteKeySql = `
+	SELECT secret FROM site_checkin_keys WHERE site_id = ?
+`
+
+const selectDeviceColumns = `
+	SELECT
+		kiosk_devices.id, kiosk_devices.site_id, sites.slug AS site_slug,
+		kiosk_devices.name, kiosk_devices.created_at, kiosk_devices.last_seen_at
+	FROM kiosk_devices JOIN sites ON sites.id = kiosk_devices.site_id
+`
+
+const listSiteDevicesSql = selectDeviceColumns + `
+	WHERE kiosk_devices.site_id = ? AND kiosk_devices.revoked_at IS NULL
+	ORDER BY kiosk_devices.id
+`
+
+const insertDeviceSql = `
+	INSERT INTO kiosk_devices (site_id, name, secret_hash, created_by) VALUES (?, ?, ?, ?)
+	RETURNING id, created_at
+`
+
+const selectDeviceCredentialSql = `
+	SELECT secret_hash FROM kiosk_devices WHERE id = ? AND revoked_at IS NULL
+`
+
+const touchDeviceSql = `
+	UPDATE kiosk_devices SET last_seen_at = now() WHERE id = ?
+`
+
+const revokeDeviceSql = `
+	UPDATE kiosk_devices SET revoked_at = now() WHERE id = ? AND site_id = ? AND revoked_at IS NULL
+`
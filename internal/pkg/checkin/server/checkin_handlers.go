@@ -0,0 +1,509 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/checkin"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/worklogs"
+	log "github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const qrCodeSize = 512 // pixels
+
+type CheckinServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *CheckinServer {
+	return &CheckinServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+func (server *CheckinServer) GetCheckinAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/checkin").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.POST("/sites/{siteSlug}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CheckInHandler).
+			Doc("Clock the logged-in user in at a site using the code scanned from its QR code").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(CheckInRequest{}).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Clocked in", worklogs.WorkLog{}).
+			Returns(http.StatusBadRequest, "The site is not open, or the location is outside the site's geofence and the organization rejects those", nil).
+			Returns(http.StatusUnauthorized, "Logged-in user no longer exists", nil).
+			Returns(http.StatusForbidden, "Code is invalid or expired, or the user is not a member of the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil).
+			Returns(http.StatusConflict, "User is already clocked in", nil))
+	service.Route(
+		service.GET("/sites/{siteSlug}/code").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetSiteCodeHandler).
+			Doc("Fetch a site's current check-in code").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Produces(restful.MIME_JSON).
+			Writes(CodeResponse{}).
+			Returns(http.StatusOK, "Fetched code", CodeResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.GET("/sites/{siteSlug}/qr.png").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetSiteQRCodeHandler).
+			Doc("Render a site's current check-in code as a QR code").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Produces("image/png").
+			Returns(http.StatusOK, "Rendered QR code", nil).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.GET("/sites/{siteSlug}/devices").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListDevicesHandler).
+			Doc("List a site's kiosk devices").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Produces(restful.MIME_JSON).
+			Writes(ListDevicesResponse{}).
+			Returns(http.StatusOK, "Fetched devices", ListDevicesResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.POST("/sites/{siteSlug}/devices").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RegisterDeviceHandler).
+			Doc("Register a kiosk device for a site. The credential is only returned once.").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(RegisterDeviceRequest{}).
+			Writes(RegisterDeviceResponse{}).
+			Returns(http.StatusOK, "Device registered", RegisterDeviceResponse{}).
+			Returns(http.StatusBadRequest, "Invalid device", nil).
+			Returns(http.StatusUnauthorized, "Logged-in user no longer exists", nil).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.DELETE("/sites/{siteSlug}/devices/{deviceId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RevokeDeviceHandler).
+			Doc("Revoke a kiosk device's credential").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Param(restful.PathParameter("deviceId", "Device ID")).
+			Returns(http.StatusOK, "Device revoked", nil).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site or device not found", nil))
+	service.Route(
+		service.GET("/kiosk/code").
+			Filter(server.KioskFilter).
+			To(server.GetKioskCodeHandler).
+			Doc("Fetch the current check-in code for the kiosk's site. Authenticate with 'Authorization: Kiosk <credential>'.").
+			Produces(restful.MIME_JSON).
+			Writes(CodeResponse{}).
+			Returns(http.StatusOK, "Fetched code", CodeResponse{}).
+			Returns(http.StatusUnauthorized, "Invalid or revoked kiosk credential", nil))
+	service.Route(
+		service.GET("/kiosk/qr.png").
+			Filter(server.KioskFilter).
+			To(server.GetKioskQRCodeHandler).
+			Doc("Render the kiosk's site's current check-in code as a QR code. Authenticate with 'Authorization: Kiosk <credential>'.").
+			Produces("image/png").
+			Returns(http.StatusOK, "Rendered QR code", nil).
+			Returns(http.StatusUnauthorized, "Invalid or revoked kiosk credential", nil))
+
+	return service
+}
+
+// Roles which may display a site's check-in code and manage its kiosks.
+var managerRoles = []users.RoleType{users.OrgAdmin, users.SiteManager}
+
+// KioskFilter authenticates a kiosk device from an "Authorization: Kiosk
+// <credential>" header, and stores the device on the request.
+func (server *CheckinServer) KioskFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	ctx := filters.GetRequestContext(req)
+	logger := filters.GetContextLogger(ctx)
+
+	authHeaderTokens := strings.Split(req.HeaderParameter("Authorization"), " ")
+	if len(authHeaderTokens) != 2 || !strings.EqualFold(authHeaderTokens[0], "Kiosk") {
+		resp.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	device, err := checkin.Authenticate(ctx, server.Config.GetDbConn(), authHeaderTokens[1])
+	if err != nil {
+		if err == checkin.ErrInvalidCredential {
+			logger.Debug("Invalid kiosk credential")
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	req.SetAttribute("kiosk.device", device)
+	chain.ProcessFilter(req, resp)
+}
+
+// findManagedSite loads the site named in the siteSlug path parameter and
+// checks that the logged-in user manages its organization. On failure it
+// writes the response and returns nil.
+func (server *CheckinServer) findManagedSite(request *restful.Request, response *restful.Response) *sites.Site {
+	ctx := filters.GetRequestContext(request)
+	site, err := sites.FindSite(ctx, request.PathParameter("siteSlug"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if site == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(site.OrganizationId, managerRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return site
+}
+
+type CodeResponse struct {
+	SiteSlug  string    `json:"site_slug"`
+	Code      string    `json:"code"`
+	URL       string    `json:"url"` // the QR code's payload
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (server *CheckinServer) currentCode(request *restful.Request, siteId uint64, siteSlug string) (*CodeResponse, error) {
+	secret, err := checkin.GetSiteSecret(filters.GetRequestContext(request), server.Config.GetDbConn(), siteId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	code := checkin.GenerateCode(secret, siteSlug, now)
+	return &CodeResponse{
+		SiteSlug:  siteSlug,
+		Code:      code,
+		URL:       checkin.CheckInURL(siteSlug, code),
+		ExpiresAt: checkin.CodeExpiry(now),
+	}, nil
+}
+
+func (server *CheckinServer) writeCode(request *restful.Request, response *restful.Response, siteId uint64, siteSlug string) {
+	logger := filters.GetContextLogger(filters.GetRequestContext(request))
+	code, err := server.currentCode(request, siteId, siteSlug)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response.AddHeader("Cache-Control", "no-store")
+	err = response.WriteEntity(code)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize code")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *CheckinServer) writeQRCode(request *restful.Request, response *restful.Response, siteId uint64, siteSlug string) {
+	logger := filters.GetContextLogger(filters.GetRequestContext(request))
+	code, err := server.currentCode(request, siteId, siteSlug)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	png, err := qrcode.Encode(code.URL, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		logger.WithError(err).Error("Failed to render QR code")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response.AddHeader("Content-Type", "image/png")
+	response.AddHeader("Cache-Control", "no-store")
+	response.AddHeader("Expires", code.ExpiresAt.Format(http.TimeFormat))
+	_, err = response.Write(png)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write QR code")
+	}
+}
+
+func (server *CheckinServer) GetSiteCodeHandler(request *restful.Request, response *restful.Response) {
+	site := server.findManagedSite(request, response)
+	if site == nil {
+		return
+	}
+	server.writeCode(request, response, site.Id, site.Slug)
+}
+
+func (server *CheckinServer) GetSiteQRCodeHandler(request *restful.Request, response *restful.Response) {
+	site := server.findManagedSite(request, response)
+	if site == nil {
+		return
+	}
+	server.writeQRCode(request, response, site.Id, site.Slug)
+}
+
+func (server *CheckinServer) GetKioskCodeHandler(request *restful.Request, response *restful.Response) {
+	device := request.Attribute("kiosk.device").(*checkin.Device)
+	server.writeCode(request, response, device.SiteId, device.SiteSlug)
+}
+
+func (server *CheckinServer) GetKioskQRCodeHandler(request *restful.Request, response *restful.Response) {
+	device := request.Attribute("kiosk.device").(*checkin.Device)
+	server.writeQRCode(request, response, device.SiteId, device.SiteSlug)
+}
+
+type CheckInRequest struct {
+	Code     string                `json:"code"`
+	Location *worklogs.Coordinates `json:"location,omitempty"` // the device's location, if it can report one
+}
+
+func (server *CheckinServer) CheckInHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CheckInHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+	})
+
+	var req CheckInRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if req.Location != nil {
+		if err = req.Location.Validate(); err != nil {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	db := server.Config.GetDbConn()
+	site, err := sites.FindSite(ctx, request.PathParameter("siteSlug"), db)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	claims := users.GetRequestJWTClaims(request)
+	if site.OrganizationId == 0 || !claims.HasRole(site.OrganizationId, users.MemberRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	secret, err := checkin.GetSiteSecret(ctx, db, site.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if !checkin.VerifyCode(secret, site.Slug, req.Code, now) {
+		logger.Debug("Invalid or expired check-in code")
+		response.WriteErrorString(http.StatusForbidden, "check-in code is invalid or has expired")
+		return
+	}
+
+	user, err := users.GetUserByGuid(ctx, claims.Subject, db)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		// The token outlived the user it was issued to
+		logger.Debug("Logged-in user no longer exists")
+		response.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	workLog := worklogs.WorkLog{
+		OrganizationId: site.OrganizationId,
+		UserId:         user.Id,
+		UserGuid:       user.Guid,
+		SiteId:         site.Id,
+		SiteSlug:       site.Slug,
+		ClockIn:        now,
+		Note:           "Checked in by QR code",
+	}
+	err = workLog.CheckOpenHours(ctx, db, site)
+	if err != nil {
+		if err == worklogs.ErrSiteClosed || err == worklogs.ErrOutsideOpenHours {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The code only shows that the volunteer has seen it, so the location is
+	// checked just as it is for clocking in
+	settings, err := organizations.GetSettings(ctx, db, site.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.WithError(err).Error("Failed to look up organization settings")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = workLog.ApplyGeofence(site, settings.GeofencePolicy, req.Location)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = workLog.Open(ctx, db)
+	if err != nil {
+		if err == worklogs.ErrAlreadyClockedIn {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type ListDevicesResponse struct {
+	Devices []checkin.Device `json:"devices"`
+}
+
+func (server *CheckinServer) ListDevicesHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListDevicesHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+	})
+
+	site := server.findManagedSite(request, response)
+	if site == nil {
+		return
+	}
+
+	devices, err := checkin.ListSiteDevices(ctx, server.Config.GetDbConn(), site.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListDevicesResponse{Devices: devices})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize devices")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type RegisterDeviceRequest struct {
+	Name string `json:"name"`
+}
+
+type RegisterDeviceResponse struct {
+	Device     checkin.Device `json:"device"`
+	Credential string         `json:"credential"` // shown once; send as "Authorization: Kiosk <credential>"
+}
+
+func (server *CheckinServer) RegisterDeviceHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "RegisterDeviceHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+	})
+
+	var req RegisterDeviceRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Name) == 0 || len(req.Name) > 128 {
+		response.WriteErrorString(http.StatusBadRequest, "name must be between 1 and 128 characters")
+		return
+	}
+
+	site := server.findManagedSite(request, response)
+	if site == nil {
+		return
+	}
+	user, err := users.GetUserByGuid(ctx, users.GetRequestJWTClaims(request).Subject, server.Config.GetDbConn())
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		// The token outlived the user it was issued to
+		logger.Debug("Logged-in user no longer exists")
+		response.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	device := checkin.Device{
+		SiteId:   site.Id,
+		SiteSlug: site.Slug,
+		Name:     req.Name,
+	}
+	credential, err := device.Register(ctx, server.Config.GetDbConn(), user.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(RegisterDeviceResponse{Device: device, Credential: credential})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize device")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *CheckinServer) RevokeDeviceHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	deviceId, err := strconv.ParseUint(request.PathParameter("deviceId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid device ID")
+		return
+	}
+	site := server.findManagedSite(request, response)
+	if site == nil {
+		return
+	}
+
+	err = checkin.RevokeDevice(ctx, server.Config.GetDbConn(), site.Id, deviceId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/checkin"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type CheckinServerTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+	Container *restful.Container
+}
+
+// TestCheckinHandlerTestSuite is the "main" entry point for the suite.
+func TestCheckinHandlerTestSuite(t *testing.T) {
+	// Initialize the webservice
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../../users/testdata/"
+	testSuite := new(CheckinServerTestSuite)
+	testSuite.Config = &cfg
+	server := New(&cfg)
+	testSuite.Container = restful.NewContainer()
+	testSuite.Container.Add(server.GetCheckinAPI())
+	if testing.Short() {
+		t.Skip("Skipping Checkin Handlers tests in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+func getAuthHeader(email string, config *config.ServiceConfig) (string, error) {
+	user, err := users.FindUser(context.Background(), email, config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("no user returned")
+	}
+
+	_, err = user.GetRoles(context.Background(), config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+
+	claims := users.CreateJWT(user, config.GetTokenExpirationDuration())
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	privateKey, _ := config.GetJWTKeys()
+	if privateKey == nil {
+		return "", errors.New("failed to load private key")
+	}
+	tokenString, err := token.SignedString(privateKey)
+	return fmt.Sprintf("Bearer %s", tokenString), err
+}
+
+func (suite *CheckinServerTestSuite) dispatch(method, path, authorization string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		suite.Require().Nil(json.NewEncoder(&payload).Encode(body))
+	}
+	req, err := http.NewRequest(method, path, &payload)
+	suite.Require().Nil(err)
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp := httptest.NewRecorder()
+	suite.Container.Dispatch(resp, req)
+	return resp
+}
+
+func (suite *CheckinServerTestSuite) authHeader(email string) string {
+	tokenStr, err := getAuthHeader(email, suite.Config)
+	suite.Require().Nil(err)
+	return tokenStr
+}
+
+// seedSite adds a site to testorg1 that is open all day today, and returns
+// its ID.
+func (suite *CheckinServerTestSuite) seedSite() uint64 {
+	db := suite.Config.GetDbConn()
+	var siteId uint64
+	err := db.Get(&siteId, `INSERT INTO sites (organization_id, slug, name_l10n, locale) VALUES (1, 'testsite1', 'Test Site 1', 'en') RETURNING id`)
+	suite.Require().Nil(err)
+	_, err = db.Exec(`INSERT INTO daily_schedules (site_id, override_date, open_time, close_time, is_open) VALUES ($1, (now() AT TIME ZONE 'UTC')::date, '00:00', '23:59', true)`, siteId)
+	suite.Require().Nil(err)
+	return siteId
+}
+
+// codeAt is testsite1's check-in code at the given time.
+func (suite *CheckinServerTestSuite) codeAt(siteId uint64, at time.Time) string {
+	secret, err := checkin.GetSiteSecret(context.Background(), suite.Config.GetDbConn(), siteId)
+	suite.Require().Nil(err)
+	return checkin.GenerateCode(secret, "testsite1", at)
+}
+
+func (suite *CheckinServerTestSuite) TestKioskFilter() {
+	siteId := suite.seedSite()
+	device := checkin.Device{SiteId: siteId, SiteSlug: "testsite1", Name: "Front desk"}
+	credential, err := device.Register(context.Background(), suite.Config.GetDbConn(), 1)
+	suite.Require().Nil(err)
+
+	testCases := map[string]string{
+		"missing":   "",
+		"bearer":    suite.authHeader("kit@example.org"),
+		"malformed": "Kiosk nonsense",
+		"wrong":     fmt.Sprintf("Kiosk %d.d3Jvbmc", device.Id),
+	}
+	for name, authorization := range testCases {
+		resp := suite.dispatch(http.MethodGet, "/vs/checkin/kiosk/code", authorization, nil)
+		suite.Equalf(http.StatusUnauthorized, resp.Code, "%s: expected the credential to be refused", name)
+	}
+
+	resp := suite.dispatch(http.MethodGet, "/vs/checkin/kiosk/code", "Kiosk "+credential, nil)
+	suite.Require().Equal(http.StatusOK, resp.Code)
+	var code CodeResponse
+	suite.Require().Nil(json.Unmarshal(resp.Body.Bytes(), &code))
+	suite.Equal("testsite1", code.SiteSlug)
+
+	suite.Require().Nil(checkin.RevokeDevice(context.Background(), suite.Config.GetDbConn(), siteId, device.Id))
+	resp = suite.dispatch(http.MethodGet, "/vs/checkin/kiosk/code", "Kiosk "+credential, nil)
+	suite.Equal(http.StatusUnauthorized, resp.Code, "Expected a revoked credential to be refused")
+}
+
+func (suite *CheckinServerTestSuite) TestCheckInHandler() {
+	siteId := suite.seedSite()
+	now := time.Now()
+
+	expired := suite.codeAt(siteId, now.Add(-time.Duration(checkin.CodeSkew+2)*checkin.CodePeriod))
+	resp := suite.dispatch(http.MethodPost, "/vs/checkin/sites/testsite1", suite.authHeader("user2@example.org"), CheckInRequest{Code: expired})
+	suite.Equal(http.StatusForbidden, resp.Code, "Expected an expired code to be refused")
+
+	resp = suite.dispatch(http.MethodPost, "/vs/checkin/sites/testsite1", suite.authHeader("user4@example.org"), CheckInRequest{Code: suite.codeAt(siteId, now)})
+	suite.Equal(http.StatusForbidden, resp.Code, "Expected a non-member to be refused")
+
+	resp = suite.dispatch(http.MethodPost, "/vs/checkin/sites/testsite1", suite.authHeader("user2@example.org"), CheckInRequest{Code: suite.codeAt(siteId, now)})
+	suite.Require().Equal(http.StatusOK, resp.Code)
+
+	resp = suite.dispatch(http.MethodPost, "/vs/checkin/sites/testsite1", suite.authHeader("user2@example.org"), CheckInRequest{Code: suite.codeAt(siteId, now)})
+	suite.Equal(http.StatusConflict, resp.Code, "Expected a second check-in to be refused while the first is open")
+}
+
+func (suite *CheckinServerTestSuite) TestCheckInHandler_DeletedUser() {
+	siteId := suite.seedSite()
+	authorization := suite.authHeader("user2@example.org")
+
+	// The token outlives the user
+	db := suite.Config.GetDbConn()
+	for _, stmt := range []string{
+		`DELETE FROM organization_memberships WHERE user_id = 2`,
+		`DELETE FROM roles WHERE user_id = 2`,
+		`DELETE FROM users WHERE id = 2`,
+	} {
+		_, err := db.Exec(stmt)
+		suite.Require().Nil(err)
+	}
+
+	resp := suite.dispatch(http.MethodPost, "/vs/checkin/sites/testsite1", authorization, CheckInRequest{Code: suite.codeAt(siteId, time.Now())})
+	suite.Equal(http.StatusUnauthorized, resp.Code)
+}
@@ -8,8 +8,12 @@ import (
 	"fmt"
 	"github.com/caarlos0/env"
 	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/mail"
 	"github.com/sirupsen/logrus"
+	"net"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -33,6 +37,11 @@ type ServiceConfig struct {
 
 	Port int64 `env:"PORT" envDefault:"8080"`
 
+	// Where clients reach the service from outside, e.g.
+	// "https://api.volunteer-savvy.org", for links in documents it produces.
+	// Links are never built from the request's Host, which the client chooses.
+	PublicBaseURL string `env:"PUBLIC_BASE_URL" envDefault:"http://localhost:8080"`
+
 	// Configure the static fileserver
 	StaticContentPath string `env:"STATIC_CONTENT_PATH"`
 
@@ -54,6 +63,39 @@ type ServiceConfig struct {
 	jwtPrivateKey       *rsa.PrivateKey
 	JwtPublicKey        string `env:"OAUTH_JWT_PUBLIC_KEY"`
 	jwtPublicKey        *rsa.PublicKey
+
+	// Anti-abuse protections for anonymous submissions
+	AbuseChallengeSecret     string `env:"ABUSE_CHALLENGE_SECRET"` // shared by all replicas
+	AbuseChallengeDifficulty int    `env:"ABUSE_CHALLENGE_DIFFICULTY" envDefault:"16"`
+	AbuseSubmissionsPerIP    int    `env:"ABUSE_SUBMISSIONS_PER_IP" envDefault:"10"`   // per hour
+	AbuseSubmissionsPerOrg   int    `env:"ABUSE_SUBMISSIONS_PER_ORG" envDefault:"200"` // per hour
+	TrustedProxies           string `env:"TRUSTED_PROXIES"`                            // comma-separated CIDRs or addresses of the load balancers
+	abuseGuard               *filters.AbuseGuard
+
+	// Push notification delivery
+	PushMaxAttempts int `env:"PUSH_MAX_ATTEMPTS" envDefault:"3"` // per message and device
+	PushMaxFailures int `env:"PUSH_MAX_FAILURES" envDefault:"5"` // failed deliveries in a row before a device is dropped
+
+	// Email. Without an SMTP host, mail is written to MailSinkDir instead.
+	SmtpHost        string `env:"SMTP_HOST"`
+	SmtpPort        int    `env:"SMTP_PORT" envDefault:"587"`
+	SmtpUsername    string `env:"SMTP_USERNAME"`
+	SmtpPassword    string `env:"SMTP_PASSWORD"`
+	MailSinkDir     string `env:"MAIL_SINK_DIR" envDefault:"./tmp/mail"`
+	MailFromAddress string `env:"MAIL_FROM_ADDRESS" envDefault:"noreply@volunteer-savvy.org"` // for orgs without their own
+	MailFromName    string `env:"MAIL_FROM_NAME" envDefault:"Volunteer Savvy"`
+	mailer          *mail.Mailer
+
+	// Background processing of outbox events
+	OutboxWorkers      int    `env:"OUTBOX_WORKERS" envDefault:"4"`
+	OutboxPollInterval string `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"` // when the queue is empty
+	OutboxMaxAttempts  int    `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"8"`   // before an event is dead-lettered
+
+	// Shift reminders, sent at each of these durations before a shift starts
+	ReminderOffsets string `env:"REMINDER_OFFSETS" envDefault:"24h,2h"`
+
+	// How long a deleted organization can be restored before it is purged
+	OrganizationRetention string `env:"ORGANIZATION_RETENTION" envDefault:"720h"`
 }
 
 // GetTokenExpirationDuration converts the JWT_EXPIRATION_DURATION environment
@@ -68,6 +110,72 @@ func (cfg *ServiceConfig) GetTokenExpirationDuration() time.Duration {
 	return d
 }
 
+// GetPublicBaseURL returns PUBLIC_BASE_URL without a trailing slash, so that
+// paths may be appended to it.
+func (cfg *ServiceConfig) GetPublicBaseURL() string {
+	return strings.TrimRight(cfg.PublicBaseURL, "/")
+}
+
+// GetOutboxPollInterval converts OUTBOX_POLL_INTERVAL to a time.Duration,
+// defaulting to 1 second if it is malformed.
+func (cfg *ServiceConfig) GetOutboxPollInterval() time.Duration {
+	d, err := time.ParseDuration(cfg.OutboxPollInterval)
+	if err != nil || d <= 0 {
+		return time.Second
+	}
+	return d
+}
+
+// GetReminderOffsets parses REMINDER_OFFSETS, a comma-separated list of
+// durations. Malformed entries are ignored.
+func (cfg *ServiceConfig) GetReminderOffsets() []time.Duration {
+	offsets := make([]time.Duration, 0)
+	for _, entry := range strings.Split(cfg.ReminderOffsets, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(entry))
+		if err == nil && d > 0 {
+			offsets = append(offsets, d)
+		}
+	}
+	return offsets
+}
+
+// GetOrganizationRetention converts ORGANIZATION_RETENTION to a
+// time.Duration, defaulting to 30 days if it is malformed.
+func (cfg *ServiceConfig) GetOrganizationRetention() time.Duration {
+	d, err := time.ParseDuration(cfg.OrganizationRetention)
+	if err != nil || d <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetTrustedProxies parses TRUSTED_PROXIES, a comma-separated list of
+// networks in CIDR notation or single addresses. Malformed entries are
+// ignored.
+func (cfg *ServiceConfig) GetTrustedProxies() []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(cfg.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
 var serviceConfig *ServiceConfig
 
 func (cfg *ServiceConfig) getDatabaseDsn() string {
@@ -136,6 +244,40 @@ func (cfg *ServiceConfig) GetDbConn() *sqlx.DB {
 	return cfg.databaseConnection
 }
 
+// GetAbuseGuard returns the guard shared by every anonymous endpoint, so that
+// its rate limits apply across all of them.
+func (cfg *ServiceConfig) GetAbuseGuard() *filters.AbuseGuard {
+	if cfg.abuseGuard == nil {
+		cfg.abuseGuard = filters.NewAbuseGuard(
+			[]byte(cfg.AbuseChallengeSecret),
+			cfg.AbuseChallengeDifficulty,
+			cfg.AbuseSubmissionsPerIP,
+			cfg.AbuseSubmissionsPerOrg,
+			time.Hour)
+		cfg.abuseGuard.TrustedProxies = cfg.GetTrustedProxies()
+	}
+	return cfg.abuseGuard
+}
+
+// GetMailer returns the mailer shared by everything that sends email. It
+// relays through SMTP_HOST if one is set, and otherwise writes each message
+// to a file in MAIL_SINK_DIR.
+func (cfg *ServiceConfig) GetMailer() *mail.Mailer {
+	if cfg.mailer == nil {
+		var sink mail.Sink = mail.FileSink{Dir: cfg.MailSinkDir}
+		if cfg.SmtpHost != "" {
+			sink = mail.SMTPSink{
+				Host:     cfg.SmtpHost,
+				Port:     cfg.SmtpPort,
+				Username: cfg.SmtpUsername,
+				Password: cfg.SmtpPassword,
+			}
+		}
+		cfg.mailer = mail.NewMailer(sink, cfg.MailFromAddress, cfg.MailFromName)
+	}
+	return cfg.mailer
+}
+
 func (cfg *ServiceConfig) GetPublicKey() *rsa.PublicKey {
 	if cfg.jwtPublicKey == nil {
 		cfg.GetJWTKeys()
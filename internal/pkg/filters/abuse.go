@@ -0,0 +1,378 @@
+package filters
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	log "github.com/sirupsen/logrus"
+	"math/bits"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons an anonymous submission is turned away.
+var (
+	ErrChallengeRequired = errors.New("a solved challenge is required")
+	ErrChallengeInvalid  = errors.New("challenge is invalid, expired or already used")
+	ErrRateLimited       = errors.New("too many submissions, try again later")
+	ErrHoneypot          = errors.New("honeypot field was filled in")
+	ErrBlockedContent    = errors.New("submission contains blocked content")
+)
+
+// Request headers carrying a solved challenge.
+const (
+	ChallengeHeader         = "X-Challenge"
+	ChallengeSolutionHeader = "X-Challenge-Solution"
+)
+
+// DefaultChallengeTTL is how long a client has to solve and use a challenge.
+const DefaultChallengeTTL = 10 * time.Minute
+
+// AbuseGuard protects the endpoints anonymous visitors may call. Clients must
+// fetch a signed challenge and solve its proof of work before submitting,
+// which is cheap for a person filling in a form and expensive for a spammer.
+// Submissions are also limited per client IP and per organization, checked
+// for a honeypot field that only bots fill in, and checked against the
+// organization's blocklist.
+//
+// Rate limits and used challenges are tracked in memory, so each replica of
+// the service enforces them separately.
+type AbuseGuard struct {
+	secret       []byte
+	Difficulty   int // leading zero bits the solution's hash must have
+	ChallengeTTL time.Duration
+
+	// TrustedProxies are the networks of the load balancers in front of
+	// the service. X-Forwarded-For is only believed from these.
+	TrustedProxies []*net.IPNet
+
+	perIP  *rateLimiter
+	perOrg *rateLimiter
+
+	mu   sync.Mutex
+	used map[string]time.Time // challenges already spent, until they expire
+
+	now func() time.Time
+}
+
+// NewAbuseGuard creates a guard that allows each IP address ipLimit, and each
+// organization orgLimit, submissions per window. If secret is empty, a random
+// one is generated, and challenges will not be accepted by other replicas.
+func NewAbuseGuard(secret []byte, difficulty, ipLimit, orgLimit int, window time.Duration) *AbuseGuard {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			panic(fmt.Sprintf("failed to generate challenge secret: %v", err))
+		}
+	}
+	return &AbuseGuard{
+		secret:       secret,
+		Difficulty:   difficulty,
+		ChallengeTTL: DefaultChallengeTTL,
+		perIP:        newRateLimiter(ipLimit, window),
+		perOrg:       newRateLimiter(orgLimit, window),
+		used:         make(map[string]time.Time),
+		now:          time.Now,
+	}
+}
+
+// Challenge is a proof-of-work puzzle. The client must find a Solution such
+// that SHA-256(Token + Solution) begins with Difficulty zero bits.
+type Challenge struct {
+	Token      string    `json:"challenge"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (g *AbuseGuard) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewChallenge issues a signed challenge. The difficulty and expiry are part
+// of the signed token, so no state is kept until it is used.
+func (g *AbuseGuard) NewChallenge() (*Challenge, error) {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := g.now().Add(g.ChallengeTTL).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", expiresAt.Unix(), g.Difficulty, hex.EncodeToString(nonce))
+	return &Challenge{
+		Token:      payload + "." + g.sign(payload),
+		Algorithm:  "sha256",
+		Difficulty: g.Difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// leadingZeroBits counts the zero bits at the start of the hash.
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// SolveChallenge finds a solution by brute force. It exists for tests and
+// command-line clients; browsers do the same in JavaScript.
+func SolveChallenge(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(token + solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+}
+
+// VerifyChallenge checks the token's signature, expiry and solution, and
+// spends it so that it cannot be used again.
+func (g *AbuseGuard) VerifyChallenge(token, solution string) error {
+	if token == "" || solution == "" {
+		return ErrChallengeRequired
+	}
+	dot := strings.LastIndex(token, ".")
+	if dot < 0 {
+		return ErrChallengeInvalid
+	}
+	payload, signature := token[:dot], token[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(g.sign(payload))) {
+		return ErrChallengeInvalid
+	}
+	fields := strings.Split(payload, ".")
+	if len(fields) != 3 {
+		return ErrChallengeInvalid
+	}
+	expiry, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+	difficulty, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+	now := g.now()
+	expiresAt := time.Unix(expiry, 0)
+	if now.After(expiresAt) {
+		return ErrChallengeInvalid
+	}
+	sum := sha256.Sum256([]byte(token + solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrChallengeInvalid
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for spent, until := range g.used {
+		if now.After(until) {
+			delete(g.used, spent)
+		}
+	}
+	if _, spent := g.used[payload]; spent {
+		return ErrChallengeInvalid
+	}
+	g.used[payload] = expiresAt
+	return nil
+}
+
+// ClientIP is the address the request came from. X-Forwarded-For is only
+// believed when the request came through one of the trusted proxies, and
+// then only as far back as the last hop that is not itself a trusted proxy;
+// anything before that was supplied by the client.
+func (g *AbuseGuard) ClientIP(req *restful.Request) string {
+	ip, _, err := net.SplitHostPort(req.Request.RemoteAddr)
+	if err != nil {
+		ip = req.Request.RemoteAddr
+	}
+	if !g.isTrustedProxy(ip) {
+		return ip
+	}
+	forwarded := req.HeaderParameter("X-Forwarded-For")
+	if forwarded == "" {
+		return ip
+	}
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = strings.TrimSpace(hops[i])
+		if !g.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (g *AbuseGuard) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range g.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// logRejection records why a submission was turned away.
+func logRejection(ctx context.Context, reason error, fields log.Fields) {
+	GetContextLogger(ctx).WithFields(fields).WithFields(log.Fields{
+		"operation": "AbuseGuard",
+		"reason":    reason.Error(),
+	}).Warn("Rejected anonymous submission")
+}
+
+// ChallengeHandler issues a new challenge. Mount it on each service that
+// uses ChallengeFilter.
+func (g *AbuseGuard) ChallengeHandler(req *restful.Request, resp *restful.Response) {
+	challenge, err := g.NewChallenge()
+	if err != nil {
+		GetContextLogger(GetRequestContext(req)).WithError(err).Error("Failed to generate challenge")
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = resp.WriteEntity(challenge)
+	if err != nil {
+		GetContextLogger(GetRequestContext(req)).WithError(err).Error("Failed to serialize challenge")
+		resp.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ChallengeFilter requires a solved challenge and applies the per-IP limit.
+func (g *AbuseGuard) ChallengeFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	ctx := GetRequestContext(req)
+	ip := g.ClientIP(req)
+
+	if !g.perIP.allow(ip, g.now()) {
+		logRejection(ctx, ErrRateLimited, log.Fields{"ip": ip, "limit": "ip"})
+		resp.WriteErrorString(http.StatusTooManyRequests, ErrRateLimited.Error())
+		return
+	}
+	err := g.VerifyChallenge(req.HeaderParameter(ChallengeHeader), req.HeaderParameter(ChallengeSolutionHeader))
+	if err != nil {
+		logRejection(ctx, err, log.Fields{"ip": ip})
+		resp.WriteErrorString(http.StatusForbidden, err.Error())
+		return
+	}
+
+	chain.ProcessFilter(req, resp)
+}
+
+// Submission is the content of an anonymous submission, once the handler has
+// worked out which organization it is for.
+type Submission struct {
+	IP             string
+	OrganizationId uint64
+	Honeypot       string   // value of the hidden field; people leave it empty
+	Text           []string // free-text fields to check against the blocklist
+	Blocklist      []string // the organization's blocked terms, in lower case
+}
+
+// CheckSubmission applies the checks that need the request body. It returns
+// nil if the submission may be saved, and otherwise logs the reason and
+// returns one of the errors above.
+func (g *AbuseGuard) CheckSubmission(ctx context.Context, s Submission) error {
+	fields := log.Fields{"ip": s.IP, "OrganizationID": s.OrganizationId}
+
+	if strings.TrimSpace(s.Honeypot) != "" {
+		logRejection(ctx, ErrHoneypot, fields)
+		return ErrHoneypot
+	}
+	if term := blockedTerm(s.Text, s.Blocklist); term != "" {
+		fields["term"] = term
+		logRejection(ctx, ErrBlockedContent, fields)
+		return ErrBlockedContent
+	}
+	if !g.perOrg.allow(strconv.FormatUint(s.OrganizationId, 10), g.now()) {
+		fields["limit"] = "organization"
+		logRejection(ctx, ErrRateLimited, fields)
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// blockedTerm returns the first blocked term found in the text, ignoring
+// case, or "" if there is none.
+func blockedTerm(text, blocklist []string) string {
+	for _, field := range text {
+		field = strings.ToLower(field)
+		for _, term := range blocklist {
+			if term != "" && strings.Contains(field, term) {
+				return term
+			}
+		}
+	}
+	return ""
+}
+
+// rateLimiter allows each key at most limit events in any sliding window.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// allow records an event for the key and reports whether it is within the
+// limit. Events over the limit are not recorded. A limit of zero or less
+// disables the check.
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	// Forget keys that have gone quiet, at most once per window
+	if now.Sub(l.lastSweep) > l.window {
+		for k, times := range l.hits {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(l.hits, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	times := l.hits[key]
+	stale := 0
+	for stale < len(times) && !times[stale].After(cutoff) {
+		stale++
+	}
+	times = times[stale:]
+	if len(times) >= l.limit {
+		l.hits[key] = times
+		return false
+	}
+	l.hits[key] = append(times, now)
+	return true
+}
@@ -0,0 +1,135 @@
+package filters
+
+import (
+	"context"
+	"github.com/emicklei/go-restful"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestGuard() (*AbuseGuard, *time.Time) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	g := NewAbuseGuard([]byte("test secret"), 8, 2, 3, time.Hour)
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestAbuseGuard_VerifyChallenge(t *testing.T) {
+	g, now := newTestGuard()
+	challenge, err := g.NewChallenge()
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	solution := SolveChallenge(challenge.Token, challenge.Difficulty)
+
+	if err := g.VerifyChallenge(challenge.Token, ""); err != ErrChallengeRequired {
+		t.Errorf("Expected a missing solution to be required, got %v", err)
+	}
+	tampered := strings.Replace(challenge.Token, ".8.", ".0.", 1)
+	if err := g.VerifyChallenge(tampered, solution); err != ErrChallengeInvalid {
+		t.Errorf("Expected a tampered challenge to be invalid, got %v", err)
+	}
+	if err := g.VerifyChallenge(challenge.Token, solution); err != nil {
+		t.Errorf("Expected the solved challenge to be accepted, got %v", err)
+	}
+	if err := g.VerifyChallenge(challenge.Token, solution); err != ErrChallengeInvalid {
+		t.Errorf("Expected a replayed challenge to be rejected, got %v", err)
+	}
+
+	expiring, _ := g.NewChallenge()
+	*now = now.Add(DefaultChallengeTTL + time.Second)
+	if err := g.VerifyChallenge(expiring.Token, SolveChallenge(expiring.Token, expiring.Difficulty)); err != ErrChallengeInvalid {
+		t.Errorf("Expected an expired challenge to be rejected, got %v", err)
+	}
+}
+
+func TestAbuseGuard_CheckSubmission(t *testing.T) {
+	g, now := newTestGuard()
+	ctx := context.Background()
+	blocklist := []string{"casino"}
+
+	if err := g.CheckSubmission(ctx, Submission{OrganizationId: 1, Honeypot: "http://spam.example.com"}); err != ErrHoneypot {
+		t.Errorf("Expected honeypot rejection, got %v", err)
+	}
+	spam := Submission{OrganizationId: 1, Text: []string{"Visit our CASINO"}, Blocklist: blocklist}
+	if err := g.CheckSubmission(ctx, spam); err != ErrBlockedContent {
+		t.Errorf("Expected blocklist rejection, got %v", err)
+	}
+
+	ok := Submission{OrganizationId: 1, Text: []string{"Thanks for the help"}, Blocklist: blocklist}
+	for i := 0; i < 3; i++ {
+		if err := g.CheckSubmission(ctx, ok); err != nil {
+			t.Errorf("Submission %d: expected it to be accepted, got %v", i, err)
+		}
+	}
+	if err := g.CheckSubmission(ctx, ok); err != ErrRateLimited {
+		t.Errorf("Expected the organization limit to apply, got %v", err)
+	}
+	ok.OrganizationId = 2
+	if err := g.CheckSubmission(ctx, ok); err != nil {
+		t.Errorf("Expected other organizations to be unaffected, got %v", err)
+	}
+
+	*now = now.Add(time.Hour + time.Second)
+	ok.OrganizationId = 1
+	if err := g.CheckSubmission(ctx, ok); err != nil {
+		t.Errorf("Expected the limit to reset after the window, got %v", err)
+	}
+}
+
+func TestAbuseGuard_ClientIP(t *testing.T) {
+	g, _ := newTestGuard()
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	g.TrustedProxies = []*net.IPNet{proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.7:4000", "", "203.0.113.7"},
+		{"spoofed without a proxy", "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"through a proxy", "10.0.0.2:4000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed through a proxy", "10.0.0.2:4000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"through two proxies", "10.0.0.2:4000", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"proxy without the header", "10.0.0.2:4000", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/suggestions", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := g.ClientIP(restful.NewRequest(req)); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, time.Minute)
+	start := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if !l.allow("a", start) || !l.allow("a", start.Add(10*time.Second)) {
+		t.Errorf("Expected the first two events to be allowed")
+	}
+	if l.allow("a", start.Add(20*time.Second)) {
+		t.Errorf("Expected the third event to be refused")
+	}
+	if !l.allow("b", start.Add(20*time.Second)) {
+		t.Errorf("Expected other keys to be unaffected")
+	}
+	if !l.allow("a", start.Add(61*time.Second)) {
+		t.Errorf("Expected the oldest event to have left the window")
+	}
+
+	unlimited := newRateLimiter(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		if !unlimited.allow("a", start) {
+			t.Errorf("Expected a zero limit to allow everything")
+		}
+	}
+}
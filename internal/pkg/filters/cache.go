@@ -0,0 +1,61 @@
+package filters
+
+import (
+	"context"
+	"sync"
+)
+
+// requestCache holds values looked up while serving one request, so that
+// each is only loaded once however many handlers and packages ask for it.
+type requestCache struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func newRequestCache() *requestCache {
+	return &requestCache{values: make(map[string]interface{})}
+}
+
+func getRequestCache(ctx context.Context) *requestCache {
+	cache, _ := ctx.Value("cache").(*requestCache)
+	return cache
+}
+
+// CachedValue returns the value cached under key for the request the
+// context belongs to, calling load to fill it in the first time. Errors are
+// not cached. Contexts that did not come from GetRequestContext, such as
+// those of background jobs, have no cache, so load is called every time.
+func CachedValue(ctx context.Context, key string, load func() (interface{}, error)) (interface{}, error) {
+	cache := getRequestCache(ctx)
+	if cache == nil {
+		return load()
+	}
+
+	cache.mu.Lock()
+	value, ok := cache.values[key]
+	cache.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	cache.mu.Lock()
+	cache.values[key] = value
+	cache.mu.Unlock()
+	return value, nil
+}
+
+// ForgetCachedValue drops the value cached under key, so that the next
+// CachedValue loads it again. Call it after changing what it was loaded from.
+func ForgetCachedValue(ctx context.Context, key string) {
+	cache := getRequestCache(ctx)
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	delete(cache.values, key)
+	cache.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCachedValue(t *testing.T) {
+	req := restful.NewRequest(httptest.NewRequest("GET", "/", nil))
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	// Each call on the same request sees the same cache
+	for i := 0; i < 3; i++ {
+		value, err := CachedValue(GetRequestContext(req), "key", load)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if value.(int) != 1 {
+			t.Errorf("Expected the first value to be cached, got %v", value)
+		}
+	}
+
+	ForgetCachedValue(GetRequestContext(req), "key")
+	value, _ := CachedValue(GetRequestContext(req), "key", load)
+	if value.(int) != 2 {
+		t.Errorf("Expected the value to be loaded again once forgotten, got %v", value)
+	}
+
+	// A new request starts with an empty cache
+	other := restful.NewRequest(httptest.NewRequest("GET", "/", nil))
+	value, _ = CachedValue(GetRequestContext(other), "key", load)
+	if value.(int) != 3 {
+		t.Errorf("Expected another request not to share the cache, got %v", value)
+	}
+}
+
+func TestCachedValue_Uncached(t *testing.T) {
+	loads := 0
+	failing := func() (interface{}, error) {
+		loads++
+		return nil, errors.New("failed")
+	}
+	req := restful.NewRequest(httptest.NewRequest("GET", "/", nil))
+	CachedValue(GetRequestContext(req), "key", failing)
+	CachedValue(GetRequestContext(req), "key", failing)
+	if loads != 2 {
+		t.Errorf("Expected errors not to be cached, loaded %d times", loads)
+	}
+
+	loads = 0
+	CachedValue(context.Background(), "key", failing)
+	CachedValue(context.Background(), "key", failing)
+	if loads != 2 {
+		t.Errorf("Expected a context without a cache to load every time, loaded %d times", loads)
+	}
+}
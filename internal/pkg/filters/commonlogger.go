@@ -60,6 +60,16 @@ func JsonLoggingFilter(req *restful.Request, resp *restful.Response, chain *rest
 		resp.ContentLength(),
 	)
 
+	// Requests made by support staff acting as another user stand out, so
+	// that they are never mistaken for the user's own.
+	if actor, ok := req.Attribute("jwt.act").(string); ok && len(actor) > 0 {
+		fields["impersonation"] = true
+		fields["impersonatedBy"] = actor
+		fields["impersonatedUser"] = req.Attribute("jwt.sub")
+		fields["impersonationSession"] = req.Attribute("jwt.jti")
+		logMsgNCSACLF = fmt.Sprintf("[IMPERSONATED by %s] %s", actor, logMsgNCSACLF)
+	}
+
 	logger = logger.WithFields(fields)
 
 	// Health Check requests are debug-level log lines to reduce logspam in non-test realms
@@ -46,6 +46,8 @@ func GetRequestContext(req *restful.Request) context.Context {
 	logger := GetContextLogger(ctx)
 	// cache the preconfigured logger on the context
 	ctx = context.WithValue(ctx, "logger", logger)
+	ctx = context.WithValue(ctx, "cache", newRequestCache())
+	req.SetAttribute("ctx", ctx)
 
 	return ctx
 }
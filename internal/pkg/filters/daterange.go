@@ -0,0 +1,24 @@
+package filters
+
+import (
+	"errors"
+	"time"
+)
+
+// ParseDateRange converts the inclusive YYYY-MM-DD dates taken by the list and
+// report endpoints into a half-open [from, to) time range in the given
+// location.
+func ParseDateRange(fromStr, toStr string, loc *time.Location) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation("2006-01-02", fromStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := time.ParseInLocation("2006-01-02", toStr, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+	return from, to.AddDate(0, 0, 1), nil
+}
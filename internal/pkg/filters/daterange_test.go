@@ -0,0 +1,31 @@
+package filters
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	from, to, err := ParseDateRange("2020-03-07", "2020-03-08", loc)
+	if err != nil {
+		t.Fatalf("Expected a valid range, got %v", err)
+	}
+	if want := time.Date(2020, time.March, 7, 0, 0, 0, 0, loc); !from.Equal(want) {
+		t.Errorf("Expected from to be %s, got %s", want, from)
+	}
+	if want := time.Date(2020, time.March, 9, 0, 0, 0, 0, loc); !to.Equal(want) {
+		t.Errorf("Expected to to include the whole last day, up to %s, got %s", want, to)
+	}
+
+	if _, _, err = ParseDateRange("2020-03-08", "2020-03-07", loc); err == nil {
+		t.Error("Expected an error for a range that ends before it starts")
+	}
+	if _, _, err = ParseDateRange("03/07/2020", "2020-03-08", loc); err == nil {
+		t.Error("Expected an error for a malformed date")
+	}
+}
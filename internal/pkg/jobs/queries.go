@@ -0,0 +1,14 @@
+package jobs
+
+// The lease is only taken if the job is due, and the row lock means that
+// only one of several replicas racing for it wins.
+const claimJobSql = `
+	INSERT INTO scheduled_jobs (name, next_run_at, last_run_at) VALUES (?, ?, now())
+	ON CONFLICT (name) DO UPDATE SET next_run_at = EXCLUDED.next_run_at, last_run_at = now()
+	WHERE scheduled_jobs.next_run_at <= now()
+	RETURNING name
+`
+
+const recordJobErrorSql = `
+	UPDATE scheduled_jobs SET last_error = ? WHERE name = ?
+`
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often a new Runner checks whether its jobs are
+// due.
+const DefaultPollInterval = 10 * time.Second
+
+// Job is work done on a schedule.
+type Job func(ctx context.Context) error
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Runner runs jobs periodically. Every replica may run the same jobs; each
+// run of a job happens on whichever replica claims it first.
+type Runner struct {
+	db   *sqlx.DB
+	jobs []scheduledJob
+
+	PollInterval time.Duration
+}
+
+func NewRunner(db *sqlx.DB) *Runner {
+	return &Runner{
+		db:           db,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Every schedules the job to run once per interval. Schedule jobs before
+// calling Run.
+func (r *Runner) Every(name string, interval time.Duration, job Job) {
+	r.jobs = append(r.jobs, scheduledJob{name: name, interval: interval, job: job})
+}
+
+// claim takes the job's lease until its next run, if it is due.
+func (r *Runner) claim(ctx context.Context, j scheduledJob) (bool, error) {
+	var name string
+	err := r.db.GetContext(ctx, &name, r.db.Rebind(claimJobSql), j.name, time.Now().Add(j.interval))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runJob calls the job, turning a panic into an error so that one bad run
+// cannot take down the runner.
+func runJob(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job(ctx)
+}
+
+// RunOnce runs the job if it is due and no other replica has claimed it. It
+// reports whether the job ran.
+func (r *Runner) RunOnce(ctx context.Context, name string) (bool, error) {
+	for _, j := range r.jobs {
+		if j.name == name {
+			return r.runIfDue(ctx, j)
+		}
+	}
+	return false, fmt.Errorf("no job named %q", name)
+}
+
+func (r *Runner) runIfDue(ctx context.Context, j scheduledJob) (bool, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "jobs.Runner",
+		"Job":       j.name,
+	})
+
+	claimed, err := r.claim(ctx, j)
+	if err != nil || !claimed {
+		return false, err
+	}
+	jobErr := runJob(ctx, j.job)
+	lastError := ""
+	if jobErr != nil {
+		logger.WithError(jobErr).Error("Job failed")
+		lastError = jobErr.Error()
+	}
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(recordJobErrorSql), lastError, j.name)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record job result")
+	}
+	return true, jobErr
+}
+
+func (r *Runner) poll(ctx context.Context, j scheduledJob) {
+	for {
+		ran, err := r.runIfDue(ctx, j)
+		if err != nil && !ran && ctx.Err() == nil {
+			filters.GetContextLogger(ctx).WithField("Job", j.name).WithError(err).Error("Failed to claim job")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// Run runs the jobs on schedule until the context is cancelled, then waits
+// for the runs in progress to finish.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range r.jobs {
+		wg.Add(1)
+		go func(j scheduledJob) {
+			defer wg.Done()
+			r.poll(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
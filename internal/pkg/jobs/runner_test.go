@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunJob_RecoversPanic(t *testing.T) {
+	err := runJob(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	})
+	if err == nil || err.Error() != "job panicked: boom" {
+		t.Errorf("Expected the panic to become an error, got %v", err)
+	}
+}
+
+func TestRunner_RunOnceUnknownJob(t *testing.T) {
+	r := NewRunner(nil)
+	r.Every("known", 0, func(ctx context.Context) error { return nil })
+	if _, err := r.RunOnce(context.Background(), "unknown"); err == nil {
+		t.Error("Expected an unknown job to be refused")
+	}
+}
+
+func (suite *JobsTestSuite) TestRunner_ConcurrentClaims() {
+	ctx := context.Background()
+	var runs int32
+	job := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+
+	// Each replica has its own Runner against the same database.
+	replicas := 8
+	var ran int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < replicas; i++ {
+		r := NewRunner(suite.Config.GetDbConn())
+		r.Every("test-job", time.Hour, job)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, err := r.RunOnce(ctx, "test-job")
+			suite.Nil(err)
+			if ok {
+				atomic.AddInt32(&ran, 1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	suite.Equal(int32(1), ran, "Expected only one replica to claim the job")
+	suite.Equal(int32(1), runs)
+
+	r := NewRunner(suite.Config.GetDbConn())
+	r.Every("test-job", time.Hour, job)
+	ok, err := r.RunOnce(ctx, "test-job")
+	suite.Require().Nil(err)
+	suite.False(ok, "Expected the job not to run again until its next run is due")
+
+	_, err = suite.Config.GetDbConn().Exec(`UPDATE scheduled_jobs SET next_run_at = now() - interval '1 second' WHERE name = 'test-job'`)
+	suite.Require().Nil(err)
+	ok, err = r.RunOnce(ctx, "test-job")
+	suite.Require().Nil(err)
+	suite.True(ok, "Expected the job to run once it is due")
+	suite.Equal(int32(2), runs)
+}
+
+func (suite *JobsTestSuite) TestRunner_RecordsError() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	failure := errors.New("failed")
+	r := NewRunner(db)
+	r.Every("failing-job", 0, func(ctx context.Context) error { return failure })
+
+	ok, err := r.RunOnce(ctx, "failing-job")
+	suite.True(ok)
+	suite.Equal(failure, err)
+	var lastError string
+	suite.Require().Nil(db.Get(&lastError, `SELECT last_error FROM scheduled_jobs WHERE name = 'failing-job'`))
+	suite.Equal("failed", lastError)
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type JobsTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestJobsTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(JobsTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping JobsTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
@@ -0,0 +1,163 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+var testBranding = Branding{Name: "Food Bank", Color: "#112233", LogoUrl: "https://example.com/logo.png"}
+
+func testSiteUpdate() SiteUpdatedData {
+	return SiteUpdatedData{
+		SiteName: "Downtown <Annex>",
+		Changes:  []ChangeLine{{Label: "Tuesday hours", Old: "09:00-17:00", New: "closed"}},
+	}
+}
+
+func TestRender_Localized(t *testing.T) {
+	testCases := map[string]string{
+		"en":    "Downtown <Annex> has changed",
+		"es":    "Downtown <Annex> ha cambiado",
+		"es-MX": "Downtown <Annex> ha cambiado",
+		"es_mx": "Downtown <Annex> ha cambiado",
+		"fr-CA": "Downtown <Annex> has changed",
+		"":      "Downtown <Annex> has changed",
+	}
+	for locale, expected := range testCases {
+		msg, err := Render(TemplateSiteUpdated, locale, testBranding, testSiteUpdate())
+		if err != nil {
+			t.Fatalf("%s: failed to render: %v", locale, err)
+		}
+		if msg.Subject != expected {
+			t.Errorf("%s: expected subject %q, got %q", locale, expected, msg.Subject)
+		}
+	}
+
+	_, err := Render("no_such_template", "en", testBranding, nil)
+	if err == nil {
+		t.Error("Expected an unknown template to be refused")
+	}
+}
+
+func TestRender_Branding(t *testing.T) {
+	msg, err := Render(TemplateSiteUpdated, "en", testBranding, testSiteUpdate())
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	for _, expected := range []string{"#112233", `src="https://example.com/logo.png"`, "Downtown &lt;Annex&gt;", "Tuesday hours"} {
+		if !strings.Contains(msg.HTML, expected) {
+			t.Errorf("Expected the HTML to contain %q:\n%s", expected, msg.HTML)
+		}
+	}
+	if !strings.Contains(msg.Text, "- Tuesday hours: 09:00-17:00 -> closed") {
+		t.Errorf("Unexpected text body:\n%s", msg.Text)
+	}
+
+	msg, err = Render(TemplateSiteUpdated, "en", Branding{Name: "Plain"}, testSiteUpdate())
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if !strings.Contains(msg.HTML, DefaultBrandColor) || strings.Contains(msg.HTML, "<img") {
+		t.Errorf("Expected the default color and no logo:\n%s", msg.HTML)
+	}
+}
+
+func TestRender_AllTemplates(t *testing.T) {
+	data := map[string]interface{}{
+		TemplateSiteUpdated:   testSiteUpdate(),
+		TemplateInvitation:    InvitationData{InviterEmail: "admin@example.com", AcceptUrl: "https://example.com/accept"},
+		TemplatePasswordReset: PasswordResetData{ResetUrl: "https://example.com/reset", ExpiresIn: "1 hour"},
+		TemplateShiftSignup:   ShiftData{SiteName: "Downtown", Starts: "Mon Jan 5 9:00 AM", Ends: "1:00 PM"},
+		TemplateShiftCancel:   ShiftData{SiteName: "Downtown", Starts: "Mon Jan 5 9:00 AM", Ends: "1:00 PM"},
+		TemplateShiftReminder: ShiftData{SiteName: "Downtown", Starts: "Mon Jan 5 9:00 AM", Ends: "1:00 PM"},
+		TemplateNewSuggestion: NewSuggestionData{Place: "Downtown", Excerpt: "The door code changed"},
+		TemplateNewUser:       NewUserData{Email: "volunteer@example.com"},
+		TemplateDigest:        DigestData{Weekly: true, Lines: []string{"Downtown changed: Monday hours"}},
+		TemplateBroadcast:     BroadcastData{Subject: "Downtown is closed today", Body: "The power is out."},
+	}
+	for name, locales := range templateSources {
+		for locale := range locales {
+			msg, err := Render(name, locale, testBranding, data[name])
+			if err != nil {
+				t.Errorf("%s.%s: failed to render: %v", name, locale, err)
+				continue
+			}
+			if msg.Subject == "" || msg.Text == "" || msg.HTML == "" {
+				t.Errorf("%s.%s: expected every part to be rendered", name, locale)
+			}
+		}
+	}
+}
+
+func TestMessage_Bytes(t *testing.T) {
+	msg := Message{
+		From:     "noreply@foodbank.example.com",
+		FromName: "Food Bank",
+		To:       "volunteer@example.com",
+		Subject:  "Horario del martes",
+		Text:     "Hello",
+		HTML:     "<p>Hello</p>",
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg.Bytes())))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if from := parsed.Header.Get("From"); from != `"Food Bank" <noreply@foodbank.example.com>` {
+		t.Errorf("Unexpected From header %q", from)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@foodbank.example.com>") {
+		t.Errorf("Unexpected Message-ID %q", id)
+	}
+	if !strings.HasPrefix(parsed.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("Unexpected Content-Type %q", parsed.Header.Get("Content-Type"))
+	}
+}
+
+func TestClassifySMTPError(t *testing.T) {
+	permanent := classifySMTPError(&textproto.Error{Code: 550, Msg: "no such user"})
+	if !errors.Is(permanent, ErrPermanentFailure) {
+		t.Errorf("Expected a 550 reply to be permanent, got %v", permanent)
+	}
+	transient := classifySMTPError(&textproto.Error{Code: 451, Msg: "try again later"})
+	if errors.Is(transient, ErrPermanentFailure) {
+		t.Errorf("Expected a 451 reply to be retryable, got %v", transient)
+	}
+	if classifySMTPError(nil) != nil {
+		t.Error("Expected no error to stay nil")
+	}
+}
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	msg := &Message{From: "a@example.com", To: "b@example.com", Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"}
+
+	memory := NewMemorySink()
+	memory.Rejected["gone@example.com"] = true
+	if err := memory.Send(ctx, msg); err != nil || len(memory.Sent) != 1 {
+		t.Errorf("Expected the message to be kept, got %v", err)
+	}
+	rejected := *msg
+	rejected.To = "gone@example.com"
+	if err := memory.Send(ctx, &rejected); !errors.Is(err, ErrPermanentFailure) {
+		t.Errorf("Expected a permanent failure, got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = (FileSink{Dir: dir}).Send(ctx, msg); err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".eml") {
+		t.Errorf("Expected one .eml file, got %v", files)
+	}
+}
@@ -0,0 +1,124 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// ErrUndeliverable is returned when sending to an address that has bounced
+// or failed permanently before.
+var ErrUndeliverable = errors.New("email address is undeliverable")
+
+// Mailer renders templates and sends them through a Sink, skipping
+// addresses known to be undeliverable and recording new ones.
+type Mailer struct {
+	Sink     Sink
+	From     string // used when the organization has no from-address
+	FromName string
+}
+
+func NewMailer(sink Sink, from, fromName string) *Mailer {
+	return &Mailer{
+		Sink:     sink,
+		From:     from,
+		FromName: fromName,
+	}
+}
+
+// Envelope is one email to send.
+type Envelope struct {
+	To       string
+	Locale   string
+	Branding Branding
+	Template string
+	Data     interface{}
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// Send renders and sends the email. If the sink reports a permanent failure,
+// the address is marked undeliverable and later sends to it are skipped with
+// ErrUndeliverable.
+func (m *Mailer) Send(ctx context.Context, db *sqlx.DB, env Envelope) error {
+	to := normalizeAddress(env.To)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Mailer.Send",
+		"Template":  env.Template,
+	})
+
+	undeliverable, err := IsUndeliverable(ctx, db, to)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check address")
+		return err
+	}
+	if undeliverable {
+		logger.Debug("Skipping undeliverable address")
+		return ErrUndeliverable
+	}
+
+	msg, err := Render(env.Template, env.Locale, env.Branding, env.Data)
+	if err != nil {
+		logger.WithError(err).Error("Failed to render email")
+		return err
+	}
+	msg.To = to
+	msg.From = env.Branding.FromAddress
+	if msg.From == "" {
+		msg.From = m.From
+	}
+	msg.FromName = env.Branding.FromName
+	if msg.FromName == "" {
+		msg.FromName = env.Branding.Name
+	}
+	if msg.FromName == "" {
+		msg.FromName = m.FromName
+	}
+
+	err = m.Sink.Send(ctx, msg)
+	if err != nil {
+		if errors.Is(err, ErrPermanentFailure) {
+			logger.WithError(err).Warn("Marking address undeliverable")
+			if markErr := MarkUndeliverable(ctx, db, to, err.Error()); markErr != nil {
+				logger.WithError(markErr).Error("Failed to mark address undeliverable")
+			}
+			return err
+		}
+		logger.WithError(err).Error("Failed to send email")
+		return err
+	}
+	return nil
+}
+
+// IsUndeliverable reports whether mail to the address has bounced or failed
+// permanently.
+func IsUndeliverable(ctx context.Context, db *sqlx.DB, address string) (bool, error) {
+	var undeliverable bool
+	err := db.GetContext(ctx, &undeliverable, db.Rebind(selectUndeliverableSql), normalizeAddress(address))
+	return undeliverable, err
+}
+
+// MarkUndeliverable stops mail to the address, such as after a bounce.
+func MarkUndeliverable(ctx context.Context, db *sqlx.DB, address, reason string) error {
+	_, err := db.ExecContext(ctx, db.Rebind(markUndeliverableSql), normalizeAddress(address), reason)
+	return err
+}
+
+// ClearUndeliverable allows mail to the address again, such as after the
+// recipient fixes their mailbox. Returns sql.ErrNoRows if it was not marked.
+func ClearUndeliverable(ctx context.Context, db *sqlx.DB, address string) error {
+	result, err := db.ExecContext(ctx, db.Rebind(clearUndeliverableSql), normalizeAddress(address))
+	if err != nil {
+		return err
+	}
+	if cleared, _ := result.RowsAffected(); cleared == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
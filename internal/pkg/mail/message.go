@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a rendered email, ready to hand to a Sink.
+type Message struct {
+	From     string // address only
+	FromName string
+	To       string
+	Subject  string
+	Text     string
+	HTML     string
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate random token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) {
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(body))
+	w.Close()
+}
+
+// Bytes encodes the message as a multipart/alternative MIME message, with
+// the plain text part first so that clients prefer the HTML.
+func (m *Message) Bytes() []byte {
+	boundary := "vs-" + randomToken(12)
+	from := mail.Address{Name: m.FromName, Address: m.From}
+	to := mail.Address{Address: m.To}
+	domain := "volunteer-savvy"
+	if at := strings.LastIndex(m.From, "@"); at >= 0 {
+		domain = m.From[at+1:]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomToken(16), domain)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	writeQuotedPrintable(&buf, m.Text)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	writeQuotedPrintable(&buf, m.HTML)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes()
+}
@@ -0,0 +1,14 @@
+package mail
+
+const selectUndeliverableSql = `
+	SELECT EXISTS(SELECT 1 FROM undeliverable_emails WHERE email = ?)
+`
+
+const markUndeliverableSql = `
+	INSERT INTO undeliverable_emails (email, reason) VALUES (?, ?)
+	ON CONFLICT (email) DO UPDATE SET reason = EXCLUDED.reason, created_at = now()
+`
+
+const clearUndeliverableSql = `
+	DELETE FROM undeliverable_emails WHERE email = ?
+`
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/mail"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type MailServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *MailServer {
+	return &MailServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+// BounceRequest reports mail that could not be delivered, as forwarded by
+// the mail provider's bounce processing.
+type BounceRequest struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+func (server *MailServer) GetMailAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/mail").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.POST("/bounces").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.BounceHandler).
+			Doc("Mark an address undeliverable after a bounce").
+			Consumes(restful.MIME_JSON).
+			Reads(BounceRequest{}).
+			Returns(http.StatusOK, "Address marked undeliverable", nil).
+			Returns(http.StatusBadRequest, "No address given", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a Site Admin", nil))
+	service.Route(
+		service.DELETE("/undeliverable/{email}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ClearUndeliverableHandler).
+			Doc("Allow mail to an address that was marked undeliverable").
+			Returns(http.StatusOK, "Address cleared", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a Site Admin", nil).
+			Returns(http.StatusNotFound, "Address was not marked undeliverable", nil))
+
+	return service
+}
+
+func (server *MailServer) BounceHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "BounceHandler",
+	})
+
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var req BounceRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if !strings.Contains(req.Email, "@") {
+		response.WriteErrorString(http.StatusBadRequest, "email must be an email address")
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "bounced"
+	}
+
+	err = mail.MarkUndeliverable(ctx, server.Config.GetDbConn(), req.Email, req.Reason)
+	if err != nil {
+		logger.WithError(err).Error("Failed to mark address undeliverable")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *MailServer) ClearUndeliverableHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ClearUndeliverableHandler",
+	})
+
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err := mail.ClearUndeliverable(ctx, server.Config.GetDbConn(), request.PathParameter("email"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.WithError(err).Error("Failed to clear address")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,94 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrPermanentFailure wraps errors for mail that can never be delivered to
+// the address, such as an unknown mailbox. Anything else may be retried.
+var ErrPermanentFailure = errors.New("permanent delivery failure")
+
+// Sink delivers rendered messages.
+type Sink interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// SMTPSink relays mail through an SMTP server. If a username is set, it
+// authenticates with PLAIN, which net/smtp only allows over TLS or to
+// localhost.
+type SMTPSink struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (s SMTPSink) Send(ctx context.Context, msg *Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	err := smtp.SendMail(addr, auth, msg.From, []string{msg.To}, msg.Bytes())
+	return classifySMTPError(err)
+}
+
+// classifySMTPError marks 5xx replies from the server as permanent failures.
+func classifySMTPError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 && reply.Code < 600 {
+		return fmt.Errorf("%w: %v", ErrPermanentFailure, err)
+	}
+	return err
+}
+
+// FileSink writes each message to its own .eml file in Dir, where it can be
+// opened with a mail client. It stands in for an SMTP server in development.
+type FileSink struct {
+	Dir string
+}
+
+func (s FileSink) Send(ctx context.Context, msg *Message) error {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), randomToken(4))
+	return ioutil.WriteFile(filepath.Join(s.Dir, name), msg.Bytes(), 0644)
+}
+
+// MemorySink keeps the messages it is sent, for tests. Addresses in
+// Rejected fail permanently, as an unknown mailbox would.
+type MemorySink struct {
+	mu       sync.Mutex
+	Sent     []Message
+	Rejected map[string]bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		Sent:     make([]Message, 0),
+		Rejected: make(map[string]bool),
+	}
+}
+
+func (s *MemorySink) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Rejected[msg.To] {
+		return fmt.Errorf("%w: 550 no such mailbox %s", ErrPermanentFailure, msg.To)
+	}
+	s.Sent = append(s.Sent, *msg)
+	return nil
+}
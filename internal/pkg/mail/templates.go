@@ -0,0 +1,407 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when a template has no translation for the
+// recipient's locale.
+const DefaultLocale = "en"
+
+// DefaultBrandColor is used for organizations that have not chosen one.
+const DefaultBrandColor = "#2a6ebb"
+
+// Template names.
+const (
+	TemplateSiteUpdated   = "site_updated"
+	TemplateInvitation    = "invitation"
+	TemplatePasswordReset = "password_reset"
+	TemplateShiftSignup   = "shift_signup"
+	TemplateShiftCancel   = "shift_cancelled"
+	TemplateShiftReminder = "shift_reminder"
+	TemplateNewSuggestion = "new_suggestion"
+	TemplateNewUser       = "new_user"
+	TemplateDigest        = "digest"
+	TemplateBroadcast     = "broadcast"
+)
+
+// Branding is how an organization's email looks and who it comes from.
+type Branding struct {
+	Name        string
+	FromAddress string
+	FromName    string
+	Color       string // #rrggbb
+	LogoUrl     string
+}
+
+// SiteUpdatedData is the data for TemplateSiteUpdated.
+type SiteUpdatedData struct {
+	SiteName string
+	Changes  []ChangeLine
+}
+
+// ChangeLine is one change to a site, already described for the recipient.
+type ChangeLine struct {
+	Label string
+	Old   string
+	New   string
+}
+
+// InvitationData is the data for TemplateInvitation.
+type InvitationData struct {
+	InviterEmail string
+	AcceptUrl    string
+}
+
+// PasswordResetData is the data for TemplatePasswordReset.
+type PasswordResetData struct {
+	ResetUrl  string
+	ExpiresIn string
+}
+
+// ShiftData is the data for TemplateShiftSignup, TemplateShiftCancel and
+// TemplateShiftReminder.
+// Times are already formatted in the site's time zone.
+type ShiftData struct {
+	SiteName string
+	Starts   string
+	Ends     string
+}
+
+// NewSuggestionData is the data for TemplateNewSuggestion. Place is the site
+// the suggestion is about, or else the organization.
+type NewSuggestionData struct {
+	Place   string
+	Excerpt string
+}
+
+// NewUserData is the data for TemplateNewUser.
+type NewUserData struct {
+	Email string
+}
+
+// DigestData is the data for TemplateDigest. Lines are already described for
+// the recipient, oldest first.
+type DigestData struct {
+	Weekly bool
+	Lines  []string
+}
+
+// BroadcastData is the data for TemplateBroadcast.
+type BroadcastData struct {
+	Subject string
+	Body    string
+}
+
+// templateData is what every template is executed with.
+type templateData struct {
+	Org  Branding
+	Data interface{}
+}
+
+type templateSource struct {
+	Subject string
+	Text    string
+	HTML    string // the "content" block of htmlLayout
+}
+
+type localizedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+const htmlLayout = `<!DOCTYPE html>
+<html>
+<body style="margin: 0; padding: 0; font-family: Helvetica, Arial, sans-serif; color: #222222;">
+<div style="max-width: 600px; margin: 0 auto; padding: 24px; border-top: 6px solid {{.Org.Color}};">
+{{if .Org.LogoUrl}}<img src="{{.Org.LogoUrl}}" alt="{{.Org.Name}}" style="max-height: 48px;">{{end}}
+{{template "content" .}}
+<p style="color: #888888; font-size: 12px;">{{.Org.Name}}</p>
+</div>
+</body>
+</html>
+`
+
+// templateSources are keyed by template name, then locale.
+var templateSources = map[string]map[string]templateSource{
+	TemplateSiteUpdated: {
+		"en": {
+			Subject: `{{.Data.SiteName}} has changed`,
+			Text: `{{.Data.SiteName}} has been updated:
+{{range .Data.Changes}}
+- {{.Label}}: {{.Old}} -> {{.New}}{{end}}
+
+You are receiving this because you subscribed to {{.Data.SiteName}} with {{.Org.Name}}.
+`,
+			HTML: `<h2>{{.Data.SiteName}} has been updated</h2>
+<ul>{{range .Data.Changes}}
+<li><strong>{{.Label}}</strong>: {{.Old}} &rarr; {{.New}}</li>{{end}}
+</ul>
+<p>You are receiving this because you subscribed to {{.Data.SiteName}}.</p>`,
+		},
+		"es": {
+			Subject: `{{.Data.SiteName}} ha cambiado`,
+			Text: `{{.Data.SiteName}} se ha actualizado:
+{{range .Data.Changes}}
+- {{.Label}}: {{.Old}} -> {{.New}}{{end}}
+
+Recibe este mensaje porque se suscribió a {{.Data.SiteName}} con {{.Org.Name}}.
+`,
+			HTML: `<h2>{{.Data.SiteName}} se ha actualizado</h2>
+<ul>{{range .Data.Changes}}
+<li><strong>{{.Label}}</strong>: {{.Old}} &rarr; {{.New}}</li>{{end}}
+</ul>
+<p>Recibe este mensaje porque se suscribió a {{.Data.SiteName}}.</p>`,
+		},
+	},
+	TemplateInvitation: {
+		"en": {
+			Subject: `You're invited to volunteer with {{.Org.Name}}`,
+			Text: `{{.Data.InviterEmail}} has invited you to volunteer with {{.Org.Name}}.
+
+Accept the invitation: {{.Data.AcceptUrl}}
+`,
+			HTML: `<p>{{.Data.InviterEmail}} has invited you to volunteer with {{.Org.Name}}.</p>
+<p><a href="{{.Data.AcceptUrl}}" style="color: {{.Org.Color}};">Accept the invitation</a></p>`,
+		},
+		"es": {
+			Subject: `Le invitan a ser voluntario con {{.Org.Name}}`,
+			Text: `{{.Data.InviterEmail}} le ha invitado a ser voluntario con {{.Org.Name}}.
+
+Acepte la invitación: {{.Data.AcceptUrl}}
+`,
+			HTML: `<p>{{.Data.InviterEmail}} le ha invitado a ser voluntario con {{.Org.Name}}.</p>
+<p><a href="{{.Data.AcceptUrl}}" style="color: {{.Org.Color}};">Aceptar la invitación</a></p>`,
+		},
+	},
+	TemplatePasswordReset: {
+		"en": {
+			Subject: `Reset your {{.Org.Name}} password`,
+			Text: `Someone asked to reset the password for your account. If it was you, open this link within {{.Data.ExpiresIn}}:
+
+{{.Data.ResetUrl}}
+
+If it was not you, you can ignore this email.
+`,
+			HTML: `<p>Someone asked to reset the password for your account. If it was you, use this link within {{.Data.ExpiresIn}}:</p>
+<p><a href="{{.Data.ResetUrl}}" style="color: {{.Org.Color}};">Reset your password</a></p>
+<p>If it was not you, you can ignore this email.</p>`,
+		},
+		"es": {
+			Subject: `Restablezca su contraseña de {{.Org.Name}}`,
+			Text: `Alguien pidió restablecer la contraseña de su cuenta. Si fue usted, abra este enlace antes de {{.Data.ExpiresIn}}:
+
+{{.Data.ResetUrl}}
+
+Si no fue usted, puede ignorar este mensaje.
+`,
+			HTML: `<p>Alguien pidió restablecer la contraseña de su cuenta. Si fue usted, use este enlace antes de {{.Data.ExpiresIn}}:</p>
+<p><a href="{{.Data.ResetUrl}}" style="color: {{.Org.Color}};">Restablecer la contraseña</a></p>
+<p>Si no fue usted, puede ignorar este mensaje.</p>`,
+		},
+	},
+	TemplateShiftSignup: {
+		"en": {
+			Subject: `You're signed up at {{.Data.SiteName}}`,
+			Text: `You are signed up to volunteer at {{.Data.SiteName}} from {{.Data.Starts}} to {{.Data.Ends}}.
+
+Thank you for volunteering with {{.Org.Name}}!
+`,
+			HTML: `<p>You are signed up to volunteer at <strong>{{.Data.SiteName}}</strong> from {{.Data.Starts}} to {{.Data.Ends}}.</p>
+<p>Thank you for volunteering with {{.Org.Name}}!</p>`,
+		},
+		"es": {
+			Subject: `Está inscrito en {{.Data.SiteName}}`,
+			Text: `Está inscrito como voluntario en {{.Data.SiteName}} de {{.Data.Starts}} a {{.Data.Ends}}.
+
+¡Gracias por ser voluntario con {{.Org.Name}}!
+`,
+			HTML: `<p>Está inscrito como voluntario en <strong>{{.Data.SiteName}}</strong> de {{.Data.Starts}} a {{.Data.Ends}}.</p>
+<p>¡Gracias por ser voluntario con {{.Org.Name}}!</p>`,
+		},
+	},
+	TemplateShiftCancel: {
+		"en": {
+			Subject: `Your shift at {{.Data.SiteName}} is cancelled`,
+			Text: `Your signup at {{.Data.SiteName}} from {{.Data.Starts}} to {{.Data.Ends}} has been cancelled.
+`,
+			HTML: `<p>Your signup at <strong>{{.Data.SiteName}}</strong> from {{.Data.Starts}} to {{.Data.Ends}} has been cancelled.</p>`,
+		},
+		"es": {
+			Subject: `Su turno en {{.Data.SiteName}} se ha cancelado`,
+			Text: `Su inscripción en {{.Data.SiteName}} de {{.Data.Starts}} a {{.Data.Ends}} se ha cancelado.
+`,
+			HTML: `<p>Su inscripción en <strong>{{.Data.SiteName}}</strong> de {{.Data.Starts}} a {{.Data.Ends}} se ha cancelado.</p>`,
+		},
+	},
+	TemplateShiftReminder: {
+		"en": {
+			Subject: `Reminder: your shift at {{.Data.SiteName}}`,
+			Text: `This is a reminder that you are volunteering at {{.Data.SiteName}} from {{.Data.Starts}} to {{.Data.Ends}}.
+
+If you can no longer make it, please cancel your signup so that {{.Org.Name}} can find someone else.
+`,
+			HTML: `<p>This is a reminder that you are volunteering at <strong>{{.Data.SiteName}}</strong> from {{.Data.Starts}} to {{.Data.Ends}}.</p>
+<p>If you can no longer make it, please cancel your signup so that {{.Org.Name}} can find someone else.</p>`,
+		},
+		"es": {
+			Subject: `Recordatorio: su turno en {{.Data.SiteName}}`,
+			Text: `Le recordamos que es voluntario en {{.Data.SiteName}} de {{.Data.Starts}} a {{.Data.Ends}}.
+
+Si ya no puede asistir, cancele su inscripción para que {{.Org.Name}} pueda encontrar a otra persona.
+`,
+			HTML: `<p>Le recordamos que es voluntario en <strong>{{.Data.SiteName}}</strong> de {{.Data.Starts}} a {{.Data.Ends}}.</p>
+<p>Si ya no puede asistir, cancele su inscripción para que {{.Org.Name}} pueda encontrar a otra persona.</p>`,
+		},
+	},
+	TemplateNewSuggestion: {
+		"en": {
+			Subject: `New suggestion for {{.Data.Place}}`,
+			Text: `A new suggestion was left for {{.Data.Place}}:
+
+{{.Data.Excerpt}}
+`,
+			HTML: `<p>A new suggestion was left for <strong>{{.Data.Place}}</strong>:</p>
+<blockquote>{{.Data.Excerpt}}</blockquote>`,
+		},
+		"es": {
+			Subject: `Nueva sugerencia para {{.Data.Place}}`,
+			Text: `Se dejó una nueva sugerencia para {{.Data.Place}}:
+
+{{.Data.Excerpt}}
+`,
+			HTML: `<p>Se dejó una nueva sugerencia para <strong>{{.Data.Place}}</strong>:</p>
+<blockquote>{{.Data.Excerpt}}</blockquote>`,
+		},
+	},
+	TemplateNewUser: {
+		"en": {
+			Subject: `{{.Data.Email}} joined {{.Org.Name}}`,
+			Text: `{{.Data.Email}} has joined {{.Org.Name}}.
+`,
+			HTML: `<p><strong>{{.Data.Email}}</strong> has joined {{.Org.Name}}.</p>`,
+		},
+		"es": {
+			Subject: `{{.Data.Email}} se unió a {{.Org.Name}}`,
+			Text: `{{.Data.Email}} se ha unido a {{.Org.Name}}.
+`,
+			HTML: `<p><strong>{{.Data.Email}}</strong> se ha unido a {{.Org.Name}}.</p>`,
+		},
+	},
+	TemplateDigest: {
+		"en": {
+			Subject: `Your {{if .Data.Weekly}}weekly{{else}}daily{{end}} digest`,
+			Text: `Here is what happened since your last digest:
+{{range .Data.Lines}}
+- {{.}}{{end}}
+`,
+			HTML: `<h2>Your {{if .Data.Weekly}}weekly{{else}}daily{{end}} digest</h2>
+<ul>{{range .Data.Lines}}
+<li>{{.}}</li>{{end}}
+</ul>`,
+		},
+		"es": {
+			Subject: `Su resumen {{if .Data.Weekly}}semanal{{else}}diario{{end}}`,
+			Text: `Esto es lo que ha pasado desde su último resumen:
+{{range .Data.Lines}}
+- {{.}}{{end}}
+`,
+			HTML: `<h2>Su resumen {{if .Data.Weekly}}semanal{{else}}diario{{end}}</h2>
+<ul>{{range .Data.Lines}}
+<li>{{.}}</li>{{end}}
+</ul>`,
+		},
+	},
+	TemplateBroadcast: {
+		"en": {
+			Subject: `[{{.Org.Name}}] {{.Data.Subject}}`,
+			Text: `{{.Data.Body}}
+
+Please acknowledge this message in the app so that {{.Org.Name}} knows you have seen it.
+`,
+			HTML: `<h2>{{.Data.Subject}}</h2>
+<p style="white-space: pre-wrap;">{{.Data.Body}}</p>
+<p>Please acknowledge this message in the app so that {{.Org.Name}} knows you have seen it.</p>`,
+		},
+		"es": {
+			Subject: `[{{.Org.Name}}] {{.Data.Subject}}`,
+			Text: `{{.Data.Body}}
+
+Confirme este mensaje en la aplicación para que {{.Org.Name}} sepa que lo ha visto.
+`,
+			HTML: `<h2>{{.Data.Subject}}</h2>
+<p style="white-space: pre-wrap;">{{.Data.Body}}</p>
+<p>Confirme este mensaje en la aplicación para que {{.Org.Name}} sepa que lo ha visto.</p>`,
+		},
+	},
+}
+
+var templates = parseTemplates()
+
+func parseTemplates() map[string]map[string]*localizedTemplate {
+	parsed := make(map[string]map[string]*localizedTemplate, len(templateSources))
+	for name, locales := range templateSources {
+		parsed[name] = make(map[string]*localizedTemplate, len(locales))
+		for locale, source := range locales {
+			id := name + "." + locale
+			layout := htmltemplate.Must(htmltemplate.New(id).Parse(htmlLayout))
+			parsed[name][locale] = &localizedTemplate{
+				subject: texttemplate.Must(texttemplate.New(id + ".subject").Parse(source.Subject)),
+				text:    texttemplate.Must(texttemplate.New(id + ".text").Parse(source.Text)),
+				html:    htmltemplate.Must(layout.New("content").Parse(source.HTML)).Lookup(id),
+			}
+		}
+	}
+	return parsed
+}
+
+// resolveLocale picks the closest translation available: the exact locale,
+// then its language, then DefaultLocale. Locales are matched ignoring case,
+// and with either - or _ separating the region.
+func resolveLocale(available map[string]*localizedTemplate, locale string) string {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	if _, ok := available[locale]; ok {
+		return locale
+	}
+	if dash := strings.Index(locale, "-"); dash > 0 {
+		if _, ok := available[locale[:dash]]; ok {
+			return locale[:dash]
+		}
+	}
+	return DefaultLocale
+}
+
+// Render renders the named template for the recipient's locale, with the
+// organization's branding. The returned message has no sender or recipient.
+func Render(name, locale string, branding Branding, data interface{}) (*Message, error) {
+	available, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	t := available[resolveLocale(available, locale)]
+	if branding.Color == "" {
+		branding.Color = DefaultBrandColor
+	}
+	td := templateData{Org: branding, Data: data}
+
+	var subject, text, html bytes.Buffer
+	if err := t.subject.Execute(&subject, td); err != nil {
+		return nil, err
+	}
+	if err := t.text.Execute(&text, td); err != nil {
+		return nil, err
+	}
+	if err := t.html.Execute(&html, td); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
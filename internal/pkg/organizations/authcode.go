@@ -0,0 +1,132 @@
+package organizations
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	MinAuthcodeLength = 8
+	MaxAuthcodeLength = 64
+	authcodeBytes     = 15 // 24 characters of base32
+)
+
+var (
+	ErrDuplicateAuthcode = errors.New("another organization already uses this authcode")
+	ErrInvalidAuthcode   = errors.New("authcode is wrong, expired or used up")
+)
+
+// AuthcodeStatus is how an organization's authcode may still be used.
+type AuthcodeStatus struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"authcode_expires_at"`
+	MaxUses   *int       `json:"max_uses,omitempty" db:"authcode_max_uses"`
+	Uses      int        `json:"uses" db:"authcode_uses"`
+	RotatedAt time.Time  `json:"rotated_at" db:"authcode_rotated_at"`
+}
+
+func hashAuthcode(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+// GenerateAuthcode returns a new random authcode.
+func GenerateAuthcode() (string, error) {
+	code := make([]byte, authcodeBytes)
+	if _, err := rand.Read(code); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(code), nil
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// RotateAuthcode replaces the organization's authcode with a new random one,
+// which may expire or be limited to a number of uses, and returns it. The old
+// code stops working at once. Returns sql.ErrNoRows if the organization does
+// not exist.
+func RotateAuthcode(ctx context.Context, db *sqlx.DB, organizationID uint64, expiresAt *time.Time, maxUses *int) (string, *AuthcodeStatus, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":      "RotateAuthcode",
+		"OrganizationID": organizationID,
+	})
+
+	code, err := GenerateAuthcode()
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate authcode")
+		return "", nil, err
+	}
+	var status AuthcodeStatus
+	err = db.GetContext(ctx, &status, db.Rebind(rotateAuthcodeSql), hashAuthcode(code), expiresAt, maxUses, organizationID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to rotate authcode")
+		}
+		return "", nil, err
+	}
+
+	// Success!
+	return code, &status, nil
+}
+
+// RedeemAuthcode finds the organization the authcode belongs to, and counts
+// the use against it. Returns ErrInvalidAuthcode if the code is wrong, has
+// expired, or has been used as many times as allowed.
+func RedeemAuthcode(ctx context.Context, tx *sqlx.Tx, code string) (uint64, error) {
+	var organizationID uint64
+	err := tx.GetContext(ctx, &organizationID, tx.Rebind(redeemAuthcodeSql), hashAuthcode(code))
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidAuthcode
+	}
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("operation", "RedeemAuthcode").WithError(err).Error("Failed to redeem authcode")
+		return 0, err
+	}
+	return organizationID, nil
+}
+
+// JoinOrganization makes the user a member of the organization the authcode
+// belongs to, as a Volunteer, and returns its ID. Returns ErrInvalidAuthcode
+// if the code cannot be used.
+func JoinOrganization(ctx context.Context, db *sqlx.DB, userId uint64, code string) (uint64, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation": "JoinOrganization",
+		"UserID":    userId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	organizationID, err := RedeemAuthcode(ctx, tx, code)
+	if err != nil {
+		return 0, err
+	}
+	err = users.AddMembership(ctx, tx, organizationID, userId)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit membership")
+		return 0, err
+	}
+
+	// Success!
+	return organizationID, nil
+}
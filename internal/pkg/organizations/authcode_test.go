@@ -0,0 +1,29 @@
+package organizations
+
+import "bytes"
+
+func (suite *OrganizationsTestSuite) TestGenerateAuthcode() {
+	code, err := GenerateAuthcode()
+	suite.Nil(err, "Error generating authcode")
+	suite.Len(code, 24, "Expected a 24 character code")
+	suite.Nil((Organization{Name: "testorg", Slug: "testorg", Authcode: code}).Validate(), "Expected a generated code to be valid")
+
+	other, err := GenerateAuthcode()
+	suite.Nil(err, "Error generating authcode")
+	suite.NotEqual(code, other, "Expected each code to be different")
+}
+
+func (suite *OrganizationsTestSuite) TestHashAuthcode() {
+	suite.True(bytes.Equal(hashAuthcode("secretcode1234"), hashAuthcode("secretcode1234")), "Expected the hash to be stable")
+	suite.False(bytes.Equal(hashAuthcode("secretcode1234"), hashAuthcode("secretcode1235")), "Expected different codes to hash differently")
+	suite.Len(hashAuthcode(""), 32, "Expected a SHA-256 hash")
+}
+
+func (suite *OrganizationsTestSuite) TestOrganization_ValidateAuthcode() {
+	o := Organization{Name: "testorg", Slug: "testorg"}
+	suite.Nil(o.Validate(), "Expected an organization without an authcode to be valid, so that one is generated")
+
+	o.Authcode = "short"
+	validationErrs := o.Validate()
+	suite.Len(validationErrs.Errors, 1, "Expected a short authcode to be invalid")
+}
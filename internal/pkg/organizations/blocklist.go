@@ -0,0 +1,90 @@
+package organizations
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+const (
+	MaxBlockedTerms      = 200
+	MaxBlockedTermLength = 64
+)
+
+// NormalizeBlocklist lower-cases and trims the terms, dropping blanks and
+// duplicates, and checks that the list is within limits.
+func NormalizeBlocklist(terms []string) ([]string, error) {
+	seen := make(map[string]bool, len(terms))
+	normalized := make([]string, 0, len(terms))
+	for _, term := range terms {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term == "" || seen[term] {
+			continue
+		}
+		if len(term) > MaxBlockedTermLength {
+			return nil, fmt.Errorf("blocked terms may be at most %d characters", MaxBlockedTermLength)
+		}
+		seen[term] = true
+		normalized = append(normalized, term)
+	}
+	if len(normalized) > MaxBlockedTerms {
+		return nil, fmt.Errorf("at most %d terms may be blocked", MaxBlockedTerms)
+	}
+	return normalized, nil
+}
+
+// GetBlockedTerms fetches the terms the organization will not accept in
+// anonymous submissions.
+func GetBlockedTerms(ctx context.Context, db *sqlx.DB, organizationID uint64) ([]string, error) {
+	terms := make([]string, 0)
+	err := db.SelectContext(ctx, &terms, db.Rebind(selectBlockedTermsSql), organizationID)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+			"operation":      "GetBlockedTerms",
+			"OrganizationID": organizationID,
+		}).WithError(err).Error("Failed to select blocked terms")
+		return nil, err
+	}
+	return terms, nil
+}
+
+// SetBlockedTerms replaces the organization's blocklist. The terms should
+// already have been through NormalizeBlocklist.
+func SetBlockedTerms(ctx context.Context, db *sqlx.DB, organizationID uint64, terms []string) error {
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":      "SetBlockedTerms",
+		"OrganizationID": organizationID,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteBlockedTermsSql), organizationID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete blocked terms")
+		return err
+	}
+	for _, term := range terms {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertBlockedTermSql), organizationID, term)
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert blocked term")
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit blocked terms")
+		return err
+	}
+
+	// Success!
+	return nil
+}
@@ -0,0 +1,22 @@
+package organizations
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (suite *OrganizationsTestSuite) TestNormalizeBlocklist() {
+	terms, err := NormalizeBlocklist([]string{" Casino ", "casino", "", "Cheap Pills"})
+	suite.NoError(err)
+	suite.Equal([]string{"casino", "cheap pills"}, terms)
+
+	_, err = NormalizeBlocklist([]string{strings.Repeat("a", MaxBlockedTermLength+1)})
+	suite.Error(err, "Expected an overlong term to be refused")
+
+	tooMany := make([]string, MaxBlockedTerms+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("term%d", i)
+	}
+	_, err = NormalizeBlocklist(tooMany)
+	suite.Error(err, "Expected too many terms to be refused")
+}
@@ -2,6 +2,7 @@ package organizations
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
@@ -24,29 +25,65 @@ func ListOrganizations(ctx context.Context, db *sqlx.DB) ([]Organization, error)
 	return organizationSet, nil
 }
 
+// DescribeOrganization fetches the organization, with its contact user and
+// emergency contacts. Returns sql.ErrNoRows if it does not exist.
 func DescribeOrganization(ctx context.Context, db *sqlx.DB, organizationID int64) (*Organization, error) {
-	sqlStmt := db.Rebind(describeOrganizationSql)
+	return describeOrganization(ctx, db, describeOrganizationSql, organizationID)
+}
+func DescribeOrganizationBySlug(ctx context.Context, db *sqlx.DB, slug string) (*Organization, error) {
+	return describeOrganization(ctx, db, describeOrganizationBySlugSql, slug)
+}
+
+func describeOrganization(ctx context.Context, db *sqlx.DB, query string, arg interface{}) (*Organization, error) {
+	sqlStmt := db.Rebind(query)
 	var orgRow OrganizationDbRow
-	err := db.Get(&orgRow, sqlStmt, organizationID)
+	err := db.Get(&orgRow, sqlStmt, arg)
 	if err != nil {
 		return nil, err
 	}
 
 	org := orgRow.CopyToOrganization()
+	org.EmergencyContacts, err = GetEmergencyContacts(ctx, db, org.Id)
+	if err != nil {
+		return nil, err
+	}
 	return org, nil
 }
-func DescribeOrganizationBySlug(ctx context.Context, db *sqlx.DB, slug string) (*Organization, error) {
-	sqlStmt := db.Rebind(describeOrganizationBySlugSql)
-	var orgRow OrganizationDbRow
-	err := db.Get(&orgRow, sqlStmt, slug)
+
+// GetEmergencyContacts fetches the organization's emergency contacts, in the
+// order to try them.
+func GetEmergencyContacts(ctx context.Context, db *sqlx.DB, organizationID uint64) ([]Contact, error) {
+	contacts := make([]Contact, 0)
+	err := db.SelectContext(ctx, &contacts, db.Rebind(selectEmergencyContactsSql), organizationID)
 	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+			"operation":      "GetEmergencyContacts",
+			"OrganizationID": organizationID,
+		}).WithError(err).Error("Failed to select emergency contacts")
 		return nil, err
 	}
+	return contacts, nil
+}
 
-	org := orgRow.CopyToOrganization()
-	return org, nil
+// setEmergencyContacts replaces the organization's emergency contacts.
+func setEmergencyContacts(ctx context.Context, tx *sqlx.Tx, organizationID uint64, contacts []Contact) error {
+	_, err := tx.ExecContext(ctx, tx.Rebind(deleteEmergencyContactsSql), organizationID)
+	if err != nil {
+		return err
+	}
+	for i, contact := range contacts {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertEmergencyContactSql),
+			organizationID, i, contact.Name, contact.Phone, contact.Email, contact.Role)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// Create saves a new organization, generating an authcode for it if it does
+// not have one. Returns ErrDuplicateAuthcode if another organization already
+// uses the authcode.
 func (o *Organization) Create(ctx context.Context, db *sqlx.DB) error {
 	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
 		"operation":        "Organization.Create",
@@ -59,9 +96,29 @@ func (o *Organization) Create(ctx context.Context, db *sqlx.DB) error {
 		return fmt.Errorf("cannot save - organiztaion failed validation with %d errors: %v", len(errorSet.Errors), errorSet)
 	}
 
-	sqlStmt := db.Rebind(createOrganizationSql)
-	rows, err := db.NamedQueryContext(ctx, sqlStmt, o)
+	if o.Authcode == "" {
+		code, err := GenerateAuthcode()
+		if err != nil {
+			logger.WithError(err).Error("Failed to generate authcode")
+			return err
+		}
+		o.Authcode = code
+	}
+	o.AuthcodeHash = hashAuthcode(o.Authcode)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStmt := tx.Rebind(createOrganizationSql)
+	rows, err := tx.NamedQuery(sqlStmt, o)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateAuthcode
+		}
 		logger.WithError(err).Error("Failed to insert organization")
 		return err
 	}
@@ -70,14 +127,32 @@ func (o *Organization) Create(ctx context.Context, db *sqlx.DB) error {
 		return errors.New("no rows returned from insert")
 	}
 	var newId int64
+	o.AuthcodeStatus = &AuthcodeStatus{}
 	for rows.Next() {
-		rows.Scan(&newId)
+		rows.Scan(&newId, &o.AuthcodeStatus.RotatedAt)
 	}
+	rows.Close()
 	o.Id = uint64(newId)
 
+	err = setEmergencyContacts(ctx, tx, o.Id, o.EmergencyContacts)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert emergency contacts")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit organization")
+		return err
+	}
+
 	return nil
 }
 
+// Update saves the organization's fields, and replaces its emergency contacts
+// unless EmergencyContacts is nil. Returns ErrContactNotMember if the contact
+// user is not an active member. The geofence policy, default locale, email
+// sender and branding are settings, and are left unchanged when empty; clear
+// them with UpdateSettings. Returns sql.ErrNoRows if it does not exist.
 func (o *Organization) Update(ctx context.Context, db *sqlx.DB) error {
 	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
 		"operation":        "Organization.Update",
@@ -90,32 +165,55 @@ func (o *Organization) Update(ctx context.Context, db *sqlx.DB) error {
 		return fmt.Errorf("cannot save - organiztaion failed validation with %d errors: %v", len(errorSet.Errors), errorSet)
 	}
 
-	sqlStmt := db.Rebind(updateOrganizationSql)
-	_, err := db.NamedExec(sqlStmt, o)
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
-		logger.WithError(err).Error("Failed to update organization")
+		logger.WithError(err).Error("Failed to begin transaction")
 		return err
 	}
+	defer tx.Rollback()
 
-	// Success!
-	return nil
-}
-
-func DeleteOrganization(ctx context.Context, organizationID uint64, db *sqlx.DB) error {
-	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
-		"operation":      "DeleteOrganization",
-		"OrganizationID": organizationID,
-	})
+	// The contact user is shown to anyone who looks up the organization, so
+	// it must be one of its own members
+	if o.ContactUserId != 0 {
+		var isMember bool
+		err = tx.GetContext(ctx, &isMember, tx.Rebind(isActiveMemberSql), o.Id, o.ContactUserId)
+		if err != nil {
+			logger.WithError(err).Error("Failed to check contact user's membership")
+			return err
+		}
+		if !isMember {
+			return ErrContactNotMember
+		}
+	}
 
-	org := Organization{
-		Id: organizationID,
+	sqlStmt := tx.Rebind(updateOrganizationSql)
+	result, err := tx.NamedExec(sqlStmt, o)
+	if err != nil {
+		logger.WithError(err).Error("Failed to update organization")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	if o.EmergencyContacts != nil {
+		err = setEmergencyContacts(ctx, tx, o.Id, o.EmergencyContacts)
+		if err != nil {
+			logger.WithError(err).Error("Failed to replace emergency contacts")
+			return err
+		}
+	}
+	// Some of the organization's fields are also settings
+	_, err = tx.ExecContext(ctx, tx.Rebind(bumpSettingsVersionSql), o.Id)
+	if err != nil {
+		logger.WithError(err).Error("Failed to bump settings version")
+		return err
 	}
-	sqlStmt := db.Rebind(deleteOrganizationNullFkeysSql)
-	_, err := db.NamedExec(sqlStmt, &org)
+	err = tx.Commit()
 	if err != nil {
-		logger.WithError(err).Error("Error deleting organization")
+		logger.WithError(err).Error("Failed to commit organization")
 		return err
 	}
+	filters.ForgetCachedValue(ctx, settingsCacheKey(o.Id))
 
 	// Success!
 	return nil
@@ -0,0 +1,140 @@
+package organizations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// DefaultRetention is how long a deleted organization is kept, restorable,
+// before it is purged.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// DeletedOrganization is an organization waiting to be purged.
+type DeletedOrganization struct {
+	Id         uint64    `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	Slug       string    `json:"slug" db:"slug"`
+	DeletedAt  time.Time `json:"deleted_at" db:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after" db:"purge_after"`
+}
+
+// DeleteOrganization hides the organization, and schedules it to be purged
+// once the retention period is up. Until then a site admin may restore it.
+// Returns when it will be purged, or sql.ErrNoRows if it does not exist or
+// is already deleted.
+func DeleteOrganization(ctx context.Context, organizationID uint64, retention time.Duration, db *sqlx.DB) (time.Time, error) {
+	var purgeAfter time.Time
+	err := db.GetContext(ctx, &purgeAfter, db.Rebind(softDeleteOrganizationSql), time.Now().Add(retention), organizationID)
+	if err != nil && err != sql.ErrNoRows {
+		filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+			"operation":      "DeleteOrganization",
+			"OrganizationID": organizationID,
+		}).WithError(err).Error("Error deleting organization")
+	}
+	return purgeAfter, err
+}
+
+// RestoreOrganization undoes DeleteOrganization. Returns sql.ErrNoRows if
+// the organization is not waiting to be purged.
+func RestoreOrganization(ctx context.Context, db *sqlx.DB, organizationID uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(restoreOrganizationSql), organizationID)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+			"operation":      "RestoreOrganization",
+			"OrganizationID": organizationID,
+		}).WithError(err).Error("Error restoring organization")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CheckActive returns sql.ErrNoRows if the organization does not exist or
+// has been deleted, so that anything belonging to it can be treated as gone
+// too. The answer is cached for the rest of the request along with the
+// organization's settings.
+func CheckActive(ctx context.Context, db *sqlx.DB, organizationID uint64) error {
+	_, err := GetSettings(ctx, db, organizationID)
+	return err
+}
+
+// ListDeletedOrganizations fetches the organizations waiting to be purged,
+// soonest first.
+func ListDeletedOrganizations(ctx context.Context, db *sqlx.DB) ([]DeletedOrganization, error) {
+	organizationSet := make([]DeletedOrganization, 0)
+	err := db.SelectContext(ctx, &organizationSet, listDeletedOrganizationsSql)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("operation", "ListDeletedOrganizations").WithError(err).Error("Failed to select deleted organizations")
+		return nil, err
+	}
+	return organizationSet, nil
+}
+
+// Purger removes deleted organizations, and everything that belongs to them,
+// once their retention period is up.
+type Purger struct {
+	db *sqlx.DB
+}
+
+func NewPurger(db *sqlx.DB) *Purger {
+	return &Purger{db: db}
+}
+
+// PurgeDue purges every organization whose retention period is up. It is run
+// as a scheduled job.
+func (p *Purger) PurgeDue(ctx context.Context) error {
+	for {
+		purged, err := p.purgeOne(ctx)
+		if err != nil || !purged {
+			return err
+		}
+	}
+}
+
+// purgeOne claims and purges one organization in a transaction, so that it
+// is removed entirely or not at all. It reports whether there was one.
+func (p *Purger) purgeOne(ctx context.Context) (bool, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation": "Purger.PurgeDue",
+	})
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var organizationID uint64
+	err = tx.GetContext(ctx, &organizationID, claimPurgeableOrganizationSql)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim organization")
+		return false, err
+	}
+	logger = logger.WithField("OrganizationID", organizationID)
+
+	for _, stmt := range purgeOrganizationSql {
+		_, err = tx.ExecContext(ctx, tx.Rebind(stmt), organizationID)
+		if err != nil {
+			logger.WithError(err).WithField("SQL", stmt).Error("Failed to purge organization")
+			return false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit purge")
+		return false, err
+	}
+
+	logger.Info("Purged organization")
+	return true, nil
+}
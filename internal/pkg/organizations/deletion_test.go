@@ -0,0 +1,80 @@
+package organizations
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+func (suite *OrganizationsTestSuite) TestPurgeOrganizationSql() {
+	for _, stmt := range purgeOrganizationSql {
+		suite.Equalf(1, strings.Count(stmt, "?"), "Expected each purge statement to take only the organization ID: %s", stmt)
+	}
+	last := purgeOrganizationSql[len(purgeOrganizationSql)-1]
+	suite.Equal("DELETE FROM organizations WHERE id = ?", last, "Expected the organization to be deleted after everything that refers to it")
+}
+
+func (suite *OrganizationsDatabaseTestSuite) countRows(query string, args ...interface{}) int {
+	var n int
+	err := suite.Config.GetDbConn().Get(&n, query, args...)
+	suite.Require().Nil(err)
+	return n
+}
+
+func (suite *OrganizationsDatabaseTestSuite) TestPurger_PurgeDue() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+
+	// testorg1 was deleted past its retention period, testorg3 is still
+	// within it. Each has a site, along with the fixtures' roles and
+	// memberships.
+	_, err := db.Exec(`INSERT INTO sites (organization_id, slug, name_l10n, locale) VALUES (1, 'testsite1', 'Test Site 1', 'en'), (3, 'testsite3', 'Test Site 3', 'en')`)
+	suite.Require().Nil(err)
+	_, err = db.Exec(`UPDATE organizations SET deleted_at = now() - interval '31 days', purge_after = now() - interval '1 day' WHERE id = 1`)
+	suite.Require().Nil(err)
+	_, err = DeleteOrganization(ctx, 3, DefaultRetention, db)
+	suite.Require().Nil(err)
+
+	err = NewPurger(db).PurgeDue(ctx)
+	suite.Require().Nil(err)
+
+	suite.Equal(0, suite.countRows(`SELECT count(*) FROM organizations WHERE id = 1`), "Expected testorg1 to be purged")
+	suite.Equal(0, suite.countRows(`SELECT count(*) FROM roles WHERE org_id = 1`), "Expected testorg1's roles to be purged")
+	suite.Equal(0, suite.countRows(`SELECT count(*) FROM organization_memberships WHERE organization_id = 1`), "Expected testorg1's memberships to be purged")
+	suite.Equal(0, suite.countRows(`SELECT count(*) FROM sites WHERE organization_id = 1`), "Expected testorg1's sites to be purged")
+	suite.Equal(4, suite.countRows(`SELECT count(*) FROM users`), "Expected the members themselves to be kept")
+
+	suite.Equal(1, suite.countRows(`SELECT count(*) FROM organizations WHERE id = 3`), "Expected testorg3 to be kept until its retention period is up")
+	suite.Equal(1, suite.countRows(`SELECT count(*) FROM roles WHERE org_id = 3`))
+	suite.Equal(1, suite.countRows(`SELECT count(*) FROM organization_memberships WHERE organization_id = 3`))
+	suite.Equal(1, suite.countRows(`SELECT count(*) FROM sites WHERE organization_id = 3`))
+
+	deleted, err := ListDeletedOrganizations(ctx, db)
+	suite.Require().Nil(err)
+	suite.Require().Len(deleted, 1)
+	suite.Equal(uint64(3), deleted[0].Id)
+
+	// Nothing else is due, so another run is a no-op.
+	err = NewPurger(db).PurgeDue(ctx)
+	suite.Require().Nil(err)
+	suite.Equal(1, suite.countRows(`SELECT count(*) FROM organizations WHERE id = 3`))
+}
+
+func (suite *OrganizationsDatabaseTestSuite) TestRestoreOrganization() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+
+	purgeAfter, err := DeleteOrganization(ctx, 2, DefaultRetention, db)
+	suite.Require().Nil(err)
+	suite.True(purgeAfter.After(time.Now().Add(DefaultRetention-time.Hour)), "Expected the organization to be kept for the retention period")
+	suite.Equal(sql.ErrNoRows, CheckActive(ctx, db, 2), "Expected a deleted organization to be inactive")
+
+	err = RestoreOrganization(ctx, db, 2)
+	suite.Require().Nil(err)
+	suite.Equal(0, suite.countRows(`SELECT count(*) FROM organizations WHERE id = 2 AND (deleted_at IS NOT NULL OR purge_after IS NOT NULL)`), "Expected restoring to clear deleted_at and purge_after")
+	suite.Nil(CheckActive(ctx, db, 2))
+
+	err = RestoreOrganization(ctx, db, 2)
+	suite.Equal(sql.ErrNoRows, err, "Expected an organization that is not deleted to not be restorable")
+}
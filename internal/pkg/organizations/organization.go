@@ -6,67 +6,178 @@ import (
 	"fmt"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"net/mail"
 	"regexp"
+	"strings"
 )
 
 type Organization struct {
-	Id       uint64 `json:"id" db:"id"`
-	Name     string `json:"name" db:"name"`
-	Slug     string `json:"slug" db:"slug"`
-	Authcode string `json:"authcode" db:"authcode"`
+	Id   uint64 `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	Slug string `json:"slug" db:"slug"`
+
+	// Only a hash of the authcode is stored. The code itself is only known
+	// when the organization is created, or its code rotated.
+	Authcode       string          `json:"authcode,omitempty" db:"-"`
+	AuthcodeHash   []byte          `json:"-" db:"authcode_hash"`
+	AuthcodeStatus *AuthcodeStatus `json:"authcode_status,omitempty"` // for the organization's admins only
 
 	// Contact info
-	ContactUserId uint64      `json:"contact_user_id" db:"contact_user_id"`
-	ContactUser   *users.User `json:"contact"`
+	ContactUserId     uint64      `json:"contact_user_id" db:"contact_user_id"`
+	ContactUser       *users.User `json:"contact"`
+	ContactInfo       Contact     `json:"contact_info" db:"contact"`
+	EmergencyContacts []Contact   `json:"emergency_contacts"` // in the order to try them. Left alone by Update if nil
 
 	// Geographical Center - used for map view defaults
 	Latitude  float64 `json:"lat" db:"lat"`
 	Longitude float64 `json:"lon" db:"lon"`
+
+	// What to do with clock-ins from outside a site's geofence
+	GeofencePolicy string `json:"geofence_policy" db:"geofence_policy"`
+
+	// Locale for messages about sites that do not set their own
+	DefaultLocale string `json:"default_locale" db:"default_locale"`
+
+	// Branding for email sent on the organization's behalf. Empty fields
+	// fall back to the service defaults.
+	EmailFromAddress string `json:"email_from_address" db:"email_from_address"`
+	EmailFromName    string `json:"email_from_name" db:"email_from_name"`
+	BrandColor       string `json:"brand_color" db:"brand_color"` // #rrggbb
+	LogoUrl          string `json:"logo_url" db:"logo_url"`
+}
+
+// Contact is a person to get in touch with about an Organization.
+type Contact struct {
+	Name  string `json:"name" db:"name"`
+	Phone string `json:"phone" db:"phone"` // E.164, such as +12065550123
+	Email string `json:"email" db:"email"`
+	Role  string `json:"role" db:"role"` // such as "Site Coordinator"
+}
+
+const (
+	MaxEmergencyContacts  = 5
+	MaxContactNameLength  = 128
+	MaxContactEmailLength = 128
+	MaxContactRoleLength  = 64
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+var ErrContactNotMember = errors.New("contact_user_id must be an active member of the organization")
+
+// isEmailAddress reports whether s is a bare email address, without a
+// display name.
+func isEmailAddress(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
 }
 
+// validate checks the contact's fields, naming them after field in the
+// errors. Emergency contacts must have a name and a phone number.
+func (c Contact) validate(field string, emergency bool) []error {
+	errSet := make([]error, 0)
+	if len(c.Name) > MaxContactNameLength {
+		errSet = append(errSet, fmt.Errorf("%s.name may be at most %d characters", field, MaxContactNameLength))
+	} else if emergency && len(strings.TrimSpace(c.Name)) == 0 {
+		errSet = append(errSet, fmt.Errorf("%s.name must be present", field))
+	}
+	if len(c.Phone) > 0 && !e164Pattern.MatchString(c.Phone) {
+		errSet = append(errSet, fmt.Errorf("%s.phone must be in E.164 format, such as +12065550123", field))
+	} else if emergency && len(c.Phone) == 0 {
+		errSet = append(errSet, fmt.Errorf("%s.phone must be present", field))
+	}
+	if len(c.Email) > MaxContactEmailLength || (len(c.Email) > 0 && !isEmailAddress(c.Email)) {
+		errSet = append(errSet, fmt.Errorf("%s.email must be an email address of at most %d characters", field, MaxContactEmailLength))
+	}
+	if len(c.Role) > MaxContactRoleLength {
+		errSet = append(errSet, fmt.Errorf("%s.role may be at most %d characters", field, MaxContactRoleLength))
+	}
+	return errSet
+}
+
+// Geofence policies, deciding what happens to a clock-in punched from outside
+// the site's radius.
+const (
+	GeofenceReject = "reject" // refuse the clock-in
+	GeofenceFlag   = "flag"   // accept it, but flag it for manager review
+	GeofenceAllow  = "allow"  // accept it as normal
+)
+
 type OrganizationDbRow struct {
-	Id       uint64 `json:"id" db:"id"`
-	Name     string `json:"name" db:"name"`
-	Slug     string `json:"slug" db:"slug"`
-	Authcode string `json:"authcode" db:"authcode"`
+	Id   uint64 `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	Slug string `json:"slug" db:"slug"`
+
+	AuthcodeStatus
 
 	// Contact info
-	ContactUserId sql.NullInt64 `json:"contact_user_id" db:"contact_user_id"`
+	ContactUserId    sql.NullInt64  `json:"contact_user_id" db:"contact_user_id"`
+	ContactUserGuid  sql.NullString `json:"-" db:"contact_user_guid"`
+	ContactUserEmail sql.NullString `json:"-" db:"contact_user_email"`
+	ContactInfo      Contact        `json:"contact_info" db:"contact"`
 
 	// Geographical Center - used for map view defaults
 	Latitude  float64 `json:"lat" db:"lat"`
 	Longitude float64 `json:"lon" db:"lon"`
+
+	GeofencePolicy string `json:"geofence_policy" db:"geofence_policy"`
+
+	DefaultLocale    string `json:"default_locale" db:"default_locale"`
+	EmailFromAddress string `json:"email_from_address" db:"email_from_address"`
+	EmailFromName    string `json:"email_from_name" db:"email_from_name"`
+	BrandColor       string `json:"brand_color" db:"brand_color"`
+	LogoUrl          string `json:"logo_url" db:"logo_url"`
 }
 
 func (row OrganizationDbRow) CopyToOrganization() *Organization {
 	o := Organization{
-		Id:            row.Id,
-		Name:          row.Name,
-		Slug:          row.Slug,
-		Authcode:      row.Authcode,
-		ContactUserId: 0,
-		Latitude:      row.Latitude,
-		Longitude:     row.Longitude,
+		Id:             row.Id,
+		Name:           row.Name,
+		Slug:           row.Slug,
+		ContactUserId:  0,
+		ContactInfo:    row.ContactInfo,
+		Latitude:       row.Latitude,
+		Longitude:      row.Longitude,
+		GeofencePolicy: row.GeofencePolicy,
+
+		DefaultLocale:    row.DefaultLocale,
+		EmailFromAddress: row.EmailFromAddress,
+		EmailFromName:    row.EmailFromName,
+		BrandColor:       row.BrandColor,
+		LogoUrl:          row.LogoUrl,
 	}
 
+	status := row.AuthcodeStatus
+	o.AuthcodeStatus = &status
 	if row.ContactUserId.Valid {
 		o.ContactUserId = uint64(row.ContactUserId.Int64)
 	}
+	if row.ContactUserGuid.Valid {
+		o.ContactUser = &users.User{
+			Id:    o.ContactUserId,
+			Guid:  row.ContactUserGuid.String,
+			Email: row.ContactUserEmail.String,
+		}
+	}
 	return &o
 }
 
 func New() *Organization {
 	return &Organization{
-		Id:            0,
-		Name:          "",
-		Slug:          "",
-		Authcode:      "",
-		ContactUserId: 0,
-		Latitude:      0,
-		Longitude:     0,
+		Id:             0,
+		Name:           "",
+		Slug:           "",
+		Authcode:       "",
+		ContactUserId:  0,
+		Latitude:       0,
+		Longitude:      0,
+		GeofencePolicy: GeofenceFlag,
+		DefaultLocale:  "en",
 	}
 }
 
+var brandColorPattern = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+
 func (o Organization) Validate() (errs *config.ErrorSet) {
 	errSet := make([]error, 0)
 	if len(o.Name) == 0 {
@@ -85,8 +196,32 @@ func (o Organization) Validate() (errs *config.ErrorSet) {
 	if !pattern.Match([]byte(o.Slug)) {
 		errSet = append(errSet, errors.New("slug must match pattern /^[a-z0-9]+(?:-[a-z0-9]+)*$/"))
 	}
-	if len(o.Authcode) == 0 {
-		errSet = append(errSet, errors.New("authcode must be present"))
+	if len(o.Authcode) > 0 && (len(o.Authcode) < MinAuthcodeLength || len(o.Authcode) > MaxAuthcodeLength) {
+		errSet = append(errSet, fmt.Errorf("authcode must be between %d and %d characters, or left out to generate one", MinAuthcodeLength, MaxAuthcodeLength))
+	}
+	switch o.GeofencePolicy {
+	case "", GeofenceReject, GeofenceFlag, GeofenceAllow:
+	default:
+		errSet = append(errSet, errors.New("geofence_policy must be one of reject, flag or allow"))
+	}
+	if len(o.EmailFromAddress) > 128 || (len(o.EmailFromAddress) > 0 && !strings.Contains(o.EmailFromAddress, "@")) {
+		errSet = append(errSet, errors.New("email_from_address must be an email address of at most 128 characters"))
+	}
+	if len(o.EmailFromName) > 128 {
+		errSet = append(errSet, errors.New("email_from_name may be at most 128 characters"))
+	}
+	if len(o.BrandColor) > 0 && !brandColorPattern.MatchString(o.BrandColor) {
+		errSet = append(errSet, errors.New("brand_color must be given as #rrggbb"))
+	}
+	if len(o.LogoUrl) > 512 || (len(o.LogoUrl) > 0 && !strings.HasPrefix(o.LogoUrl, "https://")) {
+		errSet = append(errSet, errors.New("logo_url must be an https URL of at most 512 characters"))
+	}
+	errSet = append(errSet, o.ContactInfo.validate("contact_info", false)...)
+	if len(o.EmergencyContacts) > MaxEmergencyContacts {
+		errSet = append(errSet, fmt.Errorf("at most %d emergency contacts may be given", MaxEmergencyContacts))
+	}
+	for i, contact := range o.EmergencyContacts {
+		errSet = append(errSet, contact.validate(fmt.Sprintf("emergency_contacts[%d]", i), true)...)
 	}
 
 	if len(errSet) == 0 {
@@ -44,4 +44,56 @@ func (suite *OrganizationsTestSuite) TestOrganization_Validate() {
 
 	validationErrs = o.Validate()
 	suite.Less(0, len(validationErrs.Errors), fmt.Sprintf("Expected slug '%s' to be invalid, but successfully validated", o.Slug))
+
+	// Set invalid branding
+	o = &Organization{
+		Name:             "testorg",
+		Slug:             "testorg",
+		Authcode:         "supersecret",
+		EmailFromAddress: "not-an-address",
+		BrandColor:       "red",
+		LogoUrl:          "http://example.com/logo.png",
+	}
+	validationErrs = o.Validate()
+	suite.Len(validationErrs.Errors, 3, "Expected the from address, brand color and logo URL to be invalid")
+}
+
+func (suite *OrganizationsTestSuite) TestOrganization_ValidateContacts() {
+	o := &Organization{
+		Name:     "testorg",
+		Slug:     "testorg",
+		Authcode: "supersecret",
+		ContactInfo: Contact{
+			Name:  "Pat Doe",
+			Phone: "+12065550123",
+			Email: "pat@example.org",
+			Role:  "Coordinator",
+		},
+		EmergencyContacts: []Contact{
+			{Name: "Front Desk", Phone: "+442071838750"},
+		},
+	}
+	validationErrs := o.Validate()
+	suite.Nilf(validationErrs, "Expected nil errorset, got %+v", validationErrs)
+
+	// The primary contact may be left empty, but emergency contacts need a
+	// name and phone number
+	o.ContactInfo = Contact{}
+	o.EmergencyContacts = []Contact{{Email: "desk@example.org"}}
+	validationErrs = o.Validate()
+	suite.Len(validationErrs.Errors, 2, "Expected the emergency contact's missing name and phone to be invalid")
+
+	// Phone numbers must be E.164 and email addresses must be bare
+	o.ContactInfo = Contact{Name: "Pat Doe", Phone: "206-555-0123", Email: "Pat <pat@example.org>"}
+	o.EmergencyContacts = []Contact{{Name: "Front Desk", Phone: "+0123"}}
+	validationErrs = o.Validate()
+	suite.Len(validationErrs.Errors, 3, "Expected both phone numbers and the email address to be invalid")
+
+	o.ContactInfo = Contact{}
+	o.EmergencyContacts = make([]Contact, MaxEmergencyContacts+1)
+	for i := range o.EmergencyContacts {
+		o.EmergencyContacts[i] = Contact{Name: "Front Desk", Phone: "+12065550123"}
+	}
+	validationErrs = o.Validate()
+	suite.Len(validationErrs.Errors, 1, "Expected too many emergency contacts to be invalid")
 }
@@ -2,25 +2,164 @@ package organizations
 
 const createOrganizationSql = `
 INSERT INTO organizations 
-		(name, slug, authcode, contact_user_id, lat, lon) 
+		(name, slug, authcode_hash, contact_user_id, lat, lon, geofence_policy,
+		default_locale, email_from_address, email_from_name, brand_color, logo_url,
+		contact_name, contact_phone, contact_email, contact_role) 
 	VALUES 
-		(:name, :slug, :authcode, :contact_user_id, :lat, :lon)
-RETURNING id`
+		(:name, :slug, :authcode_hash, :contact_user_id, :lat, :lon, COALESCE(NULLIF(:geofence_policy, ''), 'flag'),
+		COALESCE(NULLIF(:default_locale, ''), 'en'), :email_from_address, :email_from_name, :brand_color, :logo_url,
+		:contact.name, :contact.phone, :contact.email, :contact.role)
+RETURNING id, authcode_rotated_at`
 const updateOrganizationSql = `
 UPDATE organizations 
 SET 
 	name=:name,
 	slug=:slug,
-	authcode=:authcode,
 	contact_user_id=:contact_user_id,
 	lat=:lat,
-	lon=:lon
-WHERE id=:id`
-const deleteOrganizationNullFkeysSql = `
-	UPDATE sites SET organization_id=0 WHERE organization_id=:id; 
-	UPDATE users SET organization_id=0 WHERE organization_id=:id; 
-	DELETE FROM organizations WHERE id=:id LIMIT 1
+	lon=:lon,
+	geofence_policy=COALESCE(NULLIF(:geofence_policy, ''), geofence_policy),
+	default_locale=COALESCE(NULLIF(:default_locale, ''), default_locale),
+	email_from_address=COALESCE(NULLIF(:email_from_address, ''), email_from_address),
+	email_from_name=COALESCE(NULLIF(:email_from_name, ''), email_from_name),
+	brand_color=COALESCE(NULLIF(:brand_color, ''), brand_color),
+	logo_url=COALESCE(NULLIF(:logo_url, ''), logo_url),
+	contact_name=:contact.name,
+	contact_phone=:contact.phone,
+	contact_email=:contact.email,
+	contact_role=:contact.role
+WHERE id=:id AND deleted_at IS NULL`
+const isActiveMemberSql = `SELECT EXISTS (SELECT 1 FROM organization_memberships WHERE organization_id=? AND user_id=? AND status='active')`
+const listOrganizationsSql = `SELECT id, name, slug, contact_user_id, lat, lon, geofence_policy, default_locale, email_from_address, email_from_name, brand_color, logo_url,
+	contact_name AS "contact.name", contact_phone AS "contact.phone", contact_email AS "contact.email", contact_role AS "contact.role"
+FROM organizations
+WHERE deleted_at IS NULL`
+const listDeletedOrganizationsSql = `SELECT id, name, slug, deleted_at, purge_after FROM organizations WHERE deleted_at IS NOT NULL ORDER BY purge_after`
+
+// The contact user is joined in, if there is one.
+const selectOrganizationColumns = `
+SELECT
+	organizations.id, organizations.name, organizations.slug, organizations.contact_user_id,
+	organizations.lat, organizations.lon, organizations.geofence_policy, organizations.default_locale,
+	organizations.email_from_address, organizations.email_from_name, organizations.brand_color, organizations.logo_url,
+	organizations.contact_name AS "contact.name", organizations.contact_phone AS "contact.phone",
+	organizations.contact_email AS "contact.email", organizations.contact_role AS "contact.role",
+	contact_users.user_guid AS contact_user_guid, contact_users.email AS contact_user_email,
+	organizations.authcode_expires_at, organizations.authcode_max_uses, organizations.authcode_uses,
+	organizations.authcode_rotated_at
+FROM organizations
+	LEFT JOIN users AS contact_users ON contact_users.id = organizations.contact_user_id
 `
-const listOrganizationsSql = `SELECT id, name, slug, authcode, contact_user_id, lat, lon FROM organizations`
-const describeOrganizationSql = `SELECT id, name, slug, authcode, contact_user_id, lat, lon FROM organizations WHERE id=?`
-const describeOrganizationBySlugSql = `SELECT id, name, slug, authcode, contact_user_id, lat, lon FROM organizations WHERE slug=?`
+const describeOrganizationSql = selectOrganizationColumns + `WHERE organizations.id=? AND organizations.deleted_at IS NULL`
+const describeOrganizationBySlugSql = selectOrganizationColumns + `WHERE organizations.slug=? AND organizations.deleted_at IS NULL`
+
+const rotateAuthcodeSql = `
+	UPDATE organizations SET
+		authcode_hash = ?,
+		authcode_expires_at = ?,
+		authcode_max_uses = ?,
+		authcode_uses = 0,
+		authcode_rotated_at = now()
+	WHERE id = ? AND deleted_at IS NULL
+	RETURNING authcode_expires_at, authcode_max_uses, authcode_uses, authcode_rotated_at`
+const redeemAuthcodeSql = `
+	UPDATE organizations SET authcode_uses = authcode_uses + 1
+	WHERE authcode_hash = ?
+		AND deleted_at IS NULL
+		AND (authcode_expires_at IS NULL OR authcode_expires_at > now())
+		AND (authcode_max_uses IS NULL OR authcode_uses < authcode_max_uses)
+	RETURNING id`
+
+const softDeleteOrganizationSql = `
+	UPDATE organizations SET deleted_at = now(), purge_after = ?
+	WHERE id = ? AND deleted_at IS NULL
+	RETURNING purge_after`
+const restoreOrganizationSql = `
+	UPDATE organizations SET deleted_at = NULL, purge_after = NULL
+	WHERE id = ? AND deleted_at IS NOT NULL`
+const claimPurgeableOrganizationSql = `
+	SELECT id FROM organizations
+	WHERE purge_after <= now()
+	ORDER BY purge_after
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED`
+
+// purgeOrganizationSql removes everything belonging to an organization,
+// children first. Each statement takes the organization ID. Users are kept,
+// since they may belong to other organizations.
+var purgeOrganizationSql = []string{
+	`DELETE FROM shift_reminders WHERE signup_id IN (
+		SELECT shift_signups.id FROM shift_signups INNER JOIN shifts ON shifts.id = shift_signups.shift_id
+		WHERE shifts.organization_id = ?)`,
+	`DELETE FROM shift_signups WHERE shift_id IN (SELECT id FROM shifts WHERE organization_id = ?)`,
+	`DELETE FROM work_log_events WHERE work_log_id IN (SELECT id FROM work_logs WHERE organization_id = ?)`,
+	`DELETE FROM work_logs WHERE organization_id = ?`,
+	`DELETE FROM shifts WHERE organization_id = ?`,
+	`DELETE FROM site_coordinators WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM daily_schedules WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM user_preferred_sites WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM site_checkin_keys WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM kiosk_devices WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM site_subscriptions WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`DELETE FROM site_features WHERE site_id IN (SELECT id FROM sites WHERE organization_id = ?)`,
+	`UPDATE notifications SET broadcast_id = NULL WHERE broadcast_id IN (SELECT id FROM broadcasts WHERE organization_id = ?)`,
+	`DELETE FROM broadcast_recipients WHERE broadcast_id IN (SELECT id FROM broadcasts WHERE organization_id = ?)`,
+	`DELETE FROM broadcasts WHERE organization_id = ?`,
+	`DELETE FROM suggestions WHERE organization_id = ?`,
+	`DELETE FROM certificates WHERE organization_id = ?`,
+	`DELETE FROM organization_blocked_terms WHERE organization_id = ?`,
+	`DELETE FROM teams WHERE organization_id = ?`,
+	`DELETE FROM webhooks WHERE organization_id = ?`,
+	`DELETE FROM roles WHERE org_id = ?`,
+	`UPDATE users SET organization_id = NULL WHERE organization_id = ?`,
+	`DELETE FROM sites WHERE organization_id = ?`,
+	`DELETE FROM organizations WHERE id = ?`,
+}
+
+const selectEmergencyContactsSql = `SELECT name, phone, email, role FROM organization_emergency_contacts WHERE organization_id=? ORDER BY position`
+const deleteEmergencyContactsSql = `DELETE FROM organization_emergency_contacts WHERE organization_id=?`
+const insertEmergencyContactSql = `INSERT INTO organization_emergency_contacts (organization_id, position, name, phone, email, role) VALUES (?, ?, ?, ?, ?, ?)`
+
+const selectBlockedTermsSql = `SELECT term FROM organization_blocked_terms WHERE organization_id=? ORDER BY term`
+const deleteBlockedTermsSql = `DELETE FROM organization_blocked_terms WHERE organization_id=?`
+const insertBlockedTermSql = `INSERT INTO organization_blocked_terms (organization_id, term) VALUES (?, ?)`
+
+// Organizations without a settings row have NULLs here, for the defaults.
+const selectSettingsSql = `
+SELECT
+	organizations.id AS organization_id, organizations.geofence_policy, organizations.default_locale,
+	organizations.email_from_address, organizations.email_from_name, organizations.brand_color, organizations.logo_url,
+	organization_settings.version, organization_settings.timezone, organization_settings.self_signup,
+	organization_settings.work_log_approval, organization_settings.max_weekly_hours, organization_settings.updated_at
+FROM organizations
+	LEFT JOIN organization_settings ON organization_settings.organization_id = organizations.id
+WHERE organizations.id=? AND organizations.deleted_at IS NULL`
+const lockSettingsSql = selectSettingsSql + ` FOR UPDATE OF organizations`
+const shareSettingsSql = selectSettingsSql + ` FOR SHARE OF organizations`
+const upsertSettingsSql = `
+INSERT INTO organization_settings
+		(organization_id, version, timezone, self_signup, work_log_approval, max_weekly_hours, updated_at)
+	VALUES
+		(:organization_id, :version, :timezone, :self_signup, :work_log_approval, :max_weekly_hours, NOW())
+ON CONFLICT (organization_id) DO UPDATE SET
+	version = EXCLUDED.version,
+	timezone = EXCLUDED.timezone,
+	self_signup = EXCLUDED.self_signup,
+	work_log_approval = EXCLUDED.work_log_approval,
+	max_weekly_hours = EXCLUDED.max_weekly_hours,
+	updated_at = EXCLUDED.updated_at
+RETURNING updated_at`
+const updateOrganizationSettingsSql = `
+UPDATE organizations SET
+	geofence_policy = :geofence_policy,
+	default_locale = :default_locale,
+	email_from_address = :email_from_address,
+	email_from_name = :email_from_name,
+	brand_color = :brand_color,
+	logo_url = :logo_url
+WHERE id = :organization_id`
+
+// Organizations without a settings row are on version 1, the defaults.
+const bumpSettingsVersionSql = `
+INSERT INTO organization_settings (organization_id, version) VALUES (?, 2)
+ON CONFLICT (organization_id) DO UPDATE SET version = organization_settings.version + 1, updated_at = NOW()`
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type Blocklist struct {
+	Terms []string `json:"terms"`
+}
+
+// adminOrgID parses the organization ID and checks that the logged-in
+// user administers it. On failure it writes the response and returns 0.
+func adminOrgID(request *restful.Request, response *restful.Response) uint64 {
+	orgID, err := strconv.ParseUint(request.PathParameter("organizationID"), 10, 64)
+	if err != nil || orgID == 0 {
+		response.WriteHeader(http.StatusBadRequest)
+		return 0
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgID, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return 0
+	}
+	return orgID
+}
+
+func (server *OrganizationsServer) GetBlocklistHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "GetBlocklistHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID := adminOrgID(request, response)
+	if orgID == 0 {
+		return
+	}
+
+	terms, err := organizations.GetBlockedTerms(ctx, server.Config.GetDbConn(), orgID)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(Blocklist{Terms: terms})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize blocklist")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OrganizationsServer) SetBlocklistHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "SetBlocklistHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID := adminOrgID(request, response)
+	if orgID == 0 {
+		return
+	}
+
+	var blocklist Blocklist
+	err := request.ReadEntity(&blocklist)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize blocklist")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	blocklist.Terms, err = organizations.NormalizeBlocklist(blocklist.Terms)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	err = organizations.SetBlockedTerms(ctx, server.Config.GetDbConn(), orgID, blocklist.Terms)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(blocklist)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize blocklist")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
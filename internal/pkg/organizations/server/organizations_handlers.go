@@ -12,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type OrganizationsServer struct {
@@ -60,22 +61,22 @@ func (server *OrganizationsServer) GetOrganizationsAPI() *restful.WebService {
 			Returns(http.StatusOK, "Organization created.", organizations.Organization{}))
 	service.Route(
 		service.GET("/{organizationID}").
+			Filter(authConfig.OptionalJwtFilter).
 			//Filter(filters.RateLimitingFilter).
 			To(server.DescribeOrganizationHandler).
-			Doc("Describe Organization").
+			Doc("Describe Organization, with its contact user and emergency contacts. Only members see the contact user's email and the emergency contacts, and only OrgAdmins their phone numbers").
 			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
 			Produces(restful.MIME_JSON).
 			Writes(organizations.Organization{}).
 			Returns(http.StatusOK, "Organization details fetched", organizations.Organization{}).
 			Returns(http.StatusNotFound, "Invalid Organization ID", nil))
-	// TODO: UpdateOrganization needs a SuperAdmin permissions check filter
 	service.Route(
 		service.PUT("/{organizationID}").
 			Filter(authConfig.ValidJwtFilter).
 			//Filter(filters.RateLimitingFilter).
 			//Filter(filters.RequireSuperAdminPermission).
 			To(server.UpdateOrganizationHandler).
-			Doc("Update Organization").
+			Doc("Update Organization. Emergency contacts are left unchanged if emergency_contacts is omitted, and the email sender and branding if they are empty. The settings can also clear those").
 			Param(restful.PathParameter("organizationId", "ID taken from ListOrganizations")).
 			Consumes(restful.MIME_JSON).
 			Produces(restful.MIME_JSON).
@@ -83,18 +84,103 @@ func (server *OrganizationsServer) GetOrganizationsAPI() *restful.WebService {
 			Writes(organizations.Organization{}).
 			Returns(http.StatusOK, "Organization details updated", organizations.Organization{}).
 			Returns(http.StatusBadRequest, "Unable to set the requested values.", nil).
+			Returns(http.StatusForbidden, "Only the Organization's admins may update it", nil).
 			Returns(http.StatusNotFound, "Invalid Organization ID", nil))
-	// TODO: DeleteOrganizations needs a SuperAdmin permissions check filter
 	service.Route(
 		service.DELETE("/{organizationID}").
 			Filter(authConfig.ValidJwtFilter).
 			//Filter(filters.RateLimitingFilter).
-			//Filter(filters.RequireSuperAdminPermission).
 			To(server.DeleteOrganizationHandler).
-			Doc("Destroy Organization").
+			Doc("Delete Organization. It is hidden at once, and purged along with its sites, schedules, roles and logs once the retention period is up").
+			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
+			Produces(restful.MIME_JSON).
+			Writes(DeleteOrganizationResponse{}).
+			Returns(http.StatusOK, "Organization deleted", DeleteOrganizationResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Invalid Organization ID", nil))
+	service.Route(
+		service.GET("/deleted").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListDeletedOrganizationsHandler).
+			Doc("List deleted Organizations that have not been purged yet").
+			Produces(restful.MIME_JSON).
+			Writes(ListDeletedOrganizationsResponse{}).
+			Returns(http.StatusOK, "Fetched deleted organizations", ListDeletedOrganizationsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a site admin", nil))
+	service.Route(
+		service.POST("/{organizationID}/restore").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RestoreOrganizationHandler).
+			Doc("Restore a deleted Organization before it is purged").
+			Param(restful.PathParameter("organizationID", "ID taken from ListDeletedOrganizations")).
+			Produces(restful.MIME_JSON).
+			Writes(organizations.Organization{}).
+			Returns(http.StatusOK, "Organization restored", organizations.Organization{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a site admin", nil).
+			Returns(http.StatusNotFound, "No deleted organization with this ID", nil))
+	service.Route(
+		service.POST("/{organizationID}/authcode").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RotateAuthcodeHandler).
+			Doc("Replace the Organization's authcode with a new random one, optionally expiring or limited to a number of uses. The old code stops working at once").
+			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(RotateAuthcodeRequest{}).
+			Writes(RotateAuthcodeResponse{}).
+			Returns(http.StatusOK, "Authcode rotated. The response is the only time the new code is shown", RotateAuthcodeResponse{}).
+			Returns(http.StatusBadRequest, "Invalid expiry or use limit", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Invalid Organization ID", nil))
+	service.Route(
+		service.GET("/{organizationID}/settings").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetSettingsHandler).
+			Doc("Fetch the Organization's settings, with defaults for any it has not changed").
 			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
-			Returns(http.StatusOK, "Organization deleted", nil).
+			Produces(restful.MIME_JSON).
+			Writes(organizations.Settings{}).
+			Returns(http.StatusOK, "Fetched settings", organizations.Settings{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the Organization", nil).
 			Returns(http.StatusNotFound, "Invalid Organization ID", nil))
+	service.Route(
+		service.PATCH("/{organizationID}/settings").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UpdateSettingsHandler).
+			Doc("Change some of the Organization's settings. Give the version they were fetched at to refuse the change if someone else has made one since").
+			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(organizations.SettingsPatch{}).
+			Writes(organizations.Settings{}).
+			Returns(http.StatusOK, "Settings updated", organizations.Settings{}).
+			Returns(http.StatusBadRequest, "Unable to set the requested values.", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the Organization", nil).
+			Returns(http.StatusNotFound, "Invalid Organization ID", nil).
+			Returns(http.StatusConflict, "The settings have changed since the given version", nil))
+	service.Route(
+		service.GET("/{organizationID}/blocklist").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetBlocklistHandler).
+			Doc("List the terms the Organization will not accept in anonymous submissions").
+			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
+			Produces(restful.MIME_JSON).
+			Writes(Blocklist{}).
+			Returns(http.StatusOK, "Fetched blocklist", Blocklist{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the Organization", nil))
+	service.Route(
+		service.PUT("/{organizationID}/blocklist").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SetBlocklistHandler).
+			Doc("Replace the terms the Organization will not accept in anonymous submissions").
+			Param(restful.PathParameter("organizationID", "ID taken from ListOrganizations")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(Blocklist{}).
+			Writes(Blocklist{}).
+			Returns(http.StatusOK, "Blocklist updated", Blocklist{}).
+			Returns(http.StatusBadRequest, "Too many terms, or a term is too long", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the Organization", nil))
 
 	return service
 }
@@ -103,6 +189,24 @@ type ListOrganizationsResponse struct {
 	Organizations []organizations.Organization `json:"organizations"`
 }
 
+type ListDeletedOrganizationsResponse struct {
+	Organizations []organizations.DeletedOrganization `json:"organizations"`
+}
+
+type RotateAuthcodeRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // never, if left out
+	MaxUses   *int       `json:"max_uses,omitempty"`   // any number of times, if left out
+}
+
+type RotateAuthcodeResponse struct {
+	Authcode string `json:"authcode"`
+	organizations.AuthcodeStatus
+}
+
+type DeleteOrganizationResponse struct {
+	PurgeAfter time.Time `json:"purge_after"` // until then, a site admin may restore it
+}
+
 func (server *OrganizationsServer) ListOrganizationsHandler(request *restful.Request, response *restful.Response) {
 	// Set up the context for this request thread
 	ctx := filters.GetRequestContext(request)
@@ -174,6 +278,23 @@ func (server *OrganizationsServer) DescribeOrganizationHandler(request *restful.
 		return
 	}
 
+	// Only the organization's admins see how its authcode may be used, and
+	// the emergency contacts' phone numbers. Outsiders see neither the
+	// contact user's email nor the emergency contacts.
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(org.Id, users.OrgAdmin) {
+		org.AuthcodeStatus = nil
+		for i := range org.EmergencyContacts {
+			org.EmergencyContacts[i].Phone = ""
+		}
+	}
+	if !claims.HasRole(org.Id, users.MemberRoles...) {
+		if org.ContactUser != nil {
+			org.ContactUser.Email = ""
+		}
+		org.EmergencyContacts = nil
+	}
+
 	// Format and send the response
 	err = response.WriteEntity(org)
 	if err != nil {
@@ -225,6 +346,10 @@ func (server *OrganizationsServer) CreateOrganizationHandler(request *restful.Re
 	// Publish the new Org to the DB
 	err = newOrg.Create(ctx, server.Config.GetDbConn())
 	if err != nil {
+		if err == organizations.ErrDuplicateAuthcode {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
 		logger.WithError(err).Error("Failed to create organization")
 		response.WriteHeader(http.StatusInternalServerError)
 		return
@@ -269,16 +394,59 @@ func (server *OrganizationsServer) UpdateOrganizationHandler(request *restful.Re
 		return
 	}
 
-	// TODO: get logged-in user and add it to the context so that permissions and scope can be determined.
+	newOrg.Id, err = strconv.ParseUint(orgID, 10, 64)
+	if err != nil || newOrg.Id == 0 {
+		logger.Debug("Invalid org ID")
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// The authcode is only changed by rotating it
+	newOrg.Authcode = ""
+
+	// Only the organization's admins may change it, since this sets its
+	// geofence policy along with its profile
+	if !users.GetRequestJWTClaims(request).HasRole(newOrg.Id, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// Check whether the requested values, including any contact phone
+	// numbers and email addresses, form a valid Organization
+	errorSet := newOrg.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Specified org is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
 
 	// Publish the updates to the DB
 	err = newOrg.Update(ctx, server.Config.GetDbConn())
 	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err == organizations.ErrContactNotMember {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
 		logger.WithError(err).Error("Failed to create organization")
 		response.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// Re-fetch it to pick up the contact user and any emergency contacts
+	// left unchanged
+	newOrg, err = organizations.DescribeOrganization(ctx, server.Config.GetDbConn(), int64(newOrg.Id))
+	if err != nil {
+		logger.WithError(err).Error("Failed to fetch updated organization")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(newOrg.Id, users.OrgAdmin) {
+		newOrg.AuthcodeStatus = nil
+	}
+
 	// Format and send the response
 	err = response.WriteEntity(newOrg)
 	if err != nil {
@@ -311,22 +479,138 @@ func (server *OrganizationsServer) DeleteOrganizationHandler(request *restful.Re
 	if orgID <= 0 {
 		logger.WithError(errors.New("invalid org ID")).Debug("Negative Org ID given")
 		response.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	// TODO: get logged-in user and check their permissions
+	if !users.GetRequestJWTClaims(request).HasRole(uint64(orgID), users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
 
-	// Fetch the organization data
-	err = organizations.DeleteOrganization(ctx, uint64(orgID), server.Config.GetDbConn())
+	// Hide the organization until it is purged
+	purgeAfter, err := organizations.DeleteOrganization(ctx, uint64(orgID), server.Config.GetOrganizationRetention(), server.Config.GetDbConn())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			response.WriteHeader(http.StatusNotFound)
 		} else {
-			logger.WithError(err).Error("Failed to fetch organization")
 			response.WriteHeader(http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// Format and send the response
-	response.WriteHeader(http.StatusOK)
+	err = response.WriteEntity(DeleteOrganizationResponse{PurgeAfter: purgeAfter})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize response")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OrganizationsServer) ListDeletedOrganizationsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation": "ListDeletedOrganizationsHandler",
+	})
+
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	organizationSet, err := organizations.ListDeletedOrganizations(ctx, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListDeletedOrganizationsResponse{Organizations: organizationSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize organizations")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OrganizationsServer) RestoreOrganizationHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "RestoreOrganizationHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID, err := strconv.ParseUint(request.PathParameter("organizationID"), 10, 64)
+	if err != nil || orgID == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = organizations.RestoreOrganization(ctx, server.Config.GetDbConn(), orgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	org, err := organizations.DescribeOrganization(ctx, server.Config.GetDbConn(), int64(orgID))
+	if err != nil {
+		logger.WithError(err).Error("Failed to fetch restored organization")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(org)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize organization")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OrganizationsServer) RotateAuthcodeHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "RotateAuthcodeHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID, err := strconv.ParseUint(request.PathParameter("organizationID"), 10, 64)
+	if err != nil || orgID == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	var req RotateAuthcodeRequest
+	err = request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		response.WriteErrorString(http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+	if req.MaxUses != nil && *req.MaxUses < 1 {
+		response.WriteErrorString(http.StatusBadRequest, "max_uses must be at least 1")
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgID, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	code, status, err := organizations.RotateAuthcode(ctx, server.Config.GetDbConn(), orgID, req.ExpiresAt, req.MaxUses)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(RotateAuthcodeResponse{Authcode: code, AuthcodeStatus: *status})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize authcode")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
 }
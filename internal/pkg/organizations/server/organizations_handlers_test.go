@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type OrganizationsServerTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+	Container *restful.Container
+}
+
+// TestOrganizationsHandlerTestSuite is the "main" entry point for the suite.
+func TestOrganizationsHandlerTestSuite(t *testing.T) {
+	// Initialize the webservice
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../../users/testdata/"
+	testSuite := new(OrganizationsServerTestSuite)
+	testSuite.Config = &cfg
+	server := New(&cfg)
+	testSuite.Container = restful.NewContainer()
+	testSuite.Container.Add(server.GetOrganizationsAPI())
+	if testing.Short() {
+		t.Skip("Skipping Organizations Handlers tests in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+func getAuthHeader(email string, config *config.ServiceConfig) (string, error) {
+	user, err := users.FindUser(context.Background(), email, config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("no user returned")
+	}
+
+	_, err = user.GetRoles(context.Background(), config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+
+	claims := users.CreateJWT(user, config.GetTokenExpirationDuration())
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	privateKey, _ := config.GetJWTKeys()
+	if privateKey == nil {
+		return "", errors.New("failed to load private key")
+	}
+	tokenString, err := token.SignedString(privateKey)
+	return fmt.Sprintf("Bearer %s", tokenString), err
+}
+
+func (suite *OrganizationsServerTestSuite) describeOrganization(email string) organizations.Organization {
+	req, err := http.NewRequest(http.MethodGet, "/vs/organizations/1", nil)
+	suite.Require().Nil(err)
+	if len(email) > 0 {
+		tokenStr, err := getAuthHeader(email, suite.Config)
+		suite.Require().Nil(err)
+		req.Header.Set("Authorization", tokenStr)
+	}
+	resp := httptest.NewRecorder()
+	suite.Container.Dispatch(resp, req)
+	suite.Require().Equal(http.StatusOK, resp.Code, "DescribeOrganization API returned incorrect response code")
+
+	var org organizations.Organization
+	suite.Require().Nil(json.Unmarshal(resp.Body.Bytes(), &org))
+	return org
+}
+
+func (suite *OrganizationsServerTestSuite) TestDescribeOrganizationHandler() {
+	db := suite.Config.GetDbConn()
+	_, err := db.Exec(`UPDATE organizations SET contact_user_id = 1 WHERE id = 1`)
+	suite.Require().Nil(err)
+	_, err = db.Exec(`INSERT INTO organization_emergency_contacts (organization_id, position, name, phone) VALUES (1, 0, 'Night Manager', '+12065550123')`)
+	suite.Require().Nil(err)
+
+	// Anonymous callers see neither the contact user's email nor the emergency contacts
+	org := suite.describeOrganization("")
+	suite.Require().NotNil(org.ContactUser)
+	suite.Equal("", org.ContactUser.Email)
+	suite.Empty(org.EmergencyContacts)
+	suite.Nil(org.AuthcodeStatus)
+
+	// Neither do users of other organizations
+	org = suite.describeOrganization("user4@example.org")
+	suite.Equal("", org.ContactUser.Email)
+	suite.Empty(org.EmergencyContacts)
+
+	// Members see the emergency contacts, but not their phone numbers
+	org = suite.describeOrganization("user2@example.org")
+	suite.Equal("kit@example.org", org.ContactUser.Email)
+	suite.Require().Len(org.EmergencyContacts, 1)
+	suite.Equal("Night Manager", org.EmergencyContacts[0].Name)
+	suite.Equal("", org.EmergencyContacts[0].Phone)
+	suite.Nil(org.AuthcodeStatus)
+
+	// Admins see everything
+	org = suite.describeOrganization("kit@example.org")
+	suite.Require().Len(org.EmergencyContacts, 1)
+	suite.Equal("+12065550123", org.EmergencyContacts[0].Phone)
+	suite.NotNil(org.AuthcodeStatus)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func (server *OrganizationsServer) GetSettingsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "GetSettingsHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID := adminOrgID(request, response)
+	if orgID == 0 {
+		return
+	}
+
+	settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), orgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteErrorString(http.StatusNotFound, "organization not found")
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(settings)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize settings")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OrganizationsServer) UpdateSettingsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":            "UpdateSettingsHandler",
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgID := adminOrgID(request, response)
+	if orgID == 0 {
+		return
+	}
+
+	var patch organizations.SettingsPatch
+	err := request.ReadEntity(&patch)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize settings")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	settings, err := organizations.UpdateSettings(ctx, server.Config.GetDbConn(), orgID, patch)
+	if err != nil {
+		if errorSet, ok := err.(*config.ErrorSet); ok {
+			logger.WithError(errorSet.Errors[0]).Debugf("Settings failed validation with %d errors", len(errorSet.Errors))
+			response.WriteError(http.StatusBadRequest, errorSet)
+			return
+		}
+		switch err {
+		case sql.ErrNoRows:
+			response.WriteErrorString(http.StatusNotFound, "organization not found")
+		case organizations.ErrSettingsConflict:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = response.WriteEntity(settings)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize settings")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
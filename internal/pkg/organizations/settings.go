@@ -0,0 +1,311 @@
+package organizations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const MaxWeeklyHoursLimit = 168
+
+var ErrSettingsConflict = errors.New("settings were changed by someone else; fetch them and try again")
+
+// Settings are the behaviors that differ from one organization to another.
+// Organizations that have never changed them get DefaultSettings.
+type Settings struct {
+	OrganizationId uint64 `json:"organization_id" db:"organization_id"`
+
+	// Version is bumped by each change, so that clients can tell when the
+	// settings they are looking at are stale.
+	Version int `json:"version" db:"version"`
+
+	Timezone      string `json:"timezone" db:"timezone"`             // IANA name, for sites that do not set their own
+	DefaultLocale string `json:"default_locale" db:"default_locale"` // for messages about sites that do not set their own
+
+	SelfSignup      bool    `json:"self_signup" db:"self_signup"`             // volunteers may sign themselves up for shifts
+	GeofencePolicy  string  `json:"geofence_policy" db:"geofence_policy"`     // one of GeofenceReject, GeofenceFlag or GeofenceAllow
+	WorkLogApproval bool    `json:"work_log_approval" db:"work_log_approval"` // work logs need a manager's approval
+	MaxWeeklyHours  float64 `json:"max_weekly_hours" db:"max_weekly_hours"`   // 0 means no cap
+
+	// Sender and branding of the organization's email
+	EmailFromAddress string `json:"email_from_address" db:"email_from_address"`
+	EmailFromName    string `json:"email_from_name" db:"email_from_name"`
+	BrandColor       string `json:"brand_color" db:"brand_color"` // #rrggbb
+	LogoUrl          string `json:"logo_url" db:"logo_url"`
+
+	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"` // unset until first changed
+}
+
+// DefaultSettings are the settings of an organization that has not changed
+// them.
+func DefaultSettings(organizationID uint64) Settings {
+	return Settings{
+		OrganizationId:  organizationID,
+		Version:         1,
+		Timezone:        "UTC",
+		DefaultLocale:   "en",
+		SelfSignup:      true,
+		GeofencePolicy:  GeofenceFlag,
+		WorkLogApproval: true,
+	}
+}
+
+// Location resolves the settings' time zone, falling back to UTC if it is
+// not a known one.
+func (s Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s Settings) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if _, err := time.LoadLocation(s.Timezone); len(s.Timezone) == 0 || err != nil {
+		errSet = append(errSet, errors.New("timezone must be an IANA time zone name, such as America/New_York"))
+	}
+	if len(s.DefaultLocale) == 0 || len(s.DefaultLocale) > 16 {
+		errSet = append(errSet, errors.New("default_locale must be present, and at most 16 characters"))
+	}
+	switch s.GeofencePolicy {
+	case GeofenceReject, GeofenceFlag, GeofenceAllow:
+	default:
+		errSet = append(errSet, errors.New("geofence_policy must be one of reject, flag or allow"))
+	}
+	if s.MaxWeeklyHours < 0 || s.MaxWeeklyHours > MaxWeeklyHoursLimit {
+		errSet = append(errSet, fmt.Errorf("max_weekly_hours must be between 0 and %d", MaxWeeklyHoursLimit))
+	}
+	if len(s.EmailFromAddress) > 128 || (len(s.EmailFromAddress) > 0 && !strings.Contains(s.EmailFromAddress, "@")) {
+		errSet = append(errSet, errors.New("email_from_address must be an email address of at most 128 characters"))
+	}
+	if len(s.EmailFromName) > 128 {
+		errSet = append(errSet, errors.New("email_from_name may be at most 128 characters"))
+	}
+	if len(s.BrandColor) > 0 && !brandColorPattern.MatchString(s.BrandColor) {
+		errSet = append(errSet, errors.New("brand_color must be given as #rrggbb"))
+	}
+	if len(s.LogoUrl) > 512 || (len(s.LogoUrl) > 0 && !strings.HasPrefix(s.LogoUrl, "https://")) {
+		errSet = append(errSet, errors.New("logo_url must be an https URL of at most 512 characters"))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+// SettingsPatch changes only the settings that are given. If Version is
+// given, the change is refused with ErrSettingsConflict unless it is still
+// the current version.
+type SettingsPatch struct {
+	Version *int `json:"version"`
+
+	Timezone        *string  `json:"timezone"`
+	DefaultLocale   *string  `json:"default_locale"`
+	SelfSignup      *bool    `json:"self_signup"`
+	GeofencePolicy  *string  `json:"geofence_policy"`
+	WorkLogApproval *bool    `json:"work_log_approval"`
+	MaxWeeklyHours  *float64 `json:"max_weekly_hours"`
+
+	EmailFromAddress *string `json:"email_from_address"`
+	EmailFromName    *string `json:"email_from_name"`
+	BrandColor       *string `json:"brand_color"`
+	LogoUrl          *string `json:"logo_url"`
+}
+
+// Apply copies the given settings onto s.
+func (p SettingsPatch) Apply(s *Settings) {
+	if p.Timezone != nil {
+		s.Timezone = *p.Timezone
+	}
+	if p.DefaultLocale != nil {
+		s.DefaultLocale = *p.DefaultLocale
+	}
+	if p.SelfSignup != nil {
+		s.SelfSignup = *p.SelfSignup
+	}
+	if p.GeofencePolicy != nil {
+		s.GeofencePolicy = *p.GeofencePolicy
+	}
+	if p.WorkLogApproval != nil {
+		s.WorkLogApproval = *p.WorkLogApproval
+	}
+	if p.MaxWeeklyHours != nil {
+		s.MaxWeeklyHours = *p.MaxWeeklyHours
+	}
+	if p.EmailFromAddress != nil {
+		s.EmailFromAddress = *p.EmailFromAddress
+	}
+	if p.EmailFromName != nil {
+		s.EmailFromName = *p.EmailFromName
+	}
+	if p.BrandColor != nil {
+		s.BrandColor = *p.BrandColor
+	}
+	if p.LogoUrl != nil {
+		s.LogoUrl = *p.LogoUrl
+	}
+}
+
+// settingsDbRow has NULLs for the settings of an organization that has not
+// changed them.
+type settingsDbRow struct {
+	OrganizationId   uint64          `db:"organization_id"`
+	GeofencePolicy   string          `db:"geofence_policy"`
+	DefaultLocale    string          `db:"default_locale"`
+	EmailFromAddress string          `db:"email_from_address"`
+	EmailFromName    string          `db:"email_from_name"`
+	BrandColor       string          `db:"brand_color"`
+	LogoUrl          string          `db:"logo_url"`
+	Version          sql.NullInt64   `db:"version"`
+	Timezone         sql.NullString  `db:"timezone"`
+	SelfSignup       sql.NullBool    `db:"self_signup"`
+	WorkLogApproval  sql.NullBool    `db:"work_log_approval"`
+	MaxWeeklyHours   sql.NullFloat64 `db:"max_weekly_hours"`
+	UpdatedAt        sql.NullTime    `db:"updated_at"`
+}
+
+func (row settingsDbRow) copyToSettings() *Settings {
+	s := DefaultSettings(row.OrganizationId)
+	s.GeofencePolicy = row.GeofencePolicy
+	s.DefaultLocale = row.DefaultLocale
+	s.EmailFromAddress = row.EmailFromAddress
+	s.EmailFromName = row.EmailFromName
+	s.BrandColor = row.BrandColor
+	s.LogoUrl = row.LogoUrl
+	if !row.Version.Valid {
+		return &s
+	}
+	s.Version = int(row.Version.Int64)
+	s.Timezone = row.Timezone.String
+	s.SelfSignup = row.SelfSignup.Bool
+	s.WorkLogApproval = row.WorkLogApproval.Bool
+	s.MaxWeeklyHours = row.MaxWeeklyHours.Float64
+	s.UpdatedAt = &row.UpdatedAt.Time
+	return &s
+}
+
+func settingsCacheKey(organizationID uint64) string {
+	return fmt.Sprintf("organizations.settings.%d", organizationID)
+}
+
+// GetSettings fetches the organization's settings. They are cached for the
+// rest of the request, so other packages may call it as often as they need.
+// Returns sql.ErrNoRows if the organization does not exist.
+func GetSettings(ctx context.Context, db *sqlx.DB, organizationID uint64) (*Settings, error) {
+	value, err := filters.CachedValue(ctx, settingsCacheKey(organizationID), func() (interface{}, error) {
+		var row settingsDbRow
+		err := db.GetContext(ctx, &row, db.Rebind(selectSettingsSql), organizationID)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+					"operation":      "GetSettings",
+					"OrganizationID": organizationID,
+				}).WithError(err).Error("Failed to select settings")
+			}
+			return nil, err
+		}
+		return row.copyToSettings(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Callers get their own copy, so that they cannot change the cached one.
+	s := *value.(*Settings)
+	return &s, nil
+}
+
+// GetSettingsTx fetches the organization's settings within the transaction,
+// for callers that act on them in the same transaction. They may not change
+// until it ends. Returns sql.ErrNoRows if the organization does not exist.
+func GetSettingsTx(ctx context.Context, tx *sqlx.Tx, organizationID uint64) (*Settings, error) {
+	var row settingsDbRow
+	err := tx.GetContext(ctx, &row, tx.Rebind(shareSettingsSql), organizationID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+				"operation":      "GetSettingsTx",
+				"OrganizationID": organizationID,
+			}).WithError(err).Error("Failed to select settings")
+		}
+		return nil, err
+	}
+	return row.copyToSettings(), nil
+}
+
+// UpdateSettings applies the patch to the organization's settings and saves
+// them as a new version. Returns a *config.ErrorSet if the result is not
+// valid, ErrSettingsConflict if the patch was made against an old version,
+// or sql.ErrNoRows if the organization does not exist.
+func UpdateSettings(ctx context.Context, db *sqlx.DB, organizationID uint64, patch SettingsPatch) (*Settings, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(logrus.Fields{
+		"operation":      "UpdateSettings",
+		"OrganizationID": organizationID,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var row settingsDbRow
+	err = tx.GetContext(ctx, &row, tx.Rebind(lockSettingsSql), organizationID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to lock settings")
+		}
+		return nil, err
+	}
+	s := row.copyToSettings()
+	if patch.Version != nil && *patch.Version != s.Version {
+		return nil, ErrSettingsConflict
+	}
+	patch.Apply(s)
+	if errorSet := s.Validate(); errorSet != nil {
+		return nil, errorSet
+	}
+	s.Version++
+
+	rows, err := tx.NamedQuery(tx.Rebind(upsertSettingsSql), s)
+	if err != nil {
+		logger.WithError(err).Error("Failed to save settings")
+		return nil, err
+	}
+	var updatedAt time.Time
+	if rows.Next() {
+		err = rows.Scan(&updatedAt)
+	}
+	rows.Close()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read back settings")
+		return nil, err
+	}
+	s.UpdatedAt = &updatedAt
+
+	_, err = tx.NamedExec(tx.Rebind(updateOrganizationSettingsSql), s)
+	if err != nil {
+		logger.WithError(err).Error("Failed to save organization settings")
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit settings")
+		return nil, err
+	}
+	filters.ForgetCachedValue(ctx, settingsCacheKey(organizationID))
+
+	// Success!
+	return s, nil
+}
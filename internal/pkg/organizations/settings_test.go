@@ -0,0 +1,57 @@
+package organizations
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (suite *OrganizationsTestSuite) TestDefaultSettings() {
+	s := DefaultSettings(42)
+	suite.Nil(s.Validate(), "Expected the defaults to be valid")
+	suite.Equal(uint64(42), s.OrganizationId)
+	suite.Equal(1, s.Version, "Expected the defaults to be the first version")
+	suite.Equal(time.UTC, s.Location())
+}
+
+func (suite *OrganizationsTestSuite) TestSettings_Validate() {
+	s := DefaultSettings(1)
+	s.Timezone = "Mars/Olympus_Mons"
+	s.GeofencePolicy = ""
+	s.MaxWeeklyHours = -1
+	s.BrandColor = "red"
+	s.LogoUrl = "http://example.com/logo.png"
+	s.EmailFromAddress = "volunteers"
+	validationErrs := s.Validate()
+	suite.NotNil(validationErrs, "Expected invalid settings to fail validation")
+	suite.Len(validationErrs.Errors, 6, "Expected one error for each invalid setting")
+}
+
+func (suite *OrganizationsTestSuite) TestSettingsPatch_Apply() {
+	s := DefaultSettings(1)
+	selfSignup := false
+	hours := 20.0
+	SettingsPatch{SelfSignup: &selfSignup, MaxWeeklyHours: &hours}.Apply(&s)
+
+	suite.False(s.SelfSignup)
+	suite.Equal(20.0, s.MaxWeeklyHours)
+	suite.True(s.WorkLogApproval, "Expected settings left out of the patch to be unchanged")
+	suite.Equal("UTC", s.Timezone, "Expected settings left out of the patch to be unchanged")
+}
+
+func (suite *OrganizationsTestSuite) TestSettingsDbRow_CopyToSettings() {
+	row := settingsDbRow{OrganizationId: 1, GeofencePolicy: GeofenceReject, DefaultLocale: "es"}
+	s := row.copyToSettings()
+	suite.Equal(GeofenceReject, s.GeofencePolicy, "Expected the organization's own columns to be used")
+	suite.Equal("es", s.DefaultLocale, "Expected the organization's own columns to be used")
+	suite.True(s.SelfSignup, "Expected the defaults when the organization has no settings row")
+	suite.Nil(s.UpdatedAt)
+
+	row.Version = sql.NullInt64{Int64: 3, Valid: true}
+	row.Timezone = sql.NullString{String: "UTC", Valid: true}
+	row.SelfSignup = sql.NullBool{Bool: false, Valid: true}
+	row.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s = row.copyToSettings()
+	suite.Equal(3, s.Version)
+	suite.False(s.SelfSignup, "Expected the saved settings to be used")
+	suite.NotNil(s.UpdatedAt)
+}
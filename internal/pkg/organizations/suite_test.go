@@ -1,6 +1,7 @@
 package organizations
 
 import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
 	"github.com/stretchr/testify/suite"
 	"testing"
 )
@@ -13,3 +14,20 @@ func TestOrganizationsTestSuite(t *testing.T) {
 	testSuite := new(OrganizationsTestSuite)
 	suite.Run(t, testSuite)
 }
+
+type OrganizationsDatabaseTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestOrganizationsDatabaseTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(OrganizationsDatabaseTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping OrganizationsDatabaseTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
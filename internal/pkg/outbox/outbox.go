@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Event statuses.
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusDead    = "dead" // failed MaxAttempts times; waiting for an admin to replay it
+)
+
+// ErrNotDead is returned when replaying an event that is not dead-lettered.
+var ErrNotDead = errors.New("event is not dead-lettered")
+
+// Event is something that happened, to be acted on after the transaction
+// that recorded it commits.
+type Event struct {
+	Id          uint64     `json:"id" db:"id"`
+	EventType   string     `json:"event_type" db:"event_type"`
+	Payload     string     `json:"payload" db:"payload"`
+	Status      string     `json:"status" db:"status"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	LastError   string     `json:"last_error" db:"last_error"`
+	AvailableAt time.Time  `json:"available_at" db:"available_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty" db:"processed_at"`
+}
+
+// Decode unmarshals the event's payload.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(e.Payload), v)
+}
+
+// Enqueue records an event in the transaction, so that it is only processed
+// if the transaction commits.
+func Enqueue(ctx context.Context, tx *sqlx.Tx, eventType string, payload interface{}) error {
+	return enqueue(ctx, tx, eventType, payload, nil)
+}
+
+// EnqueueAt records an event in the transaction that is not to be processed
+// before the given time.
+func EnqueueAt(ctx context.Context, tx *sqlx.Tx, eventType string, payload interface{}, at time.Time) error {
+	return enqueue(ctx, tx, eventType, payload, &at)
+}
+
+func enqueue(ctx context.Context, tx *sqlx.Tx, eventType string, payload interface{}, at *time.Time) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(insertEventSql), eventType, string(body), at)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "outbox.Enqueue",
+			"EventType": eventType,
+		}).WithError(err).Error("Failed to enqueue event")
+	}
+	return err
+}
+
+// DescribeEvent fetches a single event. Returns sql.ErrNoRows if it does not
+// exist.
+func DescribeEvent(ctx context.Context, db *sqlx.DB, id uint64) (*Event, error) {
+	var e Event
+	err := db.GetContext(ctx, &e, db.Rebind(describeEventSql), id)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListEvents fetches the newest events with the status, optionally of one
+// type.
+func ListEvents(ctx context.Context, db *sqlx.DB, status, eventType string, limit int) ([]Event, error) {
+	var typeFilter *string
+	if eventType != "" {
+		typeFilter = &eventType
+	}
+	eventSet := make([]Event, 0)
+	err := db.SelectContext(ctx, &eventSet, db.Rebind(listEventsSql), status, typeFilter, typeFilter, limit)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "outbox.ListEvents",
+			"Status":    status,
+		}).WithError(err).Error("Failed to select events")
+		return nil, err
+	}
+	return eventSet, nil
+}
+
+// Replay returns a dead-lettered event to the queue with its attempts reset.
+// Returns sql.ErrNoRows if there is no such event, or ErrNotDead if it is not
+// dead-lettered.
+func Replay(ctx context.Context, db *sqlx.DB, id uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(replayEventSql), id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "outbox.Replay",
+			"EventID":   id,
+		}).WithError(err).Error("Failed to replay event")
+		return err
+	}
+	if replayed, _ := result.RowsAffected(); replayed == 0 {
+		if _, err = DescribeEvent(ctx, db, id); err != nil {
+			return err
+		}
+		return ErrNotDead
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package outbox
+
+const selectEventColumns = `
+	SELECT id, event_type, payload::text AS payload, status, attempts, last_error,
+		available_at, created_at, processed_at
+	FROM outbox_events
+`
+
+// A NULL time makes the event available right away.
+const insertEventSql = `
+	INSERT INTO outbox_events (event_type, payload, available_at) VALUES (?, ?::jsonb, COALESCE(?::timestamptz, now()))
+`
+
+// Workers skip events another worker holds, so each is processed once.
+const claimEventSql = selectEventColumns + `
+	WHERE status = 'pending' AND available_at <= now()
+	ORDER BY available_at, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+`
+
+const markDoneSql = `
+	UPDATE outbox_events
+	SET status = 'done', attempts = attempts + 1, last_error = '', processed_at = now()
+	WHERE id = ?
+`
+
+const markFailedSql = `
+	UPDATE outbox_events
+	SET status = ?, attempts = ?, last_error = ?, available_at = ?
+	WHERE id = ?
+`
+
+const describeEventSql = selectEventColumns + `
+	WHERE id = ?
+`
+
+const listEventsSql = selectEventColumns + `
+	WHERE status = ? AND (?::text IS NULL OR event_type = ?)
+	ORDER BY id DESC
+	LIMIT ?
+`
+
+const replayEventSql = `
+	UPDATE outbox_events
+	SET status = 'pending', attempts = 0, last_error = '', available_at = now()
+	WHERE id = ? AND status = 'dead'
+`
+
+const purgeProcessedSql = `
+	DELETE FROM outbox_events WHERE status = 'done' AND processed_at < ?
+`
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+type OutboxServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *OutboxServer {
+	return &OutboxServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+type ListEventsResponse struct {
+	Events []outbox.Event `json:"events"`
+}
+
+// requireSiteAdmin writes a 403 and returns false unless the logged-in user
+// is a Site Admin. The outbox spans every organization.
+func requireSiteAdmin(request *restful.Request, response *restful.Response) bool {
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (server *OutboxServer) GetOutboxAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/outbox").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListEventsHandler).
+			Doc("List outbox events, newest first. Defaults to dead-lettered events").
+			Param(service.QueryParameter("status", "pending, done or dead").DataType("string")).
+			Param(service.QueryParameter("event_type", "Only list events of this type").DataType("string")).
+			Param(service.QueryParameter("limit", "At most this many events, up to 500").DataType("integer")).
+			Produces(restful.MIME_JSON).
+			Writes(ListEventsResponse{}).
+			Returns(http.StatusOK, "Fetched events", ListEventsResponse{}).
+			Returns(http.StatusBadRequest, "Invalid status or limit", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a Site Admin", nil))
+	service.Route(
+		service.GET("/{eventId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DescribeEventHandler).
+			Doc("Fetch an outbox event, including its last error").
+			Produces(restful.MIME_JSON).
+			Writes(outbox.Event{}).
+			Returns(http.StatusOK, "Fetched event", outbox.Event{}).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a Site Admin", nil).
+			Returns(http.StatusNotFound, "Event not found", nil))
+	service.Route(
+		service.POST("/{eventId}/replay").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ReplayEventHandler).
+			Doc("Return a dead-lettered event to the queue").
+			Produces(restful.MIME_JSON).
+			Returns(http.StatusOK, "Event queued", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a Site Admin", nil).
+			Returns(http.StatusNotFound, "Event not found", nil).
+			Returns(http.StatusConflict, "Event is not dead-lettered", nil))
+
+	return service
+}
+
+func (server *OutboxServer) ListEventsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListEventsHandler",
+	})
+	if !requireSiteAdmin(request, response) {
+		return
+	}
+
+	status := request.QueryParameter("status")
+	switch status {
+	case "":
+		status = outbox.StatusDead
+	case outbox.StatusPending, outbox.StatusDone, outbox.StatusDead:
+	default:
+		response.WriteErrorString(http.StatusBadRequest, "status must be one of pending, done or dead")
+		return
+	}
+	limit := defaultListLimit
+	if param := request.QueryParameter("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			response.WriteErrorString(http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+
+	eventSet, err := outbox.ListEvents(ctx, server.Config.GetDbConn(), status, request.QueryParameter("event_type"), limit)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListEventsResponse{Events: eventSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize events")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseEventId reads the eventId path parameter. On failure it writes the
+// response and returns false.
+func parseEventId(request *restful.Request, response *restful.Response) (uint64, bool) {
+	eventId, err := strconv.ParseUint(request.PathParameter("eventId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid event ID")
+		return 0, false
+	}
+	return eventId, true
+}
+
+func (server *OutboxServer) DescribeEventHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "DescribeEventHandler",
+	})
+	if !requireSiteAdmin(request, response) {
+		return
+	}
+	eventId, ok := parseEventId(request, response)
+	if !ok {
+		return
+	}
+
+	event, err := outbox.DescribeEvent(ctx, server.Config.GetDbConn(), eventId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.WithError(err).Error("Failed to fetch event")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(event)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize event")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *OutboxServer) ReplayEventHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	if !requireSiteAdmin(request, response) {
+		return
+	}
+	eventId, ok := parseEventId(request, response)
+	if !ok {
+		return
+	}
+
+	err := outbox.Replay(ctx, server.Config.GetDbConn(), eventId)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			response.WriteHeader(http.StatusNotFound)
+		case outbox.ErrNotDead:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"context"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type OutboxTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestOutboxTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(OutboxTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping OutboxTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+// enqueue commits an event, and returns its ID.
+func (suite *OutboxTestSuite) enqueue(eventType string, payload interface{}) uint64 {
+	db := suite.Config.GetDbConn()
+	tx, err := db.Beginx()
+	suite.Require().Nil(err)
+	defer tx.Rollback()
+	suite.Require().Nil(Enqueue(context.Background(), tx, eventType, payload))
+	var id uint64
+	suite.Require().Nil(tx.Get(&id, `SELECT max(id) FROM outbox_events`))
+	suite.Require().Nil(tx.Commit())
+	return id
+}
+
+// makeAvailable skips the event's retry delay.
+func (suite *OutboxTestSuite) makeAvailable(id uint64) {
+	_, err := suite.Config.GetDbConn().Exec(`UPDATE outbox_events SET available_at = now() - interval '1 second' WHERE id = $1`, id)
+	suite.Require().Nil(err)
+}
+
+func (suite *OutboxTestSuite) describe(id uint64) *Event {
+	event, err := DescribeEvent(context.Background(), suite.Config.GetDbConn(), id)
+	suite.Require().Nil(err)
+	return event
+}
@@ -0,0 +1,222 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Handler processes one event. It runs in the transaction that marks the
+// event done, so anything it writes through tx commits if and only if it
+// succeeds. Returning an error schedules a retry.
+type Handler func(ctx context.Context, tx *sqlx.Tx, event Event) error
+
+// Defaults for a new Worker.
+const (
+	DefaultConcurrency     = 4
+	DefaultPollInterval    = time.Second
+	DefaultMaxAttempts     = 8
+	DefaultBackoff         = 10 * time.Second
+	DefaultMaxBackoff      = time.Hour
+	DefaultRetainProcessed = 7 * 24 * time.Hour
+)
+
+// Worker is a pool of goroutines that process outbox events. Any number of
+// workers, in any number of replicas, may run against the same table.
+type Worker struct {
+	db       *sqlx.DB
+	handlers map[string][]Handler
+
+	Concurrency     int
+	PollInterval    time.Duration // wait when the queue is empty
+	MaxAttempts     int           // before an event is dead-lettered
+	Backoff         time.Duration // before the first retry, doubled for each one after
+	MaxBackoff      time.Duration
+	RetainProcessed time.Duration // how long processed events are kept
+}
+
+func NewWorker(db *sqlx.DB) *Worker {
+	return &Worker{
+		db:              db,
+		handlers:        make(map[string][]Handler),
+		Concurrency:     DefaultConcurrency,
+		PollInterval:    DefaultPollInterval,
+		MaxAttempts:     DefaultMaxAttempts,
+		Backoff:         DefaultBackoff,
+		MaxBackoff:      DefaultMaxBackoff,
+		RetainProcessed: DefaultRetainProcessed,
+	}
+}
+
+// Handle registers a handler for an event type. Handlers for the same type
+// run in the order they were registered, in one transaction: if any fails,
+// the event is retried from the first. Register handlers before calling Run.
+func (w *Worker) Handle(eventType string, handler Handler) {
+	w.handlers[eventType] = append(w.handlers[eventType], handler)
+}
+
+// retryDelay is how long to wait before the next attempt, after the given
+// number of failed attempts.
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.Backoff
+	for i := 1; i < attempts && delay < w.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.MaxBackoff {
+		delay = w.MaxBackoff
+	}
+	return delay
+}
+
+// runHandler calls the handler, turning a panic into an error so that one
+// bad event cannot take down the worker.
+func runHandler(ctx context.Context, handler Handler, tx *sqlx.Tx, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, tx, event)
+}
+
+// ProcessOne claims and processes the next available event. It reports
+// whether there was one.
+func (w *Worker) ProcessOne(ctx context.Context) (bool, error) {
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var event Event
+	err = tx.GetContext(ctx, &event, tx.Rebind(claimEventSql))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "outbox.ProcessOne",
+		"EventID":   event.Id,
+		"EventType": event.EventType,
+	})
+
+	// The savepoint lets a failed handler's writes be undone while the
+	// retry bookkeeping is still saved.
+	_, err = tx.ExecContext(ctx, "SAVEPOINT outbox_handler")
+	if err != nil {
+		return false, err
+	}
+	attempts := event.Attempts + 1
+	handlers, ok := w.handlers[event.EventType]
+	if ok {
+		for _, handler := range handlers {
+			if err = runHandler(ctx, handler, tx, event); err != nil {
+				break
+			}
+		}
+	} else {
+		err = fmt.Errorf("no handler for event type %q", event.EventType)
+		attempts = w.MaxAttempts // it will not get one by retrying
+	}
+
+	if err == nil {
+		_, err = tx.ExecContext(ctx, tx.Rebind(markDoneSql), event.Id)
+		if err != nil {
+			return true, err
+		}
+		return true, tx.Commit()
+	}
+
+	handlerErr := err
+	_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT outbox_handler")
+	if err != nil {
+		return true, err
+	}
+	status := StatusPending
+	if attempts >= w.MaxAttempts {
+		status = StatusDead
+		logger.WithError(handlerErr).WithField("Attempts", attempts).Error("Dead-lettering event")
+	} else {
+		logger.WithError(handlerErr).WithField("Attempts", attempts).Warn("Failed to process event, will retry")
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(markFailedSql),
+		status, attempts, handlerErr.Error(), time.Now().Add(w.retryDelay(attempts)), event.Id)
+	if err != nil {
+		return true, err
+	}
+	return true, tx.Commit()
+}
+
+// PurgeProcessed deletes events processed before the cutoff.
+func (w *Worker) PurgeProcessed(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := w.db.ExecContext(ctx, w.db.Rebind(purgeProcessedSql), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (w *Worker) poll(ctx context.Context, id int) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "outbox.Worker",
+		"Worker":    id,
+	})
+	for {
+		processed, err := w.ProcessOne(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).Error("Failed to process outbox")
+		}
+		if processed && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+func (w *Worker) purge(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		purged, err := w.PurgeProcessed(ctx, time.Now().Add(-w.RetainProcessed))
+		if err != nil && ctx.Err() == nil {
+			filters.GetContextLogger(ctx).WithError(err).Error("Failed to purge processed events")
+		} else if purged > 0 {
+			filters.GetContextLogger(ctx).WithField("Purged", purged).Debug("Purged processed events")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run processes events until the context is cancelled, then waits for the
+// events in progress to finish.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			w.poll(ctx, id)
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.purge(ctx)
+	}()
+	wg.Wait()
+}
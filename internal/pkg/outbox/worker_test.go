@@ -0,0 +1,224 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"testing"
+	"time"
+)
+
+func TestWorker_retryDelay(t *testing.T) {
+	w := NewWorker(nil)
+	w.Backoff = 10 * time.Second
+	w.MaxBackoff = time.Minute
+
+	expected := map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		9: time.Minute,
+	}
+	for attempts, delay := range expected {
+		if got := w.retryDelay(attempts); got != delay {
+			t.Errorf("After %d attempts: expected %v, got %v", attempts, delay, got)
+		}
+	}
+}
+
+func TestRunHandler_RecoversPanic(t *testing.T) {
+	panics := func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		panic("boom")
+	}
+	err := runHandler(context.Background(), panics, nil, Event{})
+	if err == nil || err.Error() != "handler panicked: boom" {
+		t.Errorf("Expected the panic to become an error, got %v", err)
+	}
+
+	failure := errors.New("failed")
+	fails := func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		return failure
+	}
+	if err = runHandler(context.Background(), fails, nil, Event{}); err != failure {
+		t.Errorf("Expected the handler's error, got %v", err)
+	}
+}
+
+func TestEvent_Decode(t *testing.T) {
+	var payload struct {
+		SiteSlug string `json:"site_slug"`
+	}
+	err := Event{Payload: `{"site_slug": "downtown"}`}.Decode(&payload)
+	if err != nil || payload.SiteSlug != "downtown" {
+		t.Errorf("Expected to decode the payload, got %v and %+v", err, payload)
+	}
+}
+
+func (suite *OutboxTestSuite) TestProcessOne_SkipsLockedEvents() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	first := suite.enqueue("test.event", map[string]int{"n": 1})
+	second := suite.enqueue("test.event", map[string]int{"n": 2})
+
+	// Another worker holds the first event.
+	held, err := db.Beginx()
+	suite.Require().Nil(err)
+	defer held.Rollback()
+	var claimed Event
+	suite.Require().Nil(held.Get(&claimed, claimEventSql))
+	suite.Require().Equal(first, claimed.Id)
+
+	processed := make([]uint64, 0)
+	w := NewWorker(db)
+	w.Handle("test.event", func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		processed = append(processed, event.Id)
+		return nil
+	})
+
+	ok, err := w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+	suite.Equal([]uint64{second}, processed, "Expected the worker to skip the event another worker holds")
+
+	ok, err = w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.False(ok, "Expected nothing else to be available while the first event is held")
+
+	suite.Require().Nil(held.Rollback())
+	ok, err = w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+	suite.Equal([]uint64{second, first}, processed, "Expected the first event once it is released")
+	suite.Equal(StatusDone, suite.describe(first).Status)
+	suite.Equal(StatusDone, suite.describe(second).Status)
+}
+
+func (suite *OutboxTestSuite) TestProcessOne_RollsBackFailedHandler() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	id := suite.enqueue("test.event", nil)
+
+	fail := true
+	w := NewWorker(db)
+	w.Handle("test.event", func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		_, err := tx.ExecContext(ctx, `UPDATE organizations SET name = 'renamed' WHERE id = 1`)
+		return err
+	})
+	w.Handle("test.event", func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	ok, err := w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+
+	var name string
+	suite.Require().Nil(db.Get(&name, `SELECT name FROM organizations WHERE id = 1`))
+	suite.Equal("testorg1", name, "Expected the first handler's write to be rolled back when the second fails")
+	event := suite.describe(id)
+	suite.Equal(StatusPending, event.Status)
+	suite.Equal(1, event.Attempts)
+	suite.Equal("failed", event.LastError)
+	suite.True(event.AvailableAt.After(event.CreatedAt), "Expected the retry to be delayed")
+
+	fail = false
+	suite.makeAvailable(id)
+	ok, err = w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+
+	suite.Require().Nil(db.Get(&name, `SELECT name FROM organizations WHERE id = 1`))
+	suite.Equal("renamed", name, "Expected the handlers' writes to commit once they succeed")
+	event = suite.describe(id)
+	suite.Equal(StatusDone, event.Status)
+	suite.Equal(2, event.Attempts)
+	suite.Equal("", event.LastError)
+	suite.NotNil(event.ProcessedAt)
+}
+
+func (suite *OutboxTestSuite) TestProcessOne_DeadLetters() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	id := suite.enqueue("test.event", nil)
+	unhandled := suite.enqueue("test.unhandled", nil)
+
+	w := NewWorker(db)
+	w.MaxAttempts = 3
+	w.Handle("test.event", func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		return errors.New("failed")
+	})
+
+	for attempt := 1; attempt <= w.MaxAttempts; attempt++ {
+		suite.makeAvailable(id)
+		ok, err := w.ProcessOne(ctx)
+		suite.Require().Nil(err)
+		suite.True(ok)
+		if attempt == 1 {
+			// The unhandled event is next in line, and gives up at once.
+			ok, err = w.ProcessOne(ctx)
+			suite.Require().Nil(err)
+			suite.True(ok)
+		}
+		event := suite.describe(id)
+		suite.Equal(attempt, event.Attempts)
+		if attempt < w.MaxAttempts {
+			suite.Equal(StatusPending, event.Status)
+		} else {
+			suite.Equal(StatusDead, event.Status, "Expected the event to be dead-lettered after MaxAttempts")
+		}
+	}
+
+	event := suite.describe(unhandled)
+	suite.Equal(StatusDead, event.Status, "Expected an event without a handler to be dead-lettered right away")
+	suite.Equal(`no handler for event type "test.unhandled"`, event.LastError)
+
+	suite.makeAvailable(id)
+	ok, err := w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.False(ok, "Expected dead events not to be claimed")
+
+	dead, err := ListEvents(ctx, db, StatusDead, "test.event", 10)
+	suite.Require().Nil(err)
+	suite.Require().Len(dead, 1)
+	suite.Equal(id, dead[0].Id)
+}
+
+func (suite *OutboxTestSuite) TestReplay() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	id := suite.enqueue("test.unhandled", nil)
+	pending := suite.enqueue("test.event", nil)
+	_, err := db.Exec(`UPDATE outbox_events SET available_at = now() + interval '1 hour' WHERE id = $1`, pending)
+	suite.Require().Nil(err)
+
+	w := NewWorker(db)
+	ok, err := w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+	suite.Require().Equal(StatusDead, suite.describe(id).Status)
+
+	suite.Equal(ErrNotDead, Replay(ctx, db, pending), "Expected a pending event not to be replayable")
+	suite.Equal(sql.ErrNoRows, Replay(ctx, db, id+100), "Expected a missing event not to be replayable")
+
+	suite.Require().Nil(Replay(ctx, db, id))
+	event := suite.describe(id)
+	suite.Equal(StatusPending, event.Status)
+	suite.Equal(0, event.Attempts)
+	suite.Equal("", event.LastError)
+
+	handled := false
+	w.Handle("test.unhandled", func(ctx context.Context, tx *sqlx.Tx, event Event) error {
+		handled = true
+		return nil
+	})
+	ok, err = w.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(ok)
+	suite.True(handled, "Expected the replayed event to be processed again")
+	suite.Equal(StatusDone, suite.describe(id).Status)
+}
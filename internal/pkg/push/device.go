@@ -0,0 +1,103 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Platforms a device may be registered for.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web"
+)
+
+const MaxTokenLength = 4096
+
+// Device is a phone or browser registered to receive a user's push
+// notifications.
+type Device struct {
+	Id              uint64     `json:"id" db:"id"`
+	UserId          uint64     `json:"-" db:"user_id"`
+	Platform        string     `json:"platform" db:"platform"`
+	Token           string     `json:"token" db:"token"`
+	FailureCount    int        `json:"-" db:"failure_count"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty" db:"last_delivered_at"`
+}
+
+func ValidPlatform(platform string) bool {
+	switch platform {
+	case PlatformIOS, PlatformAndroid, PlatformWeb:
+		return true
+	}
+	return false
+}
+
+// Validate checks the fields a user controls when registering a device.
+func (d Device) Validate() error {
+	if !ValidPlatform(d.Platform) {
+		return fmt.Errorf("platform must be one of %s, %s or %s", PlatformIOS, PlatformAndroid, PlatformWeb)
+	}
+	if len(d.Token) == 0 {
+		return errors.New("token must be present")
+	}
+	if len(d.Token) > MaxTokenLength {
+		return fmt.Errorf("token may be at most %d characters", MaxTokenLength)
+	}
+	return nil
+}
+
+// RegisterDevice saves the device for the user. If the token was already
+// registered, it is moved to this user and its failures are forgotten.
+func RegisterDevice(ctx context.Context, db *sqlx.DB, userId uint64, platform, token string) (*Device, error) {
+	var d Device
+	err := db.GetContext(ctx, &d, db.Rebind(registerDeviceSql), userId, platform, token)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "RegisterDevice",
+			"UserID":    userId,
+			"Platform":  platform,
+		}).WithError(err).Error("Failed to register device")
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListUserDevices fetches the devices registered to the user.
+func ListUserDevices(ctx context.Context, db *sqlx.DB, userId uint64) ([]Device, error) {
+	deviceSet := make([]Device, 0)
+	err := db.SelectContext(ctx, &deviceSet, db.Rebind(listUserDevicesSql), userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ListUserDevices",
+			"UserID":    userId,
+		}).WithError(err).Error("Failed to select devices")
+		return nil, err
+	}
+	return deviceSet, nil
+}
+
+func deleteDevice(ctx context.Context, db *sqlx.DB, id uint64) error {
+	_, err := db.ExecContext(ctx, db.Rebind(deleteDeviceSql), id)
+	return err
+}
+
+func recordDelivery(ctx context.Context, db *sqlx.DB, id uint64) error {
+	_, err := db.ExecContext(ctx, db.Rebind(recordDeliverySql), id)
+	return err
+}
+
+// recordFailure counts a failed delivery, and returns the number of
+// consecutive failures.
+func recordFailure(ctx context.Context, db *sqlx.DB, id uint64) (int, error) {
+	var failures int
+	err := db.GetContext(ctx, &failures, db.Rebind(recordFailureSql), id)
+	return failures, err
+}
@@ -0,0 +1,85 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// ErrInvalidToken is returned by a Provider when the device's token has been
+// revoked or was never valid. The device will never receive messages again,
+// so it is not retried.
+var ErrInvalidToken = errors.New("device token is not valid")
+
+// Message is a push notification.
+type Message struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Provider delivers messages to devices, such as through APNs or Firebase.
+// Send should return an error wrapping ErrInvalidToken when the provider
+// reports the token is invalid; any other error is retried.
+type Provider interface {
+	Send(ctx context.Context, device Device, msg Message) error
+}
+
+// LogProvider writes messages to the log instead of delivering them. It is
+// used in development, where there are no provider credentials.
+type LogProvider struct{}
+
+func (LogProvider) Send(ctx context.Context, device Device, msg Message) error {
+	filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "LogProvider.Send",
+		"DeviceID":  device.Id,
+		"Platform":  device.Platform,
+		"Title":     msg.Title,
+	}).Info(msg.Body)
+	return nil
+}
+
+// FakeDelivery is a message accepted by a FakeProvider.
+type FakeDelivery struct {
+	Token   string
+	Message Message
+}
+
+// FakeProvider records the messages it is sent, for tests. Tokens in
+// InvalidTokens are rejected with ErrInvalidToken, and each token in
+// Failures fails that many times before it is accepted.
+type FakeProvider struct {
+	mu            sync.Mutex
+	Sent          []FakeDelivery
+	InvalidTokens map[string]bool
+	Failures      map[string]int
+	Attempts      int
+}
+
+// ErrFakeUnavailable is the transient error returned by a FakeProvider.
+var ErrFakeUnavailable = errors.New("fake provider unavailable")
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		Sent:          make([]FakeDelivery, 0),
+		InvalidTokens: make(map[string]bool),
+		Failures:      make(map[string]int),
+	}
+}
+
+func (p *FakeProvider) Send(ctx context.Context, device Device, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Attempts++
+	if p.InvalidTokens[device.Token] {
+		return ErrInvalidToken
+	}
+	if p.Failures[device.Token] > 0 {
+		p.Failures[device.Token]--
+		return ErrFakeUnavailable
+	}
+	p.Sent = append(p.Sent, FakeDelivery{Token: device.Token, Message: msg})
+	return nil
+}
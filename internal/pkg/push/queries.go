@@ -0,0 +1,36 @@
+package push
+
+const selectDeviceColumns = `
+	SELECT id, user_id, platform, token, failure_count, created_at, updated_at, last_delivered_at
+	FROM push_devices
+`
+
+const listUserDevicesSql = selectDeviceColumns + `
+	WHERE user_id = ?
+	ORDER BY id
+`
+
+// Registering a known token moves it to the new user and gives it a fresh
+// start.
+const registerDeviceSql = `
+	INSERT INTO push_devices (user_id, platform, token) VALUES (?, ?, ?)
+	ON CONFLICT (token) DO UPDATE SET
+		user_id = EXCLUDED.user_id,
+		platform = EXCLUDED.platform,
+		failure_count = 0,
+		updated_at = now()
+	RETURNING id, user_id, platform, token, failure_count, created_at, updated_at, last_delivered_at
+`
+
+const deleteDeviceSql = `
+	DELETE FROM push_devices WHERE id = ?
+`
+
+const recordDeliverySql = `
+	UPDATE push_devices SET failure_count = 0, last_delivered_at = now() WHERE id = ?
+`
+
+const recordFailureSql = `
+	UPDATE push_devices SET failure_count = failure_count + 1 WHERE id = ?
+	RETURNING failure_count
+`
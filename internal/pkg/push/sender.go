@@ -0,0 +1,119 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Defaults for a new Sender.
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = time.Second
+	DefaultMaxFailures = 5
+)
+
+// Sender delivers messages to a user's devices through a Provider. Each
+// message is retried with exponential backoff. Devices whose tokens the
+// provider rejects are removed at once, and devices that fail MaxFailures
+// deliveries in a row are removed as unresponsive.
+type Sender struct {
+	Provider    Provider
+	MaxAttempts int           // tries per message and device
+	Backoff     time.Duration // wait before the first retry, doubled for each one after
+	MaxFailures int           // failed deliveries in a row before a device is removed
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewSender(provider Provider) *Sender {
+	return &Sender{
+		Provider:    provider,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxFailures: DefaultMaxFailures,
+		sleep:       sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// deliver sends the message to one device, retrying transient failures.
+// It returns the last error if every attempt failed.
+func (s *Sender) deliver(ctx context.Context, device Device, msg Message) error {
+	backoff := s.Backoff
+	var err error
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		err = s.Provider.Send(ctx, device, msg)
+		if err == nil || errors.Is(err, ErrInvalidToken) || attempt == s.MaxAttempts {
+			return err
+		}
+		if sleepErr := s.sleep(ctx, backoff); sleepErr != nil {
+			return err
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// SendToUser delivers the message to each of the user's devices, and returns
+// how many of them received it. It only returns an error if the devices
+// could not be loaded; failed deliveries are recorded against the device.
+func (s *Sender) SendToUser(ctx context.Context, db *sqlx.DB, userId uint64, msg Message) (int, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SendToUser",
+		"UserID":    userId,
+	})
+
+	deviceSet, err := ListUserDevices(ctx, db, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, device := range deviceSet {
+		deviceLogger := logger.WithField("DeviceID", device.Id)
+		err = s.deliver(ctx, device, msg)
+		if err == nil {
+			delivered++
+			if err = recordDelivery(ctx, db, device.Id); err != nil {
+				deviceLogger.WithError(err).Error("Failed to record delivery")
+			}
+			continue
+		}
+
+		if errors.Is(err, ErrInvalidToken) {
+			deviceLogger.Info("Removing device with invalid token")
+			if err = deleteDevice(ctx, db, device.Id); err != nil {
+				deviceLogger.WithError(err).Error("Failed to remove device")
+			}
+			continue
+		}
+
+		deviceLogger.WithError(err).Warn("Failed to deliver push notification")
+		failures, err := recordFailure(ctx, db, device.Id)
+		if err != nil {
+			deviceLogger.WithError(err).Error("Failed to record delivery failure")
+			continue
+		}
+		if failures >= s.MaxFailures {
+			deviceLogger.WithField("Failures", failures).Info("Removing unresponsive device")
+			if err = deleteDevice(ctx, db, device.Id); err != nil {
+				deviceLogger.WithError(err).Error("Failed to remove device")
+			}
+		}
+	}
+	return delivered, nil
+}
@@ -0,0 +1,80 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSender(provider Provider) (*Sender, *[]time.Duration) {
+	waits := make([]time.Duration, 0)
+	s := NewSender(provider)
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return s, &waits
+}
+
+func TestSender_deliverRetriesWithBackoff(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Failures["flaky"] = 2
+	s, waits := newTestSender(provider)
+
+	err := s.deliver(context.Background(), Device{Token: "flaky"}, Message{Title: "Hello"})
+	if err != nil {
+		t.Fatalf("Expected delivery to succeed on the last attempt, got %v", err)
+	}
+	if provider.Attempts != 3 || len(provider.Sent) != 1 {
+		t.Errorf("Expected 3 attempts and 1 delivery, got %d and %d", provider.Attempts, len(provider.Sent))
+	}
+	if expected := []time.Duration{DefaultBackoff, 2 * DefaultBackoff}; !reflect.DeepEqual(*waits, expected) {
+		t.Errorf("Expected waits of %v, got %v", expected, *waits)
+	}
+}
+
+func TestSender_deliverGivesUp(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.Failures["down"] = 10
+	s, waits := newTestSender(provider)
+
+	err := s.deliver(context.Background(), Device{Token: "down"}, Message{})
+	if !errors.Is(err, ErrFakeUnavailable) {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+	if provider.Attempts != DefaultMaxAttempts || len(*waits) != DefaultMaxAttempts-1 {
+		t.Errorf("Expected %d attempts, got %d with %d waits", DefaultMaxAttempts, provider.Attempts, len(*waits))
+	}
+}
+
+func TestSender_deliverInvalidToken(t *testing.T) {
+	provider := NewFakeProvider()
+	provider.InvalidTokens["revoked"] = true
+	s, waits := newTestSender(provider)
+
+	err := s.deliver(context.Background(), Device{Token: "revoked"}, Message{})
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+	if provider.Attempts != 1 || len(*waits) != 0 {
+		t.Errorf("Expected an invalid token not to be retried, got %d attempts", provider.Attempts)
+	}
+}
+
+func TestDevice_Validate(t *testing.T) {
+	if err := (Device{Platform: PlatformAndroid, Token: "abc"}).Validate(); err != nil {
+		t.Errorf("Expected device to be valid, got %v", err)
+	}
+	testCases := map[string]Device{
+		"no platform":  {Token: "abc"},
+		"bad platform": {Platform: "blackberry", Token: "abc"},
+		"no token":     {Platform: PlatformIOS},
+	}
+	for name, d := range testCases {
+		if err := d.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package reports
+
+// Aggregates approved work logs. The grouping's key, label and join clauses
+// and the optional site filter are substituted in by buildQuery; they are
+// never taken from user input.
+const hoursReportSqlTemplate = `
+	SELECT
+		%s AS group_key,
+		%s AS label,
+		SUM(EXTRACT(EPOCH FROM (work_logs.clock_out - work_logs.clock_in))) / 3600.0 AS hours,
+		COUNT(*) AS work_logs
+	FROM work_logs
+		%s
+	WHERE work_logs.organization_id = ? AND work_logs.status = 'approved'
+		AND work_logs.clock_in >= ? AND work_logs.clock_in < ?
+		%s
+	GROUP BY 1, 2
+`
+
+const siteFilterSql = `AND work_logs.site_id = ?`
+
+const selectHoursReportPageSql = `
+	SELECT group_key, label, hours, work_logs FROM (%s) report
+	ORDER BY group_key
+	LIMIT ? OFFSET ?
+`
+
+const selectHoursReportTotalsSql = `
+	SELECT COUNT(*) AS total_rows, COALESCE(SUM(hours), 0) AS total_hours FROM (%s) report
+`
+
+const selectHoursReportAllSql = `
+	SELECT group_key, label, hours, work_logs FROM (%s) report
+	ORDER BY group_key
+`
@@ -0,0 +1,239 @@
+package reports
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ways to group the hours report.
+const (
+	GroupByVolunteer = "volunteer"
+	GroupBySite      = "site"
+	GroupByWeek      = "week"
+	GroupByMonth     = "month"
+	GroupByRole      = "role"
+)
+
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 500
+)
+
+type grouping struct {
+	key   string // SQL expression for the group's key
+	label string // SQL expression for the group's human-readable name
+	join  string
+	inTz  bool // whether key takes the report's time zone as a parameter
+}
+
+var groupings = map[string]grouping{
+	GroupByVolunteer: {
+		key:   "users.user_guid",
+		label: "users.email",
+		join:  "JOIN users ON users.id = work_logs.user_id",
+	},
+	GroupBySite: {
+		key:   "sites.slug",
+		label: "sites.name_l10n",
+		join:  "JOIN sites ON sites.id = work_logs.site_id",
+	},
+	GroupByWeek: {
+		key:   "to_char(date_trunc('week', work_logs.clock_in AT TIME ZONE ?), 'YYYY-MM-DD')",
+		label: "''",
+		inTz:  true,
+	},
+	GroupByMonth: {
+		key:   "to_char(date_trunc('month', work_logs.clock_in AT TIME ZONE ?), 'YYYY-MM')",
+		label: "''",
+		inTz:  true,
+	},
+	// Work logged against a shift counts towards the shift's role. Other work
+	// is grouped under an empty key.
+	GroupByRole: {
+		key:   "COALESCE(shifts.role::text, '')",
+		label: "''",
+		join:  "LEFT OUTER JOIN shifts ON shifts.id = work_logs.shift_id",
+	},
+}
+
+// HoursReportParams selects the approved work to aggregate.
+type HoursReportParams struct {
+	OrganizationId uint64
+	SiteId         uint64 // optional
+	GroupBy        string
+	From           time.Time // inclusive
+	To             time.Time // exclusive
+	Location       *time.Location
+	Page           int // 1-based
+	PerPage        int
+}
+
+func (p HoursReportParams) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if p.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("organization_id must be present"))
+	}
+	if _, ok := groupings[p.GroupBy]; !ok {
+		errSet = append(errSet, errors.New("group_by must be one of volunteer, site, week, month or role"))
+	}
+	if p.From.IsZero() || p.To.IsZero() || !p.To.After(p.From) {
+		errSet = append(errSet, errors.New("from and to must give a date range"))
+	}
+	if p.Page < 1 {
+		errSet = append(errSet, errors.New("page must be at least 1"))
+	}
+	if p.PerPage < 1 || p.PerPage > MaxPerPage {
+		errSet = append(errSet, fmt.Errorf("per_page must be between 1 and %d", MaxPerPage))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+// buildQuery returns the grouped aggregation as a subquery, and its
+// arguments.
+func (p HoursReportParams) buildQuery() (string, []interface{}) {
+	g := groupings[p.GroupBy]
+	args := make([]interface{}, 0, 5)
+	if g.inTz {
+		loc := p.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		args = append(args, loc.String())
+	}
+	args = append(args, p.OrganizationId, p.From, p.To)
+	siteFilter := ""
+	if p.SiteId != 0 {
+		siteFilter = siteFilterSql
+		args = append(args, p.SiteId)
+	}
+	return fmt.Sprintf(hoursReportSqlTemplate, g.key, g.label, g.join, siteFilter), args
+}
+
+// HoursReportRow is one group's approved hours.
+type HoursReportRow struct {
+	Key      string  `json:"key" db:"group_key"`
+	Label    string  `json:"label" db:"label"`
+	Hours    float64 `json:"hours" db:"hours"`
+	WorkLogs int     `json:"work_logs" db:"work_logs"`
+}
+
+type HoursReport struct {
+	GroupBy    string           `json:"group_by"`
+	Rows       []HoursReportRow `json:"rows"`
+	Page       int              `json:"page"`
+	PerPage    int              `json:"per_page"`
+	TotalRows  int              `json:"total_rows" db:"total_rows"`
+	TotalHours float64          `json:"total_hours" db:"total_hours"`
+}
+
+// fillLabels names the groups whose SQL has no label of its own.
+func fillLabels(groupBy string, rows []HoursReportRow) {
+	for i := range rows {
+		switch groupBy {
+		case GroupByWeek, GroupByMonth:
+			rows[i].Label = rows[i].Key
+		case GroupByRole:
+			role, err := strconv.Atoi(rows[i].Key)
+			if err != nil {
+				rows[i].Label = "Unscheduled"
+			} else {
+				rows[i].Label = users.RoleType(role).String()
+			}
+		}
+	}
+}
+
+// GetHoursReport fetches one page of the report, with totals across all
+// pages.
+func GetHoursReport(ctx context.Context, db *sqlx.DB, params HoursReportParams) (*HoursReport, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "GetHoursReport",
+		"OrganizationID": params.OrganizationId,
+		"GroupBy":        params.GroupBy,
+	})
+
+	query, args := params.buildQuery()
+	report := HoursReport{
+		GroupBy: params.GroupBy,
+		Rows:    make([]HoursReportRow, 0),
+		Page:    params.Page,
+		PerPage: params.PerPage,
+	}
+	err := db.GetContext(ctx, &report, db.Rebind(fmt.Sprintf(selectHoursReportTotalsSql, query)), args...)
+	if err != nil {
+		logger.WithError(err).Error("Failed to total report")
+		return nil, err
+	}
+
+	pageArgs := append(args, params.PerPage, (params.Page-1)*params.PerPage)
+	err = db.SelectContext(ctx, &report.Rows, db.Rebind(fmt.Sprintf(selectHoursReportPageSql, query)), pageArgs...)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select report rows")
+		return nil, err
+	}
+	fillLabels(params.GroupBy, report.Rows)
+	return &report, nil
+}
+
+// GetAllHoursReportRows fetches every row of the report, for export.
+func GetAllHoursReportRows(ctx context.Context, db *sqlx.DB, params HoursReportParams) ([]HoursReportRow, error) {
+	query, args := params.buildQuery()
+	rows := make([]HoursReportRow, 0)
+	err := db.SelectContext(ctx, &rows, db.Rebind(fmt.Sprintf(selectHoursReportAllSql, query)), args...)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"OrganizationID": params.OrganizationId,
+			"GroupBy":        params.GroupBy,
+		}).WithError(err).Error("Failed to select report rows")
+		return nil, err
+	}
+	fillLabels(params.GroupBy, rows)
+	return rows, nil
+}
+
+// csvSafe keeps spreadsheet programs from evaluating a cell as a formula.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// WriteCSV writes the rows with a header line.
+func WriteCSV(w io.Writer, groupBy string, rows []HoursReportRow) error {
+	out := csv.NewWriter(w)
+	err := out.Write([]string{groupBy, "label", "hours", "work_logs"})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err = out.Write([]string{
+			csvSafe(row.Key),
+			csvSafe(row.Label),
+			strconv.FormatFloat(row.Hours, 'f', 2, 64),
+			strconv.Itoa(row.WorkLogs),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHoursReportParams_Validate(t *testing.T) {
+	valid := HoursReportParams{
+		OrganizationId: 1,
+		GroupBy:        GroupByWeek,
+		From:           time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2020, time.April, 1, 0, 0, 0, 0, time.UTC),
+		Page:           1,
+		PerPage:        DefaultPerPage,
+	}
+	if errs := valid.Validate(); errs != nil {
+		t.Errorf("Expected params to be valid, got %v", errs)
+	}
+
+	invalid := HoursReportParams{GroupBy: "year", From: valid.To, To: valid.From, PerPage: MaxPerPage + 1}
+	errs := invalid.Validate()
+	if errs == nil || len(errs.Errors) != 5 {
+		t.Errorf("Expected 5 validation errors, got %v", errs)
+	}
+}
+
+func TestHoursReportParams_buildQuery(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	p := HoursReportParams{OrganizationId: 1, SiteId: 2, GroupBy: GroupByMonth, Location: loc}
+	query, args := p.buildQuery()
+	if strings.Count(query, "?") != len(args) {
+		t.Errorf("Expected %d placeholders, got query %s", len(args), query)
+	}
+	if args[0] != "America/New_York" || args[1] != uint64(1) || args[4] != uint64(2) {
+		t.Errorf("Arguments are out of order: %v", args)
+	}
+
+	p = HoursReportParams{OrganizationId: 1, GroupBy: GroupByVolunteer}
+	query, args = p.buildQuery()
+	if strings.Count(query, "?") != 3 || len(args) != 3 {
+		t.Errorf("Expected only the organization and date range arguments, got %v", args)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rows := []HoursReportRow{
+		{Key: "2", Label: "Volunteer", Hours: 12.5, WorkLogs: 3},
+		{Key: "", Label: "=HYPERLINK(\"x\")", Hours: 1.0 / 3, WorkLogs: 1},
+	}
+	fillLabels(GroupByRole, rows[:1])
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, GroupByRole, rows); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	expected := "role,label,hours,work_logs\n" +
+		"2,Volunteer,12.50,3\n" +
+		",\"'=HYPERLINK(\"\"x\"\")\",0.33,1\n"
+	if buf.String() != expected {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/reports"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ReportsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *ReportsServer {
+	return &ReportsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+func (server *ReportsServer) GetReportsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/reports").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	reportParams := func(builder *restful.RouteBuilder) {
+		builder.
+			Param(restful.QueryParameter("organization_id", "Organization to report on")).
+			Param(restful.QueryParameter("from", "First date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("to", "Last date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("group_by", "One of volunteer, site, week, month or role")).
+			Param(restful.QueryParameter("site", "Only include work at this site (optional)")).
+			Param(restful.QueryParameter("timezone", "Time zone to interpret the dates and weeks in. Defaults to UTC."))
+	}
+
+	service.Route(
+		service.GET("/hours").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.HoursReportHandler).
+			Doc("Total approved hours, grouped by volunteer, site, week, month or role").
+			Do(reportParams).
+			Param(restful.QueryParameter("page", "Page number, starting from 1")).
+			Param(restful.QueryParameter("per_page", fmt.Sprintf("Rows per page, at most %d", reports.MaxPerPage))).
+			Produces(restful.MIME_JSON).
+			Writes(reports.HoursReport{}).
+			Returns(http.StatusOK, "Generated report", reports.HoursReport{}).
+			Returns(http.StatusBadRequest, "Invalid report parameters", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not generate reports for the organization", nil))
+	service.Route(
+		service.GET("/hours.csv").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.HoursReportCSVHandler).
+			Doc("Export every row of the approved hours report as CSV").
+			Do(reportParams).
+			Produces("text/csv").
+			Returns(http.StatusOK, "Generated report", nil).
+			Returns(http.StatusBadRequest, "Invalid report parameters", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not generate reports for the organization", nil))
+
+	return service
+}
+
+// parseReportParams reads the report's query parameters and checks that the
+// logged-in user may see it. On failure it writes the response and returns
+// nil.
+func (server *ReportsServer) parseReportParams(request *restful.Request, response *restful.Response, logger *log.Entry, paginated bool) *reports.HoursReportParams {
+	ctx := filters.GetRequestContext(request)
+	params := reports.HoursReportParams{
+		GroupBy: request.QueryParameter("group_by"),
+		Page:    1,
+		PerPage: reports.DefaultPerPage,
+	}
+
+	var err error
+	params.OrganizationId, _ = strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	params.Location = time.UTC
+	if tz := request.QueryParameter("timezone"); tz != "" {
+		params.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			response.WriteErrorString(http.StatusBadRequest, "unknown timezone")
+			return nil
+		}
+	}
+	params.From, params.To, err = filters.ParseDateRange(request.QueryParameter("from"), request.QueryParameter("to"), params.Location)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "from and to must be given as YYYY-MM-DD")
+		return nil
+	}
+	if paginated {
+		if page := request.QueryParameter("page"); page != "" {
+			params.Page, err = strconv.Atoi(page)
+			if err != nil {
+				response.WriteErrorString(http.StatusBadRequest, "page must be a number")
+				return nil
+			}
+		}
+		if perPage := request.QueryParameter("per_page"); perPage != "" {
+			params.PerPage, err = strconv.Atoi(perPage)
+			if err != nil {
+				response.WriteErrorString(http.StatusBadRequest, "per_page must be a number")
+				return nil
+			}
+		}
+	}
+	errorSet := params.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Report parameters are not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return nil
+	}
+
+	if !users.GetRequestJWTClaims(request).HasRole(params.OrganizationId, users.OrgAdmin, users.BackOffice) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), params.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+
+	if slug := request.QueryParameter("site"); slug != "" {
+		site, err := sites.FindSite(ctx, slug, server.Config.GetDbConn())
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return nil
+		}
+		if site == nil || site.OrganizationId != params.OrganizationId {
+			response.WriteErrorString(http.StatusBadRequest, "site not found in the organization")
+			return nil
+		}
+		params.SiteId = site.Id
+	}
+	return &params
+}
+
+func (server *ReportsServer) HoursReportHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "HoursReportHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	params := server.parseReportParams(request, response, logger, true)
+	if params == nil {
+		return
+	}
+
+	report, err := reports.GetHoursReport(ctx, server.Config.GetDbConn(), *params)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(report)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize report")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *ReportsServer) HoursReportCSVHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "HoursReportCSVHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	params := server.parseReportParams(request, response, logger, false)
+	if params == nil {
+		return
+	}
+
+	rows, err := reports.GetAllHoursReportRows(ctx, server.Config.GetDbConn(), *params)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("hours-by-%s-%s-%s.csv", params.GroupBy,
+		request.QueryParameter("from"), request.QueryParameter("to"))
+	response.AddHeader("Content-Type", "text/csv")
+	response.AddHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	err = reports.WriteCSV(response, params.GroupBy, rows)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write CSV")
+	}
+}
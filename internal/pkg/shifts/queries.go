@@ -0,0 +1,78 @@
+package shifts
+
+const selectShiftColumns = `
+	SELECT
+		shifts.id, shifts.organization_id, shifts.site_id, sites.slug AS site_slug,
+		shifts.role, shifts.starts_at, shifts.ends_at, shifts.slots,
+		(SELECT COUNT(*) FROM shift_signups
+			WHERE shift_signups.shift_id = shifts.id AND shift_signups.cancelled_at IS NULL) AS filled
+	FROM shifts
+		JOIN sites ON sites.id = shifts.site_id
+		JOIN organizations ON organizations.id = shifts.organization_id AND organizations.deleted_at IS NULL
+`
+
+const listShiftsSql = selectShiftColumns + `
+	WHERE shifts.organization_id = ? AND shifts.starts_at >= ? AND shifts.starts_at < ?
+	ORDER BY shifts.starts_at, shifts.id
+`
+
+const describeShiftSql = selectShiftColumns + `
+	WHERE shifts.id = ?
+`
+
+const insertShiftSql = `
+	INSERT INTO shifts (organization_id, site_id, role, starts_at, ends_at, slots)
+	SELECT organizations.id, sites.id, ?, ?, ?, ?
+	FROM sites JOIN organizations ON organizations.id = ? AND organizations.deleted_at IS NULL
+	WHERE sites.slug = ?
+	RETURNING id, site_id
+`
+
+const lockShiftSql = `
+	SELECT shifts.organization_id, shifts.slots
+	FROM shifts JOIN organizations ON organizations.id = shifts.organization_id AND organizations.deleted_at IS NULL
+	WHERE shifts.id = ?
+	FOR UPDATE OF shifts
+`
+
+const countActiveSignupsSql = `
+	SELECT COUNT(*) FROM shift_signups WHERE shift_id = ? AND cancelled_at IS NULL
+`
+
+const countUserActiveSignupsSql = `
+	SELECT COUNT(*) FROM shift_signups WHERE shift_id = ? AND user_id = ? AND cancelled_at IS NULL
+`
+
+const insertSignupSql = `
+	INSERT INTO shift_signups (shift_id, user_id, source) VALUES (?, ?, ?)
+	RETURNING id, created_at
+`
+
+const cancelSignupSql = `
+	UPDATE shift_signups SET cancelled_at = now()
+	WHERE shift_id = ? AND user_id = ? AND cancelled_at IS NULL
+	RETURNING id
+`
+
+const listActiveSignupsSql = `
+	SELECT
+		shift_signups.id, shift_signups.shift_id, shift_signups.user_id, users.user_guid,
+		shift_signups.source, shift_signups.created_at
+	FROM shift_signups
+		JOIN shifts ON shifts.id = shift_signups.shift_id
+		JOIN users ON users.id = shift_signups.user_id
+	WHERE shifts.organization_id = ? AND shifts.starts_at >= ? AND shifts.starts_at < ?
+		AND shift_signups.cancelled_at IS NULL
+`
+
+const listOrganizationVolunteerRolesSql = `
+	SELECT users.id, users.user_guid, roles.name
+	FROM roles
+		JOIN users ON users.id = roles.user_id
+		JOIN organization_memberships ON organization_memberships.organization_id = roles.org_id
+			AND organization_memberships.user_id = roles.user_id
+	WHERE roles.org_id = ? AND organization_memberships.status = 'active'
+	ORDER BY users.id
+`
+
+const selectUserIdByGuidSql = `SELECT id FROM users WHERE user_guid = ?`
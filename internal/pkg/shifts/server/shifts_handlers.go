@@ -0,0 +1,510 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ShiftsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *ShiftsServer {
+	return &ShiftsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+func (server *ShiftsServer) GetShiftsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/shifts").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListShiftsHandler).
+			Doc("List an organization's shifts between two dates").
+			Param(restful.QueryParameter("organization_id", "Organization to list shifts for")).
+			Param(restful.QueryParameter("from", "First date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("to", "Last date to include, YYYY-MM-DD")).
+			Produces(restful.MIME_JSON).
+			Writes(ListShiftsResponse{}).
+			Returns(http.StatusOK, "Fetched shifts", ListShiftsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a member of the organization", nil))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CreateShiftHandler).
+			Doc("Create a shift").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(shifts.Shift{}).
+			Writes(shifts.Shift{}).
+			Returns(http.StatusOK, "Shift created", shifts.Shift{}).
+			Returns(http.StatusBadRequest, "Invalid shift", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to create shifts", nil))
+	service.Route(
+		service.POST("/{shiftId}/signup").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SignUpHandler).
+			Doc("Sign the logged-in user up for a shift").
+			Param(restful.PathParameter("shiftId", "ID taken from ListShifts")).
+			Produces(restful.MIME_JSON).
+			Writes(shifts.Signup{}).
+			Returns(http.StatusOK, "Signed up", shifts.Signup{}).
+			Returns(http.StatusNotFound, "Invalid shift ID", nil).
+			Returns(http.StatusConflict, "Shift is full, or the user is already signed up", nil))
+	service.Route(
+		service.DELETE("/{shiftId}/signup").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CancelSignupHandler).
+			Doc("Cancel the logged-in user's signup for a shift").
+			Param(restful.PathParameter("shiftId", "ID taken from ListShifts")).
+			Returns(http.StatusOK, "Signup cancelled", nil).
+			Returns(http.StatusNotFound, "User is not signed up for the shift", nil))
+	service.Route(
+		service.POST("/auto-assign").
+			Filter(users.AllowImpersonation).
+			Filter(authConfig.ValidJwtFilter).
+			To(server.PreviewAutoAssignHandler).
+			Doc("Dry run: propose volunteers for an organization's open shifts. Nothing is saved.").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(AutoAssignRequest{}).
+			Writes(shifts.Proposal{}).
+			Returns(http.StatusOK, "Proposal generated", shifts.Proposal{}).
+			Returns(http.StatusBadRequest, "Invalid request", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to staff shifts", nil))
+	service.Route(
+		service.POST("/auto-assign/commit").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CommitAutoAssignHandler).
+			Doc("Save a previewed proposal's assignments as signups").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(CommitAutoAssignRequest{}).
+			Writes(CommitAutoAssignResponse{}).
+			Returns(http.StatusOK, "Assignments saved", CommitAutoAssignResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to staff shifts", nil).
+			Returns(http.StatusConflict, "A shift has filled up since the proposal was generated. Nothing was saved.", nil))
+
+	return service
+}
+
+type ListShiftsResponse struct {
+	Shifts []shifts.Shift `json:"shifts"`
+}
+
+func (server *ShiftsServer) ListShiftsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListShiftsHandler",
+	})
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		logger.WithError(err).Debug("Invalid organization ID")
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	from, to, err := filters.ParseDateRange(request.QueryParameter("from"), request.QueryParameter("to"), time.UTC)
+	if err != nil {
+		logger.WithError(err).Debug("Invalid date range")
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(orgId, users.MemberRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	shiftSet, err := shifts.ListShifts(ctx, server.Config.GetDbConn(), orgId, from, to)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListShiftsResponse{Shifts: shiftSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize shifts")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *ShiftsServer) CreateShiftHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CreateShiftHandler",
+	})
+
+	var newShift shifts.Shift
+	err := request.ReadEntity(&newShift)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize shift")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(newShift.OrganizationId, users.OrgAdmin, users.SiteManager) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), newShift.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	errorSet := newShift.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Specified shift is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+
+	err = newShift.Create(ctx, server.Config.GetDbConn())
+	if err != nil {
+		if err == shifts.ErrSiteNotFound {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(newShift)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize shift")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// loggedInUserId resolves the JWT subject to the user's database ID.
+func (server *ShiftsServer) loggedInUserId(request *restful.Request) (uint64, error) {
+	claims := users.GetRequestJWTClaims(request)
+	if claims == nil {
+		return 0, errors.New("no JWT claims available on request")
+	}
+	u, err := users.GetUserByGuid(filters.GetRequestContext(request), claims.Subject, server.Config.GetDbConn())
+	if err != nil {
+		return 0, err
+	}
+	if u == nil {
+		return 0, sql.ErrNoRows
+	}
+	return u.Id, nil
+}
+
+func (server *ShiftsServer) SignUpHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":     "SignUpHandler",
+		"ShiftID.input": request.PathParameter("shiftId"),
+	})
+
+	shiftId, err := strconv.ParseUint(request.PathParameter("shiftId"), 10, 64)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	shift, err := shifts.DescribeShift(ctx, server.Config.GetDbConn(), shiftId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Volunteers may only sign up for shifts in their orgs that need their role
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(shift.OrganizationId, shift.Role) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	// Unless the org lets them sign themselves up, only its admins may
+	settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), shift.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !settings.SelfSignup && !claims.HasRole(shift.OrganizationId, users.OrgAdmin) {
+		response.WriteErrorString(http.StatusForbidden, "this organization does not allow volunteers to sign themselves up")
+		return
+	}
+
+	userId, err := server.loggedInUserId(request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	signup, err := shifts.SignUp(ctx, server.Config.GetDbConn(), shiftId, userId, shifts.SignupSourceSelf)
+	if err != nil {
+		switch err {
+		case shifts.ErrShiftFull, shifts.ErrAlreadySignedUp:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		case sql.ErrNoRows:
+			response.WriteHeader(http.StatusNotFound)
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	signup.UserGuid = claims.Subject
+
+	err = response.WriteEntity(signup)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize signup")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *ShiftsServer) CancelSignupHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":     "CancelSignupHandler",
+		"ShiftID.input": request.PathParameter("shiftId"),
+	})
+
+	shiftId, err := strconv.ParseUint(request.PathParameter("shiftId"), 10, 64)
+	if err != nil {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	userId, err := server.loggedInUserId(request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = shifts.CancelSignup(ctx, server.Config.GetDbConn(), shiftId, userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+// VolunteerPreferences overrides a volunteer's saved availability for a
+// single auto-assign run, so coordinators can try out "what if" scenarios.
+type VolunteerPreferences struct {
+	Windows         []users.AvailabilityWindow `json:"windows"`
+	BlackoutDates   []string                   `json:"blackout_dates"`
+	PreferredSites  []string                   `json:"preferred_sites"` // site slugs
+	MaxHoursPerWeek float64                    `json:"max_hours_per_week"`
+}
+
+type AutoAssignRequest struct {
+	OrganizationId uint64 `json:"organization_id"`
+	From           string `json:"from"`     // YYYY-MM-DD
+	To             string `json:"to"`       // YYYY-MM-DD, inclusive
+	Timezone       string `json:"timezone"` // IANA zone name used for availability windows. Defaults to the organization's.
+
+	// Keyed by user GUID
+	Preferences map[string]VolunteerPreferences `json:"preferences"`
+}
+
+func (server *ShiftsServer) PreviewAutoAssignHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "PreviewAutoAssignHandler",
+	})
+
+	var input AutoAssignRequest
+	err := request.ReadEntity(&input)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize auto-assign request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	logger = logger.WithField("OrganizationID", input.OrganizationId)
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(input.OrganizationId, users.OrgAdmin, users.SiteManager) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), input.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	loc := settings.Location()
+	if len(input.Timezone) > 0 {
+		loc, err = time.LoadLocation(input.Timezone)
+		if err != nil {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	from, to, err := filters.ParseDateRange(input.From, input.To, loc)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	problem, err := shifts.LoadProblem(ctx, server.Config.GetDbConn(), input.OrganizationId, from, to, loc)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Layer the requested preferences on top of the volunteers' saved ones
+	siteIds := make(map[string]uint64)
+	for _, s := range problem.Shifts {
+		siteIds[s.SiteSlug] = s.SiteId
+	}
+	for i := range problem.Volunteers {
+		prefs, ok := input.Preferences[problem.Volunteers[i].UserGuid]
+		if !ok {
+			continue
+		}
+		for _, w := range prefs.Windows {
+			if err := w.Validate(); err != nil {
+				response.WriteErrorString(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		v := &problem.Volunteers[i]
+		v.Windows = prefs.Windows
+		v.BlackoutDates = prefs.BlackoutDates
+		v.MaxHoursPerWeek = prefs.MaxHoursPerWeek
+		v.PreferredSiteIds = nil
+		for _, slug := range prefs.PreferredSites {
+			if siteId, ok := siteIds[slug]; ok {
+				v.PreferredSiteIds = append(v.PreferredSiteIds, siteId)
+			}
+		}
+	}
+
+	proposal := shifts.Solve(*problem)
+	logger.WithFields(log.Fields{
+		"OpenSlots":   proposal.OpenSlots,
+		"FilledSlots": proposal.FilledSlots,
+	}).Debug("Generated staffing proposal")
+
+	err = response.WriteEntity(proposal)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize proposal")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type CommitAutoAssignRequest struct {
+	OrganizationId uint64              `json:"organization_id"`
+	Timezone       string              `json:"timezone"` // IANA zone name used for availability windows. Defaults to the organization's.
+	Assignments    []shifts.Assignment `json:"assignments"`
+}
+
+type CommitAutoAssignResponse struct {
+	Signups []shifts.Signup `json:"signups"`
+}
+
+func (server *ShiftsServer) CommitAutoAssignHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CommitAutoAssignHandler",
+	})
+
+	var input CommitAutoAssignRequest
+	err := request.ReadEntity(&input)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize commit request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(input.OrganizationId, users.OrgAdmin, users.SiteManager) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), input.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	loc := settings.Location()
+	if len(input.Timezone) > 0 {
+		loc, err = time.LoadLocation(input.Timezone)
+		if err != nil {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	signups, err := shifts.CommitAssignments(ctx, server.Config.GetDbConn(), input.OrganizationId, input.Assignments, loc)
+	if err != nil {
+		switch {
+		case errors.Is(err, shifts.ErrInvalidAssignment):
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		case err == shifts.ErrShiftFull, err == shifts.ErrAlreadySignedUp, err == shifts.ErrWrongOrg:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		case err == sql.ErrNoRows:
+			response.WriteErrorString(http.StatusBadRequest, "unknown shift or user in assignments")
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = response.WriteEntity(CommitAutoAssignResponse{Signups: signups})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize signups")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,459 @@
+package shifts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ErrShiftFull       = errors.New("shift has no open slots")
+	ErrAlreadySignedUp = errors.New("user is already signed up for this shift")
+	ErrSiteNotFound    = errors.New("site not found")
+	ErrWrongOrg        = errors.New("shift does not belong to the organization")
+
+	ErrInvalidAssignment = errors.New("assignment breaks a staffing constraint")
+)
+
+// Shift is a block of time at a Site that needs one or more volunteers
+// holding a particular Role.
+type Shift struct {
+	Id             uint64         `json:"id" db:"id"`
+	OrganizationId uint64         `json:"organization_id" db:"organization_id"`
+	SiteId         uint64         `json:"-" db:"site_id"`
+	SiteSlug       string         `json:"site_slug" db:"site_slug"`
+	Role           users.RoleType `json:"role" db:"role"`
+	StartsAt       time.Time      `json:"starts_at" db:"starts_at"`
+	EndsAt         time.Time      `json:"ends_at" db:"ends_at"`
+	Slots          int            `json:"slots" db:"slots"`
+	Filled         int            `json:"filled" db:"filled"` // number of active signups
+}
+
+// Hours is the length of the shift.
+func (s Shift) Hours() float64 {
+	return s.EndsAt.Sub(s.StartsAt).Hours()
+}
+
+// OpenSlots is the number of volunteers still needed.
+func (s Shift) OpenSlots() int {
+	if s.Filled >= s.Slots {
+		return 0
+	}
+	return s.Slots - s.Filled
+}
+
+func (s Shift) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if s.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("organization_id must be present"))
+	}
+	if len(s.SiteSlug) == 0 {
+		errSet = append(errSet, errors.New("site_slug must be present"))
+	}
+	if s.StartsAt.IsZero() || s.EndsAt.IsZero() {
+		errSet = append(errSet, errors.New("starts_at and ends_at must be present"))
+	} else if !s.EndsAt.After(s.StartsAt) {
+		errSet = append(errSet, errors.New("ends_at must be after starts_at"))
+	}
+	if s.Slots <= 0 {
+		errSet = append(errSet, errors.New("slots must be positive"))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+// Signup records a volunteer filling one slot on a Shift.
+type Signup struct {
+	Id        uint64    `json:"id" db:"id"`
+	ShiftId   uint64    `json:"shift_id" db:"shift_id"`
+	UserId    uint64    `json:"-" db:"user_id"`
+	UserGuid  string    `json:"user_guid" db:"user_guid"`
+	Source    string    `json:"source" db:"source"` // "self" or "auto"
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+const (
+	SignupSourceSelf = "self"
+	SignupSourceAuto = "auto"
+)
+
+// Outbox event types, enqueued in the transaction that saves the signup.
+const (
+	EventSignupCreated   = "shift.signup"
+	EventSignupCancelled = "shift.signup_cancelled"
+)
+
+// SignupEvent is the payload of EventSignupCreated and EventSignupCancelled.
+type SignupEvent struct {
+	SignupId uint64 `json:"signup_id"`
+	ShiftId  uint64 `json:"shift_id"`
+	UserId   uint64 `json:"user_id"`
+	Source   string `json:"source,omitempty"`
+}
+
+// Create inserts the shift, resolving its SiteSlug to a site ID.
+func (s *Shift) Create(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Shift.Create",
+		"SiteSlug":  s.SiteSlug,
+	})
+
+	row := db.QueryRowxContext(ctx, db.Rebind(insertShiftSql), s.Role, s.StartsAt, s.EndsAt, s.Slots, s.OrganizationId, s.SiteSlug)
+	err := row.Scan(&s.Id, &s.SiteId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			logger.Debug("Site not found")
+			return ErrSiteNotFound
+		}
+		logger.WithError(err).Error("Failed to insert shift")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// ListShifts fetches all of an organization's shifts starting in [from, to).
+func ListShifts(ctx context.Context, db *sqlx.DB, orgId uint64, from, to time.Time) ([]Shift, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "ListShifts",
+		"OrganizationID": orgId,
+	})
+
+	shiftSet := make([]Shift, 0)
+	err := db.SelectContext(ctx, &shiftSet, db.Rebind(listShiftsSql), orgId, from, to)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select shifts")
+		return nil, err
+	}
+	return shiftSet, nil
+}
+
+// DescribeShift fetches a single shift. Returns sql.ErrNoRows if it does not exist.
+func DescribeShift(ctx context.Context, db *sqlx.DB, shiftId uint64) (*Shift, error) {
+	var s Shift
+	err := db.GetContext(ctx, &s, db.Rebind(describeShiftSql), shiftId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			filters.GetContextLogger(ctx).WithField("ShiftID", shiftId).WithError(err).Error("Failed to select shift")
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListActiveSignups fetches the uncancelled signups for an organization's
+// shifts starting in [from, to).
+func ListActiveSignups(ctx context.Context, db *sqlx.DB, orgId uint64, from, to time.Time) ([]Signup, error) {
+	signups := make([]Signup, 0)
+	err := db.SelectContext(ctx, &signups, db.Rebind(listActiveSignupsSql), orgId, from, to)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("OrganizationID", orgId).WithError(err).Error("Failed to select signups")
+		return nil, err
+	}
+	return signups, nil
+}
+
+// signUpTx fills one slot on the shift for the user, locking the shift row so
+// that concurrent signups cannot overfill it.
+func signUpTx(ctx context.Context, tx *sqlx.Tx, orgId, shiftId, userId uint64, source string) (*Signup, error) {
+	var shiftOrgId uint64
+	var slots int
+	err := tx.QueryRowxContext(ctx, tx.Rebind(lockShiftSql), shiftId).Scan(&shiftOrgId, &slots)
+	if err != nil {
+		return nil, err
+	}
+	if orgId != 0 && shiftOrgId != orgId {
+		return nil, ErrWrongOrg
+	}
+
+	var existing int
+	err = tx.GetContext(ctx, &existing, tx.Rebind(countUserActiveSignupsSql), shiftId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadySignedUp
+	}
+
+	var filled int
+	err = tx.GetContext(ctx, &filled, tx.Rebind(countActiveSignupsSql), shiftId)
+	if err != nil {
+		return nil, err
+	}
+	if filled >= slots {
+		return nil, ErrShiftFull
+	}
+
+	signup := Signup{
+		ShiftId: shiftId,
+		UserId:  userId,
+		Source:  source,
+	}
+	err = tx.QueryRowxContext(ctx, tx.Rebind(insertSignupSql), shiftId, userId, source).Scan(&signup.Id, &signup.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = outbox.Enqueue(ctx, tx, EventSignupCreated, SignupEvent{
+		SignupId: signup.Id,
+		ShiftId:  shiftId,
+		UserId:   userId,
+		Source:   source,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &signup, nil
+}
+
+// SignUp fills one slot on the shift for the user.
+func SignUp(ctx context.Context, db *sqlx.DB, shiftId, userId uint64, source string) (*Signup, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SignUp",
+		"ShiftID":   shiftId,
+		"UserID":    userId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return nil, err
+	}
+	signup, err := signUpTx(ctx, tx, 0, shiftId, userId, source)
+	if err != nil {
+		tx.Rollback()
+		if err != sql.ErrNoRows && err != ErrShiftFull && err != ErrAlreadySignedUp {
+			logger.WithError(err).Error("Failed to sign up for shift")
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit signup")
+		return nil, err
+	}
+
+	// Success!
+	return signup, nil
+}
+
+// CancelSignup cancels the user's active signup for the shift. Returns
+// sql.ErrNoRows if the user was not signed up.
+func CancelSignup(ctx context.Context, db *sqlx.DB, shiftId, userId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CancelSignup",
+		"ShiftID":   shiftId,
+		"UserID":    userId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	var signupId uint64
+	err = tx.GetContext(ctx, &signupId, tx.Rebind(cancelSignupSql), shiftId, userId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to cancel signup")
+		}
+		return err
+	}
+	err = outbox.Enqueue(ctx, tx, EventSignupCancelled, SignupEvent{
+		SignupId: signupId,
+		ShiftId:  shiftId,
+		UserId:   userId,
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit cancellation")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// CommitAssignments saves a solver Proposal's assignments as signups. Either
+// all of the assignments are saved, or none of them are: if any shift has
+// filled up since the proposal was generated, the whole commit is rolled back
+// so that the coordinator can preview a fresh proposal.
+//
+// The assignments come from the client, so they are checked again against
+// the volunteers' saved availability, roles and hour caps, with weeks and
+// windows evaluated in loc, before anything is saved. Returns an error
+// wrapping ErrInvalidAssignment if any of them breaks a constraint.
+func CommitAssignments(ctx context.Context, db *sqlx.DB, orgId uint64, assignments []Assignment, loc *time.Location) ([]Signup, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "CommitAssignments",
+		"OrganizationID": orgId,
+	})
+	if len(assignments) == 0 {
+		return []Signup{}, nil
+	}
+
+	// Resolve the users, and find the span of time the assignments cover
+	var from, to time.Time
+	for i := range assignments {
+		a := &assignments[i]
+		if a.UserId == 0 {
+			err := db.GetContext(ctx, &a.UserId, db.Rebind(selectUserIdByGuidSql), a.UserGuid)
+			if err != nil {
+				logger.WithField("UserGuid", a.UserGuid).WithError(err).Debug("Failed to resolve assigned user")
+				return nil, err
+			}
+		}
+		shift, err := DescribeShift(ctx, db, a.ShiftId)
+		if err != nil {
+			return nil, err
+		}
+		if shift.OrganizationId != orgId {
+			return nil, ErrWrongOrg
+		}
+		if from.IsZero() || shift.StartsAt.Before(from) {
+			from = shift.StartsAt
+		}
+		if shift.StartsAt.After(to) {
+			to = shift.StartsAt
+		}
+	}
+
+	// Take in the weeks around them, so that existing signups count toward
+	// the hour caps and block overlapping shifts.
+	problem, err := LoadProblem(ctx, db, orgId, from.AddDate(0, 0, -7), to.AddDate(0, 0, 8), loc)
+	if err != nil {
+		return nil, err
+	}
+	err = CheckAssignments(*problem, assignments)
+	if err != nil {
+		logger.WithError(err).Debug("Refused assignments")
+		return nil, err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return nil, err
+	}
+
+	signups := make([]Signup, 0, len(assignments))
+	for _, a := range assignments {
+		signup, err := signUpTx(ctx, tx, orgId, a.ShiftId, a.UserId, SignupSourceAuto)
+		if err != nil {
+			tx.Rollback()
+			logger.WithFields(log.Fields{
+				"ShiftID":  a.ShiftId,
+				"UserGuid": a.UserGuid,
+			}).WithError(err).Debug("Failed to commit assignment")
+			return nil, err
+		}
+		signup.UserGuid = a.UserGuid
+		signups = append(signups, *signup)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit assignments")
+		return nil, err
+	}
+
+	// Success!
+	return signups, nil
+}
+
+type volunteerRoleRow struct {
+	UserId   uint64         `db:"id"`
+	UserGuid string         `db:"user_guid"`
+	Role     users.RoleType `db:"name"`
+}
+
+// LoadVolunteers builds the solver's view of every user holding a role in
+// the organization, including their saved availability preferences.
+func LoadVolunteers(ctx context.Context, db *sqlx.DB, orgId uint64) ([]Volunteer, error) {
+	rows := make([]volunteerRoleRow, 0)
+	err := db.SelectContext(ctx, &rows, db.Rebind(listOrganizationVolunteerRolesSql), orgId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("OrganizationID", orgId).WithError(err).Error("Failed to select volunteers")
+		return nil, err
+	}
+
+	volunteers := make([]Volunteer, 0)
+	for _, row := range rows {
+		if len(volunteers) == 0 || volunteers[len(volunteers)-1].UserId != row.UserId {
+			volunteers = append(volunteers, Volunteer{
+				UserId:   row.UserId,
+				UserGuid: row.UserGuid,
+			})
+		}
+		v := &volunteers[len(volunteers)-1]
+		v.Roles = append(v.Roles, row.Role)
+	}
+
+	userIds := make([]uint64, len(volunteers))
+	for i := range volunteers {
+		userIds[i] = volunteers[i].UserId
+	}
+	availability, err := users.ListAvailability(ctx, db, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range volunteers {
+		a, ok := availability[volunteers[i].UserId]
+		if !ok {
+			continue
+		}
+		volunteers[i].Windows = a.Windows
+		volunteers[i].BlackoutDates = a.BlackoutDates
+		volunteers[i].PreferredSiteIds = a.PreferredSiteIds
+		volunteers[i].MaxHoursPerWeek = a.MaxHoursPerWeek
+	}
+	return volunteers, nil
+}
+
+// LoadProblem gathers everything the solver needs to staff an
+// organization's shifts starting in [from, to), including the organization's
+// weekly hour cap.
+func LoadProblem(ctx context.Context, db *sqlx.DB, orgId uint64, from, to time.Time, loc *time.Location) (*Problem, error) {
+	settings, err := organizations.GetSettings(ctx, db, orgId)
+	if err != nil {
+		return nil, err
+	}
+	shiftSet, err := ListShifts(ctx, db, orgId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := ListActiveSignups(ctx, db, orgId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	volunteers, err := LoadVolunteers(ctx, db, orgId)
+	if err != nil {
+		return nil, err
+	}
+	return &Problem{
+		Shifts:     shiftSet,
+		Volunteers: volunteers,
+		Existing:   existing,
+		Location:   loc,
+
+		MaxHoursPerWeek: settings.MaxWeeklyHours,
+	}, nil
+}
@@ -0,0 +1,460 @@
+package shifts
+
+import (
+	"fmt"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"sort"
+	"time"
+)
+
+// Volunteer is the solver's view of a user who may be assigned to shifts.
+type Volunteer struct {
+	UserId   uint64           `json:"-"`
+	UserGuid string           `json:"user_guid"`
+	Roles    []users.RoleType `json:"roles"`
+
+	// If no windows are given, the volunteer is treated as always available.
+	Windows          []users.AvailabilityWindow `json:"windows"`
+	BlackoutDates    []string                   `json:"blackout_dates"` // Expected format: YYYY-MM-DD
+	PreferredSiteIds []uint64                   `json:"-"`
+	MaxHoursPerWeek  float64                    `json:"max_hours_per_week"` // 0 means no cap
+}
+
+// Problem is the input to Solve.
+type Problem struct {
+	Shifts     []Shift
+	Volunteers []Volunteer
+	// Existing signups count toward the volunteers' hours and block
+	// overlapping assignments.
+	Existing []Signup
+	// Location is used to evaluate availability windows, blackout dates and
+	// week boundaries. Defaults to UTC.
+	Location *time.Location
+	// MaxHoursPerWeek caps the volunteers who have not set a cap of their
+	// own. 0 means no cap.
+	MaxHoursPerWeek float64
+}
+
+// Assignment proposes a volunteer for one slot on a shift.
+type Assignment struct {
+	ShiftId  uint64 `json:"shift_id"`
+	UserId   uint64 `json:"-"`
+	UserGuid string `json:"user_guid"`
+}
+
+type UnfilledShift struct {
+	ShiftId   uint64 `json:"shift_id"`
+	OpenSlots int    `json:"open_slots"`
+}
+
+// Proposal is the solver's output. It is not saved until a coordinator
+// commits it.
+type Proposal struct {
+	Assignments      []Assignment       `json:"assignments"`
+	Unfilled         []UnfilledShift    `json:"unfilled"`
+	OpenSlots        int                `json:"open_slots"`
+	FilledSlots      int                `json:"filled_slots"`
+	Coverage         float64            `json:"coverage"` // FilledSlots / OpenSlots
+	HoursByVolunteer map[string]float64 `json:"hours_by_volunteer"`
+}
+
+// nonPreferredSitePenalty is how many hours of extra load an assignment to a
+// site outside a volunteer's preferences "costs" when ranking candidates.
+const nonPreferredSitePenalty = 4.0
+
+// maxRepairPasses bounds the repair phase. Each pass either fills at least
+// one slot or ends the phase, so this is only a safety net.
+const maxRepairPasses = 50
+
+type solverState struct {
+	problem  Problem
+	loc      *time.Location
+	windows  [][]minuteWindow // per volunteer, parsed from Windows
+	blackout []map[string]bool
+
+	// assigned[v] lists the shift indices volunteer v holds, including
+	// existing signups.
+	assigned [][]int
+	// proposed[v] lists the shift indices proposed by this run only.
+	proposed [][]int
+	hours    []map[string]float64 // per volunteer, keyed by ISO week
+	total    []float64            // per volunteer, proposed + existing hours
+	open     []int                // per shift, slots still open
+}
+
+type minuteWindow struct {
+	dotw       time.Weekday
+	start, end int
+}
+
+func weekKey(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+func newSolverState(p Problem) *solverState {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	st := &solverState{
+		problem:  p,
+		loc:      loc,
+		windows:  make([][]minuteWindow, len(p.Volunteers)),
+		blackout: make([]map[string]bool, len(p.Volunteers)),
+		assigned: make([][]int, len(p.Volunteers)),
+		proposed: make([][]int, len(p.Volunteers)),
+		hours:    make([]map[string]float64, len(p.Volunteers)),
+		total:    make([]float64, len(p.Volunteers)),
+		open:     make([]int, len(p.Shifts)),
+	}
+
+	for v, vol := range p.Volunteers {
+		for _, w := range vol.Windows {
+			if w.Validate() != nil {
+				// Unparseable windows never match, rather than silently
+				// widening the volunteer's availability.
+				continue
+			}
+			dotw, _ := users.ParseDotw(w.Dotw)
+			start, _ := users.ParseClock(w.Start)
+			end, _ := users.ParseClock(w.End)
+			st.windows[v] = append(st.windows[v], minuteWindow{
+				dotw:  dotw,
+				start: start,
+				end:   end,
+			})
+		}
+		st.blackout[v] = make(map[string]bool, len(vol.BlackoutDates))
+		for _, d := range vol.BlackoutDates {
+			st.blackout[v][d] = true
+		}
+		st.hours[v] = make(map[string]float64)
+	}
+	for s := range p.Shifts {
+		st.open[s] = p.Shifts[s].OpenSlots()
+	}
+
+	// Seed the state with existing signups so they count against caps and
+	// block overlapping assignments.
+	shiftIndex := make(map[uint64]int, len(p.Shifts))
+	for s := range p.Shifts {
+		shiftIndex[p.Shifts[s].Id] = s
+	}
+	volunteerIndex := make(map[uint64]int, len(p.Volunteers))
+	for v := range p.Volunteers {
+		volunteerIndex[p.Volunteers[v].UserId] = v
+	}
+	for _, signup := range p.Existing {
+		s, ok := shiftIndex[signup.ShiftId]
+		if !ok {
+			continue
+		}
+		v, ok := volunteerIndex[signup.UserId]
+		if !ok {
+			continue
+		}
+		st.add(v, s)
+	}
+	return st
+}
+
+func (st *solverState) add(v, s int) {
+	shift := st.problem.Shifts[s]
+	st.assigned[v] = append(st.assigned[v], s)
+	st.hours[v][weekKey(shift.StartsAt.In(st.loc))] += shift.Hours()
+	st.total[v] += shift.Hours()
+}
+
+func (st *solverState) propose(v, s int) {
+	st.add(v, s)
+	st.proposed[v] = append(st.proposed[v], s)
+	st.open[s]--
+}
+
+func (st *solverState) unpropose(v, s int) {
+	shift := st.problem.Shifts[s]
+	st.assigned[v] = removeIndex(st.assigned[v], s)
+	st.proposed[v] = removeIndex(st.proposed[v], s)
+	st.hours[v][weekKey(shift.StartsAt.In(st.loc))] -= shift.Hours()
+	st.total[v] -= shift.Hours()
+	st.open[s]++
+}
+
+func removeIndex(list []int, item int) []int {
+	for i := range list {
+		if list[i] == item {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// qualified checks the static constraints: role, availability and blackouts.
+func (st *solverState) qualified(v, s int) bool {
+	vol := st.problem.Volunteers[v]
+	shift := st.problem.Shifts[s]
+
+	hasRole := false
+	for _, r := range vol.Roles {
+		if r == shift.Role {
+			hasRole = true
+			break
+		}
+	}
+	if !hasRole {
+		return false
+	}
+
+	start := shift.StartsAt.In(st.loc)
+	end := shift.EndsAt.In(st.loc)
+	if st.blackout[v][start.Format("2006-01-02")] || st.blackout[v][end.Format("2006-01-02")] {
+		return false
+	}
+
+	if len(vol.Windows) == 0 {
+		return true
+	}
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	if end.Format("2006-01-02") != start.Format("2006-01-02") {
+		// Only a shift ending exactly at midnight may cross the date line.
+		if endMinute != 0 || end.Sub(start) > 24*time.Hour {
+			return false
+		}
+		endMinute = 24 * 60
+	}
+	for _, w := range st.windows[v] {
+		if w.dotw == start.Weekday() && w.start <= startMinute && endMinute <= w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// fits checks the dynamic constraints on top of qualified: no double
+// booking, no overlapping shifts and the weekly hour cap.
+func (st *solverState) fits(v, s int) bool {
+	if !st.qualified(v, s) {
+		return false
+	}
+	shift := st.problem.Shifts[s]
+	for _, other := range st.assigned[v] {
+		if other == s {
+			return false
+		}
+		o := st.problem.Shifts[other]
+		if shift.StartsAt.Before(o.EndsAt) && o.StartsAt.Before(shift.EndsAt) {
+			return false
+		}
+	}
+	maxHours := st.problem.Volunteers[v].MaxHoursPerWeek
+	if maxHours == 0 {
+		maxHours = st.problem.MaxHoursPerWeek
+	}
+	if maxHours > 0 && st.hours[v][weekKey(shift.StartsAt.In(st.loc))]+shift.Hours() > maxHours+1e-9 {
+		return false
+	}
+	return true
+}
+
+// cost ranks candidates for a slot. Lower is better: volunteers carrying less
+// load are preferred, as are volunteers who asked for the shift's site.
+func (st *solverState) cost(v, s int) float64 {
+	c := st.total[v]
+	preferred := st.problem.Volunteers[v].PreferredSiteIds
+	if len(preferred) > 0 {
+		match := false
+		for _, siteId := range preferred {
+			if siteId == st.problem.Shifts[s].SiteId {
+				match = true
+				break
+			}
+		}
+		if !match {
+			c += nonPreferredSitePenalty
+		}
+	}
+	return c
+}
+
+// bestCandidate returns the lowest-cost volunteer who fits the shift, or -1.
+// The exclude index is skipped.
+func (st *solverState) bestCandidate(s, exclude int) int {
+	best := -1
+	bestCost := 0.0
+	for v := range st.problem.Volunteers {
+		if v == exclude || !st.fits(v, s) {
+			continue
+		}
+		c := st.cost(v, s)
+		if best == -1 || c < bestCost || (c == bestCost && st.problem.Volunteers[v].UserId < st.problem.Volunteers[best].UserId) {
+			best = v
+			bestCost = c
+		}
+	}
+	return best
+}
+
+// Solve proposes volunteers for the open slots in the problem's shifts.
+//
+// It runs a greedy pass followed by a repair pass. The greedy pass fills the
+// scarcest shifts first (those with the fewest qualified volunteers), giving
+// each slot to the least-loaded volunteer who fits, with a penalty for sites
+// the volunteer did not ask for. The repair pass then looks at each slot that
+// is still open and tries to free up a qualified volunteer by moving one of
+// their proposed shifts to somebody else.
+//
+// The result is deterministic for a given input.
+func Solve(p Problem) Proposal {
+	st := newSolverState(p)
+
+	// Order shifts by scarcity, then chronologically.
+	order := make([]int, len(p.Shifts))
+	candidates := make([]int, len(p.Shifts))
+	for s := range p.Shifts {
+		order[s] = s
+		for v := range p.Volunteers {
+			if st.qualified(v, s) {
+				candidates[s]++
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := p.Shifts[order[i]], p.Shifts[order[j]]
+		if candidates[order[i]] != candidates[order[j]] {
+			return candidates[order[i]] < candidates[order[j]]
+		}
+		if !a.StartsAt.Equal(b.StartsAt) {
+			return a.StartsAt.Before(b.StartsAt)
+		}
+		return a.Id < b.Id
+	})
+
+	// Greedy pass
+	for _, s := range order {
+		for st.open[s] > 0 {
+			v := st.bestCandidate(s, -1)
+			if v == -1 {
+				break
+			}
+			st.propose(v, s)
+		}
+	}
+
+	// Repair pass
+	for pass := 0; pass < maxRepairPasses; pass++ {
+		improved := false
+		for _, s := range order {
+			for st.open[s] > 0 && st.repair(s) {
+				improved = true
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return st.proposal()
+}
+
+// repair tries to fill one open slot on shift s by moving one of a qualified
+// volunteer's proposed shifts to another volunteer. Returns true on success.
+func (st *solverState) repair(s int) bool {
+	for v := range st.problem.Volunteers {
+		if !st.qualified(v, s) {
+			continue
+		}
+		for _, other := range append([]int(nil), st.proposed[v]...) {
+			st.unpropose(v, other)
+			if st.fits(v, s) {
+				if w := st.bestCandidate(other, v); w != -1 {
+					st.propose(w, other)
+					st.propose(v, s)
+					return true
+				}
+			}
+			st.propose(v, other)
+		}
+	}
+	return false
+}
+
+func (st *solverState) proposal() Proposal {
+	p := Proposal{
+		Assignments:      make([]Assignment, 0),
+		Unfilled:         make([]UnfilledShift, 0),
+		HoursByVolunteer: make(map[string]float64),
+	}
+	for v, vol := range st.problem.Volunteers {
+		for _, s := range st.proposed[v] {
+			p.Assignments = append(p.Assignments, Assignment{
+				ShiftId:  st.problem.Shifts[s].Id,
+				UserId:   vol.UserId,
+				UserGuid: vol.UserGuid,
+			})
+			p.HoursByVolunteer[vol.UserGuid] += st.problem.Shifts[s].Hours()
+		}
+	}
+	sort.Slice(p.Assignments, func(i, j int) bool {
+		if p.Assignments[i].ShiftId != p.Assignments[j].ShiftId {
+			return p.Assignments[i].ShiftId < p.Assignments[j].ShiftId
+		}
+		return p.Assignments[i].UserGuid < p.Assignments[j].UserGuid
+	})
+
+	for s, shift := range st.problem.Shifts {
+		p.OpenSlots += shift.OpenSlots()
+		if st.open[s] > 0 {
+			p.Unfilled = append(p.Unfilled, UnfilledShift{
+				ShiftId:   shift.Id,
+				OpenSlots: st.open[s],
+			})
+		}
+	}
+	p.FilledSlots = len(p.Assignments)
+	if p.OpenSlots > 0 {
+		p.Coverage = float64(p.FilledSlots) / float64(p.OpenSlots)
+	} else {
+		p.Coverage = 1
+	}
+	return p
+}
+
+// CheckAssignments replays the assignments against the problem with the same
+// constraints Solve uses, in order, so that each one counts against those
+// after it. It returns an error wrapping ErrInvalidAssignment for the first
+// one that breaks a constraint, or ErrShiftFull if it overfills a shift.
+func CheckAssignments(p Problem, assignments []Assignment) error {
+	st := newSolverState(p)
+	shiftIndex := make(map[uint64]int, len(p.Shifts))
+	for s := range p.Shifts {
+		shiftIndex[p.Shifts[s].Id] = s
+	}
+	volunteerIndex := make(map[uint64]int, len(p.Volunteers))
+	for v := range p.Volunteers {
+		volunteerIndex[p.Volunteers[v].UserId] = v
+	}
+
+	for _, a := range assignments {
+		s, ok := shiftIndex[a.ShiftId]
+		if !ok {
+			return fmt.Errorf("%w: shift %d is not one of the organization's", ErrInvalidAssignment, a.ShiftId)
+		}
+		v, ok := volunteerIndex[a.UserId]
+		if !ok {
+			return fmt.Errorf("%w: %s is not a member of the organization", ErrInvalidAssignment, a.UserGuid)
+		}
+		if !st.qualified(v, s) {
+			return fmt.Errorf("%w: %s does not hold the role for shift %d, or is not available then", ErrInvalidAssignment, a.UserGuid, a.ShiftId)
+		}
+		if !st.fits(v, s) {
+			return fmt.Errorf("%w: %s is already booked during shift %d, or it would take them over their weekly hours", ErrInvalidAssignment, a.UserGuid, a.ShiftId)
+		}
+		if st.open[s] <= 0 {
+			return ErrShiftFull
+		}
+		st.propose(v, s)
+	}
+	return nil
+}
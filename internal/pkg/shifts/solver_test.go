@@ -0,0 +1,250 @@
+package shifts
+
+import (
+	"errors"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"testing"
+	"time"
+)
+
+// 2020-02-03 is a Monday
+var monday = time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+
+func testShift(id uint64, siteId uint64, day, startHour, endHour, slots int) Shift {
+	return Shift{
+		Id:       id,
+		SiteId:   siteId,
+		Role:     users.Volunteer,
+		StartsAt: monday.AddDate(0, 0, day).Add(time.Duration(startHour) * time.Hour),
+		EndsAt:   monday.AddDate(0, 0, day).Add(time.Duration(endHour) * time.Hour),
+		Slots:    slots,
+	}
+}
+
+func testVolunteer(id uint64) Volunteer {
+	return Volunteer{
+		UserId:   id,
+		UserGuid: string(rune('a' + id)),
+		Roles:    []users.RoleType{users.Volunteer},
+	}
+}
+
+func TestSolve_BalancesLoad(t *testing.T) {
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),
+			testShift(2, 1, 1, 9, 13, 1),
+			testShift(3, 1, 2, 9, 13, 1),
+			testShift(4, 1, 3, 9, 13, 1),
+		},
+		Volunteers: []Volunteer{testVolunteer(1), testVolunteer(2)},
+	}
+
+	proposal := Solve(p)
+	if proposal.FilledSlots != 4 {
+		t.Fatalf("Expected all 4 slots to be filled, got %+v", proposal)
+	}
+	if proposal.Coverage != 1 {
+		t.Errorf("Expected full coverage, got %f", proposal.Coverage)
+	}
+	for guid, hours := range proposal.HoursByVolunteer {
+		if hours != 8 {
+			t.Errorf("Expected the load to be split evenly, but %s got %f hours", guid, hours)
+		}
+	}
+}
+
+func TestSolve_RespectsConstraints(t *testing.T) {
+	capped := testVolunteer(1)
+	capped.MaxHoursPerWeek = 4
+
+	mornings := testVolunteer(2)
+	mornings.Windows = []users.AvailabilityWindow{{Dotw: "monday", Start: "08:00", End: "12:00"}}
+
+	away := testVolunteer(3)
+	away.BlackoutDates = []string{"2020-02-03"}
+
+	manager := testVolunteer(4)
+	manager.Roles = []users.RoleType{users.SiteManager}
+
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),  // Monday 9-13: nobody but capped fits
+			testShift(2, 1, 1, 9, 13, 1),  // Tuesday 9-13: capped is now over the cap, away fits
+			testShift(3, 1, 0, 14, 18, 1), // Monday afternoon: capped is capped, mornings is unavailable, away is blacked out
+		},
+		Volunteers: []Volunteer{capped, mornings, away, manager},
+	}
+
+	proposal := Solve(p)
+	assigned := make(map[uint64]string)
+	for _, a := range proposal.Assignments {
+		assigned[a.ShiftId] = a.UserGuid
+	}
+	if assigned[1] != capped.UserGuid {
+		t.Errorf("Expected shift 1 to go to %s, got %q", capped.UserGuid, assigned[1])
+	}
+	if assigned[2] != away.UserGuid {
+		t.Errorf("Expected shift 2 to go to %s, got %q", away.UserGuid, assigned[2])
+	}
+	if _, ok := assigned[3]; ok {
+		t.Errorf("Expected shift 3 to be unfilled, got %q", assigned[3])
+	}
+	if len(proposal.Unfilled) != 1 || proposal.Unfilled[0].ShiftId != 3 {
+		t.Errorf("Expected shift 3 to be reported unfilled, got %+v", proposal.Unfilled)
+	}
+}
+
+func TestSolve_OrganizationCap(t *testing.T) {
+	ownCap := testVolunteer(2)
+	ownCap.MaxHoursPerWeek = 8
+
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 2),
+			testShift(2, 1, 1, 9, 13, 2),
+		},
+		Volunteers:      []Volunteer{testVolunteer(1), ownCap},
+		MaxHoursPerWeek: 4,
+	}
+
+	proposal := Solve(p)
+	hours := make(map[uint64]int)
+	for _, a := range proposal.Assignments {
+		hours[a.UserId] += 4
+	}
+	if hours[1] != 4 {
+		t.Errorf("Expected volunteer 1 to be held to the organization's 4 hours, got %d", hours[1])
+	}
+	if hours[2] != 8 {
+		t.Errorf("Expected volunteer 2 to work up to their own 8 hours, got %d", hours[2])
+	}
+}
+
+func TestSolve_NoOverlapsOrDoubleBooking(t *testing.T) {
+	existing := Signup{ShiftId: 2, UserId: 1}
+	existingShift := testShift(2, 1, 0, 10, 14, 2)
+	existingShift.Filled = 1
+
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),
+			existingShift,
+		},
+		Volunteers: []Volunteer{testVolunteer(1), testVolunteer(2)},
+		Existing:   []Signup{existing},
+	}
+
+	proposal := Solve(p)
+	for _, a := range proposal.Assignments {
+		if a.UserId == 1 {
+			t.Errorf("Volunteer 1 is already working 10-14 and should not be assigned %+v", a)
+		}
+	}
+	if proposal.OpenSlots != 2 {
+		t.Errorf("Expected 2 open slots, got %d", proposal.OpenSlots)
+	}
+	if proposal.FilledSlots != 1 {
+		t.Errorf("Expected volunteer 2 to fill one of the overlapping shifts, got %+v", proposal.Assignments)
+	}
+}
+
+func TestCheckAssignments(t *testing.T) {
+	capped := testVolunteer(1)
+	capped.MaxHoursPerWeek = 4
+
+	manager := testVolunteer(2)
+	manager.Roles = []users.RoleType{users.SiteManager}
+
+	free := testVolunteer(3)
+
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),
+			testShift(2, 1, 1, 9, 13, 1),
+			testShift(3, 1, 1, 10, 14, 1),
+		},
+		Volunteers: []Volunteer{capped, manager, free},
+	}
+
+	tests := []struct {
+		name        string
+		assignments []Assignment
+		want        error
+	}{
+		{"valid", []Assignment{{ShiftId: 1, UserId: 1}, {ShiftId: 2, UserId: 3}}, nil},
+		{"unknown shift", []Assignment{{ShiftId: 9, UserId: 1}}, ErrInvalidAssignment},
+		{"not a member", []Assignment{{ShiftId: 1, UserId: 9}}, ErrInvalidAssignment},
+		{"wrong role", []Assignment{{ShiftId: 1, UserId: 2}}, ErrInvalidAssignment},
+		{"over the cap", []Assignment{{ShiftId: 1, UserId: 1}, {ShiftId: 2, UserId: 1}}, ErrInvalidAssignment},
+		{"overlap", []Assignment{{ShiftId: 2, UserId: 3}, {ShiftId: 3, UserId: 3}}, ErrInvalidAssignment},
+		{"overfilled", []Assignment{{ShiftId: 1, UserId: 1}, {ShiftId: 1, UserId: 3}}, ErrShiftFull},
+	}
+	for _, tt := range tests {
+		err := CheckAssignments(p, tt.assignments)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestSolve_PrefersRequestedSites(t *testing.T) {
+	likesSiteTwo := testVolunteer(1)
+	likesSiteTwo.PreferredSiteIds = []uint64{2}
+	likesSiteOne := testVolunteer(2)
+	likesSiteOne.PreferredSiteIds = []uint64{1}
+
+	p := Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),
+			testShift(2, 2, 0, 9, 13, 1),
+		},
+		Volunteers: []Volunteer{likesSiteTwo, likesSiteOne},
+	}
+
+	proposal := Solve(p)
+	for _, a := range proposal.Assignments {
+		if a.ShiftId == 1 && a.UserGuid != likesSiteOne.UserGuid {
+			t.Errorf("Expected site 1's shift to go to %s, got %s", likesSiteOne.UserGuid, a.UserGuid)
+		}
+		if a.ShiftId == 2 && a.UserGuid != likesSiteTwo.UserGuid {
+			t.Errorf("Expected site 2's shift to go to %s, got %s", likesSiteTwo.UserGuid, a.UserGuid)
+		}
+	}
+}
+
+func TestSolverState_Repair(t *testing.T) {
+	// The greedy pass can strand a shift when the only volunteer who could
+	// work it was handed an overlapping shift someone else could have taken.
+	flexible := testVolunteer(1)
+	narrow := testVolunteer(2)
+	narrow.Windows = []users.AvailabilityWindow{{Dotw: "monday", Start: "09:00", End: "13:00"}}
+
+	st := newSolverState(Problem{
+		Shifts: []Shift{
+			testShift(1, 1, 0, 9, 13, 1),
+			testShift(2, 1, 0, 11, 15, 1),
+		},
+		Volunteers: []Volunteer{flexible, narrow},
+	})
+	st.propose(0, 0)
+	if st.fits(0, 1) || st.fits(1, 1) {
+		t.Fatal("Expected nobody to fit the afternoon shift before repair")
+	}
+
+	if !st.repair(1) {
+		t.Fatal("Expected repair to fill the afternoon shift")
+	}
+	proposal := st.proposal()
+	if proposal.FilledSlots != 2 {
+		t.Fatalf("Expected both shifts to be filled, got %+v", proposal)
+	}
+	for _, a := range proposal.Assignments {
+		if a.ShiftId == 1 && a.UserGuid != narrow.UserGuid {
+			t.Errorf("Expected the morning shift to move to %s, got %s", narrow.UserGuid, a.UserGuid)
+		}
+		if a.ShiftId == 2 && a.UserGuid != flexible.UserGuid {
+			t.Errorf("Expected the afternoon shift to go to %s, got %s", flexible.UserGuid, a.UserGuid)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sites
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"time"
+)
+
+// Weekdays lists the keys of a site's default schedule, in calendar order.
+var Weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// FieldChange is one field of a site that an update changed.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ChangeListener is called with each change to a site, inside the
+// transaction that saves it. Returning an error rolls the change back.
+type ChangeListener func(ctx context.Context, tx *sqlx.Tx, site *Site, changes []FieldChange) error
+
+var changeListeners []ChangeListener
+
+// OnChange registers a listener for site changes. Register listeners while
+// the service starts up, before it serves requests.
+func OnChange(listener ChangeListener) {
+	changeListeners = append(changeListeners, listener)
+}
+
+func notifyChange(ctx context.Context, tx *sqlx.Tx, site *Site, changes []FieldChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	for _, listener := range changeListeners {
+		err := listener(ctx, tx, site, changes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiffSite lists the fields subscribers care about that differ between two
+// versions of a site. Schedules are compared separately.
+func DiffSite(before, after *Site) []FieldChange {
+	fields := []struct {
+		name       string
+		old, value string
+	}{
+		{"name", before.Name, after.Name},
+		{"locale", before.Locale, after.Locale},
+		{"timezone", before.Timezone, after.Timezone},
+		{"active", fmt.Sprint(before.IsActive), fmt.Sprint(after.IsActive)},
+		{"location.lat", before.Latitude, after.Latitude},
+		{"location.lon", before.Longitude, after.Longitude},
+		{"location.street", before.Street, after.Street},
+		{"location.city", before.City, after.City},
+		{"location.state", before.State, after.State},
+		{"location.zip", before.ZipCode, after.ZipCode},
+	}
+	changes := make([]FieldChange, 0)
+	for _, f := range fields {
+		if f.old != f.value {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.old, New: f.value})
+		}
+	}
+	return changes
+}
+
+// describeHours summarizes a day's schedule for a change notification. A nil
+// override means the day follows the default schedule.
+func describeHours(d *DailySchedule) string {
+	switch {
+	case d == nil:
+		return "default"
+	case !d.IsOpen:
+		return "closed"
+	default:
+		return d.OpenTime + "-" + d.CloseTime
+	}
+}
+
+// DiffSchedules lists the days of the week whose default hours differ.
+func DiffSchedules(before, after map[string]DailySchedule) []FieldChange {
+	changes := make([]FieldChange, 0)
+	for _, day := range Weekdays {
+		old, oldOk := before[day]
+		updated, newOk := after[day]
+		if !newOk {
+			continue
+		}
+		oldHours := "closed"
+		if oldOk {
+			oldHours = describeHours(&old)
+		}
+		if newHours := describeHours(&updated); newHours != oldHours {
+			changes = append(changes, FieldChange{Field: "schedule." + day, Old: oldHours, New: newHours})
+		}
+	}
+	return changes
+}
+
+// diffOverride describes a change to the calendar override for one date.
+// Either side may be nil, when the override is being added or removed.
+func diffOverride(date string, before, after *DailySchedule) []FieldChange {
+	oldHours, newHours := describeHours(before), describeHours(after)
+	if oldHours == newHours {
+		return []FieldChange{}
+	}
+	return []FieldChange{{Field: "calendar." + date, Old: oldHours, New: newHours}}
+}
+
+// Validate checks a day's hours. Closed days need no hours.
+func (d DailySchedule) Validate() error {
+	if !d.IsOpen {
+		return nil
+	}
+	open, err := users.ParseClock(d.OpenTime)
+	if err != nil {
+		return errors.New("open must be given as HH:MM")
+	}
+	closing, err := users.ParseClock(d.CloseTime)
+	if err != nil {
+		return errors.New("close must be given as HH:MM")
+	}
+	if closing <= open {
+		return errors.New("close must be after open")
+	}
+	return nil
+}
+
+// ValidateOverrideDate checks that an override's date is a YYYY-MM-DD date.
+func ValidateOverrideDate(date string) error {
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return errors.New("date must be given as YYYY-MM-DD")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package sites
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSite(t *testing.T) {
+	before := &Site{Slug: "downtown", Name: "Downtown", Timezone: "America/New_York", IsActive: true,
+		Location: Location{Street: "1 Main St", City: "Springfield"}}
+	after := *before
+	if changes := DiffSite(before, &after); len(changes) != 0 {
+		t.Errorf("Expected no changes for an identical site, got %v", changes)
+	}
+
+	after.Name = "Downtown Library"
+	after.IsActive = false
+	after.Location.Street = "2 Main St"
+	after.Managers = nil // not something subscribers are told about
+	expected := []FieldChange{
+		{Field: "name", Old: "Downtown", New: "Downtown Library"},
+		{Field: "active", Old: "true", New: "false"},
+		{Field: "location.street", Old: "1 Main St", New: "2 Main St"},
+	}
+	if changes := DiffSite(before, &after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+}
+
+func TestDiffSchedules(t *testing.T) {
+	before := map[string]DailySchedule{
+		"monday":  {OpenTime: "09:00", CloseTime: "17:00", IsOpen: true},
+		"tuesday": {OpenTime: "09:00", CloseTime: "17:00", IsOpen: true},
+	}
+	after := map[string]DailySchedule{
+		"monday":   {OpenTime: "09:00", CloseTime: "17:00", IsOpen: true},
+		"tuesday":  {IsOpen: false},
+		"saturday": {OpenTime: "10:00", CloseTime: "14:00", IsOpen: true},
+	}
+	expected := []FieldChange{
+		{Field: "schedule.tuesday", Old: "09:00-17:00", New: "closed"},
+		{Field: "schedule.saturday", Old: "closed", New: "10:00-14:00"},
+	}
+	if changes := DiffSchedules(before, after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+}
+
+func TestDiffOverride(t *testing.T) {
+	closed := &DailySchedule{IsOpen: false}
+	shortDay := &DailySchedule{OpenTime: "09:00", CloseTime: "12:00", IsOpen: true}
+
+	testCases := map[string]struct {
+		before, after *DailySchedule
+		expected      []FieldChange
+	}{
+		"added":     {nil, closed, []FieldChange{{Field: "calendar.2026-12-25", Old: "default", New: "closed"}}},
+		"changed":   {closed, shortDay, []FieldChange{{Field: "calendar.2026-12-25", Old: "closed", New: "09:00-12:00"}}},
+		"removed":   {shortDay, nil, []FieldChange{{Field: "calendar.2026-12-25", Old: "09:00-12:00", New: "default"}}},
+		"unchanged": {closed, &DailySchedule{IsOpen: false}, []FieldChange{}},
+	}
+	for name, tc := range testCases {
+		if changes := diffOverride("2026-12-25", tc.before, tc.after); !reflect.DeepEqual(changes, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, changes)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	valid := map[string]DailySchedule{
+		"monday": {OpenTime: "09:00", CloseTime: "17:00", IsOpen: true},
+		"sunday": {IsOpen: false},
+	}
+	if err := ValidateSchedule(valid); err != nil {
+		t.Errorf("Expected schedule to be valid, got %v", err)
+	}
+
+	testCases := map[string]map[string]DailySchedule{
+		"not a weekday":    {"someday": {IsOpen: false}},
+		"bad open time":    {"monday": {OpenTime: "9am", CloseTime: "17:00", IsOpen: true}},
+		"closes too early": {"monday": {OpenTime: "17:00", CloseTime: "09:00", IsOpen: true}},
+	}
+	for name, schedule := range testCases {
+		if err := ValidateSchedule(schedule); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := ValidateOverrideDate("2026-02-30"); err == nil {
+		t.Error("Expected an invalid date to be rejected")
+	}
+}
+
+func TestNormalizeFeature(t *testing.T) {
+	testCases := map[string]string{
+		"Tax Prep":       "tax-prep",
+		"  tax_prep  ":   "tax-prep",
+		"TAX--PREP":      "tax-prep",
+		"Food Pantry\t2": "food-pantry-2",
+		" - ":            "",
+	}
+	for name, expected := range testCases {
+		if key := NormalizeFeature(name); key != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, key)
+		}
+	}
+	if err := ValidateFeature(""); err == nil {
+		t.Error("Expected an empty feature to be refused")
+	}
+}
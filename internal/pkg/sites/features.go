@@ -0,0 +1,133 @@
+package sites
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// Values of a feature's FieldChange.
+const (
+	FeatureOffered    = "offered"
+	FeatureNotOffered = "not offered"
+)
+
+// MaxFeatureLength is the longest feature key that can be stored.
+const MaxFeatureLength = 64
+
+var featureSeparators = regexp.MustCompile(`[\s_-]+`)
+
+// NormalizeFeature turns a feature name into the key it is stored and
+// matched by: lower case, with words joined by dashes. "Tax Prep" and
+// "tax_prep" are both "tax-prep".
+func NormalizeFeature(name string) string {
+	return strings.Trim(featureSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// ValidateFeature checks a normalized feature key.
+func ValidateFeature(key string) error {
+	if key == "" {
+		return errors.New("feature must not be empty")
+	}
+	if len(key) > MaxFeatureLength {
+		return errors.New("feature must be at most 64 characters")
+	}
+	return nil
+}
+
+// ListFeatures fetches the keys of the site's features, in alphabetical
+// order.
+func ListFeatures(ctx context.Context, db *sqlx.DB, siteId uint64) ([]string, error) {
+	features := make([]string, 0)
+	err := db.SelectContext(ctx, &features, db.Rebind(listFeaturesSql), siteId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("SiteID", siteId).WithError(err).Error("Failed to select features")
+		return nil, err
+	}
+	return features, nil
+}
+
+// AddFeature records that the site offers the feature. Adding a feature the
+// site already offers does nothing.
+func (site *Site) AddFeature(ctx context.Context, db *sqlx.DB, feature string) error {
+	return site.setFeature(ctx, db, feature, true)
+}
+
+// RemoveFeature records that the site no longer offers the feature. Returns
+// sql.ErrNoRows if it did not.
+func (site *Site) RemoveFeature(ctx context.Context, db *sqlx.DB, feature string) error {
+	return site.setFeature(ctx, db, feature, false)
+}
+
+func (site *Site) setFeature(ctx context.Context, db *sqlx.DB, feature string, offered bool) error {
+	key := NormalizeFeature(feature)
+	if err := ValidateFeature(key); err != nil {
+		return err
+	}
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Site.setFeature",
+		"SiteSlug":  site.Slug,
+		"Feature":   key,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockSite(ctx, tx, site.Slug)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to select site")
+		}
+		return err
+	}
+	site.Id = locked.Id
+	site.OrganizationId = locked.OrganizationId
+
+	var existing int
+	err = tx.GetContext(ctx, &existing, tx.Rebind(countFeatureSql), site.Id, key)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select feature")
+		return err
+	}
+	if (existing > 0) == offered {
+		if !offered {
+			return sql.ErrNoRows
+		}
+		return nil
+	}
+
+	change := FieldChange{Field: "feature." + key, Old: FeatureNotOffered, New: FeatureOffered}
+	if offered {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertFeatureSql), site.Id, key)
+	} else {
+		change.Old, change.New = FeatureOffered, FeatureNotOffered
+		_, err = tx.ExecContext(ctx, tx.Rebind(deleteFeatureSql), site.Id, key)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to save feature")
+		return err
+	}
+
+	err = notifyChange(ctx, tx, site, []FieldChange{change})
+	if err != nil {
+		logger.WithError(err).Error("Failed to record feature change")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit feature")
+		return err
+	}
+
+	// Success!
+	return nil
+}
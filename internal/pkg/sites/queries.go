@@ -1,17 +1,22 @@
 package sites
 
+// Sites of deleted organizations are hidden along with them. Sites without an
+// organization are always shown.
+const liveSiteSql = `NOT EXISTS (SELECT 1 FROM organizations WHERE organizations.id = sites.organization_id AND organizations.deleted_at IS NOT NULL)`
 
 const findSiteSql = `
 	SELECT
-		id, slug, name_l10n, locale, 
-		lat, lon, gplace_id, street, city, state, zip, 
+		id, COALESCE(organization_id, 0) AS organization_id, slug, name_l10n, locale, timezone,
+		geofence_radius_m, lat, lon, gplace_id, street, city, state, zip, 
 		is_active 
-	FROM sites WHERE slug=? LIMIT 1
+	FROM sites WHERE slug=? AND ` + liveSiteSql + `
+	LIMIT 1
 `
 
-const listAllSitesSql = `
+const selectSitesSql = `
 	SELECT 
-		sites.id, sites.slug, sites.name_l10n, sites.locale, 
+		sites.id, COALESCE(sites.organization_id, 0) AS organization_id,
+		sites.slug, sites.name_l10n, sites.locale, sites.timezone, sites.geofence_radius_m,
 		sites.lat, sites.lon, sites.gplace_id, sites.street, 
 		sites.city, sites.state, sites.zip, sites.is_active,
 
@@ -26,13 +31,15 @@ const listAllSitesSql = `
 		LEFT OUTER JOIN users ON site_coordinators.user_id = users.id 
 		LEFT OUTER JOIN daily_schedules on daily_schedules.site_id = sites.id
 `
-const describeSiteSql = listAllSitesSql + `
-	WHERE sites.slug = ?	
-`
+const listAllSitesSql = selectSitesSql + `
+	WHERE ` + liveSiteSql
+const describeSiteSql = selectSitesSql + `
+	WHERE sites.slug = ? AND ` + liveSiteSql
 
 const listOrganizationSitesSql = `
 	SELECT 
-		sites.id, sites.slug, sites.name_l10n, sites.locale, 
+		sites.id, COALESCE(sites.organization_id, 0) AS organization_id,
+		sites.slug, sites.name_l10n, sites.locale, sites.timezone, sites.geofence_radius_m,
 		sites.lat, sites.lon, sites.gplace_id, sites.street, 
 		sites.city, sites.state, sites.zip, sites.is_active,
 
@@ -47,14 +54,17 @@ const listOrganizationSitesSql = `
 		LEFT OUTER JOIN users ON site_coordinators.user_id = users.id 
 		LEFT OUTER JOIN daily_schedules on daily_schedules.site_id = sites.id
 	WHERE
-		sites.organization_id = ?
-`
+		sites.organization_id = ? AND ` + liveSiteSql
 
 const selectSiteCoordinatorsForSiteSql = `
 	SELECT users.id, users.user_guid, users.email 
 	FROM users JOIN site_coordinators ON users.id = site_coordinators.user_id
 	WHERE site_coordinators.site_id = ?`
 
+const selectCoordinatedSiteIdsSql = `
+	SELECT site_id FROM site_coordinators WHERE user_id = ?
+`
+
 const selectSiteSchedulesSql = `
 	SELECT id, site_id, dotw_default, override_date, open_time, close_time, is_open 
 	FROM daily_schedules 
@@ -63,9 +73,9 @@ const selectSiteSchedulesSql = `
 
 const insertSiteSql = `
 	INSERT INTO sites (
-		slug, name_l10n, locale, lat, lon, gplace_id, street, city, state, zip, is_active
+		organization_id, slug, name_l10n, locale, timezone, geofence_radius_m, lat, lon, gplace_id, street, city, state, zip, is_active
 	) VALUES (
-		:slug, :name_l10n, :locale, :lat, :lon, :gplace_id, :street, :city, :state, :zip, :is_active
+		NULLIF(:organization_id, 0), :slug, :name_l10n, :locale, :timezone, :geofence_radius_m, :lat, :lon, :gplace_id, :street, :city, :state, :zip, :is_active
 	) RETURNING id
 `
 
@@ -89,6 +99,8 @@ const updateSiteSql = `
 	UPDATE sites SET 
 		name_l10n = :name_l10n,
 		locale = :locale,
+		timezone = COALESCE(NULLIF(:timezone, ''), timezone),
+		geofence_radius_m = COALESCE(NULLIF(:geofence_radius_m, 0), geofence_radius_m),
 		lat = :lat,
 		lon = :lon,
 		gplace_id = :gplace_id,
@@ -99,3 +111,75 @@ const updateSiteSql = `
 		is_active = :is_active
 	WHERE slug = :slug
 `
+
+// Overrides for the date take precedence over the day of the week's default.
+const selectScheduleForDateSql = `
+	SELECT 
+		id, site_id, COALESCE(dotw_default::text, '') AS dotw_default,
+		COALESCE(to_char(override_date, 'YYYY-MM-DD'), '') AS override_date,
+		open_time, close_time, is_open
+	FROM daily_schedules
+	WHERE site_id = ? AND (override_date = ? OR (override_date IS NULL AND dotw_default = ?::dotw_type))
+	ORDER BY override_date IS NULL
+	LIMIT 1
+`
+
+const lockSiteSql = `
+	SELECT
+		id, COALESCE(organization_id, 0) AS organization_id, slug, name_l10n, locale, timezone,
+		geofence_radius_m, lat, lon, gplace_id, street, city, state, zip,
+		is_active
+	FROM sites WHERE slug=? AND ` + liveSiteSql + `
+	FOR UPDATE
+`
+
+const selectDefaultScheduleSql = `
+	SELECT
+		id, site_id, dotw_default::text AS dotw_default, '' AS override_date,
+		open_time, close_time, is_open
+	FROM daily_schedules
+	WHERE site_id = ? AND dotw_default IS NOT NULL
+`
+
+const updateDefaultDaySql = `
+	UPDATE daily_schedules SET open_time = ?, close_time = ?, is_open = ?
+	WHERE site_id = ? AND dotw_default = ?::dotw_type
+`
+
+const insertDefaultDaySql = `
+	INSERT INTO daily_schedules (site_id, dotw_default, override_date, open_time, close_time, is_open)
+	VALUES (?, ?::dotw_type, null, ?, ?, ?)
+`
+
+const selectOverrideSql = `
+	SELECT
+		id, site_id, '' AS dotw_default, to_char(override_date, 'YYYY-MM-DD') AS override_date,
+		open_time, close_time, is_open
+	FROM daily_schedules
+	WHERE site_id = ? AND override_date = ?
+`
+
+const deleteOverrideSql = `
+	DELETE FROM daily_schedules WHERE site_id = ? AND override_date = ?
+`
+
+const insertOverrideSql = `
+	INSERT INTO daily_schedules (site_id, dotw_default, override_date, open_time, close_time, is_open)
+	VALUES (?, null, ?, ?, ?, ?)
+`
+
+const listFeaturesSql = `
+	SELECT feature FROM site_features WHERE site_id = ? ORDER BY feature
+`
+
+const countFeatureSql = `
+	SELECT COUNT(*) FROM site_features WHERE site_id = ? AND feature = ?
+`
+
+const insertFeatureSql = `
+	INSERT INTO site_features (site_id, feature) VALUES (?, ?)
+`
+
+const deleteFeatureSql = `
+	DELETE FROM site_features WHERE site_id = ? AND feature = ?
+`
@@ -0,0 +1,202 @@
+package sites
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+)
+
+// lockSite selects the site's row for update, so that concurrent changes to
+// the site are diffed one at a time. Returns sql.ErrNoRows if there is no
+// such site.
+func lockSite(ctx context.Context, tx *sqlx.Tx, slug string) (*Site, error) {
+	var site Site
+	err := tx.GetContext(ctx, &site, tx.Rebind(lockSiteSql), slug)
+	if err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+// SetDefaultSchedule saves the site's usual hours for the given days of the
+// week. Days missing from the map are left as they are.
+func (site *Site) SetDefaultSchedule(ctx context.Context, db *sqlx.DB, schedule map[string]DailySchedule) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Site.SetDefaultSchedule",
+		"SiteSlug":  site.Slug,
+	})
+
+	if err := ValidateSchedule(schedule); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockSite(ctx, tx, site.Slug)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to select site")
+		}
+		return err
+	}
+	site.Id = locked.Id
+	site.OrganizationId = locked.OrganizationId
+
+	rows := make([]DailySchedule, 0, len(Weekdays))
+	err = tx.SelectContext(ctx, &rows, tx.Rebind(selectDefaultScheduleSql), site.Id)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select default schedule")
+		return err
+	}
+	before := make(map[string]DailySchedule, len(rows))
+	for _, row := range rows {
+		before[row.DotwDefault] = row
+	}
+
+	for day, hours := range schedule {
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, tx.Rebind(updateDefaultDaySql), hours.OpenTime, hours.CloseTime, hours.IsOpen, site.Id, day)
+		if err == nil {
+			if updated, _ := result.RowsAffected(); updated == 0 {
+				_, err = tx.ExecContext(ctx, tx.Rebind(insertDefaultDaySql), site.Id, day, hours.OpenTime, hours.CloseTime, hours.IsOpen)
+			}
+		}
+		if err != nil {
+			logger.WithError(err).WithField("Day", day).Error("Failed to save default schedule")
+			return err
+		}
+	}
+
+	err = notifyChange(ctx, tx, site, DiffSchedules(before, schedule))
+	if err != nil {
+		logger.WithError(err).Error("Failed to record schedule changes")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit default schedule")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// ValidateSchedule checks that each key is a day of the week, and each day's
+// hours are valid.
+func ValidateSchedule(schedule map[string]DailySchedule) error {
+	for day, hours := range schedule {
+		if !isWeekday(day) {
+			return fmt.Errorf("%s is not a day of the week", day)
+		}
+		if err := hours.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", day, err)
+		}
+	}
+	return nil
+}
+
+func isWeekday(day string) bool {
+	for _, weekday := range Weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCalendarOverride saves different hours, or a closure, for a single date,
+// replacing any override already set for it.
+func (site *Site) SetCalendarOverride(ctx context.Context, db *sqlx.DB, override DailySchedule) error {
+	if err := ValidateOverrideDate(override.Day); err != nil {
+		return err
+	}
+	if err := override.Validate(); err != nil {
+		return err
+	}
+	return site.writeCalendarOverride(ctx, db, override.Day, &override)
+}
+
+// DeleteCalendarOverride returns the date to the site's default schedule.
+// Returns sql.ErrNoRows if there was no override for it.
+func (site *Site) DeleteCalendarOverride(ctx context.Context, db *sqlx.DB, date string) error {
+	if err := ValidateOverrideDate(date); err != nil {
+		return err
+	}
+	return site.writeCalendarOverride(ctx, db, date, nil)
+}
+
+// writeCalendarOverride replaces the override for the date, or removes it if
+// override is nil.
+func (site *Site) writeCalendarOverride(ctx context.Context, db *sqlx.DB, date string, override *DailySchedule) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Site.writeCalendarOverride",
+		"SiteSlug":  site.Slug,
+		"Date":      date,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockSite(ctx, tx, site.Slug)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to select site")
+		}
+		return err
+	}
+	site.Id = locked.Id
+	site.OrganizationId = locked.OrganizationId
+
+	var before *DailySchedule
+	var existing DailySchedule
+	err = tx.GetContext(ctx, &existing, tx.Rebind(selectOverrideSql), site.Id, date)
+	if err == nil {
+		before = &existing
+	} else if err != sql.ErrNoRows {
+		logger.WithError(err).Error("Failed to select override")
+		return err
+	}
+	if before == nil && override == nil {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteOverrideSql), site.Id, date)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete override")
+		return err
+	}
+	if override != nil {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertOverrideSql), site.Id, date, override.OpenTime, override.CloseTime, override.IsOpen)
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert override")
+			return err
+		}
+	}
+
+	err = notifyChange(ctx, tx, site, diffOverride(date, before, override))
+	if err != nil {
+		logger.WithError(err).Error("Failed to record calendar changes")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit override")
+		return err
+	}
+
+	// Success!
+	return nil
+}
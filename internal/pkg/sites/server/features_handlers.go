@@ -0,0 +1,63 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"net/http"
+)
+
+func (server *SitesServer) AddSiteFeatureHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	feature := sites.NormalizeFeature(request.PathParameter("featureId"))
+	if err := sites.ValidateFeature(feature); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	site := server.findEditableSite(request, response)
+	if site == nil {
+		return
+	}
+
+	err := site.AddFeature(ctx, server.Config.GetDbConn(), feature)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *SitesServer) DeleteSiteFeatureHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	feature := sites.NormalizeFeature(request.PathParameter("featureId"))
+	if err := sites.ValidateFeature(feature); err != nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	site := server.findEditableSite(request, response)
+	if site == nil {
+		return
+	}
+
+	err := site.RemoveFeature(ctx, server.Config.GetDbConn(), feature)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// scheduleRoles may change a site's hours and features.
+var scheduleRoles = []users.RoleType{users.OrgAdmin, users.SiteManager}
+
+// findEditableSite loads the site named in the siteSlug path parameter and
+// checks that the logged-in user may change its hours and features. On
+// failure it writes the response and returns nil.
+func (server *SitesServer) findEditableSite(request *restful.Request, response *restful.Response) *sites.Site {
+	ctx := filters.GetRequestContext(request)
+	site, err := sites.FindSite(ctx, request.PathParameter("siteSlug"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if site == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(site.OrganizationId, scheduleRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return site
+}
+
+func (server *SitesServer) UpdateScheduleHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "UpdateScheduleHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+	})
+
+	site := server.findEditableSite(request, response)
+	if site == nil {
+		return
+	}
+
+	schedule := make(map[string]sites.DailySchedule)
+	err := request.ReadEntity(&schedule)
+	if err != nil {
+		logger.WithError(err).Debug("Unable to deserialize the request body")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	err = sites.ValidateSchedule(schedule)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = site.SetDefaultSchedule(ctx, server.Config.GetDbConn(), schedule)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *SitesServer) SetCalendarOverrideHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	date := request.PathParameter("date")
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SetCalendarOverrideHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+		"Date":      date,
+	})
+
+	site := server.findEditableSite(request, response)
+	if site == nil {
+		return
+	}
+
+	var override sites.DailySchedule
+	err := request.ReadEntity(&override)
+	if err != nil {
+		logger.WithError(err).Debug("Unable to deserialize the request body")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	override.Day = date
+	if err = sites.ValidateOverrideDate(date); err == nil {
+		err = override.Validate()
+	}
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = site.SetCalendarOverride(ctx, server.Config.GetDbConn(), override)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *SitesServer) DeleteCalendarOverrideHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	date := request.PathParameter("date")
+
+	site := server.findEditableSite(request, response)
+	if site == nil {
+		return
+	}
+	if err := sites.ValidateOverrideDate(date); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := site.DeleteCalendarOverride(ctx, server.Config.GetDbConn(), date)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
@@ -6,10 +6,12 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
 	"net/http"
+	"time"
 )
 
 type SitesServer struct {
@@ -66,16 +68,17 @@ func (server *SitesServer) GetSitesAPI() *restful.WebService {
 		service.PUT("/sites/{siteSlug}").
 			Filter(authConfig.ValidJwtFilter).
 			//Filter(filters.RateLimitingFilter).
-			//Filter(filters.RequireSiteUpdatePermission).
 			To(server.UpdateSiteHandler).
-			Doc("Update site config").
+			Doc("Update site config. The time zone is left unchanged if empty, and the geofence radius if omitted").
 			Produces(restful.MIME_JSON).
 			Consumes(restful.MIME_JSON).
 			Reads(sites.UpdateSiteRequestAdmin{}).
 			Writes(sites.Site{}).
 			Returns(http.StatusOK, "Site updated", sites.Site{}).
+			Returns(http.StatusBadRequest, "Unknown time zone, or a radius that is not positive", nil).
 			Returns(http.StatusUnauthorized, "Not logged in", nil).
-			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil))
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
 	service.Route(
 		service.DELETE("/sites/{siteSlug}").
 			Filter(authConfig.ValidJwtFilter).
@@ -87,30 +90,65 @@ func (server *SitesServer) GetSitesAPI() *restful.WebService {
 			Returns(http.StatusOK, "Site deleted", nil).
 			Returns(http.StatusUnauthorized, "Not logged in", nil).
 			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil))
-	//service.Route(
-	//	service.PUT("/sites/{siteSlug}/feature/{featureId}").
-	//		Filter(filters.ValidJwtFilter).
-	//		//Filter(filters.RateLimitingFilter).
-	//		//Filter(filters.RequireSiteUpdatePermission).
-	//		To(AddSiteFeatureHandler).
-	//		Doc("Add a Feature to a Site").
-	//		Produces(restful.MIME_JSON).
-	//		Reads(AddSiteFeatureRequest{}).
-	//		Writes(sites.Site{}).
-	//		Returns(http.StatusOK, "Site updated", sites.Site{}).
-	//		Returns(http.StatusUnauthorized, "Not logged in", nil).
-	//		Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil))
-	//service.Route(
-	//	service.DELETE("/sites/{siteSlug}/feature/{featureId}").
-	//		Filter(filters.ValidJwtFilter).
-	//		//Filter(filters.RateLimitingFilter).
-	//		//Filter(filters.RequireSiteUpdatePermission).
-	//		To(DeleteSiteFeatureHandler).
-	//		Doc("Remove a Feature from a Site").
-	//		Produces(restful.MIME_JSON).
-	//		Returns(http.StatusOK, "Site feature removed", nil).
-	//		Returns(http.StatusUnauthorized, "Not logged in", nil).
-	//		Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil))
+	service.Route(
+		service.PUT("/sites/{siteSlug}/schedule").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UpdateScheduleHandler).
+			Doc("Set the site's default hours for some days of the week").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(map[string]sites.DailySchedule{}).
+			Returns(http.StatusOK, "Schedule updated", nil).
+			Returns(http.StatusBadRequest, "Invalid schedule", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.PUT("/sites/{siteSlug}/calendar/{date}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SetCalendarOverrideHandler).
+			Doc("Set different hours, or a closure, for a single date").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(sites.DailySchedule{}).
+			Returns(http.StatusOK, "Override saved", nil).
+			Returns(http.StatusBadRequest, "Invalid override", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.DELETE("/sites/{siteSlug}/calendar/{date}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DeleteCalendarOverrideHandler).
+			Doc("Return a date to the site's default hours").
+			Produces(restful.MIME_JSON).
+			Returns(http.StatusOK, "Override removed", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site or override not found", nil))
+	service.Route(
+		service.PUT("/sites/{siteSlug}/feature/{featureId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.AddSiteFeatureHandler).
+			Doc("Add a Feature to a Site").
+			Param(restful.PathParameter("featureId", "Feature name, such as tax-prep")).
+			Produces(restful.MIME_JSON).
+			Returns(http.StatusOK, "Site updated", nil).
+			Returns(http.StatusBadRequest, "Invalid feature", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.DELETE("/sites/{siteSlug}/feature/{featureId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DeleteSiteFeatureHandler).
+			Doc("Remove a Feature from a Site").
+			Param(restful.PathParameter("featureId", "Feature name, such as tax-prep")).
+			Produces(restful.MIME_JSON).
+			Returns(http.StatusOK, "Site feature removed", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not authorized to update this site", nil).
+			Returns(http.StatusNotFound, "Site not found, or it does not offer the feature", nil))
 	//service.Route(
 	//	service.PUT("/sites/{siteSlug}/coordinators/{userId}").
 	//		Filter(filters.ValidJwtFilter).
@@ -184,6 +222,20 @@ func (server *SitesServer) CreateSiteHandler(request *restful.Request, response
 		return
 	}
 
+	// Sites without a time zone of their own take the organization's
+	if requestSite.Timezone == "" {
+		settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), requestSite.OrganizationId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				response.WriteErrorString(http.StatusBadRequest, "organization not found")
+				return
+			}
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		requestSite.Timezone = settings.Timezone
+	}
+
 	// Save it
 	err = requestSite.Create(ctx, server.Config.GetDbConn())
 	if err != nil {
@@ -234,10 +286,13 @@ func (server *SitesServer) UpdateSiteHandler(request *restful.Request, response
 		response.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if server.findEditableSite(request, response) == nil {
+		return
+	}
 
 	// Deserialize the request body
-	requestSite := sites.Site{}
-	err := request.ReadEntity(&requestSite)
+	updateRequest := sites.UpdateSiteRequestAdmin{}
+	err := request.ReadEntity(&updateRequest)
 	if err != nil {
 		logger.WithError(err).Error("Unable to deserialize the request body")
 		err = response.WriteError(http.StatusBadRequest, err)
@@ -248,10 +303,20 @@ func (server *SitesServer) UpdateSiteHandler(request *restful.Request, response
 		return
 	}
 
-	// TODO: Check the logged-in user's permissions for this site to determine what fields to save.
+	requestSite := updateRequest.Site
+	requestSite.Slug = slug
+	if len(requestSite.Timezone) > 0 {
+		if _, err = time.LoadLocation(requestSite.Timezone); err != nil {
+			response.WriteErrorString(http.StatusBadRequest, "timezone must be an IANA time zone name, such as America/New_York")
+			return
+		}
+	}
+	if updateRequest.GeofenceRadius != nil && *updateRequest.GeofenceRadius <= 0 {
+		response.WriteErrorString(http.StatusBadRequest, "geofence_radius_m must be a positive number of meters")
+		return
+	}
 
 	// Save it
-	updateRequest := sites.UpdateSiteRequestAdmin{Site: requestSite}
 	err = requestSite.UpdateSiteAdmin(ctx, server.Config.GetDbConn(), &updateRequest)
 	if err != nil {
 		logger.WithError(err).Error("Failed to save site")
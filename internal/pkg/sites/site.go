@@ -9,6 +9,9 @@ import (
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
 	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Location struct {
@@ -58,8 +61,14 @@ type Site struct {
 	Name   string `json:"name" db:"name_l10n"`
 	Locale string `json:"locale" db:"locale"`
 
+	// IANA time zone name, used to interpret the site's open hours
+	Timezone string `json:"timezone" db:"timezone"`
+
 	Location
 
+	// How far from the site's coordinates a clock-in may be punched
+	GeofenceRadius int `json:"geofence_radius_m" db:"geofence_radius_m"`
+
 	IsActive bool `json:"active" db:"is_active"`
 
 	// List of Site Coordinators/Managers
@@ -73,6 +82,46 @@ type Site struct {
 
 	// Computed Calendar
 	Calendar []DailySchedule `json:"calendar"`
+
+	// Keys of the services offered at the site, such as "tax-prep"
+	Features []string `json:"features"`
+}
+
+// GetScheduleForDate returns the site's hours on the given date: the override
+// for that date if there is one, otherwise the default for its day of the
+// week. Returns nil if neither exists.
+func (site *Site) GetScheduleForDate(ctx context.Context, db *sqlx.DB, day time.Time) (*DailySchedule, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Site.GetScheduleForDate",
+		"SiteSlug":  site.Slug,
+		"Date":      day.Format("2006-01-02"),
+	})
+
+	var schedule DailySchedule
+	err := db.Get(&schedule, db.Rebind(selectScheduleForDateSql),
+		site.Id, day.Format("2006-01-02"), strings.ToLower(day.Weekday().String()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.WithError(err).Error("Failed to select schedule")
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// DefaultGeofenceRadius is used for sites created without a radius.
+const DefaultGeofenceRadius = 200 // meters
+
+// Coordinates parses the site's latitude and longitude. ok is false if the
+// site's location has not been set.
+func (site *Site) Coordinates() (lat, lon float64, ok bool) {
+	lat, latErr := strconv.ParseFloat(site.Latitude, 64)
+	lon, lonErr := strconv.ParseFloat(site.Longitude, 64)
+	if latErr != nil || lonErr != nil {
+		return 0, 0, false
+	}
+	return lat, lon, true
 }
 
 type SiteCoordinator struct {
@@ -82,6 +131,26 @@ type SiteCoordinator struct {
 	IsPrimary bool `db:"is_primary"`
 }
 
+// FindSite fetches just the site's own row, without its managers or
+// schedule. Returns nil if no site has the slug.
+func FindSite(ctx context.Context, slug string, db *sqlx.DB) (*Site, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "FindSite",
+		"slug":      slug,
+	})
+
+	var site Site
+	err := db.Get(&site, db.Rebind(findSiteSql), slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.WithError(err).Error("Failed to select site")
+		return nil, err
+	}
+	return &site, nil
+}
+
 func DescribeSite(ctx context.Context, slug string, db *sqlx.DB) (site *Site, err error) {
 	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
 		"operation": "FindSite",
@@ -100,6 +169,10 @@ func DescribeSite(ctx context.Context, slug string, db *sqlx.DB) (site *Site, er
 	// Sort the Sites, Managers, and Calendars into the nested structs we use
 	sites := CoallateSiteSet(rows)
 
+	sites[0].Features, err = ListFeatures(ctx, db, sites[0].Id)
+	if err != nil {
+		return nil, err
+	}
 	return &sites[0], nil
 }
 
@@ -110,8 +183,21 @@ func (site *Site) validate() bool {
 	if len(site.Slug) == 0 {
 		return false
 	}
+	if _, err := time.LoadLocation(site.Timezone); err != nil {
+		return false
+	}
 	return true
 }
+
+// TimeLocation resolves the site's time zone, falling back to UTC if it is
+// unset or unknown.
+func (site *Site) TimeLocation() *time.Location {
+	loc, err := time.LoadLocation(site.Timezone)
+	if err != nil || site.Timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
 func (site *Site) Create(ctx context.Context, db *sqlx.DB) error {
 	// Setup
 	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
@@ -131,6 +217,12 @@ func (site *Site) Create(ctx context.Context, db *sqlx.DB) error {
 		return errors.New("no transaction handle returned for CreateSite")
 	}
 
+	if site.Timezone == "" {
+		site.Timezone = "UTC"
+	}
+	if site.GeofenceRadius == 0 {
+		site.GeofenceRadius = DefaultGeofenceRadius
+	}
 	if !site.validate() {
 		return errors.New("failed to validate site")
 	}
@@ -186,11 +278,15 @@ func CoallateSiteSet(rows []ListSitesRow) []Site {
 		if thisSite == nil {
 			thisSite = &Site{
 				Id: row.Site.Id,
+				OrganizationId: row.Site.OrganizationId,
 				Slug: row.Site.Slug,
 				Name: row.Site.Name,
 				Locale: row.Site.Locale,
+				Timezone: row.Site.Timezone,
 				Location: row.Site.Location,
+				GeofenceRadius: row.Site.GeofenceRadius,
 				IsActive: row.Site.IsActive,
+				DefaultSchedule: make(map[string]DailySchedule),
 			}
 		}
 
@@ -277,26 +373,73 @@ func DeleteSite(ctx context.Context, db *sqlx.DB, siteSlug string) error {
 	return nil
 }
 
+// UpdateSiteRequestAdmin leaves the site's time zone unchanged if it is
+// empty, and its geofence radius if it is omitted.
 type UpdateSiteRequestAdmin struct {
 	Site
+	GeofenceRadius *int `json:"geofence_radius_m,omitempty"` // meters
 }
 func (site *Site) UpdateSiteAdmin(ctx context.Context, db *sqlx.DB, updateData *UpdateSiteRequestAdmin) error {
 	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
-		"operation": "DeleteSite",
+		"operation": "UpdateSiteAdmin",
 		"SiteSlug": site.Slug,
 	})
 
-	sqlStmt := db.Rebind(updateSiteSql)
-	_, err := db.NamedExec(sqlStmt, site)
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockSite(ctx, tx, site.Slug)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Debug("Site does not exist")
 		} else {
-			logger.WithError(err).Error("Failed to update site")
+			logger.WithError(err).Error("Failed to select site")
 		}
 		return err
 	}
+	site.Id = before.Id
+	site.OrganizationId = before.OrganizationId
+	if site.Timezone == "" {
+		site.Timezone = before.Timezone
+	}
+	site.GeofenceRadius = before.GeofenceRadius
+	if updateData.GeofenceRadius != nil {
+		site.GeofenceRadius = *updateData.GeofenceRadius
+	}
+
+	sqlStmt := tx.Rebind(updateSiteSql)
+	_, err = tx.NamedExecContext(ctx, sqlStmt, site)
+	if err != nil {
+		logger.WithError(err).Error("Failed to update site")
+		return err
+	}
+
+	err = notifyChange(ctx, tx, site, DiffSite(before, site))
+	if err != nil {
+		logger.WithError(err).Error("Failed to record site changes")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit site update")
+		return err
+	}
 
 	// Success
 	return nil
 }
+
+// ListCoordinatedSiteIds fetches the IDs of the sites the user coordinates.
+func ListCoordinatedSiteIds(ctx context.Context, db *sqlx.DB, userId uint64) ([]uint64, error) {
+	siteIds := make([]uint64, 0)
+	err := db.SelectContext(ctx, &siteIds, db.Rebind(selectCoordinatedSiteIdsSql), userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("UserID", userId).WithError(err).Error("Failed to select coordinated sites")
+		return nil, err
+	}
+	return siteIds, nil
+}
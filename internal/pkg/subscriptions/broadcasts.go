@@ -0,0 +1,315 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// EventBroadcast is the type of the notifications carrying a broadcast. It is
+// not one of DigestEventTypes, so broadcasts ignore quiet hours and digests.
+const EventBroadcast = "broadcast"
+
+// Broadcast target types.
+const (
+	TargetOrganization = "organization" // everyone with a role in the organization
+	TargetSignups      = "signups"      // everyone signed up at a site, on a date, or both
+	TargetTeam         = "team"
+)
+
+const (
+	MaxBroadcastSubjectLength = 200
+	MaxBroadcastBodyLength    = 5000
+)
+
+// ErrUnknownTeam is returned when broadcasting to a team that is not the
+// organization's.
+var ErrUnknownTeam = errors.New("unknown team")
+
+// BroadcastTarget picks who a broadcast is sent to.
+type BroadcastTarget struct {
+	Type     string `json:"type" db:"target_type"`
+	SiteSlug string `json:"site_slug,omitempty" db:"site_slug"` // signups only
+	Date     string `json:"date,omitempty" db:"shift_date"`     // signups only. YYYY-MM-DD in each site's time zone
+	TeamId   uint64 `json:"team_id,omitempty" db:"team_id"`     // team only
+}
+
+// Broadcast is an urgent message from an Organization's admin to a group of
+// its volunteers, sent on every channel.
+type Broadcast struct {
+	Id             uint64 `json:"id" db:"id"`
+	OrganizationId uint64 `json:"organization_id" db:"organization_id"`
+	SentBy         uint64 `json:"-" db:"sent_by"`
+	SenderGuid     string `json:"sent_by" db:"sender_guid"`
+	Subject        string `json:"subject" db:"subject"`
+	Body           string `json:"body" db:"body"`
+
+	BroadcastTarget `json:"target"`
+
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	Summary   *BroadcastSummary `json:"summary,omitempty"`
+}
+
+// BroadcastSummary is how far a broadcast has got.
+type BroadcastSummary struct {
+	Recipients   int `json:"recipients" db:"recipients"`
+	Delivered    int `json:"delivered" db:"delivered"` // on at least one channel
+	EmailSent    int `json:"email_sent" db:"email_sent"`
+	PushSent     int `json:"push_sent" db:"push_sent"`
+	Pending      int `json:"pending" db:"pending"`         // notifications not tried yet
+	Undelivered  int `json:"undelivered" db:"undelivered"` // notifications no device or mailbox took
+	Acknowledged int `json:"acknowledged" db:"acknowledged"`
+}
+
+// BroadcastRecipient is where a broadcast stands with one recipient.
+type BroadcastRecipient struct {
+	UserGuid       string     `json:"user_guid" db:"user_guid"`
+	Email          string     `json:"email" db:"email"`
+	EmailStatus    *string    `json:"email_status,omitempty" db:"email_status"`
+	EmailSentAt    *time.Time `json:"email_sent_at,omitempty" db:"email_sent_at"`
+	PushStatus     *string    `json:"push_status,omitempty" db:"push_status"`
+	PushSentAt     *time.Time `json:"push_sent_at,omitempty" db:"push_sent_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+}
+
+// BroadcastEvent is the payload of an EventBroadcast notification.
+type BroadcastEvent struct {
+	BroadcastId    uint64 `json:"broadcast_id"`
+	OrganizationId uint64 `json:"organization_id"`
+	Subject        string `json:"subject"`
+	Body           string `json:"body"`
+}
+
+// Validate checks the fields a sender controls.
+func (b Broadcast) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if b.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("organization_id must be present"))
+	}
+	subject := strings.TrimSpace(b.Subject)
+	if len(subject) == 0 {
+		errSet = append(errSet, errors.New("subject must be present"))
+	} else if len(subject) > MaxBroadcastSubjectLength {
+		errSet = append(errSet, fmt.Errorf("subject may be at most %d characters", MaxBroadcastSubjectLength))
+	}
+	body := strings.TrimSpace(b.Body)
+	if len(body) == 0 {
+		errSet = append(errSet, errors.New("body must be present"))
+	} else if len(body) > MaxBroadcastBodyLength {
+		errSet = append(errSet, fmt.Errorf("body may be at most %d characters", MaxBroadcastBodyLength))
+	}
+
+	switch b.Type {
+	case TargetOrganization:
+	case TargetSignups:
+		if b.SiteSlug == "" && b.Date == "" {
+			errSet = append(errSet, errors.New("a signups target needs a site_slug, a date or both"))
+		}
+		if b.Date != "" {
+			if _, err := time.Parse("2006-01-02", b.Date); err != nil {
+				errSet = append(errSet, errors.New("date must be given as YYYY-MM-DD"))
+			}
+		}
+	case TargetTeam:
+		if b.TeamId == 0 {
+			errSet = append(errSet, errors.New("a team target needs a team_id"))
+		}
+	default:
+		errSet = append(errSet, fmt.Errorf("unknown target type %q, expected %s, %s or %s", b.Type, TargetOrganization, TargetSignups, TargetTeam))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// Create saves the broadcast, picks its recipients and queues a notification
+// to each on every channel, all in one transaction. Returns ErrUnknownSite or
+// ErrUnknownTeam if the target names a site or team outside the organization.
+func (b *Broadcast) Create(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "CreateBroadcast",
+		"OrganizationID": b.OrganizationId,
+		"TargetType":     b.Type,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteId, teamId *uint64
+	if b.Type == TargetSignups && b.SiteSlug != "" {
+		var id uint64
+		err = tx.GetContext(ctx, &id, tx.Rebind(selectOrgSiteIdSql), b.SiteSlug, b.OrganizationId)
+		if err == sql.ErrNoRows {
+			return ErrUnknownSite
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to look up site")
+			return err
+		}
+		siteId = &id
+	}
+	if b.Type == TargetTeam {
+		err = tx.GetContext(ctx, new(uint64), tx.Rebind(selectOrgTeamIdSql), b.TeamId, b.OrganizationId)
+		if err == sql.ErrNoRows {
+			return ErrUnknownTeam
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to look up team")
+			return err
+		}
+		teamId = &b.TeamId
+	}
+	date := nullIfEmpty(b.Date)
+
+	b.Subject = strings.TrimSpace(b.Subject)
+	b.Body = strings.TrimSpace(b.Body)
+	row := tx.QueryRowxContext(ctx, tx.Rebind(insertBroadcastSql),
+		b.OrganizationId, b.SentBy, b.Subject, b.Body, b.Type, siteId, date, teamId)
+	err = row.Scan(&b.Id, &b.CreatedAt)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert broadcast")
+		return err
+	}
+
+	switch b.Type {
+	case TargetOrganization:
+		memberRoles := make([]int64, 0, len(users.MemberRoles))
+		for _, role := range users.MemberRoles {
+			memberRoles = append(memberRoles, int64(role))
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertOrgRecipientsSql), b.Id, b.OrganizationId, pq.Array(memberRoles))
+	case TargetSignups:
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertSignupRecipientsSql), b.Id, b.OrganizationId, siteId, siteId, date, date)
+	case TargetTeam:
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertTeamRecipientsSql), b.Id, b.TeamId)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert recipients")
+		return err
+	}
+
+	payload, err := json.Marshal(BroadcastEvent{
+		BroadcastId:    b.Id,
+		OrganizationId: b.OrganizationId,
+		Subject:        b.Subject,
+		Body:           b.Body,
+	})
+	if err != nil {
+		return err
+	}
+	notificationIds := make([]uint64, 0)
+	err = tx.SelectContext(ctx, &notificationIds, tx.Rebind(queueBroadcastNotificationsSql), EventBroadcast, string(payload), b.Id)
+	if err != nil {
+		logger.WithError(err).Error("Failed to queue notifications")
+		return err
+	}
+	if err = queueDeliveries(ctx, tx, notificationIds); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit broadcast")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// DescribeBroadcast fetches a single broadcast, without its summary. Returns
+// sql.ErrNoRows if it does not exist.
+func DescribeBroadcast(ctx context.Context, db *sqlx.DB, id uint64) (*Broadcast, error) {
+	var b Broadcast
+	err := db.GetContext(ctx, &b, db.Rebind(describeBroadcastSql), id)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBroadcasts fetches an Organization's newest broadcasts, without their
+// summaries.
+func ListBroadcasts(ctx context.Context, db *sqlx.DB, orgId uint64, limit int) ([]Broadcast, error) {
+	broadcastSet := make([]Broadcast, 0)
+	err := db.SelectContext(ctx, &broadcastSet, db.Rebind(listBroadcastsSql), orgId, limit)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":      "ListBroadcasts",
+			"OrganizationID": orgId,
+		}).WithError(err).Error("Failed to select broadcasts")
+		return nil, err
+	}
+	return broadcastSet, nil
+}
+
+// GetBroadcastSummary counts the broadcast's recipients, deliveries and
+// acknowledgements.
+func GetBroadcastSummary(ctx context.Context, db *sqlx.DB, id uint64) (*BroadcastSummary, error) {
+	var summary BroadcastSummary
+	err := db.GetContext(ctx, &summary, db.Rebind(broadcastSummarySql), id, id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":   "GetBroadcastSummary",
+			"BroadcastID": id,
+		}).WithError(err).Error("Failed to summarize broadcast")
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// ListBroadcastRecipients fetches where the broadcast stands with each of its
+// recipients, ordered by email.
+func ListBroadcastRecipients(ctx context.Context, db *sqlx.DB, id uint64) ([]BroadcastRecipient, error) {
+	recipients := make([]BroadcastRecipient, 0)
+	err := db.SelectContext(ctx, &recipients, db.Rebind(listBroadcastRecipientsSql), id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":   "ListBroadcastRecipients",
+			"BroadcastID": id,
+		}).WithError(err).Error("Failed to select recipients")
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// AcknowledgeBroadcast records that the user has read the broadcast, and
+// returns when they first did. Returns sql.ErrNoRows if they are not one of
+// its recipients.
+func AcknowledgeBroadcast(ctx context.Context, db *sqlx.DB, id, userId uint64) (time.Time, error) {
+	var acknowledgedAt time.Time
+	err := db.GetContext(ctx, &acknowledgedAt, db.Rebind(acknowledgeBroadcastSql), id, userId)
+	if err != nil && err != sql.ErrNoRows {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":   "AcknowledgeBroadcast",
+			"BroadcastID": id,
+			"UserID":      userId,
+		}).WithError(err).Error("Failed to acknowledge broadcast")
+	}
+	return acknowledgedAt, err
+}
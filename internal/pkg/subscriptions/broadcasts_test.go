@@ -0,0 +1,57 @@
+package subscriptions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBroadcast_Validate(t *testing.T) {
+	valid := []Broadcast{
+		{OrganizationId: 1, Subject: "Closed today", Body: "The power is out.", BroadcastTarget: BroadcastTarget{Type: TargetOrganization}},
+		{OrganizationId: 1, Subject: "Closed today", Body: "The power is out.", BroadcastTarget: BroadcastTarget{Type: TargetSignups, SiteSlug: "downtown"}},
+		{OrganizationId: 1, Subject: "Closed today", Body: "The power is out.", BroadcastTarget: BroadcastTarget{Type: TargetSignups, Date: "2026-10-19"}},
+		{OrganizationId: 1, Subject: "Closed today", Body: "The power is out.", BroadcastTarget: BroadcastTarget{Type: TargetTeam, TeamId: 4}},
+	}
+	for _, b := range valid {
+		if errs := b.Validate(); errs != nil {
+			t.Errorf("Expected %+v to be valid, got %v", b.BroadcastTarget, errs)
+		}
+	}
+
+	target := BroadcastTarget{Type: TargetOrganization}
+	testCases := map[string]Broadcast{
+		"no organization": {Subject: "Closed", Body: "Closed", BroadcastTarget: target},
+		"no subject":      {OrganizationId: 1, Subject: "  ", Body: "Closed", BroadcastTarget: target},
+		"long subject":    {OrganizationId: 1, Subject: strings.Repeat("x", MaxBroadcastSubjectLength+1), Body: "Closed", BroadcastTarget: target},
+		"no body":         {OrganizationId: 1, Subject: "Closed", BroadcastTarget: target},
+		"unknown target":  {OrganizationId: 1, Subject: "Closed", Body: "Closed", BroadcastTarget: BroadcastTarget{Type: "everyone"}},
+		"no site or date": {OrganizationId: 1, Subject: "Closed", Body: "Closed", BroadcastTarget: BroadcastTarget{Type: TargetSignups}},
+		"bad date":        {OrganizationId: 1, Subject: "Closed", Body: "Closed", BroadcastTarget: BroadcastTarget{Type: TargetSignups, Date: "10/19/2026"}},
+		"no team":         {OrganizationId: 1, Subject: "Closed", Body: "Closed", BroadcastTarget: BroadcastTarget{Type: TargetTeam}},
+	}
+	for name, b := range testCases {
+		if errs := b.Validate(); errs == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNotification_PushMessage_Broadcast(t *testing.T) {
+	n := Notification{
+		EventType: EventBroadcast,
+		Payload:   `{"broadcast_id": 7, "organization_id": 1, "subject": "Downtown is closed today", "body": "The power is out."}`,
+	}
+	msg, err := n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Downtown is closed today" || msg.Body != "The power is out." || msg.Data["broadcast_id"] != "7" {
+		t.Errorf("Unexpected message %q: %q %v", msg.Title, msg.Body, msg.Data)
+	}
+}
+
+func TestIsDigestEventType_Broadcast(t *testing.T) {
+	if isDigestEventType(EventBroadcast) {
+		t.Error("Expected broadcasts to skip quiet hours and digests")
+	}
+}
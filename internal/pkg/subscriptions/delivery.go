@@ -0,0 +1,477 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/mail"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/push"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Notification is an event queued for delivery to a user on one channel.
+type Notification struct {
+	Id        uint64     `json:"id" db:"id"`
+	UserId    uint64     `json:"-" db:"user_id"`
+	Email     string     `json:"-" db:"email"`
+	OrgId     *uint64    `json:"-" db:"organization_id"` // the user's
+	Channel   string     `json:"channel" db:"channel"`
+	EventType string     `json:"event_type" db:"event_type"`
+	Payload   string     `json:"payload" db:"payload"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	Status    string     `json:"status" db:"status"`
+	SentAt    *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	LastError string     `json:"last_error,omitempty" db:"last_error"`
+}
+
+// Notification statuses.
+const (
+	NotificationPending     = "pending"
+	NotificationSent        = "sent"
+	NotificationUndelivered = "undelivered" // no device or mailbox would take it
+)
+
+// fieldLabels name changed fields the way a volunteer would, by language.
+// The weekday or date replaces %s.
+var fieldLabels = map[string]map[string]string{
+	"en": {
+		"schedule": "%s hours",
+		"calendar": "hours on %s",
+		"feature":  "%s service",
+		"location": "location",
+		"active":   "open status",
+		"name":     "name",
+		"locale":   "language",
+		"timezone": "time zone",
+	},
+	"es": {
+		"schedule": "horario del %s",
+		"calendar": "horario del %s",
+		"feature":  "servicio %s",
+		"location": "ubicación",
+		"active":   "estado de apertura",
+		"name":     "nombre",
+		"locale":   "idioma",
+		"timezone": "zona horaria",
+	},
+}
+
+var weekdayNames = map[string]map[string]string{
+	"es": {
+		"sunday":    "domingo",
+		"monday":    "lunes",
+		"tuesday":   "martes",
+		"wednesday": "miércoles",
+		"thursday":  "jueves",
+		"friday":    "viernes",
+		"saturday":  "sábado",
+	},
+}
+
+// language reduces a locale such as es-MX to a language with labels.
+func language(locale string) string {
+	lang := strings.ToLower(locale)
+	if dash := strings.IndexAny(lang, "-_"); dash > 0 {
+		lang = lang[:dash]
+	}
+	if _, ok := fieldLabels[lang]; !ok {
+		return "en"
+	}
+	return lang
+}
+
+// describeField names a changed field in the given language.
+func describeField(field, lang string) string {
+	labels := fieldLabels[language(lang)]
+	kind, arg := field, ""
+	if dot := strings.Index(field, "."); dot > 0 {
+		kind, arg = field[:dot], field[dot+1:]
+	}
+	label, ok := labels[kind]
+	if !ok {
+		return field
+	}
+	if !strings.Contains(label, "%s") {
+		return label
+	}
+	if kind == "schedule" {
+		if name, ok := weekdayNames[language(lang)][arg]; ok {
+			arg = name
+		} else {
+			arg = strings.Title(arg)
+		}
+	}
+	return fmt.Sprintf(label, arg)
+}
+
+// localTimes formats the shift's start and end in its site's time zone.
+func (e ShiftEvent) localTimes() (string, string) {
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return e.StartsAt.In(loc).Format("Mon Jan 2 3:04 PM"), e.EndsAt.In(loc).Format("3:04 PM")
+}
+
+// PushMessage renders the notification for a phone's lock screen.
+func (n Notification) PushMessage() (push.Message, error) {
+	msg := push.Message{
+		Data: map[string]string{
+			"event_type":      n.EventType,
+			"notification_id": fmt.Sprint(n.Id),
+		},
+	}
+	switch n.EventType {
+	case EventSiteUpdated:
+		var event SiteChangeEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return msg, err
+		}
+		msg.Title = event.SiteName + " has changed"
+		msg.Body = "Updated: " + describeChanges(event.Changes, "en")
+		msg.Data["site_slug"] = event.SiteSlug
+	case shifts.EventSignupCreated, shifts.EventSignupCancelled, EventShiftReminder:
+		var event ShiftEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return msg, err
+		}
+		starts, ends := event.localTimes()
+		switch n.EventType {
+		case shifts.EventSignupCreated:
+			msg.Title = "Signed up at " + event.SiteName
+		case shifts.EventSignupCancelled:
+			msg.Title = "Shift cancelled at " + event.SiteName
+		default:
+			msg.Title = "Reminder: your shift at " + event.SiteName
+		}
+		msg.Body = starts + " - " + ends
+		msg.Data["site_slug"] = event.SiteSlug
+		msg.Data["shift_id"] = fmt.Sprint(event.ShiftId)
+	case suggestions.EventSuggestionCreated:
+		var notice SuggestionNotice
+		err := json.Unmarshal([]byte(n.Payload), &notice)
+		if err != nil {
+			return msg, err
+		}
+		msg.Title = "New suggestion for " + notice.Place()
+		msg.Body = notice.Excerpt
+		msg.Data["suggestion_id"] = fmt.Sprint(notice.SuggestionId)
+	case users.EventUserCreated:
+		var notice NewUserNotice
+		err := json.Unmarshal([]byte(n.Payload), &notice)
+		if err != nil {
+			return msg, err
+		}
+		msg.Title = "New volunteer at " + notice.OrganizationName
+		msg.Body = notice.Email + " joined"
+		msg.Data["user_guid"] = notice.UserGuid
+	case EventDigest:
+		var event DigestEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return msg, err
+		}
+		lines, err := event.Lines("en")
+		if err != nil {
+			return msg, err
+		}
+		msg.Title = fmt.Sprintf("Your %s digest", event.Frequency)
+		msg.Body = strings.Join(lines, "\n")
+	case EventBroadcast:
+		var event BroadcastEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return msg, err
+		}
+		msg.Title = event.Subject
+		msg.Body = event.Body
+		msg.Data["broadcast_id"] = fmt.Sprint(event.BroadcastId)
+	default:
+		return msg, fmt.Errorf("no push message for event type %q", n.EventType)
+	}
+	return msg, nil
+}
+
+// organizationBranding is how email on the organization's behalf looks.
+func organizationBranding(org *organizations.Organization) mail.Branding {
+	return mail.Branding{
+		Name:        org.Name,
+		FromAddress: org.EmailFromAddress,
+		FromName:    org.EmailFromName,
+		Color:       org.BrandColor,
+		LogoUrl:     org.LogoUrl,
+	}
+}
+
+// errGone is returned for email about an organization or site that has been
+// deleted since the notification was queued. It will never be sent.
+var errGone = errors.New("the organization or site no longer exists")
+
+// orgEnvelope addresses the notification as email from the organization, with
+// its branding, in the given locale or else the organization's.
+func (n Notification) orgEnvelope(ctx context.Context, db *sqlx.DB, orgId uint64, locale, template string) (*mail.Envelope, error) {
+	env := mail.Envelope{
+		To:       n.Email,
+		Locale:   locale,
+		Template: template,
+	}
+	if orgId != 0 {
+		org, err := organizations.DescribeOrganization(ctx, db, int64(orgId))
+		if err == sql.ErrNoRows {
+			return nil, errGone
+		}
+		if err != nil {
+			return nil, err
+		}
+		env.Branding = organizationBranding(org)
+		if env.Locale == "" {
+			env.Locale = org.DefaultLocale
+		}
+	}
+	return &env, nil
+}
+
+// siteEnvelope addresses the notification as email about the site, in the
+// site's locale or else its organization's, and with the organization's
+// branding.
+func (n Notification) siteEnvelope(ctx context.Context, db *sqlx.DB, siteSlug, template string) (*mail.Envelope, error) {
+	site, err := sites.FindSite(ctx, siteSlug, db)
+	if err != nil {
+		return nil, err
+	}
+	if site == nil {
+		return nil, errGone
+	}
+	return n.orgEnvelope(ctx, db, site.OrganizationId, site.Locale, template)
+}
+
+// EmailEnvelope renders the notification as an email.
+func (n Notification) EmailEnvelope(ctx context.Context, db *sqlx.DB) (*mail.Envelope, error) {
+	switch n.EventType {
+	case EventSiteUpdated:
+		var event SiteChangeEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return nil, err
+		}
+		env, err := n.siteEnvelope(ctx, db, event.SiteSlug, mail.TemplateSiteUpdated)
+		if err != nil {
+			return nil, err
+		}
+		data := mail.SiteUpdatedData{SiteName: event.SiteName, Changes: make([]mail.ChangeLine, 0, len(event.Changes))}
+		for _, change := range event.Changes {
+			data.Changes = append(data.Changes, mail.ChangeLine{
+				Label: describeField(change.Field, env.Locale),
+				Old:   change.Old,
+				New:   change.New,
+			})
+		}
+		env.Data = data
+		return env, nil
+	case shifts.EventSignupCreated, shifts.EventSignupCancelled, EventShiftReminder:
+		var event ShiftEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return nil, err
+		}
+		template := mail.TemplateShiftSignup
+		switch n.EventType {
+		case shifts.EventSignupCancelled:
+			template = mail.TemplateShiftCancel
+		case EventShiftReminder:
+			template = mail.TemplateShiftReminder
+		}
+		env, err := n.siteEnvelope(ctx, db, event.SiteSlug, template)
+		if err != nil {
+			return nil, err
+		}
+		starts, ends := event.localTimes()
+		env.Data = mail.ShiftData{SiteName: event.SiteName, Starts: starts, Ends: ends}
+		return env, nil
+	case suggestions.EventSuggestionCreated:
+		var notice SuggestionNotice
+		err := json.Unmarshal([]byte(n.Payload), &notice)
+		if err != nil {
+			return nil, err
+		}
+		env, err := n.orgEnvelope(ctx, db, notice.OrganizationId, "", mail.TemplateNewSuggestion)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = mail.NewSuggestionData{Place: notice.Place(), Excerpt: notice.Excerpt}
+		return env, nil
+	case users.EventUserCreated:
+		var notice NewUserNotice
+		err := json.Unmarshal([]byte(n.Payload), &notice)
+		if err != nil {
+			return nil, err
+		}
+		env, err := n.orgEnvelope(ctx, db, notice.OrganizationId, "", mail.TemplateNewUser)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = mail.NewUserData{Email: notice.Email}
+		return env, nil
+	case EventDigest:
+		var event DigestEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return nil, err
+		}
+		// A digest may span organizations, so it comes from the user's own
+		var orgId uint64
+		if n.OrgId != nil {
+			orgId = *n.OrgId
+		}
+		env, err := n.orgEnvelope(ctx, db, orgId, "", mail.TemplateDigest)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := event.Lines(env.Locale)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = mail.DigestData{Weekly: event.Frequency == DigestWeekly, Lines: lines}
+		return env, nil
+	case EventBroadcast:
+		var event BroadcastEvent
+		err := json.Unmarshal([]byte(n.Payload), &event)
+		if err != nil {
+			return nil, err
+		}
+		env, err := n.orgEnvelope(ctx, db, event.OrganizationId, "", mail.TemplateBroadcast)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = mail.BroadcastData{Subject: event.Subject, Body: event.Body}
+		return env, nil
+	}
+	return nil, fmt.Errorf("no email for event type %q", n.EventType)
+}
+
+// Deliverer sends queued notifications on their channel.
+type Deliverer struct {
+	db     *sqlx.DB
+	Sender *push.Sender
+	Mailer *mail.Mailer
+}
+
+func NewDeliverer(db *sqlx.DB, sender *push.Sender, mailer *mail.Mailer) *Deliverer {
+	return &Deliverer{
+		db:     db,
+		Sender: sender,
+		Mailer: mailer,
+	}
+}
+
+// Deliver handles EventDeliverNotification. Non-urgent notifications that
+// come due during the user's quiet hours are put off until they end. Failures
+// to send are returned so that the outbox retries them. Notifications that no
+// device or mailbox will ever take are marked undelivered instead.
+func (d *Deliverer) Deliver(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var req deliverRequest
+	if err := event.Decode(&req); err != nil {
+		return err
+	}
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "Deliverer.Deliver",
+		"NotificationID": req.NotificationId,
+	})
+
+	var n Notification
+	err := tx.GetContext(ctx, &n, tx.Rebind(lockNotificationSql), req.NotificationId)
+	if err == sql.ErrNoRows {
+		logger.Debug("Notification no longer exists")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if n.Status != NotificationPending {
+		return nil
+	}
+	if isDigestEventType(n.EventType) {
+		quiet, err := quietHoursFor(ctx, tx, n.UserId)
+		if err != nil {
+			return err
+		}
+		if quiet != nil {
+			if until := quiet.QuietUntil(time.Now()); !until.IsZero() {
+				logger.WithField("Until", until).Debug("Putting off notification during quiet hours")
+				return outbox.EnqueueAt(ctx, tx, EventDeliverNotification, req, until)
+			}
+		}
+	}
+
+	switch n.Channel {
+	case ChannelPush:
+		msg, err := n.PushMessage()
+		if err != nil {
+			return err
+		}
+		delivered, err := d.Sender.SendToUser(ctx, d.db, n.UserId, msg)
+		if err != nil {
+			return err
+		}
+		if delivered == 0 {
+			logger.Info("No device received the push notification")
+			return markUndelivered(ctx, tx, n.Id, "no device received it")
+		}
+	case ChannelEmail:
+		env, err := n.EmailEnvelope(ctx, d.db)
+		if err == errGone {
+			logger.Info("Dropping email about a deleted organization or site")
+			return markUndelivered(ctx, tx, n.Id, "the organization or site has been deleted")
+		}
+		if err != nil {
+			return err
+		}
+		err = d.Mailer.Send(ctx, d.db, *env)
+		if errors.Is(err, mail.ErrUndeliverable) || errors.Is(err, mail.ErrPermanentFailure) {
+			logger.WithError(err).Info("Dropping email to undeliverable address")
+			return markUndelivered(ctx, tx, n.Id, err.Error())
+		} else if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown channel %q", n.Channel)
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(markNotificationSentSql), n.Id)
+	return err
+}
+
+// markUndelivered settles a notification that will never reach the user, so
+// that it is neither retried nor counted as sent.
+func markUndelivered(ctx context.Context, tx *sqlx.Tx, id uint64, reason string) error {
+	_, err := tx.ExecContext(ctx, tx.Rebind(markNotificationUndeliveredSql), reason, id)
+	return err
+}
+
+// RegisterHandlers sets up the worker to turn site, suggestion, user and
+// signup events into notifications, to schedule and cancel reminders, and to
+// deliver them all.
+func RegisterHandlers(worker *outbox.Worker, deliverer *Deliverer, reminders *Reminders) {
+	worker.Handle(EventSiteUpdated, FanOutSiteChange)
+	worker.Handle(suggestions.EventSuggestionCreated, FanOutSuggestion)
+	worker.Handle(users.EventUserCreated, FanOutNewUser)
+	worker.Handle(shifts.EventSignupCreated, FanOutSignup)
+	worker.Handle(shifts.EventSignupCreated, reminders.Schedule)
+	worker.Handle(shifts.EventSignupCancelled, FanOutSignup)
+	worker.Handle(shifts.EventSignupCancelled, CancelReminders)
+	worker.Handle(EventDeliverNotification, deliverer.Deliver)
+}
@@ -0,0 +1,294 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventDigest is the type of the notification that delivers a user's held
+// notifications together.
+const EventDigest = "notification.digest"
+
+// Digest frequencies.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DefaultDigestBatchSize is how many due digests a new Digests builds per
+// transaction.
+const DefaultDigestBatchSize = 100
+
+// Digest is when a user wants their non-urgent notifications batched up and
+// sent, in their time zone.
+type Digest struct {
+	Frequency string `json:"frequency" db:"frequency"` // daily or weekly
+	Timezone  string `json:"timezone" db:"timezone"`
+	At        string `json:"at" db:"send_at"`                // HH:MM
+	Weekday   string `json:"weekday,omitempty" db:"weekday"` // sunday, monday, ... saturday; weekly digests only
+}
+
+func (d Digest) Validate() error {
+	if d.Frequency != DigestDaily && d.Frequency != DigestWeekly {
+		return fmt.Errorf("unknown digest frequency %q, expected %s or %s", d.Frequency, DigestDaily, DigestWeekly)
+	}
+	if d.Timezone == "" {
+		return errors.New("a digest needs a timezone")
+	}
+	if _, err := time.LoadLocation(d.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", d.Timezone)
+	}
+	if at, err := users.ParseClock(d.At); err != nil || at >= 24*60 {
+		return errors.New("digest time must be given as HH:MM")
+	}
+	if d.Frequency == DigestWeekly {
+		if _, err := users.ParseDotw(d.Weekday); err != nil {
+			return errors.New("a weekly digest needs a weekday")
+		}
+	}
+	return nil
+}
+
+// Next returns when the digest is next sent after the given time.
+func (d Digest) Next(after time.Time) time.Time {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	at, err := users.ParseClock(d.At)
+	if err != nil {
+		at = 0
+	}
+
+	local := after.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), at/60, at%60, 0, 0, loc)
+	days := 1
+	if d.Frequency == DigestWeekly {
+		days = 7
+		if weekday, err := users.ParseDotw(d.Weekday); err == nil {
+			next = next.AddDate(0, 0, (int(weekday)-int(next.Weekday())+7)%7)
+		}
+	}
+	for !next.After(after) {
+		next = next.AddDate(0, 0, days)
+	}
+	return next
+}
+
+// DigestEvent is the payload of an EventDigest notification.
+type DigestEvent struct {
+	Frequency string       `json:"frequency"`
+	Items     []DigestItem `json:"items"` // oldest first
+}
+
+// DigestItem is one notification held for a digest.
+type DigestItem struct {
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// digestPhrases describe each kind of digested notification in one line,
+// by language.
+var digestPhrases = map[string]map[string]string{
+	"en": {
+		EventSiteUpdated:                   "%s changed: %s",
+		suggestions.EventSuggestionCreated: "New suggestion for %s: %s",
+		users.EventUserCreated:             "%s joined %s",
+	},
+	"es": {
+		EventSiteUpdated:                   "%s cambió: %s",
+		suggestions.EventSuggestionCreated: "Nueva sugerencia para %s: %s",
+		users.EventUserCreated:             "%s se unió a %s",
+	},
+}
+
+// describeChanges lists the fields a site change touched, once each.
+func describeChanges(changes []sites.FieldChange, lang string) string {
+	seen := make(map[string]bool)
+	described := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if d := describeField(change.Field, lang); !seen[d] {
+			seen[d] = true
+			described = append(described, d)
+		}
+	}
+	sort.Strings(described)
+	return strings.Join(described, ", ")
+}
+
+// Line describes the item in one line of the given language.
+func (item DigestItem) Line(lang string) (string, error) {
+	phrase, ok := digestPhrases[language(lang)][item.EventType]
+	if !ok {
+		return "", fmt.Errorf("no digest line for event type %q", item.EventType)
+	}
+	switch item.EventType {
+	case EventSiteUpdated:
+		var event SiteChangeEvent
+		if err := json.Unmarshal(item.Payload, &event); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(phrase, event.SiteName, describeChanges(event.Changes, lang)), nil
+	case suggestions.EventSuggestionCreated:
+		var notice SuggestionNotice
+		if err := json.Unmarshal(item.Payload, &notice); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(phrase, notice.Place(), notice.Excerpt), nil
+	default:
+		var notice NewUserNotice
+		if err := json.Unmarshal(item.Payload, &notice); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(phrase, notice.Email, notice.OrganizationName), nil
+	}
+}
+
+// Lines describes each item in the digest.
+func (e DigestEvent) Lines(lang string) ([]string, error) {
+	lines := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		line, err := item.Line(lang)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// Digests builds each user's digest from the notifications held for it, once
+// it comes due.
+type Digests struct {
+	db *sqlx.DB
+
+	BatchSize int
+}
+
+func NewDigests(db *sqlx.DB) *Digests {
+	return &Digests{
+		db:        db,
+		BatchSize: DefaultDigestBatchSize,
+	}
+}
+
+type dueDigest struct {
+	Digest
+	UserId uint64 `db:"user_id"`
+}
+
+// BuildDue builds every digest that has come due. It is run as a scheduled
+// job.
+func (d *Digests) BuildDue(ctx context.Context) error {
+	for {
+		claimed, err := d.buildBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if claimed < d.BatchSize {
+			return nil
+		}
+	}
+}
+
+// buildBatch claims a batch of due digests and queues them in the same
+// transaction, so that each is sent once even across replicas and restarts.
+func (d *Digests) buildBatch(ctx context.Context) (int, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Digests.BuildDue",
+	})
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	due := make([]dueDigest, 0)
+	err = tx.SelectContext(ctx, &due, tx.Rebind(claimDueDigestsSql), d.BatchSize)
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim due digests")
+		return 0, err
+	}
+	now := time.Now()
+	for _, digest := range due {
+		err = buildDigest(ctx, tx, digest, now)
+		if err != nil {
+			logger.WithField("UserID", digest.UserId).WithError(err).Error("Failed to build digest")
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit digests")
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// buildDigest queues one digest per channel that has notifications held for
+// it, marks them sent as part of the digest, and schedules the next one. A
+// user with nothing held gets no digest.
+func buildDigest(ctx context.Context, tx *sqlx.Tx, digest dueDigest, now time.Time) error {
+	held := make([]Notification, 0)
+	err := tx.SelectContext(ctx, &held, tx.Rebind(selectHeldNotificationsSql), digest.UserId)
+	if err != nil {
+		return err
+	}
+
+	notificationIds := make([]uint64, 0, 2)
+	for _, channel := range []string{ChannelEmail, ChannelPush} {
+		event := DigestEvent{Frequency: digest.Frequency, Items: make([]DigestItem, 0)}
+		heldIds := make([]int64, 0)
+		for _, n := range held {
+			if n.Channel != channel {
+				continue
+			}
+			event.Items = append(event.Items, DigestItem{
+				EventType: n.EventType,
+				Payload:   json.RawMessage(n.Payload),
+				CreatedAt: n.CreatedAt,
+			})
+			heldIds = append(heldIds, int64(n.Id))
+		}
+		if len(heldIds) == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		var id uint64
+		err = tx.GetContext(ctx, &id, tx.Rebind(insertNotificationSql), digest.UserId, channel, EventDigest, string(payload))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(markDigestedSql), id, pq.Array(heldIds))
+		if err != nil {
+			return err
+		}
+		notificationIds = append(notificationIds, id)
+	}
+	if err = queueDeliveries(ctx, tx, notificationIds); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(setNextDigestSql), digest.Next(now), digest.UserId)
+	return err
+}
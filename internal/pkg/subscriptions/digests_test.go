@@ -0,0 +1,112 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigest_Validate(t *testing.T) {
+	valid := []Digest{
+		{Frequency: DigestDaily, Timezone: "America/Chicago", At: "07:30"},
+		{Frequency: DigestWeekly, Timezone: "UTC", At: "18:00", Weekday: "Friday"},
+	}
+	for _, d := range valid {
+		if err := d.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", d, err)
+		}
+	}
+
+	testCases := map[string]Digest{
+		"unknown frequency": {Frequency: "hourly", Timezone: "UTC", At: "07:30"},
+		"no timezone":       {Frequency: DigestDaily, At: "07:30"},
+		"bad time":          {Frequency: DigestDaily, Timezone: "UTC", At: "7am"},
+		"end of day":        {Frequency: DigestDaily, Timezone: "UTC", At: "24:00"},
+		"no weekday":        {Frequency: DigestWeekly, Timezone: "UTC", At: "07:30"},
+	}
+	for name, d := range testCases {
+		if err := d.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDigest_Next(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	daily := Digest{Frequency: DigestDaily, Timezone: "America/New_York", At: "07:30"}
+	weekly := Digest{Frequency: DigestWeekly, Timezone: "America/New_York", At: "07:30", Weekday: "monday"}
+
+	testCases := map[string]struct {
+		digest   Digest
+		after    time.Time
+		expected time.Time
+	}{
+		"later today":     {daily, time.Date(2026, 3, 3, 6, 0, 0, 0, ny), time.Date(2026, 3, 3, 7, 30, 0, 0, ny)},
+		"tomorrow":        {daily, time.Date(2026, 3, 3, 7, 30, 0, 0, ny), time.Date(2026, 3, 4, 7, 30, 0, 0, ny)},
+		"across DST":      {daily, time.Date(2026, 3, 7, 12, 0, 0, 0, ny), time.Date(2026, 3, 8, 7, 30, 0, 0, ny)},
+		"in another zone": {daily, time.Date(2026, 3, 3, 11, 0, 0, 0, time.UTC), time.Date(2026, 3, 3, 7, 30, 0, 0, ny)},
+		"next monday":     {weekly, time.Date(2026, 3, 4, 12, 0, 0, 0, ny), time.Date(2026, 3, 9, 7, 30, 0, 0, ny)},
+		"later on monday": {weekly, time.Date(2026, 3, 2, 6, 0, 0, 0, ny), time.Date(2026, 3, 2, 7, 30, 0, 0, ny)},
+		"monday after":    {weekly, time.Date(2026, 3, 2, 8, 0, 0, 0, ny), time.Date(2026, 3, 9, 7, 30, 0, 0, ny)},
+	}
+	for name, tc := range testCases {
+		if got := tc.digest.Next(tc.after); !got.Equal(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, got)
+		}
+	}
+}
+
+func TestDigestEvent_Lines(t *testing.T) {
+	event := DigestEvent{
+		Frequency: DigestDaily,
+		Items: []DigestItem{
+			{
+				EventType: EventSiteUpdated,
+				Payload:   json.RawMessage(`{"site_name": "Downtown", "changes": [{"field": "schedule.monday"}, {"field": "name"}]}`),
+			},
+			{
+				EventType: suggestions.EventSuggestionCreated,
+				Payload:   json.RawMessage(`{"organization_name": "Food Bank", "excerpt": "More parking"}`),
+			},
+			{
+				EventType: users.EventUserCreated,
+				Payload:   json.RawMessage(`{"email": "new@example.com", "organization_name": "Food Bank"}`),
+			},
+		},
+	}
+	lines, err := event.Lines("es-MX")
+	if err != nil {
+		t.Fatalf("Failed to describe digest: %v", err)
+	}
+	expected := []string{
+		"Downtown cambió: horario del lunes, nombre",
+		"Nueva sugerencia para Food Bank: More parking",
+		"new@example.com se unió a Food Bank",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+
+	event.Items = append(event.Items, DigestItem{EventType: EventShiftReminder, Payload: json.RawMessage(`{}`)})
+	if _, err = event.Lines("en"); err == nil {
+		t.Error("Expected reminders to have no digest line")
+	}
+}
+
+func TestNotification_PushMessage_Digest(t *testing.T) {
+	n := Notification{
+		EventType: EventDigest,
+		Payload: `{"frequency": "weekly", "items": [
+			{"event_type": "suggestion.created", "payload": {"site_name": "Downtown", "excerpt": "Open earlier"}}]}`,
+	}
+	msg, err := n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Your weekly digest" || msg.Body != "New suggestion for Downtown: Open earlier" {
+		t.Errorf("Unexpected message %q: %q", msg.Title, msg.Body)
+	}
+}
@@ -0,0 +1,229 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// EventSiteUpdated is the type of the outbox event recorded when a site's
+// details, hours or calendar change, and of the notifications it fans out to.
+const EventSiteUpdated = "site.updated"
+
+// EventDeliverNotification is the type of the outbox event that delivers one
+// notification.
+const EventDeliverNotification = "notification.deliver"
+
+// SiteChangeEvent is the payload of an EventSiteUpdated notification.
+type SiteChangeEvent struct {
+	SiteId   uint64              `json:"site_id"`
+	SiteSlug string              `json:"site_slug"`
+	SiteName string              `json:"site_name"`
+	Changes  []sites.FieldChange `json:"changes"`
+}
+
+// ShiftEvent is the payload of a notification about a volunteer's signup
+// for a shift, or its cancellation.
+type ShiftEvent struct {
+	ShiftId  uint64    `json:"shift_id" db:"shift_id"`
+	SiteSlug string    `json:"site_slug" db:"site_slug"`
+	SiteName string    `json:"site_name" db:"site_name"`
+	Timezone string    `json:"timezone" db:"timezone"`
+	StartsAt time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt   time.Time `json:"ends_at" db:"ends_at"`
+}
+
+// SuggestionNotice is the payload of a suggestions.EventSuggestionCreated
+// notification. SiteSlug and SiteName are empty when the suggestion is about
+// the organization as a whole.
+type SuggestionNotice struct {
+	SuggestionId     uint64 `json:"suggestion_id" db:"suggestion_id"`
+	OrganizationId   uint64 `json:"organization_id" db:"organization_id"`
+	OrganizationName string `json:"organization_name" db:"organization_name"`
+	SiteSlug         string `json:"site_slug,omitempty" db:"site_slug"`
+	SiteName         string `json:"site_name,omitempty" db:"site_name"`
+	Excerpt          string `json:"excerpt" db:"excerpt"`
+}
+
+// Place names what the suggestion is about.
+func (n SuggestionNotice) Place() string {
+	if n.SiteName != "" {
+		return n.SiteName
+	}
+	return n.OrganizationName
+}
+
+// NewUserNotice is the payload of a users.EventUserCreated notification.
+type NewUserNotice struct {
+	UserGuid         string `json:"user_guid" db:"user_guid"`
+	Email            string `json:"email" db:"email"`
+	OrganizationId   uint64 `json:"organization_id" db:"organization_id"`
+	OrganizationName string `json:"organization_name" db:"organization_name"`
+}
+
+// queuedNotification is a notification just inserted, which is held if its
+// recipient takes a digest.
+type queuedNotification struct {
+	Id   uint64 `db:"id"`
+	Held bool   `db:"held"`
+}
+
+// deliverRequest is the payload of EventDeliverNotification.
+type deliverRequest struct {
+	NotificationId uint64 `json:"notification_id"`
+}
+
+// EnqueueSiteChange records the change in the outbox, for FanOutSiteChange
+// to tell the site's subscribers about. It is registered as a
+// sites.ChangeListener, so it runs in the transaction that saves the change.
+func EnqueueSiteChange(ctx context.Context, tx *sqlx.Tx, site *sites.Site, changes []sites.FieldChange) error {
+	return outbox.Enqueue(ctx, tx, EventSiteUpdated, SiteChangeEvent{
+		SiteId:   site.Id,
+		SiteSlug: site.Slug,
+		SiteName: site.Name,
+		Changes:  changes,
+	})
+}
+
+// queueDeliveries enqueues delivery of each of the notifications just
+// inserted.
+func queueDeliveries(ctx context.Context, tx *sqlx.Tx, notificationIds []uint64) error {
+	for _, id := range notificationIds {
+		err := outbox.Enqueue(ctx, tx, EventDeliverNotification, deliverRequest{NotificationId: id})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueUnheld enqueues delivery of the notifications that are not held for a
+// digest.
+func queueUnheld(ctx context.Context, tx *sqlx.Tx, queued []queuedNotification) error {
+	notificationIds := make([]uint64, 0, len(queued))
+	for _, n := range queued {
+		if !n.Held {
+			notificationIds = append(notificationIds, n.Id)
+		}
+	}
+	return queueDeliveries(ctx, tx, notificationIds)
+}
+
+// changedFeatures lists the site features that a change added or removed.
+func changedFeatures(changes []sites.FieldChange) []string {
+	features := make([]string, 0)
+	for _, change := range changes {
+		if strings.HasPrefix(change.Field, "feature.") {
+			features = append(features, strings.TrimPrefix(change.Field, "feature."))
+		}
+	}
+	return features
+}
+
+// FanOutSiteChange handles EventSiteUpdated, queuing a notification for each
+// of the site's subscribers, on each channel they chose, and for each member
+// of a matching team who opted in.
+func FanOutSiteChange(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var change SiteChangeEvent
+	if err := event.Decode(&change); err != nil {
+		return err
+	}
+	queued := make([]queuedNotification, 0)
+	err := tx.SelectContext(ctx, &queued, tx.Rebind(queueSiteNotificationsSql),
+		EventSiteUpdated, event.Payload, change.SiteId, EventSiteUpdated, change.SiteId, pq.Array(changedFeatures(change.Changes)))
+	if err != nil {
+		return err
+	}
+	return queueUnheld(ctx, tx, queued)
+}
+
+// notifyOrgAdmins queues a notification for each admin of the organization,
+// on each channel they prefer for the kind of event.
+func notifyOrgAdmins(ctx context.Context, tx *sqlx.Tx, orgId uint64, eventType string, notice interface{}) error {
+	payload, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+	queued := make([]queuedNotification, 0)
+	err = tx.SelectContext(ctx, &queued, tx.Rebind(queueOrgAdminNotificationsSql),
+		eventType, string(payload), eventType, orgId, users.OrgAdmin)
+	if err != nil {
+		return err
+	}
+	return queueUnheld(ctx, tx, queued)
+}
+
+// FanOutSuggestion handles suggestions.EventSuggestionCreated, notifying the
+// organization's admins.
+func FanOutSuggestion(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var created suggestions.SuggestionEvent
+	if err := event.Decode(&created); err != nil {
+		return err
+	}
+	var notice SuggestionNotice
+	err := tx.GetContext(ctx, &notice, tx.Rebind(selectSuggestionNoticeSql), created.SuggestionId)
+	if err == sql.ErrNoRows {
+		// Deleted before anyone heard about it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return notifyOrgAdmins(ctx, tx, notice.OrganizationId, event.EventType, notice)
+}
+
+// FanOutNewUser handles users.EventUserCreated, notifying the admins of the
+// organization the user joined.
+func FanOutNewUser(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var created users.UserEvent
+	if err := event.Decode(&created); err != nil {
+		return err
+	}
+	var notice NewUserNotice
+	err := tx.GetContext(ctx, &notice, tx.Rebind(selectNewUserNoticeSql), created.UserId, created.OrganizationId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return notifyOrgAdmins(ctx, tx, notice.OrganizationId, event.EventType, notice)
+}
+
+// FanOutSignup handles shifts.EventSignupCreated and
+// shifts.EventSignupCancelled, notifying the volunteer on every channel.
+func FanOutSignup(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var signup shifts.SignupEvent
+	if err := event.Decode(&signup); err != nil {
+		return err
+	}
+	var shift ShiftEvent
+	err := tx.GetContext(ctx, &shift, tx.Rebind(selectShiftEventSql), signup.ShiftId)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(shift)
+	if err != nil {
+		return err
+	}
+
+	notificationIds := make([]uint64, 0, 2)
+	for _, channel := range []string{ChannelEmail, ChannelPush} {
+		var id uint64
+		err = tx.GetContext(ctx, &id, tx.Rebind(insertNotificationSql), signup.UserId, channel, event.EventType, string(payload))
+		if err != nil {
+			return err
+		}
+		notificationIds = append(notificationIds, id)
+	}
+	return queueDeliveries(ctx, tx, notificationIds)
+}
@@ -0,0 +1,300 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// ChannelNone turns a kind of notification off.
+const ChannelNone = "none"
+
+// PreferenceEventTypes are the kinds of notification a user may choose a
+// channel for. For EventSiteUpdated, the choice applies to the sites their
+// teams hear about; site subscriptions carry their own channels. New
+// suggestions and users are only sent to organization admins.
+var PreferenceEventTypes = []string{
+	EventSiteUpdated,
+	suggestions.EventSuggestionCreated,
+	users.EventUserCreated,
+	EventShiftReminder,
+}
+
+// DigestEventTypes are the kinds of notification that are not urgent. They
+// are held back during quiet hours, and held for the user's digest if they
+// take one. Reminders are timely, so they are never digested.
+var DigestEventTypes = []string{
+	EventSiteUpdated,
+	suggestions.EventSuggestionCreated,
+	users.EventUserCreated,
+}
+
+func isDigestEventType(eventType string) bool {
+	for _, t := range DigestEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Preferences are how a user wants to be notified. Kinds of notification
+// missing from Channels are sent on every channel.
+type Preferences struct {
+	Channels   map[string]string `json:"channels"`              // event type to push, email or none
+	QuietHours *QuietHours       `json:"quiet_hours,omitempty"` // nil for none
+	Digest     *Digest           `json:"digest,omitempty"`      // nil to be notified as things happen
+}
+
+// QuietHours are the hours of each day, in the user's time zone, during
+// which reminders and other non-urgent notifications are held back. They may
+// run past midnight.
+type QuietHours struct {
+	Timezone string `json:"timezone" db:"timezone"`
+	Start    string `json:"start" db:"starts_at"` // HH:MM
+	End      string `json:"end" db:"ends_at"`     // HH:MM
+}
+
+func (q QuietHours) Validate() error {
+	if q.Timezone == "" {
+		return errors.New("quiet hours need a timezone")
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", q.Timezone)
+	}
+	start, err := users.ParseClock(q.Start)
+	if err != nil {
+		return errors.New("quiet hours start must be given as HH:MM")
+	}
+	end, err := users.ParseClock(q.End)
+	if err != nil {
+		return errors.New("quiet hours end must be given as HH:MM")
+	}
+	if start == end {
+		return errors.New("quiet hours must not start and end at the same time")
+	}
+	return nil
+}
+
+// QuietUntil returns when the quiet hours that t falls in end, or the zero
+// time if t is outside quiet hours.
+func (q QuietHours) QuietUntil(t time.Time) time.Time {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start, err := users.ParseClock(q.Start)
+	if err != nil {
+		return time.Time{}
+	}
+	end, err := users.ParseClock(q.End)
+	if err != nil {
+		return time.Time{}
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	endOn := func(day int) time.Time {
+		return time.Date(local.Year(), local.Month(), day, end/60, end%60, 0, 0, loc)
+	}
+	if start < end {
+		if minute >= start && minute < end {
+			return endOn(local.Day())
+		}
+		return time.Time{}
+	}
+	// The quiet hours run past midnight
+	if minute >= start {
+		return endOn(local.Day() + 1)
+	}
+	if minute < end {
+		return endOn(local.Day())
+	}
+	return time.Time{}
+}
+
+func (p Preferences) Validate() error {
+	for eventType, channel := range p.Channels {
+		known := false
+		for _, t := range PreferenceEventTypes {
+			if t == eventType {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown notification type %q", eventType)
+		}
+		if channel != ChannelNone && !ValidChannel(channel) {
+			return fmt.Errorf("unknown channel %q, expected %s, %s or %s", channel, ChannelPush, ChannelEmail, ChannelNone)
+		}
+	}
+	if p.QuietHours != nil {
+		if err := p.QuietHours.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Digest != nil {
+		return p.Digest.Validate()
+	}
+	return nil
+}
+
+// GetPreferences fetches the user's notification preferences.
+func GetPreferences(ctx context.Context, db *sqlx.DB, userId uint64) (*Preferences, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "GetPreferences",
+		"UserID":    userId,
+	})
+
+	rows := make([]struct {
+		EventType string `db:"event_type"`
+		Channel   string `db:"channel"`
+	}, 0)
+	err := db.SelectContext(ctx, &rows, db.Rebind(selectPreferencesSql), userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select preferences")
+		return nil, err
+	}
+	prefs := Preferences{Channels: make(map[string]string, len(rows))}
+	for _, row := range rows {
+		prefs.Channels[row.EventType] = row.Channel
+	}
+
+	var quiet QuietHours
+	err = db.GetContext(ctx, &quiet, db.Rebind(selectQuietHoursSql), userId)
+	if err == nil {
+		prefs.QuietHours = &quiet
+	} else if err != sql.ErrNoRows {
+		logger.WithError(err).Error("Failed to select quiet hours")
+		return nil, err
+	}
+
+	var digest Digest
+	err = db.GetContext(ctx, &digest, db.Rebind(selectDigestSql), userId)
+	if err == nil {
+		prefs.Digest = &digest
+	} else if err != sql.ErrNoRows {
+		logger.WithError(err).Error("Failed to select digest")
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SavePreferences replaces the user's notification preferences. If they no
+// longer take a digest, the notifications held for it are delivered.
+func SavePreferences(ctx context.Context, db *sqlx.DB, userId uint64, prefs Preferences) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SavePreferences",
+		"UserID":    userId,
+	})
+
+	if err := prefs.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(deletePreferencesSql), userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete preferences")
+		return err
+	}
+	for eventType, channel := range prefs.Channels {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertPreferenceSql), userId, eventType, channel)
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert preference")
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteQuietHoursSql), userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete quiet hours")
+		return err
+	}
+	if q := prefs.QuietHours; q != nil {
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertQuietHoursSql), userId, q.Timezone, q.Start, q.End)
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert quiet hours")
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteDigestSql), userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete digest")
+		return err
+	}
+	if d := prefs.Digest; d != nil {
+		weekday := ""
+		if d.Frequency == DigestWeekly {
+			weekday = strings.ToLower(d.Weekday)
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertDigestSql),
+			userId, d.Frequency, d.Timezone, d.At, weekday, d.Next(time.Now()))
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert digest")
+			return err
+		}
+	} else {
+		released := make([]queuedNotification, 0)
+		err = tx.SelectContext(ctx, &released, tx.Rebind(releaseHeldNotificationsSql), userId)
+		if err != nil {
+			logger.WithError(err).Error("Failed to release held notifications")
+			return err
+		}
+		if err = queueUnheld(ctx, tx, released); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit preferences")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// channelsFor returns the channels the user wants the kind of notification
+// on, which is none if they turned it off.
+func channelsFor(ctx context.Context, tx *sqlx.Tx, userId uint64, eventType string) ([]string, error) {
+	var channel string
+	err := tx.GetContext(ctx, &channel, tx.Rebind(selectPreferenceSql), userId, eventType)
+	if err == sql.ErrNoRows {
+		return []string{ChannelEmail, ChannelPush}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if channel == ChannelNone {
+		return []string{}, nil
+	}
+	return []string{channel}, nil
+}
+
+// quietHoursFor fetches the user's quiet hours, or nil if they have none.
+func quietHoursFor(ctx context.Context, tx *sqlx.Tx, userId uint64) (*QuietHours, error) {
+	var quiet QuietHours
+	err := tx.GetContext(ctx, &quiet, tx.Rebind(selectQuietHoursSql), userId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quiet, nil
+}
@@ -0,0 +1,360 @@
+package subscriptions
+
+const listSiteSubscriptionsSql = `
+	SELECT sites.slug AS site_slug, site_subscriptions.channel
+	FROM site_subscriptions
+		INNER JOIN sites ON sites.id = site_subscriptions.site_id
+	WHERE site_subscriptions.user_id = ?
+	ORDER BY sites.slug, site_subscriptions.channel
+`
+
+const selectSiteIdSql = `
+	SELECT id FROM sites WHERE slug = ?
+`
+
+const insertSiteSubscriptionSql = `
+	INSERT INTO site_subscriptions (user_id, site_id, channel) VALUES (?, ?, ?)
+	ON CONFLICT DO NOTHING
+`
+
+const deleteSiteSubscriptionSql = `
+	DELETE FROM site_subscriptions WHERE user_id = ? AND site_id = ?
+`
+
+const unsubscribeFromSiteSql = `
+	DELETE FROM site_subscriptions
+	WHERE user_id = ? AND site_id = (SELECT id FROM sites WHERE slug = ?)
+`
+
+const deleteAllSiteSubscriptionsSql = `
+	DELETE FROM site_subscriptions WHERE user_id = ?
+`
+
+// Notifications for recipients who take a digest are held for it.
+const heldForDigestColumn = `
+	EXISTS (SELECT 1 FROM notification_digests WHERE notification_digests.user_id = recipients.user_id)
+`
+
+// One notification per recipient and channel. Recipients are the site's
+// subscribers, on the channels they chose, and the opted-in members of the
+// organization's teams matching a feature the site offers, or just stopped
+// offering, on the channel they prefer for site changes. UNION keeps anyone
+// who is both from hearing twice.
+const queueSiteNotificationsSql = `
+	INSERT INTO notifications (user_id, channel, event_type, payload, held)
+	SELECT recipients.user_id, recipients.channel, ?, ?::jsonb,` + heldForDigestColumn + `
+	FROM (
+		SELECT user_id, channel FROM site_subscriptions WHERE site_id = ?
+		UNION
+		SELECT team_members.user_id, channels.channel
+		FROM sites
+			INNER JOIN teams ON teams.organization_id = sites.organization_id
+			INNER JOIN team_members ON team_members.team_id = teams.id AND team_members.notify
+			CROSS JOIN (VALUES ('push'), ('email')) AS channels (channel)
+			LEFT OUTER JOIN notification_preferences ON notification_preferences.user_id = team_members.user_id
+				AND notification_preferences.event_type = ?
+		WHERE sites.id = ?
+			AND (teams.feature_key IN (SELECT feature FROM site_features WHERE site_features.site_id = sites.id)
+				OR teams.feature_key = ANY(?))
+			AND (notification_preferences.channel IS NULL OR notification_preferences.channel = channels.channel)
+	) AS recipients
+	RETURNING id, held
+`
+
+// One notification per admin of the organization, on each channel they
+// prefer for the kind of event.
+const queueOrgAdminNotificationsSql = `
+	INSERT INTO notifications (user_id, channel, event_type, payload, held)
+	SELECT recipients.user_id, recipients.channel, ?, ?::jsonb,` + heldForDigestColumn + `
+	FROM (
+		SELECT DISTINCT roles.user_id, channels.channel
+		FROM roles
+			CROSS JOIN (VALUES ('push'), ('email')) AS channels (channel)
+			LEFT OUTER JOIN notification_preferences ON notification_preferences.user_id = roles.user_id
+				AND notification_preferences.event_type = ?
+		WHERE roles.org_id = ? AND roles.name = ?
+			AND (notification_preferences.channel IS NULL OR notification_preferences.channel = channels.channel)
+	) AS recipients
+	RETURNING id, held
+`
+
+const selectSuggestionNoticeSql = `
+	SELECT
+		suggestions.id AS suggestion_id, suggestions.organization_id, organizations.name AS organization_name,
+		COALESCE(sites.slug, '') AS site_slug, COALESCE(sites.name_l10n, '') AS site_name,
+		LEFT(suggestions.body, 200) AS excerpt
+	FROM suggestions
+		INNER JOIN organizations ON organizations.id = suggestions.organization_id
+		LEFT OUTER JOIN sites ON sites.id = suggestions.site_id
+	WHERE suggestions.id = ?
+`
+
+const selectNewUserNoticeSql = `
+	SELECT users.user_guid, users.email, organizations.id AS organization_id, organizations.name AS organization_name
+	FROM users, organizations
+	WHERE users.id = ? AND organizations.id = ?
+`
+
+const insertNotificationSql = `
+	INSERT INTO notifications (user_id, channel, event_type, payload) VALUES (?, ?, ?, ?::jsonb)
+	RETURNING id
+`
+
+const selectShiftEventSql = `
+	SELECT shifts.id AS shift_id, sites.slug AS site_slug, sites.name_l10n AS site_name, sites.timezone,
+		shifts.starts_at, shifts.ends_at
+	FROM shifts
+		INNER JOIN sites ON sites.id = shifts.site_id
+	WHERE shifts.id = ?
+`
+
+// The lock keeps a replayed delivery from racing the original.
+const lockNotificationSql = `
+	SELECT
+		notifications.id, notifications.user_id, notifications.channel, notifications.event_type,
+		notifications.payload::text AS payload, notifications.created_at, notifications.status,
+		notifications.sent_at, notifications.last_error, users.email, users.organization_id
+	FROM notifications
+		INNER JOIN users ON users.id = notifications.user_id
+	WHERE notifications.id = ?
+	FOR UPDATE OF notifications
+`
+
+const markNotificationSentSql = `
+	UPDATE notifications SET status = 'sent', sent_at = now() WHERE id = ?
+`
+
+const markNotificationUndeliveredSql = `
+	UPDATE notifications SET status = 'undelivered', last_error = ? WHERE id = ?
+`
+
+const selectPreferencesSql = `
+	SELECT event_type, channel FROM notification_preferences WHERE user_id = ?
+`
+
+const selectPreferenceSql = `
+	SELECT channel FROM notification_preferences WHERE user_id = ? AND event_type = ?
+`
+
+const deletePreferencesSql = `
+	DELETE FROM notification_preferences WHERE user_id = ?
+`
+
+const insertPreferenceSql = `
+	INSERT INTO notification_preferences (user_id, event_type, channel) VALUES (?, ?, ?)
+`
+
+const selectQuietHoursSql = `
+	SELECT timezone, starts_at, ends_at FROM notification_quiet_hours WHERE user_id = ?
+`
+
+const deleteQuietHoursSql = `
+	DELETE FROM notification_quiet_hours WHERE user_id = ?
+`
+
+const insertQuietHoursSql = `
+	INSERT INTO notification_quiet_hours (user_id, timezone, starts_at, ends_at) VALUES (?, ?, ?, ?)
+`
+
+const selectDigestSql = `
+	SELECT frequency, timezone, send_at, weekday FROM notification_digests WHERE user_id = ?
+`
+
+const deleteDigestSql = `
+	DELETE FROM notification_digests WHERE user_id = ?
+`
+
+const insertDigestSql = `
+	INSERT INTO notification_digests (user_id, frequency, timezone, send_at, weekday, next_run_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+`
+
+// Once a user stops taking a digest, what it would have held is delivered.
+const releaseHeldNotificationsSql = `
+	UPDATE notifications SET held = false WHERE user_id = ? AND held
+	RETURNING id, held
+`
+
+const selectShiftStartSql = `
+	SELECT starts_at FROM shifts WHERE id = ?
+`
+
+const insertReminderSql = `
+	INSERT INTO shift_reminders (signup_id, offset_minutes, send_at) VALUES (?, ?, ?)
+	ON CONFLICT DO NOTHING
+`
+
+const cancelRemindersSql = `
+	UPDATE shift_reminders SET status = 'cancelled' WHERE signup_id = ? AND status = 'pending'
+`
+
+// Skipping locked rows lets several replicas send reminders at once without
+// sending any twice.
+const claimDueRemindersSql = `
+	SELECT
+		shift_reminders.id, shift_signups.user_id, shift_signups.shift_id, shifts.starts_at,
+		shift_signups.cancelled_at IS NOT NULL AS cancelled
+	FROM shift_reminders
+		INNER JOIN shift_signups ON shift_signups.id = shift_reminders.signup_id
+		INNER JOIN shifts ON shifts.id = shift_signups.shift_id
+	WHERE shift_reminders.status = 'pending' AND shift_reminders.send_at <= now()
+	ORDER BY shift_reminders.send_at
+	LIMIT ?
+	FOR UPDATE OF shift_reminders SKIP LOCKED
+`
+
+const setReminderStatusSql = `
+	UPDATE shift_reminders SET status = ? WHERE id = ?
+`
+
+const deferReminderSql = `
+	UPDATE shift_reminders SET send_at = ? WHERE id = ?
+`
+
+const markReminderSentSql = `
+	UPDATE shift_reminders SET status = 'sent', sent_at = now() WHERE id = ?
+`
+
+// Skipping locked rows lets several replicas build digests at once without
+// building any twice.
+const claimDueDigestsSql = `
+	SELECT user_id, frequency, timezone, send_at, weekday
+	FROM notification_digests
+	WHERE next_run_at <= now()
+	ORDER BY next_run_at
+	LIMIT ?
+	FOR UPDATE SKIP LOCKED
+`
+
+const selectHeldNotificationsSql = `
+	SELECT id, user_id, channel, event_type, payload::text AS payload, created_at
+	FROM notifications
+	WHERE user_id = ? AND held
+	ORDER BY created_at, id
+	FOR UPDATE
+`
+
+const markDigestedSql = `
+	UPDATE notifications SET held = false, status = 'sent', sent_at = now(), digest_id = ? WHERE id = ANY(?)
+`
+
+const setNextDigestSql = `
+	UPDATE notification_digests SET next_run_at = ? WHERE user_id = ?
+`
+
+const selectOrgSiteIdSql = `
+	SELECT id FROM sites WHERE slug = ? AND organization_id = ?
+`
+
+const selectOrgTeamIdSql = `
+	SELECT id FROM teams WHERE id = ? AND organization_id = ?
+`
+
+const insertBroadcastSql = `
+	INSERT INTO broadcasts (organization_id, sent_by, subject, body, target_type, site_id, shift_date, team_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id, created_at
+`
+
+const selectBroadcastColumns = `
+	SELECT
+		broadcasts.id, broadcasts.organization_id, broadcasts.sent_by, users.user_guid AS sender_guid,
+		broadcasts.subject, broadcasts.body, broadcasts.target_type,
+		COALESCE(sites.slug, '') AS site_slug, COALESCE(to_char(broadcasts.shift_date, 'YYYY-MM-DD'), '') AS shift_date,
+		COALESCE(broadcasts.team_id, 0) AS team_id, broadcasts.created_at
+	FROM broadcasts
+		INNER JOIN organizations ON organizations.id = broadcasts.organization_id AND organizations.deleted_at IS NULL
+		INNER JOIN users ON users.id = broadcasts.sent_by
+		LEFT OUTER JOIN sites ON sites.id = broadcasts.site_id
+`
+
+const describeBroadcastSql = selectBroadcastColumns + `
+	WHERE broadcasts.id = ?
+`
+
+const listBroadcastsSql = selectBroadcastColumns + `
+	WHERE broadcasts.organization_id = ?
+	ORDER BY broadcasts.created_at DESC, broadcasts.id DESC
+	LIMIT ?
+`
+
+const insertOrgRecipientsSql = `
+	INSERT INTO broadcast_recipients (broadcast_id, user_id)
+	SELECT DISTINCT ?::integer, user_id FROM roles WHERE org_id = ? AND name = ANY(?)
+`
+
+// Without a date, only signups for shifts that have not ended yet are
+// targeted. Dates are in each site's time zone.
+const insertSignupRecipientsSql = `
+	INSERT INTO broadcast_recipients (broadcast_id, user_id)
+	SELECT DISTINCT ?::integer, shift_signups.user_id
+	FROM shift_signups
+		INNER JOIN shifts ON shifts.id = shift_signups.shift_id
+		INNER JOIN sites ON sites.id = shifts.site_id
+	WHERE shifts.organization_id = ? AND shift_signups.cancelled_at IS NULL
+		AND (?::integer IS NULL OR shifts.site_id = ?)
+		AND CASE WHEN ?::date IS NULL THEN shifts.ends_at > now()
+			ELSE (shifts.starts_at AT TIME ZONE sites.timezone)::date = ?::date END
+`
+
+const insertTeamRecipientsSql = `
+	INSERT INTO broadcast_recipients (broadcast_id, user_id)
+	SELECT ?::integer, user_id FROM team_members WHERE team_id = ?
+`
+
+// Broadcasts go out on every channel, whatever the recipient's preferences.
+const queueBroadcastNotificationsSql = `
+	INSERT INTO notifications (user_id, channel, event_type, payload, broadcast_id)
+	SELECT broadcast_recipients.user_id, channels.channel, ?, ?::jsonb, broadcast_recipients.broadcast_id
+	FROM broadcast_recipients
+		CROSS JOIN (VALUES ('push'), ('email')) AS channels (channel)
+	WHERE broadcast_recipients.broadcast_id = ?
+	RETURNING id
+`
+
+const broadcastSummarySql = `
+	SELECT recipients.*, deliveries.*
+	FROM (
+		SELECT
+			COUNT(*) AS recipients,
+			COUNT(acknowledged_at) AS acknowledged,
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM notifications
+				WHERE notifications.broadcast_id = broadcast_recipients.broadcast_id
+					AND notifications.user_id = broadcast_recipients.user_id
+					AND notifications.status = 'sent'
+			)) AS delivered
+		FROM broadcast_recipients
+		WHERE broadcast_id = ?
+	) AS recipients, (
+		SELECT
+			COUNT(*) FILTER (WHERE channel = 'email' AND status = 'sent') AS email_sent,
+			COUNT(*) FILTER (WHERE channel = 'push' AND status = 'sent') AS push_sent,
+			COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+			COUNT(*) FILTER (WHERE status = 'undelivered') AS undelivered
+		FROM notifications
+		WHERE broadcast_id = ?
+	) AS deliveries
+`
+
+const listBroadcastRecipientsSql = `
+	SELECT
+		users.user_guid, users.email,
+		email.status AS email_status, email.sent_at AS email_sent_at,
+		push.status AS push_status, push.sent_at AS push_sent_at,
+		broadcast_recipients.acknowledged_at
+	FROM broadcast_recipients
+		INNER JOIN users ON users.id = broadcast_recipients.user_id
+		LEFT OUTER JOIN notifications email ON email.broadcast_id = broadcast_recipients.broadcast_id
+			AND email.user_id = broadcast_recipients.user_id AND email.channel = 'email'
+		LEFT OUTER JOIN notifications push ON push.broadcast_id = broadcast_recipients.broadcast_id
+			AND push.user_id = broadcast_recipients.user_id AND push.channel = 'push'
+	WHERE broadcast_recipients.broadcast_id = ?
+	ORDER BY users.email
+`
+
+const acknowledgeBroadcastSql = `
+	UPDATE broadcast_recipients SET acknowledged_at = COALESCE(acknowledged_at, now())
+	WHERE broadcast_id = ? AND user_id = ?
+	RETURNING acknowledged_at
+`
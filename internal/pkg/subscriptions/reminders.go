@@ -0,0 +1,203 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// EventShiftReminder is the type of the notifications reminding a volunteer
+// of a shift they signed up for.
+const EventShiftReminder = "shift.reminder"
+
+// Reminder statuses.
+const (
+	ReminderPending   = "pending"
+	ReminderSent      = "sent"
+	ReminderCancelled = "cancelled" // the signup was cancelled
+	ReminderSkipped   = "skipped"   // the shift started first, or during quiet hours
+)
+
+// DefaultReminderBatchSize is how many due reminders a new Reminders sends
+// per transaction.
+const DefaultReminderBatchSize = 100
+
+// Reminders schedules reminders at each offset before a signed-up shift
+// starts, and sends them when they come due.
+type Reminders struct {
+	db *sqlx.DB
+
+	Offsets   []time.Duration // before the shift starts
+	BatchSize int
+}
+
+func NewReminders(db *sqlx.DB, offsets []time.Duration) *Reminders {
+	return &Reminders{
+		db:        db,
+		Offsets:   offsets,
+		BatchSize: DefaultReminderBatchSize,
+	}
+}
+
+// Schedule handles shifts.EventSignupCreated, scheduling a reminder at each
+// offset that is still in the future.
+func (r *Reminders) Schedule(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var signup shifts.SignupEvent
+	if err := event.Decode(&signup); err != nil {
+		return err
+	}
+	var startsAt time.Time
+	err := tx.GetContext(ctx, &startsAt, tx.Rebind(selectShiftStartSql), signup.ShiftId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, offset := range r.Offsets {
+		sendAt := startsAt.Add(-offset)
+		if !sendAt.After(now) {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertReminderSql), signup.SignupId, int(offset/time.Minute), sendAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelReminders handles shifts.EventSignupCancelled, cancelling the
+// signup's pending reminders.
+func CancelReminders(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var signup shifts.SignupEvent
+	if err := event.Decode(&signup); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, tx.Rebind(cancelRemindersSql), signup.SignupId)
+	return err
+}
+
+type dueReminder struct {
+	Id        uint64    `db:"id"`
+	UserId    uint64    `db:"user_id"`
+	ShiftId   uint64    `db:"shift_id"`
+	StartsAt  time.Time `db:"starts_at"`
+	Cancelled bool      `db:"cancelled"`
+}
+
+// SendDue sends every reminder that has come due. It is run as a scheduled
+// job.
+func (r *Reminders) SendDue(ctx context.Context) error {
+	for {
+		claimed, err := r.sendBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if claimed < r.BatchSize {
+			return nil
+		}
+	}
+}
+
+// sendBatch claims a batch of due reminders and queues their notifications
+// in the same transaction, so that each reminder is sent once even across
+// replicas and restarts.
+func (r *Reminders) sendBatch(ctx context.Context) (int, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Reminders.SendDue",
+	})
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	due := make([]dueReminder, 0)
+	err = tx.SelectContext(ctx, &due, tx.Rebind(claimDueRemindersSql), r.BatchSize)
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim due reminders")
+		return 0, err
+	}
+	now := time.Now()
+	for _, reminder := range due {
+		err = sendReminder(ctx, tx, reminder, now)
+		if err != nil {
+			logger.WithField("ReminderID", reminder.Id).WithError(err).Error("Failed to send reminder")
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit reminders")
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// sendReminder queues the reminder's notifications on the channels the
+// volunteer chose. During their quiet hours it is put off until they end,
+// unless the shift starts first.
+func sendReminder(ctx context.Context, tx *sqlx.Tx, reminder dueReminder, now time.Time) error {
+	if reminder.Cancelled {
+		_, err := tx.ExecContext(ctx, tx.Rebind(setReminderStatusSql), ReminderCancelled, reminder.Id)
+		return err
+	}
+	if !reminder.StartsAt.After(now) {
+		_, err := tx.ExecContext(ctx, tx.Rebind(setReminderStatusSql), ReminderSkipped, reminder.Id)
+		return err
+	}
+
+	quiet, err := quietHoursFor(ctx, tx, reminder.UserId)
+	if err != nil {
+		return err
+	}
+	if quiet != nil {
+		if until := quiet.QuietUntil(now); !until.IsZero() {
+			if until.Before(reminder.StartsAt) {
+				_, err = tx.ExecContext(ctx, tx.Rebind(deferReminderSql), until, reminder.Id)
+			} else {
+				_, err = tx.ExecContext(ctx, tx.Rebind(setReminderStatusSql), ReminderSkipped, reminder.Id)
+			}
+			return err
+		}
+	}
+
+	channels, err := channelsFor(ctx, tx, reminder.UserId, EventShiftReminder)
+	if err != nil {
+		return err
+	}
+	if len(channels) > 0 {
+		var shift ShiftEvent
+		err = tx.GetContext(ctx, &shift, tx.Rebind(selectShiftEventSql), reminder.ShiftId)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(shift)
+		if err != nil {
+			return err
+		}
+		notificationIds := make([]uint64, 0, len(channels))
+		for _, channel := range channels {
+			var id uint64
+			err = tx.GetContext(ctx, &id, tx.Rebind(insertNotificationSql), reminder.UserId, channel, EventShiftReminder, string(payload))
+			if err != nil {
+				return err
+			}
+			notificationIds = append(notificationIds, id)
+		}
+		if err = queueDeliveries(ctx, tx, notificationIds); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(markReminderSentSql), reminder.Id)
+	return err
+}
@@ -0,0 +1,135 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuietHours_QuietUntil(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	overnight := QuietHours{Timezone: "America/New_York", Start: "22:00", End: "07:00"}
+	afternoon := QuietHours{Timezone: "America/New_York", Start: "13:00", End: "14:30"}
+
+	testCases := map[string]struct {
+		quiet    QuietHours
+		at       time.Time
+		expected time.Time
+	}{
+		"before midnight": {overnight, time.Date(2026, 3, 2, 23, 15, 0, 0, ny), time.Date(2026, 3, 3, 7, 0, 0, 0, ny)},
+		"after midnight":  {overnight, time.Date(2026, 3, 3, 5, 0, 0, 0, ny), time.Date(2026, 3, 3, 7, 0, 0, 0, ny)},
+		"awake":           {overnight, time.Date(2026, 3, 3, 7, 0, 0, 0, ny), time.Time{}},
+		"same day":        {afternoon, time.Date(2026, 3, 3, 13, 45, 0, 0, ny), time.Date(2026, 3, 3, 14, 30, 0, 0, ny)},
+		"after same day":  {afternoon, time.Date(2026, 3, 3, 15, 0, 0, 0, ny), time.Time{}},
+		"in another zone": {overnight, time.Date(2026, 3, 3, 4, 0, 0, 0, time.UTC), time.Date(2026, 3, 3, 7, 0, 0, 0, ny)},
+	}
+	for name, tc := range testCases {
+		if got := tc.quiet.QuietUntil(tc.at); !got.Equal(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, got)
+		}
+	}
+}
+
+func TestPreferences_Validate(t *testing.T) {
+	valid := Preferences{
+		Channels:   map[string]string{EventShiftReminder: ChannelNone},
+		QuietHours: &QuietHours{Timezone: "America/Chicago", Start: "21:00", End: "08:00"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected preferences to be valid, got %v", err)
+	}
+
+	testCases := map[string]Preferences{
+		"unknown type":    {Channels: map[string]string{"site.exploded": ChannelPush}},
+		"unknown channel": {Channels: map[string]string{EventShiftReminder: "sms"}},
+		"no timezone":     {QuietHours: &QuietHours{Start: "21:00", End: "08:00"}},
+		"bad timezone":    {QuietHours: &QuietHours{Timezone: "Mars/Olympus", Start: "21:00", End: "08:00"}},
+		"bad start":       {QuietHours: &QuietHours{Timezone: "UTC", Start: "9pm", End: "08:00"}},
+		"empty":           {QuietHours: &QuietHours{Timezone: "UTC", Start: "08:00", End: "08:00"}},
+		"bad digest":      {Digest: &Digest{Frequency: DigestWeekly, Timezone: "UTC", At: "08:00"}},
+	}
+	for name, prefs := range testCases {
+		if err := prefs.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNotification_PushMessage_Reminder(t *testing.T) {
+	n := Notification{
+		EventType: EventShiftReminder,
+		Payload: `{"shift_id": 12, "site_slug": "downtown", "site_name": "Downtown", "timezone": "UTC",
+			"starts_at": "2026-01-05T14:00:00Z", "ends_at": "2026-01-05T18:00:00Z"}`,
+	}
+	msg, err := n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Reminder: your shift at Downtown" || msg.Body != "Mon Jan 5 2:00 PM - 6:00 PM" {
+		t.Errorf("Unexpected message %q: %q", msg.Title, msg.Body)
+	}
+}
+
+func (suite *SubscriptionsTestSuite) countReminderNotifications() int {
+	var n int
+	err := suite.Config.GetDbConn().Get(&n, `SELECT count(*) FROM notifications WHERE user_id = 2 AND event_type = $1`, EventShiftReminder)
+	suite.Require().Nil(err)
+	return n
+}
+
+func (suite *SubscriptionsTestSuite) TestReminders_SendDueOnce() {
+	ctx := context.Background()
+	signupId := suite.seedSignup()
+	due := suite.seedReminder(signupId, 180, time.Now().Add(-time.Minute))
+	later := suite.seedReminder(signupId, 60, time.Now().Add(time.Hour))
+
+	// Two replicas run the job at once, then one runs it again.
+	r := NewReminders(suite.Config.GetDbConn(), nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			suite.Nil(r.SendDue(ctx))
+		}()
+	}
+	wg.Wait()
+	suite.Require().Nil(r.SendDue(ctx))
+
+	suite.Equal(2, suite.countReminderNotifications(), "Expected one notification on each default channel, once")
+	suite.Equal(ReminderSent, suite.reminderStatus(due))
+	suite.Equal(ReminderPending, suite.reminderStatus(later), "Expected a reminder that is not yet due to wait")
+}
+
+func (suite *SubscriptionsTestSuite) TestCancelReminders() {
+	ctx := context.Background()
+	db := suite.Config.GetDbConn()
+	signupId := suite.seedSignup()
+	sent := suite.seedReminder(signupId, 180, time.Now().Add(-time.Minute))
+	r := NewReminders(db, nil)
+	suite.Require().Nil(r.SendDue(ctx))
+	pending := suite.seedReminder(signupId, 60, time.Now().Add(time.Hour))
+
+	payload, err := json.Marshal(shifts.SignupEvent{SignupId: signupId, UserId: 2})
+	suite.Require().Nil(err)
+	tx, err := db.Beginx()
+	suite.Require().Nil(err)
+	defer tx.Rollback()
+	err = CancelReminders(ctx, tx, outbox.Event{EventType: shifts.EventSignupCancelled, Payload: string(payload)})
+	suite.Require().Nil(err)
+	suite.Require().Nil(tx.Commit())
+
+	suite.Equal(ReminderSent, suite.reminderStatus(sent), "Expected a sent reminder to stay sent")
+	suite.Equal(ReminderCancelled, suite.reminderStatus(pending))
+
+	// The cancelled reminder is not sent when it comes due.
+	_, err = db.Exec(`UPDATE shift_reminders SET send_at = now() - interval '1 second' WHERE id = $1`, pending)
+	suite.Require().Nil(err)
+	suite.Require().Nil(r.SendDue(ctx))
+	suite.Equal(2, suite.countReminderNotifications())
+	suite.Equal(ReminderCancelled, suite.reminderStatus(pending))
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/subscriptions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBroadcastLimit = 50
+	maxBroadcastLimit     = 500
+)
+
+type ListBroadcastsResponse struct {
+	Broadcasts []subscriptions.Broadcast `json:"broadcasts"`
+}
+
+type ListBroadcastRecipientsResponse struct {
+	Recipients []subscriptions.BroadcastRecipient `json:"recipients"`
+}
+
+type AcknowledgeResponse struct {
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+}
+
+// GetBroadcastsAPI serves urgent messages from an organization's admins to
+// its volunteers.
+func (server *SubscriptionsServer) GetBroadcastsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/broadcasts").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListBroadcastsHandler).
+			Doc("List an organization's broadcasts, newest first, with their delivery summaries").
+			Param(restful.QueryParameter("organization_id", "Organization ID")).
+			Param(service.QueryParameter("limit", "At most this many broadcasts, up to 500").DataType("integer")).
+			Produces(restful.MIME_JSON).
+			Writes(ListBroadcastsResponse{}).
+			Returns(http.StatusOK, "Fetched broadcasts", ListBroadcastsResponse{}).
+			Returns(http.StatusBadRequest, "Invalid organization ID or limit", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CreateBroadcastHandler).
+			Doc("Send a message to everyone in an organization, everyone signed up at a site or on a date, or a team, on every channel and regardless of quiet hours").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(subscriptions.Broadcast{}).
+			Writes(subscriptions.Broadcast{}).
+			Returns(http.StatusOK, "Broadcast queued", subscriptions.Broadcast{}).
+			Returns(http.StatusBadRequest, "Invalid broadcast, or unknown site or team", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil))
+	service.Route(
+		service.GET("/{broadcastId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DescribeBroadcastHandler).
+			Doc("Fetch a broadcast with its delivery summary").
+			Param(restful.PathParameter("broadcastId", "Broadcast ID")).
+			Produces(restful.MIME_JSON).
+			Writes(subscriptions.Broadcast{}).
+			Returns(http.StatusOK, "Fetched broadcast", subscriptions.Broadcast{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Broadcast not found", nil))
+	service.Route(
+		service.GET("/{broadcastId}/recipients").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListBroadcastRecipientsHandler).
+			Doc("List when a broadcast was sent to and acknowledged by each recipient").
+			Param(restful.PathParameter("broadcastId", "Broadcast ID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListBroadcastRecipientsResponse{}).
+			Returns(http.StatusOK, "Fetched recipients", ListBroadcastRecipientsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Broadcast not found", nil))
+	service.Route(
+		service.POST("/{broadcastId}/acknowledge").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.AcknowledgeBroadcastHandler).
+			Doc("Acknowledge a broadcast sent to the logged-in user").
+			Param(restful.PathParameter("broadcastId", "Broadcast ID")).
+			Produces(restful.MIME_JSON).
+			Writes(AcknowledgeResponse{}).
+			Returns(http.StatusOK, "Acknowledged", AcknowledgeResponse{}).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusNotFound, "Broadcast not found, or not sent to the logged-in user", nil))
+
+	return service
+}
+
+// parseBroadcastId reads the broadcastId path parameter. On failure it writes
+// the response and returns false.
+func parseBroadcastId(request *restful.Request, response *restful.Response) (uint64, bool) {
+	id, err := strconv.ParseUint(request.PathParameter("broadcastId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid broadcast ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// findBroadcast loads the broadcast named in the path, with its summary, and
+// checks that the logged-in user is an admin of its organization. On failure
+// it writes the response and returns nil.
+func (server *SubscriptionsServer) findBroadcast(request *restful.Request, response *restful.Response) *subscriptions.Broadcast {
+	ctx := filters.GetRequestContext(request)
+	id, ok := parseBroadcastId(request, response)
+	if !ok {
+		return nil
+	}
+	broadcast, err := subscriptions.DescribeBroadcast(ctx, server.Config.GetDbConn(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(broadcast.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	broadcast.Summary, err = subscriptions.GetBroadcastSummary(ctx, server.Config.GetDbConn(), id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	return broadcast
+}
+
+func (server *SubscriptionsServer) ListBroadcastsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "ListBroadcastsHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	limit := defaultBroadcastLimit
+	if param := request.QueryParameter("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxBroadcastLimit {
+			response.WriteErrorString(http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	broadcastSet, err := subscriptions.ListBroadcasts(ctx, server.Config.GetDbConn(), orgId, limit)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for i := range broadcastSet {
+		broadcastSet[i].Summary, err = subscriptions.GetBroadcastSummary(ctx, server.Config.GetDbConn(), broadcastSet[i].Id)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	err = response.WriteEntity(ListBroadcastsResponse{Broadcasts: broadcastSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize broadcasts")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) CreateBroadcastHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CreateBroadcastHandler",
+	})
+
+	var broadcast subscriptions.Broadcast
+	err := request.ReadEntity(&broadcast)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	errorSet := broadcast.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Broadcast is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(broadcast.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), broadcast.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sender := server.currentUser(request, response, logger)
+	if sender == nil {
+		return
+	}
+	broadcast.SentBy = sender.Id
+	broadcast.SenderGuid = sender.Guid
+	err = broadcast.Create(ctx, server.Config.GetDbConn())
+	if err != nil {
+		if err == subscriptions.ErrUnknownSite || err == subscriptions.ErrUnknownTeam {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.WithFields(log.Fields{
+		"BroadcastID": broadcast.Id,
+		"TargetType":  broadcast.Type,
+	}).Info("Broadcast queued")
+
+	broadcast.Summary, err = subscriptions.GetBroadcastSummary(ctx, server.Config.GetDbConn(), broadcast.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(broadcast)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize broadcast")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) DescribeBroadcastHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":         "DescribeBroadcastHandler",
+		"BroadcastID.input": request.PathParameter("broadcastId"),
+	})
+
+	broadcast := server.findBroadcast(request, response)
+	if broadcast == nil {
+		return
+	}
+	err := response.WriteEntity(broadcast)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize broadcast")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) ListBroadcastRecipientsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":         "ListBroadcastRecipientsHandler",
+		"BroadcastID.input": request.PathParameter("broadcastId"),
+	})
+
+	broadcast := server.findBroadcast(request, response)
+	if broadcast == nil {
+		return
+	}
+	recipients, err := subscriptions.ListBroadcastRecipients(ctx, server.Config.GetDbConn(), broadcast.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListBroadcastRecipientsResponse{Recipients: recipients})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize recipients")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) AcknowledgeBroadcastHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":         "AcknowledgeBroadcastHandler",
+		"BroadcastID.input": request.PathParameter("broadcastId"),
+	})
+
+	id, ok := parseBroadcastId(request, response)
+	if !ok {
+		return
+	}
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	acknowledgedAt, err := subscriptions.AcknowledgeBroadcast(ctx, server.Config.GetDbConn(), id, user.Id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	err = response.WriteEntity(AcknowledgeResponse{AcknowledgedAt: acknowledgedAt})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize acknowledgement")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
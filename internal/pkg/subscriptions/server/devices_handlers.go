@@ -0,0 +1,74 @@
+package server
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/push"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type RegisterDeviceRequest struct {
+	Platform string `json:"platform"`
+	Token    string `json:"token"`
+}
+
+// GetDevicesAPI serves device registration, which the design documents
+// under /subscription rather than /subscriptions.
+func (server *SubscriptionsServer) GetDevicesAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/subscription").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.POST("/register-device/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RegisterDeviceHandler).
+			Doc("Register a device to receive the logged-in user's push notifications").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(RegisterDeviceRequest{}).
+			Writes(push.Device{}).
+			Returns(http.StatusOK, "Device registered", push.Device{}).
+			Returns(http.StatusBadRequest, "Invalid platform or token", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil))
+
+	return service
+}
+
+func (server *SubscriptionsServer) RegisterDeviceHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "RegisterDeviceHandler",
+	})
+
+	var req RegisterDeviceRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	err = push.Device{Platform: req.Platform, Token: req.Token}.Validate()
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	device, err := push.RegisterDevice(ctx, server.Config.GetDbConn(), user.Id, req.Platform, req.Token)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(device)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize device")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
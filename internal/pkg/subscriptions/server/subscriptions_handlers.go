@@ -0,0 +1,336 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/subscriptions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type SubscriptionsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *SubscriptionsServer {
+	return &SubscriptionsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+type ListSubscriptionsResponse struct {
+	UserGuid string                           `json:"user_guid"`
+	Sites    []subscriptions.SiteSubscription `json:"sites"`
+}
+
+type SubscribeRequest struct {
+	Channels []string `json:"channels"`
+}
+
+// ReplaceSiteSubscriptionsRequest lists every site the user wants to hear
+// about. Sites left out are unsubscribed.
+type ReplaceSiteSubscriptionsRequest struct {
+	Sites []subscriptions.SiteSubscription `json:"sites"`
+}
+
+func (server *SubscriptionsServer) GetSubscriptionsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/subscriptions").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/{userGuid}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListSubscriptionsHandler).
+			Doc("List a user's subscriptions").
+			Produces(restful.MIME_JSON).
+			Writes(ListSubscriptionsResponse{}).
+			Returns(http.StatusOK, "Fetched subscriptions", ListSubscriptionsResponse{}).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not view these subscriptions", nil).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.POST("/site/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ReplaceSiteSubscriptionsHandler).
+			Doc("Set all of the logged-in user's site subscriptions and their channels").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(ReplaceSiteSubscriptionsRequest{}).
+			Writes(ListSubscriptionsResponse{}).
+			Returns(http.StatusOK, "Subscriptions saved", ListSubscriptionsResponse{}).
+			Returns(http.StatusBadRequest, "Unknown site or channel", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil))
+	service.Route(
+		service.POST("/site/{siteSlug}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SubscribeToSiteHandler).
+			Doc("Subscribe the logged-in user to changes at a site").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(SubscribeRequest{}).
+			Writes(subscriptions.SiteSubscription{}).
+			Returns(http.StatusOK, "Subscribed", subscriptions.SiteSubscription{}).
+			Returns(http.StatusBadRequest, "Unknown channel", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.DELETE("/site/{siteSlug}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UnsubscribeFromSiteHandler).
+			Doc("Unsubscribe the logged-in user from a site on every channel").
+			Produces(restful.MIME_JSON).
+			Returns(http.StatusOK, "Unsubscribed", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil).
+			Returns(http.StatusNotFound, "Not subscribed to this site", nil))
+	service.Route(
+		service.GET("/preferences").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetPreferencesHandler).
+			Doc("Fetch the logged-in user's notification channels, quiet hours and digest").
+			Produces(restful.MIME_JSON).
+			Writes(subscriptions.Preferences{}).
+			Returns(http.StatusOK, "Fetched preferences", subscriptions.Preferences{}).
+			Returns(http.StatusUnauthorized, "Not logged in", nil))
+	service.Route(
+		service.PUT("/preferences").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SavePreferencesHandler).
+			Doc("Replace the logged-in user's notification channels, quiet hours and digest").
+			Produces(restful.MIME_JSON).
+			Consumes(restful.MIME_JSON).
+			Reads(subscriptions.Preferences{}).
+			Writes(subscriptions.Preferences{}).
+			Returns(http.StatusOK, "Preferences saved", subscriptions.Preferences{}).
+			Returns(http.StatusBadRequest, "Unknown notification type, channel or time zone, or invalid quiet hours or digest", nil).
+			Returns(http.StatusUnauthorized, "Not logged in", nil))
+
+	return service
+}
+
+// currentUser loads the logged-in user. On failure it writes the response and
+// returns nil.
+func (server *SubscriptionsServer) currentUser(request *restful.Request, response *restful.Response, logger *log.Entry) *users.User {
+	ctx := filters.GetRequestContext(request)
+	user, err := users.GetUserByGuid(ctx, users.GetRequestJWTClaims(request).Subject, server.Config.GetDbConn())
+	if err != nil || user == nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	return user
+}
+
+func (server *SubscriptionsServer) writeSubscriptions(request *restful.Request, response *restful.Response, logger *log.Entry, user *users.User) {
+	ctx := filters.GetRequestContext(request)
+	siteSet, err := subscriptions.ListSiteSubscriptions(ctx, server.Config.GetDbConn(), user.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListSubscriptionsResponse{UserGuid: user.Guid, Sites: siteSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize subscriptions")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) ListSubscriptionsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	userGuid := request.PathParameter("userGuid")
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListSubscriptionsHandler",
+		"UserGuid":  userGuid,
+	})
+
+	// Subscriptions are personal; only the user and Site Admins may see them
+	claims := users.GetRequestJWTClaims(request)
+	if claims.Subject != userGuid && !claims.IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	user, err := users.GetUserByGuid(ctx, userGuid, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	server.writeSubscriptions(request, response, logger, user)
+}
+
+func (server *SubscriptionsServer) SubscribeToSiteHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	siteSlug := request.PathParameter("siteSlug")
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SubscribeToSiteHandler",
+		"SiteSlug":  siteSlug,
+	})
+
+	var req SubscribeRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	channels, err := subscriptions.NormalizeChannels(req.Channels)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	err = subscriptions.SubscribeToSite(ctx, server.Config.GetDbConn(), user.Id, siteSlug, channels)
+	if err != nil {
+		if errors.Is(err, subscriptions.ErrUnknownSite) {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(subscriptions.SiteSubscription{SiteSlug: siteSlug, Channels: channels})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize subscription")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) UnsubscribeFromSiteHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	siteSlug := request.PathParameter("siteSlug")
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "UnsubscribeFromSiteHandler",
+		"SiteSlug":  siteSlug,
+	})
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	err := subscriptions.UnsubscribeFromSite(ctx, server.Config.GetDbConn(), user.Id, siteSlug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *SubscriptionsServer) ReplaceSiteSubscriptionsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ReplaceSiteSubscriptionsHandler",
+	})
+
+	var req ReplaceSiteSubscriptionsRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	for i, s := range req.Sites {
+		req.Sites[i].Channels, err = subscriptions.NormalizeChannels(s.Channels)
+		if err != nil {
+			response.WriteErrorString(http.StatusBadRequest, s.SiteSlug+": "+err.Error())
+			return
+		}
+	}
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	err = subscriptions.ReplaceSiteSubscriptions(ctx, server.Config.GetDbConn(), user.Id, req.Sites)
+	if err != nil {
+		if errors.Is(err, subscriptions.ErrUnknownSite) {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	server.writeSubscriptions(request, response, logger, user)
+}
+
+func (server *SubscriptionsServer) writePreferences(request *restful.Request, response *restful.Response, logger *log.Entry, user *users.User) {
+	ctx := filters.GetRequestContext(request)
+	prefs, err := subscriptions.GetPreferences(ctx, server.Config.GetDbConn(), user.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(prefs)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize preferences")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SubscriptionsServer) GetPreferencesHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "GetPreferencesHandler",
+	})
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	server.writePreferences(request, response, logger, user)
+}
+
+func (server *SubscriptionsServer) SavePreferencesHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SavePreferencesHandler",
+	})
+
+	var prefs subscriptions.Preferences
+	err := request.ReadEntity(&prefs)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if err = prefs.Validate(); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := server.currentUser(request, response, logger)
+	if user == nil {
+		return
+	}
+	err = subscriptions.SavePreferences(ctx, server.Config.GetDbConn(), user.Id, prefs)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	server.writePreferences(request, response, logger, user)
+}
@@ -0,0 +1,214 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// Channels a notification may be delivered on.
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+// ErrUnknownSite is returned when subscribing to a site slug that does not
+// exist.
+var ErrUnknownSite = errors.New("unknown site")
+
+func ValidChannel(channel string) bool {
+	switch channel {
+	case ChannelPush, ChannelEmail:
+		return true
+	}
+	return false
+}
+
+// NormalizeChannels checks the requested channels, and returns them sorted
+// with duplicates removed. At least one channel must be given.
+func NormalizeChannels(channels []string) ([]string, error) {
+	seen := make(map[string]bool, len(channels))
+	normalized := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if !ValidChannel(channel) {
+			return nil, fmt.Errorf("unknown channel %q, expected %s or %s", channel, ChannelPush, ChannelEmail)
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			normalized = append(normalized, channel)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("at least one channel must be given")
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// SiteSubscription is a user's subscription to changes at one site.
+type SiteSubscription struct {
+	SiteSlug string   `json:"site_slug"`
+	Channels []string `json:"channels"`
+}
+
+// ListSiteSubscriptions fetches the user's subscriptions, ordered by site.
+func ListSiteSubscriptions(ctx context.Context, db *sqlx.DB, userId uint64) ([]SiteSubscription, error) {
+	rows := make([]struct {
+		SiteSlug string `db:"site_slug"`
+		Channel  string `db:"channel"`
+	}, 0)
+	err := db.SelectContext(ctx, &rows, db.Rebind(listSiteSubscriptionsSql), userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ListSiteSubscriptions",
+			"UserID":    userId,
+		}).WithError(err).Error("Failed to select site subscriptions")
+		return nil, err
+	}
+
+	subscriptionSet := make([]SiteSubscription, 0)
+	for _, row := range rows {
+		last := len(subscriptionSet) - 1
+		if last < 0 || subscriptionSet[last].SiteSlug != row.SiteSlug {
+			subscriptionSet = append(subscriptionSet, SiteSubscription{SiteSlug: row.SiteSlug, Channels: make([]string, 0, 2)})
+			last++
+		}
+		subscriptionSet[last].Channels = append(subscriptionSet[last].Channels, row.Channel)
+	}
+	return subscriptionSet, nil
+}
+
+// findSiteId looks up the site by slug, returning ErrUnknownSite if there is
+// no such site.
+func findSiteId(ctx context.Context, tx *sqlx.Tx, slug string) (uint64, error) {
+	var siteId uint64
+	err := tx.GetContext(ctx, &siteId, tx.Rebind(selectSiteIdSql), slug)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w %q", ErrUnknownSite, slug)
+	}
+	return siteId, err
+}
+
+func insertChannels(ctx context.Context, tx *sqlx.Tx, userId, siteId uint64, channels []string) error {
+	for _, channel := range channels {
+		_, err := tx.ExecContext(ctx, tx.Rebind(insertSiteSubscriptionSql), userId, siteId, channel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubscribeToSite subscribes the user to the site on the given channels,
+// replacing the channels of any existing subscription to it. Channels should
+// already have been checked with NormalizeChannels.
+func SubscribeToSite(ctx context.Context, db *sqlx.DB, userId uint64, siteSlug string, channels []string) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SubscribeToSite",
+		"UserID":    userId,
+		"SiteSlug":  siteSlug,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	siteId, err := findSiteId(ctx, tx, siteSlug)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to find site")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteSiteSubscriptionSql), userId, siteId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete previous subscription")
+		return err
+	}
+	err = insertChannels(ctx, tx, userId, siteId, channels)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert subscription")
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit subscription")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// UnsubscribeFromSite removes the user's subscription to the site on every
+// channel. Returns sql.ErrNoRows if the user was not subscribed.
+func UnsubscribeFromSite(ctx context.Context, db *sqlx.DB, userId uint64, siteSlug string) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "UnsubscribeFromSite",
+		"UserID":    userId,
+		"SiteSlug":  siteSlug,
+	})
+
+	result, err := db.ExecContext(ctx, db.Rebind(unsubscribeFromSiteSql), userId, siteSlug)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete subscription")
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Success!
+	return nil
+}
+
+// ReplaceSiteSubscriptions sets all of the user's site subscriptions at once.
+// Sites missing from the list are unsubscribed. Channels should already have
+// been checked with NormalizeChannels.
+func ReplaceSiteSubscriptions(ctx context.Context, db *sqlx.DB, userId uint64, subscriptionSet []SiteSubscription) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ReplaceSiteSubscriptions",
+		"UserID":    userId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(deleteAllSiteSubscriptionsSql), userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete previous subscriptions")
+		return err
+	}
+	for _, s := range subscriptionSet {
+		siteId, err := findSiteId(ctx, tx, s.SiteSlug)
+		if err != nil {
+			logger.WithField("SiteSlug", s.SiteSlug).WithError(err).Debug("Failed to find site")
+			return err
+		}
+		err = insertChannels(ctx, tx, userId, siteId, s.Channels)
+		if err != nil {
+			logger.WithField("SiteSlug", s.SiteSlug).WithError(err).Error("Failed to insert subscription")
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit subscriptions")
+		return err
+	}
+
+	// Success!
+	return nil
+}
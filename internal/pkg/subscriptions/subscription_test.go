@@ -0,0 +1,123 @@
+package subscriptions
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeChannels(t *testing.T) {
+	channels, err := NormalizeChannels([]string{"push", "email", "push"})
+	if err != nil {
+		t.Fatalf("Expected channels to be valid, got %v", err)
+	}
+	if expected := []string{"email", "push"}; !reflect.DeepEqual(channels, expected) {
+		t.Errorf("Expected %v, got %v", expected, channels)
+	}
+
+	testCases := map[string][]string{
+		"none":    {},
+		"unknown": {"push", "sms"},
+		"case":    {"Email"},
+	}
+	for name, channels := range testCases {
+		if _, err := NormalizeChannels(channels); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNotification_PushMessage(t *testing.T) {
+	n := Notification{
+		Id:        7,
+		EventType: EventSiteUpdated,
+		Payload: `{"site_slug": "downtown", "site_name": "Downtown", "changes": [
+			{"field": "schedule.tuesday", "old": "09:00-17:00", "new": "closed"},
+			{"field": "location.street", "old": "1 Main St", "new": "2 Main St"},
+			{"field": "location.zip", "old": "00001", "new": "00002"}
+		]}`,
+	}
+	msg, err := n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Downtown has changed" {
+		t.Errorf("Unexpected title %q", msg.Title)
+	}
+	if msg.Body != "Updated: Tuesday hours, location" {
+		t.Errorf("Unexpected body %q", msg.Body)
+	}
+	if msg.Data["site_slug"] != "downtown" || msg.Data["notification_id"] != "7" {
+		t.Errorf("Unexpected data %v", msg.Data)
+	}
+
+	_, err = Notification{EventType: "unknown.event", Payload: "{}"}.PushMessage()
+	if err == nil {
+		t.Error("Expected an unknown event type to be refused")
+	}
+}
+
+func TestNotification_PushMessage_Shift(t *testing.T) {
+	n := Notification{
+		Id:        8,
+		EventType: shifts.EventSignupCreated,
+		Payload: `{"shift_id": 12, "site_slug": "downtown", "site_name": "Downtown", "timezone": "America/New_York",
+			"starts_at": "2026-01-05T14:00:00Z", "ends_at": "2026-01-05T18:00:00Z"}`,
+	}
+	msg, err := n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Signed up at Downtown" {
+		t.Errorf("Unexpected title %q", msg.Title)
+	}
+	if msg.Body != "Mon Jan 5 9:00 AM - 1:00 PM" {
+		t.Errorf("Expected times in the site's time zone, got %q", msg.Body)
+	}
+	if msg.Data["shift_id"] != "12" {
+		t.Errorf("Unexpected data %v", msg.Data)
+	}
+
+	n.EventType = shifts.EventSignupCancelled
+	msg, err = n.PushMessage()
+	if err != nil {
+		t.Fatalf("Failed to render notification: %v", err)
+	}
+	if msg.Title != "Shift cancelled at Downtown" {
+		t.Errorf("Unexpected title %q", msg.Title)
+	}
+}
+
+func TestDescribeField(t *testing.T) {
+	testCases := []struct {
+		field, locale, expected string
+	}{
+		{"schedule.tuesday", "en-US", "Tuesday hours"},
+		{"schedule.tuesday", "es-MX", "horario del martes"},
+		{"calendar.2026-12-25", "es", "horario del 2026-12-25"},
+		{"location.zip", "fr", "location"},
+		{"feature.tax-prep", "en", "tax-prep service"},
+		{"active", "", "open status"},
+		{"something.new", "en", "something.new"},
+	}
+	for _, tc := range testCases {
+		if label := describeField(tc.field, tc.locale); label != tc.expected {
+			t.Errorf("%s in %q: expected %q, got %q", tc.field, tc.locale, tc.expected, label)
+		}
+	}
+}
+
+func TestChangedFeatures(t *testing.T) {
+	changes := []sites.FieldChange{
+		{Field: "name", Old: "Downtown", New: "Downtown Library"},
+		{Field: "feature.tax-prep", Old: sites.FeatureOffered, New: sites.FeatureNotOffered},
+		{Field: "feature.food-pantry", Old: sites.FeatureNotOffered, New: sites.FeatureOffered},
+	}
+	if features := changedFeatures(changes); !reflect.DeepEqual(features, []string{"tax-prep", "food-pantry"}) {
+		t.Errorf("Unexpected features %v", features)
+	}
+	if features := changedFeatures(changes[:1]); len(features) != 0 {
+		t.Errorf("Expected no features, got %v", features)
+	}
+}
@@ -0,0 +1,53 @@
+package subscriptions
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type SubscriptionsTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestSubscriptionsTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(SubscriptionsTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping SubscriptionsTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+// seedSignup signs user2 up for a shift at a new site in testorg1, starting
+// in two hours, and returns the signup's ID.
+func (suite *SubscriptionsTestSuite) seedSignup() uint64 {
+	db := suite.Config.GetDbConn()
+	var siteId, shiftId, signupId uint64
+	err := db.Get(&siteId, `INSERT INTO sites (organization_id, slug, name_l10n, locale) VALUES (1, 'testsite1', 'Test Site 1', 'en') RETURNING id`)
+	suite.Require().Nil(err)
+	err = db.Get(&shiftId, `INSERT INTO shifts (organization_id, site_id, role, starts_at, ends_at) VALUES (1, $1, 2, now() + interval '2 hours', now() + interval '4 hours') RETURNING id`, siteId)
+	suite.Require().Nil(err)
+	err = db.Get(&signupId, `INSERT INTO shift_signups (shift_id, user_id) VALUES ($1, 2) RETURNING id`, shiftId)
+	suite.Require().Nil(err)
+	return signupId
+}
+
+// seedReminder schedules a reminder for the signup, and returns its ID.
+func (suite *SubscriptionsTestSuite) seedReminder(signupId uint64, offsetMinutes int, sendAt time.Time) uint64 {
+	var id uint64
+	err := suite.Config.GetDbConn().Get(&id, `INSERT INTO shift_reminders (signup_id, offset_minutes, send_at) VALUES ($1, $2, $3) RETURNING id`, signupId, offsetMinutes, sendAt)
+	suite.Require().Nil(err)
+	return id
+}
+
+func (suite *SubscriptionsTestSuite) reminderStatus(id uint64) string {
+	var status string
+	suite.Require().Nil(suite.Config.GetDbConn().Get(&status, `SELECT status FROM shift_reminders WHERE id = $1`, id))
+	return status
+}
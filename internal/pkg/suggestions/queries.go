@@ -0,0 +1,45 @@
+package suggestions
+
+const selectSuggestionColumns = `
+	SELECT
+		suggestions.id, suggestions.organization_id,
+		suggestions.site_id, sites.slug AS site_slug,
+		suggestions.submitted_by, submitters.user_guid AS submitter_guid,
+		suggestions.contact_email, suggestions.body, suggestions.status,
+		suggestions.assignee_id, assignees.user_guid AS assignee_guid,
+		suggestions.internal_notes, suggestions.created_at, suggestions.updated_at
+	FROM suggestions
+		JOIN organizations ON organizations.id = suggestions.organization_id AND organizations.deleted_at IS NULL
+		LEFT OUTER JOIN sites ON sites.id = suggestions.site_id
+		LEFT OUTER JOIN users submitters ON submitters.id = suggestions.submitted_by
+		LEFT OUTER JOIN users assignees ON assignees.id = suggestions.assignee_id
+`
+
+const describeSuggestionSql = selectSuggestionColumns + `
+	WHERE suggestions.id = ?
+`
+
+// The filters are optional: a NULL argument matches every suggestion.
+const listSuggestionsSql = selectSuggestionColumns + `
+	WHERE suggestions.organization_id = ?
+		AND (?::text IS NULL OR suggestions.status = ?)
+		AND (?::integer IS NULL OR suggestions.site_id = ?)
+		AND (?::integer IS NULL OR suggestions.assignee_id = ?)
+	ORDER BY suggestions.created_at DESC, suggestions.id DESC
+`
+
+const insertSuggestionSql = `
+	INSERT INTO suggestions (organization_id, site_id, submitted_by, contact_email, body)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id, status, created_at, updated_at
+`
+
+const updateSuggestionSql = `
+	UPDATE suggestions SET status = ?, assignee_id = ?, internal_notes = ?, updated_at = now()
+	WHERE id = ?
+	RETURNING updated_at
+`
+
+const deleteSuggestionSql = `
+	DELETE FROM suggestions WHERE id = ?
+`
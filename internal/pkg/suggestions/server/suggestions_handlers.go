@@ -0,0 +1,456 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// staffRoles may read and work through an Organization's suggestions.
+var staffRoles = []users.RoleType{users.OrgAdmin, users.BackOffice}
+
+type SuggestionsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *SuggestionsServer {
+	return &SuggestionsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+// SubmitSuggestionRequest names the organization, or a site whose
+// organization should receive the suggestion.
+type SubmitSuggestionRequest struct {
+	OrganizationSlug string `json:"organization_slug"`
+	SiteSlug         string `json:"site_slug"`
+	Body             string `json:"body"`
+	ContactEmail     string `json:"contact_email"`
+
+	// Hidden from people by the form; anything filled in here came from a bot
+	Website string `json:"website"`
+}
+
+type SubmitSuggestionResponse struct {
+	Id        uint64    `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UpdateSuggestionRequest struct {
+	Status        string `json:"status"`
+	AssigneeGuid  string `json:"assignee_guid"` // empty to unassign
+	InternalNotes string `json:"internal_notes"`
+}
+
+type ListSuggestionsResponse struct {
+	Suggestions []suggestions.Suggestion `json:"suggestions"`
+}
+
+func (server *SuggestionsServer) GetSuggestionsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/suggestions").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+	guard := server.Config.GetAbuseGuard()
+
+	// Anonymous visitors may leave suggestions too, after solving a challenge
+	service.Route(
+		service.GET("/challenge").
+			To(guard.ChallengeHandler).
+			Doc("Fetch a proof-of-work challenge to solve before submitting a suggestion").
+			Produces(restful.MIME_JSON).
+			Writes(filters.Challenge{}).
+			Returns(http.StatusOK, "Issued challenge", filters.Challenge{}))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.OptionalJwtFilter).
+			Filter(guard.ChallengeFilter).
+			To(server.SubmitSuggestionHandler).
+			Doc("Leave a suggestion for an organization or one of its sites").
+			Param(restful.HeaderParameter(filters.ChallengeHeader, "Challenge fetched from /suggestions/challenge")).
+			Param(restful.HeaderParameter(filters.ChallengeSolutionHeader, "Solution to the challenge")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(SubmitSuggestionRequest{}).
+			Writes(SubmitSuggestionResponse{}).
+			Returns(http.StatusOK, "Suggestion received", SubmitSuggestionResponse{}).
+			Returns(http.StatusBadRequest, "Invalid suggestion, or unknown organization or site", nil).
+			Returns(http.StatusForbidden, "Missing, invalid or reused challenge", nil).
+			Returns(http.StatusUnprocessableEntity, "Submission was rejected as spam", nil).
+			Returns(http.StatusTooManyRequests, "Too many submissions", nil))
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListSuggestionsHandler).
+			Doc("List an organization's suggestions, newest first").
+			Param(restful.QueryParameter("organization_id", "Organization ID")).
+			Param(restful.QueryParameter("status", "Only include suggestions with this status (optional)")).
+			Param(restful.QueryParameter("site", "Only include suggestions about this site (optional)")).
+			Param(restful.QueryParameter("assignee", "Only include suggestions assigned to this user GUID (optional)")).
+			Produces(restful.MIME_JSON).
+			Writes(ListSuggestionsResponse{}).
+			Returns(http.StatusOK, "Fetched suggestions", ListSuggestionsResponse{}).
+			Returns(http.StatusBadRequest, "Invalid filter", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not read the organization's suggestions", nil))
+	service.Route(
+		service.GET("/{suggestionId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DescribeSuggestionHandler).
+			Doc("Fetch a suggestion").
+			Param(restful.PathParameter("suggestionId", "Suggestion ID")).
+			Produces(restful.MIME_JSON).
+			Writes(suggestions.Suggestion{}).
+			Returns(http.StatusOK, "Fetched suggestion", suggestions.Suggestion{}).
+			Returns(http.StatusForbidden, "Logged-in user may not read the organization's suggestions", nil).
+			Returns(http.StatusNotFound, "Suggestion not found", nil))
+	service.Route(
+		service.PUT("/{suggestionId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UpdateSuggestionHandler).
+			Doc("Update a suggestion's status, assignee and internal notes").
+			Param(restful.PathParameter("suggestionId", "Suggestion ID")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(UpdateSuggestionRequest{}).
+			Writes(suggestions.Suggestion{}).
+			Returns(http.StatusOK, "Updated suggestion", suggestions.Suggestion{}).
+			Returns(http.StatusBadRequest, "Invalid status or assignee", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not update the organization's suggestions", nil).
+			Returns(http.StatusNotFound, "Suggestion not found", nil))
+	service.Route(
+		service.DELETE("/{suggestionId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DeleteSuggestionHandler).
+			Doc("Delete a suggestion").
+			Param(restful.PathParameter("suggestionId", "Suggestion ID")).
+			Returns(http.StatusOK, "Deleted suggestion", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Suggestion not found", nil))
+
+	return service
+}
+
+func (server *SuggestionsServer) SubmitSuggestionHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "SubmitSuggestionHandler",
+	})
+	db := server.Config.GetDbConn()
+
+	var req SubmitSuggestionRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	suggestion := suggestions.Suggestion{
+		Body:         req.Body,
+		ContactEmail: req.ContactEmail,
+	}
+	if req.SiteSlug != "" {
+		site, err := sites.FindSite(ctx, req.SiteSlug, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if site == nil || site.OrganizationId == 0 {
+			response.WriteErrorString(http.StatusBadRequest, "site not found")
+			return
+		}
+		suggestion.OrganizationId = site.OrganizationId
+		suggestion.SiteId = &site.Id
+	}
+	if req.OrganizationSlug != "" {
+		org, err := organizations.DescribeOrganizationBySlug(ctx, db, req.OrganizationSlug)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				response.WriteErrorString(http.StatusBadRequest, "organization not found")
+				return
+			}
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if suggestion.SiteId != nil && suggestion.OrganizationId != org.Id {
+			response.WriteErrorString(http.StatusBadRequest, "site does not belong to the organization")
+			return
+		}
+		suggestion.OrganizationId = org.Id
+	}
+
+	errorSet := suggestion.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Suggestion is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+
+	blocklist, err := organizations.GetBlockedTerms(ctx, db, suggestion.OrganizationId)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	guard := server.Config.GetAbuseGuard()
+	err = guard.CheckSubmission(ctx, filters.Submission{
+		IP:             guard.ClientIP(request),
+		OrganizationId: suggestion.OrganizationId,
+		Honeypot:       req.Website,
+		Text:           []string{suggestion.Body, suggestion.ContactEmail},
+		Blocklist:      blocklist,
+	})
+	if err != nil {
+		if err == filters.ErrRateLimited {
+			response.WriteErrorString(http.StatusTooManyRequests, err.Error())
+			return
+		}
+		response.WriteErrorString(http.StatusUnprocessableEntity, "submission rejected")
+		return
+	}
+
+	// Remember who left it, if they were logged in
+	if claims := users.GetRequestJWTClaims(request); claims != nil {
+		submitter, err := users.GetUserByGuid(ctx, claims.Subject, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if submitter != nil {
+			suggestion.SubmittedBy = &submitter.Id
+		}
+	}
+
+	err = suggestion.Create(ctx, db)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Submitters only get a receipt; the rest is for the staff
+	err = response.WriteEntity(SubmitSuggestionResponse{
+		Id:        suggestion.Id,
+		Status:    suggestion.Status,
+		CreatedAt: suggestion.CreatedAt,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize suggestion")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SuggestionsServer) ListSuggestionsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "ListSuggestionsHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+	db := server.Config.GetDbConn()
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "organization_id must be present")
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgId, staffRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	filter := suggestions.ListFilter{Status: request.QueryParameter("status")}
+	if filter.Status != "" && !suggestions.ValidStatus(filter.Status) {
+		response.WriteErrorString(http.StatusBadRequest, "status must be one of new, in-progress or resolved")
+		return
+	}
+	if slug := request.QueryParameter("site"); slug != "" {
+		site, err := sites.FindSite(ctx, slug, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if site == nil || site.OrganizationId != orgId {
+			response.WriteErrorString(http.StatusBadRequest, "site not found in the organization")
+			return
+		}
+		filter.SiteId = site.Id
+	}
+	if guid := request.QueryParameter("assignee"); guid != "" {
+		assignee, err := users.GetUserByGuid(ctx, guid, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if assignee == nil {
+			response.WriteErrorString(http.StatusBadRequest, "assignee not found")
+			return
+		}
+		filter.AssigneeId = assignee.Id
+	}
+
+	suggestionSet, err := suggestions.ListSuggestions(ctx, db, orgId, filter)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListSuggestionsResponse{Suggestions: suggestionSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize suggestions")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// findSuggestion loads the suggestion named in the suggestionId path
+// parameter, and checks that the logged-in user holds one of the roles on its
+// organization. On failure it writes the response and returns nil.
+func (server *SuggestionsServer) findSuggestion(request *restful.Request, response *restful.Response, roles ...users.RoleType) *suggestions.Suggestion {
+	ctx := filters.GetRequestContext(request)
+	suggestionId, err := strconv.ParseUint(request.PathParameter("suggestionId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid suggestion ID")
+		return nil
+	}
+	suggestion, err := suggestions.DescribeSuggestion(ctx, server.Config.GetDbConn(), suggestionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(suggestion.OrganizationId, roles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return suggestion
+}
+
+func (server *SuggestionsServer) DescribeSuggestionHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":          "DescribeSuggestionHandler",
+		"SuggestionID.input": request.PathParameter("suggestionId"),
+	})
+
+	suggestion := server.findSuggestion(request, response, staffRoles...)
+	if suggestion == nil {
+		return
+	}
+
+	err := response.WriteEntity(suggestion)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize suggestion")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SuggestionsServer) UpdateSuggestionHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":          "UpdateSuggestionHandler",
+		"SuggestionID.input": request.PathParameter("suggestionId"),
+	})
+	db := server.Config.GetDbConn()
+
+	var req UpdateSuggestionRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if !suggestions.ValidStatus(req.Status) {
+		response.WriteErrorString(http.StatusBadRequest, "status must be one of new, in-progress or resolved")
+		return
+	}
+
+	suggestion := server.findSuggestion(request, response, staffRoles...)
+	if suggestion == nil {
+		return
+	}
+
+	suggestion.Status = req.Status
+	suggestion.InternalNotes = req.InternalNotes
+	suggestion.AssigneeId = nil
+	suggestion.AssigneeGuid = nil
+	if req.AssigneeGuid != "" {
+		// Suggestions may only be handed to the organization's staff
+		assignee, err := users.GetUserByGuid(ctx, req.AssigneeGuid, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if assignee == nil {
+			response.WriteErrorString(http.StatusBadRequest, "assignee not found")
+			return
+		}
+		roles, err := assignee.GetRoles(ctx, db)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		isStaff := false
+		for _, role := range roles[suggestion.OrganizationId] {
+			if role.Role == users.OrgAdmin || role.Role == users.BackOffice {
+				isStaff = true
+			}
+		}
+		if !isStaff {
+			response.WriteErrorString(http.StatusBadRequest, "assignee must be an OrgAdmin or BackOffice member of the organization")
+			return
+		}
+		suggestion.AssigneeId = &assignee.Id
+		suggestion.AssigneeGuid = &assignee.Guid
+	}
+
+	err = suggestion.Update(ctx, db)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(suggestion)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize suggestion")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *SuggestionsServer) DeleteSuggestionHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	suggestion := server.findSuggestion(request, response, users.OrgAdmin)
+	if suggestion == nil {
+		return
+	}
+
+	err := suggestions.DeleteSuggestion(ctx, server.Config.GetDbConn(), suggestion.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
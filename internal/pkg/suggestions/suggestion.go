@@ -0,0 +1,207 @@
+package suggestions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Suggestion statuses, as the staff work through the feedback.
+const (
+	StatusNew        = "new"
+	StatusInProgress = "in-progress"
+	StatusResolved   = "resolved"
+)
+
+// EventSuggestionCreated is the type of the outbox event recorded when a
+// suggestion is left.
+const EventSuggestionCreated = "suggestion.created"
+
+// SuggestionEvent is the payload of EventSuggestionCreated.
+type SuggestionEvent struct {
+	SuggestionId   uint64  `json:"suggestion_id"`
+	OrganizationId uint64  `json:"organization_id"`
+	SiteId         *uint64 `json:"site_id,omitempty"`
+}
+
+const (
+	MaxBodyLength         = 5000
+	MaxContactEmailLength = 128
+)
+
+// Suggestion is feedback for an Organization, optionally about one of its
+// Sites. Anonymous visitors may leave one, so SubmittedBy is often nil.
+type Suggestion struct {
+	Id             uint64    `json:"id" db:"id"`
+	OrganizationId uint64    `json:"organization_id" db:"organization_id"`
+	SiteId         *uint64   `json:"-" db:"site_id"`
+	SiteSlug       *string   `json:"site_slug,omitempty" db:"site_slug"`
+	SubmittedBy    *uint64   `json:"-" db:"submitted_by"`
+	SubmitterGuid  *string   `json:"submitted_by,omitempty" db:"submitter_guid"`
+	ContactEmail   string    `json:"contact_email" db:"contact_email"`
+	Body           string    `json:"body" db:"body"`
+	Status         string    `json:"status" db:"status"`
+	AssigneeId     *uint64   `json:"-" db:"assignee_id"`
+	AssigneeGuid   *string   `json:"assignee_guid,omitempty" db:"assignee_guid"`
+	InternalNotes  string    `json:"internal_notes" db:"internal_notes"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Validate checks the fields a submitter controls.
+func (s Suggestion) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if s.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("an organization or site must be given"))
+	}
+	body := strings.TrimSpace(s.Body)
+	if len(body) == 0 {
+		errSet = append(errSet, errors.New("body must be present"))
+	} else if len(body) > MaxBodyLength {
+		errSet = append(errSet, fmt.Errorf("body may be at most %d characters", MaxBodyLength))
+	}
+	if len(s.ContactEmail) > MaxContactEmailLength {
+		errSet = append(errSet, fmt.Errorf("contact_email may be at most %d characters", MaxContactEmailLength))
+	} else if len(s.ContactEmail) > 0 && !strings.Contains(s.ContactEmail, "@") {
+		errSet = append(errSet, errors.New("contact_email must be an email address"))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusNew, StatusInProgress, StatusResolved:
+		return true
+	}
+	return false
+}
+
+// Create saves a new suggestion, and records EventSuggestionCreated so that
+// the organization's admins hear about it. Its status always starts as new.
+func (s *Suggestion) Create(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "CreateSuggestion",
+		"OrganizationID": s.OrganizationId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	s.Body = strings.TrimSpace(s.Body)
+	row := tx.QueryRowxContext(ctx, tx.Rebind(insertSuggestionSql),
+		s.OrganizationId, s.SiteId, s.SubmittedBy, s.ContactEmail, s.Body)
+	err = row.Scan(&s.Id, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert suggestion")
+		return err
+	}
+	err = outbox.Enqueue(ctx, tx, EventSuggestionCreated, SuggestionEvent{
+		SuggestionId:   s.Id,
+		OrganizationId: s.OrganizationId,
+		SiteId:         s.SiteId,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit suggestion")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// DescribeSuggestion fetches a single suggestion. Returns sql.ErrNoRows if it
+// does not exist.
+func DescribeSuggestion(ctx context.Context, db *sqlx.DB, id uint64) (*Suggestion, error) {
+	var s Suggestion
+	err := db.GetContext(ctx, &s, db.Rebind(describeSuggestionSql), id)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListFilter narrows the suggestions listed for an Organization. Zero values
+// match everything.
+type ListFilter struct {
+	Status     string
+	SiteId     uint64
+	AssigneeId uint64
+}
+
+func nullIfZero(id uint64) *uint64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// ListSuggestions fetches an Organization's suggestions, newest first.
+func ListSuggestions(ctx context.Context, db *sqlx.DB, orgId uint64, filter ListFilter) ([]Suggestion, error) {
+	var status *string
+	if filter.Status != "" {
+		status = &filter.Status
+	}
+	siteId := nullIfZero(filter.SiteId)
+	assigneeId := nullIfZero(filter.AssigneeId)
+
+	suggestionSet := make([]Suggestion, 0)
+	err := db.SelectContext(ctx, &suggestionSet, db.Rebind(listSuggestionsSql),
+		orgId, status, status, siteId, siteId, assigneeId, assigneeId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":      "ListSuggestions",
+			"OrganizationID": orgId,
+		}).WithError(err).Error("Failed to select suggestions")
+		return nil, err
+	}
+	return suggestionSet, nil
+}
+
+// Update saves the staff-controlled fields: the status, assignee and
+// internal notes.
+func (s *Suggestion) Update(ctx context.Context, db *sqlx.DB) error {
+	err := db.GetContext(ctx, &s.UpdatedAt, db.Rebind(updateSuggestionSql),
+		s.Status, s.AssigneeId, s.InternalNotes, s.Id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":    "UpdateSuggestion",
+			"SuggestionID": s.Id,
+		}).WithError(err).Error("Failed to update suggestion")
+		return err
+	}
+	return nil
+}
+
+func DeleteSuggestion(ctx context.Context, db *sqlx.DB, id uint64) error {
+	_, err := db.ExecContext(ctx, db.Rebind(deleteSuggestionSql), id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":    "DeleteSuggestion",
+			"SuggestionID": id,
+		}).WithError(err).Error("Failed to delete suggestion")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package suggestions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuggestion_Validate(t *testing.T) {
+	valid := Suggestion{OrganizationId: 1, Body: "The door code changed", ContactEmail: "visitor@example.com"}
+	if errs := valid.Validate(); errs != nil {
+		t.Errorf("Expected suggestion to be valid, got %v", errs)
+	}
+
+	anonymous := Suggestion{OrganizationId: 1, Body: "More chairs, please"}
+	if errs := anonymous.Validate(); errs != nil {
+		t.Errorf("Expected anonymous suggestion to be valid, got %v", errs)
+	}
+
+	testCases := map[string]Suggestion{
+		"no organization": {Body: "Hello"},
+		"blank body":      {OrganizationId: 1, Body: "  \n"},
+		"long body":       {OrganizationId: 1, Body: strings.Repeat("a", MaxBodyLength+1)},
+		"bad email":       {OrganizationId: 1, Body: "Hello", ContactEmail: "not-an-email"},
+	}
+	for name, s := range testCases {
+		errs := s.Validate()
+		if errs == nil || len(errs.Errors) != 1 {
+			t.Errorf("%s: expected one validation error, got %v", name, errs)
+		}
+	}
+}
+
+func TestValidStatus(t *testing.T) {
+	for _, status := range []string{StatusNew, StatusInProgress, StatusResolved} {
+		if !ValidStatus(status) {
+			t.Errorf("Expected %s to be valid", status)
+		}
+	}
+	if ValidStatus("closed") {
+		t.Errorf("Expected closed to be invalid")
+	}
+}
@@ -0,0 +1,49 @@
+package teams
+
+const selectTeamColumns = `
+	SELECT
+		teams.id, teams.organization_id, teams.name, teams.feature_key, teams.created_at,
+		(SELECT COUNT(*) FROM team_members WHERE team_members.team_id = teams.id) AS member_count
+	FROM teams
+		JOIN organizations ON organizations.id = teams.organization_id AND organizations.deleted_at IS NULL
+`
+
+const listTeamsSql = selectTeamColumns + `
+	WHERE teams.organization_id = ?
+	ORDER BY teams.name, teams.id
+`
+
+const describeTeamSql = selectTeamColumns + `
+	WHERE teams.id = ?
+`
+
+const insertTeamSql = `
+	INSERT INTO teams (organization_id, name, feature_key) VALUES (?, ?, ?)
+	RETURNING id, created_at
+`
+
+const deleteTeamSql = `
+	DELETE FROM teams WHERE id = ?
+`
+
+const listMembersSql = `
+	SELECT users.user_guid, team_members.notify, team_members.joined_at
+	FROM team_members
+		INNER JOIN users ON users.id = team_members.user_id
+	WHERE team_members.team_id = ?
+	ORDER BY team_members.joined_at, users.id
+`
+
+// Only members of the team's organization may join it.
+const upsertMemberSql = `
+	INSERT INTO team_members (team_id, user_id, notify)
+	SELECT teams.id, ?, ?
+	FROM teams
+	WHERE teams.id = ?
+		AND EXISTS (SELECT 1 FROM roles WHERE roles.org_id = teams.organization_id AND roles.user_id = ?)
+	ON CONFLICT (team_id, user_id) DO UPDATE SET notify = EXCLUDED.notify
+`
+
+const deleteMemberSql = `
+	DELETE FROM team_members WHERE team_id = ? AND user_id = ?
+`
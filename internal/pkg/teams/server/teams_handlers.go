@@ -0,0 +1,358 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/teams"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type TeamsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *TeamsServer {
+	return &TeamsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+type ListTeamsResponse struct {
+	Teams []teams.Team `json:"teams"`
+}
+
+type DescribeTeamResponse struct {
+	teams.Team
+	Members []teams.Member `json:"members"`
+}
+
+type MembershipRequest struct {
+	Notify bool `json:"notify"` // opt in to notifications about sites offering the team's feature
+}
+
+func (server *TeamsServer) GetTeamsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/teams").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListTeamsHandler).
+			Doc("List an organization's teams").
+			Param(restful.QueryParameter("organization_id", "Organization ID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListTeamsResponse{}).
+			Returns(http.StatusOK, "Fetched teams", ListTeamsResponse{}).
+			Returns(http.StatusBadRequest, "Invalid organization ID", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a member of the organization", nil))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CreateTeamHandler).
+			Doc("Create a team. Naming it after a site feature connects it to the sites offering that feature").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(teams.Team{}).
+			Writes(teams.Team{}).
+			Returns(http.StatusOK, "Team created", teams.Team{}).
+			Returns(http.StatusBadRequest, "Invalid team", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusConflict, "The organization already has a team with this name", nil))
+	service.Route(
+		service.GET("/{teamId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DescribeTeamHandler).
+			Doc("Fetch a team and its members").
+			Param(restful.PathParameter("teamId", "Team ID")).
+			Produces(restful.MIME_JSON).
+			Writes(DescribeTeamResponse{}).
+			Returns(http.StatusOK, "Fetched team", DescribeTeamResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a member of the organization", nil).
+			Returns(http.StatusNotFound, "Team not found", nil))
+	service.Route(
+		service.DELETE("/{teamId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DeleteTeamHandler).
+			Doc("Delete a team and its memberships").
+			Param(restful.PathParameter("teamId", "Team ID")).
+			Returns(http.StatusOK, "Team deleted", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Team not found", nil))
+	service.Route(
+		service.PUT("/{teamId}/members/{userGuid}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.SetMembershipHandler).
+			Doc("Join a team, or change whether a member is notified of site changes").
+			Param(restful.PathParameter("teamId", "Team ID")).
+			Param(restful.PathParameter("userGuid", "Member's user GUID")).
+			Consumes(restful.MIME_JSON).
+			Reads(MembershipRequest{}).
+			Returns(http.StatusOK, "Membership saved", nil).
+			Returns(http.StatusBadRequest, "User is not a member of the organization", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not change this membership", nil).
+			Returns(http.StatusNotFound, "Team or user not found", nil))
+	service.Route(
+		service.DELETE("/{teamId}/members/{userGuid}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RemoveMemberHandler).
+			Doc("Leave a team").
+			Param(restful.PathParameter("teamId", "Team ID")).
+			Param(restful.PathParameter("userGuid", "Member's user GUID")).
+			Returns(http.StatusOK, "Left team", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not change this membership", nil).
+			Returns(http.StatusNotFound, "Team not found, or the user is not on it", nil))
+
+	return service
+}
+
+func (server *TeamsServer) ListTeamsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "ListTeamsHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgId, users.MemberRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	teamSet, err := teams.ListTeams(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListTeamsResponse{Teams: teamSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize teams")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *TeamsServer) CreateTeamHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CreateTeamHandler",
+	})
+
+	var team teams.Team
+	err := request.ReadEntity(&team)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	errorSet := team.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Team is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(team.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), team.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = team.Create(ctx, server.Config.GetDbConn())
+	if err != nil {
+		if err == teams.ErrDuplicateTeam {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(team)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize team")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// findTeam loads the team named in the teamId path parameter, and checks
+// that the logged-in user holds one of the roles in its organization. On
+// failure it writes the response and returns nil.
+func (server *TeamsServer) findTeam(request *restful.Request, response *restful.Response, roles ...users.RoleType) *teams.Team {
+	ctx := filters.GetRequestContext(request)
+	teamId, err := strconv.ParseUint(request.PathParameter("teamId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid team ID")
+		return nil
+	}
+	team, err := teams.DescribeTeam(ctx, server.Config.GetDbConn(), teamId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(team.OrganizationId, roles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return team
+}
+
+func (server *TeamsServer) DescribeTeamHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":    "DescribeTeamHandler",
+		"TeamID.input": request.PathParameter("teamId"),
+	})
+
+	team := server.findTeam(request, response, users.MemberRoles...)
+	if team == nil {
+		return
+	}
+	memberSet, err := teams.ListMembers(ctx, server.Config.GetDbConn(), team.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(DescribeTeamResponse{Team: *team, Members: memberSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize team")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *TeamsServer) DeleteTeamHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	team := server.findTeam(request, response, users.OrgAdmin)
+	if team == nil {
+		return
+	}
+	err := teams.DeleteTeam(ctx, server.Config.GetDbConn(), team.Id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+// findMember loads the team and the user named in the path, and checks that
+// the logged-in user is either that user, and a member of the team's
+// organization, or one of its admins. On failure it writes the response and
+// returns nil.
+func (server *TeamsServer) findMember(request *restful.Request, response *restful.Response) (*teams.Team, *users.User) {
+	ctx := filters.GetRequestContext(request)
+	userGuid := request.PathParameter("userGuid")
+
+	team := server.findTeam(request, response, users.MemberRoles...)
+	if team == nil {
+		return nil, nil
+	}
+	claims := users.GetRequestJWTClaims(request)
+	if claims.Subject != userGuid && !claims.HasRole(team.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil, nil
+	}
+	user, err := users.GetUserByGuid(ctx, userGuid, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil, nil
+	}
+	if user == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return nil, nil
+	}
+	return team, user
+}
+
+func (server *TeamsServer) SetMembershipHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":    "SetMembershipHandler",
+		"TeamID.input": request.PathParameter("teamId"),
+		"UserGuid":     request.PathParameter("userGuid"),
+	})
+
+	var req MembershipRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	team, user := server.findMember(request, response)
+	if team == nil {
+		return
+	}
+
+	err = teams.SetMembership(ctx, server.Config.GetDbConn(), team.Id, user.Id, req.Notify)
+	if err != nil {
+		if err == teams.ErrNotMember {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *TeamsServer) RemoveMemberHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	team, user := server.findMember(request, response)
+	if team == nil {
+		return
+	}
+	err := teams.RemoveMember(ctx, server.Config.GetDbConn(), team.Id, user.Id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
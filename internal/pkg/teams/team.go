@@ -0,0 +1,178 @@
+package teams
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateTeam = errors.New("the organization already has a team with this name")
+	ErrNotMember     = errors.New("user is not a member of the team's organization")
+)
+
+// MaxNameLength is the longest team name that can be stored.
+const MaxNameLength = 64
+
+// Team is a group of an Organization's volunteers. When its name matches a
+// site feature, such as "Tax Prep" and tax-prep, members who opted in are
+// notified of changes to the organization's sites that offer the feature.
+type Team struct {
+	Id             uint64    `json:"id" db:"id"`
+	OrganizationId uint64    `json:"organization_id" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Feature        string    `json:"feature" db:"feature_key"` // site feature matched by the name
+	MemberCount    int       `json:"member_count" db:"member_count"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// Member is a user's membership in a team.
+type Member struct {
+	UserGuid string    `json:"user_guid" db:"user_guid"`
+	Notify   bool      `json:"notify" db:"notify"` // opted in to site change notifications
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+}
+
+func (t Team) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if t.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("organization_id must be present"))
+	}
+	name := strings.TrimSpace(t.Name)
+	if sites.NormalizeFeature(name) == "" {
+		errSet = append(errSet, errors.New("name must be present"))
+	} else if len(name) > MaxNameLength {
+		errSet = append(errSet, fmt.Errorf("name may be at most %d characters", MaxNameLength))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// Create saves a new team. Names are unique within an organization, ignoring
+// case and punctuation, so that each matches at most one site feature.
+func (t *Team) Create(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "Team.Create",
+		"OrganizationID": t.OrganizationId,
+	})
+
+	t.Name = strings.TrimSpace(t.Name)
+	t.Feature = sites.NormalizeFeature(t.Name)
+	err := db.QueryRowxContext(ctx, db.Rebind(insertTeamSql), t.OrganizationId, t.Name, t.Feature).Scan(&t.Id, &t.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateTeam
+		}
+		logger.WithError(err).Error("Failed to insert team")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// ListTeams fetches the organization's teams, ordered by name.
+func ListTeams(ctx context.Context, db *sqlx.DB, orgId uint64) ([]Team, error) {
+	teamSet := make([]Team, 0)
+	err := db.SelectContext(ctx, &teamSet, db.Rebind(listTeamsSql), orgId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("OrganizationID", orgId).WithError(err).Error("Failed to select teams")
+		return nil, err
+	}
+	return teamSet, nil
+}
+
+// DescribeTeam fetches a single team. Returns sql.ErrNoRows if it does not
+// exist.
+func DescribeTeam(ctx context.Context, db *sqlx.DB, teamId uint64) (*Team, error) {
+	var t Team
+	err := db.GetContext(ctx, &t, db.Rebind(describeTeamSql), teamId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			filters.GetContextLogger(ctx).WithField("TeamID", teamId).WithError(err).Error("Failed to select team")
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTeam deletes the team and its memberships. Returns sql.ErrNoRows if
+// it does not exist.
+func DeleteTeam(ctx context.Context, db *sqlx.DB, teamId uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(deleteTeamSql), teamId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("TeamID", teamId).WithError(err).Error("Failed to delete team")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListMembers fetches the team's members, in the order they joined.
+func ListMembers(ctx context.Context, db *sqlx.DB, teamId uint64) ([]Member, error) {
+	memberSet := make([]Member, 0)
+	err := db.SelectContext(ctx, &memberSet, db.Rebind(listMembersSql), teamId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("TeamID", teamId).WithError(err).Error("Failed to select team members")
+		return nil, err
+	}
+	return memberSet, nil
+}
+
+// SetMembership adds the user to the team, or updates their opt-in if they
+// are already a member. Returns ErrNotMember if the user holds no role in the
+// team's organization.
+func SetMembership(ctx context.Context, db *sqlx.DB, teamId, userId uint64, notify bool) error {
+	result, err := db.ExecContext(ctx, db.Rebind(upsertMemberSql), userId, notify, teamId, userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "SetMembership",
+			"TeamID":    teamId,
+			"UserID":    userId,
+		}).WithError(err).Error("Failed to save team membership")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// RemoveMember takes the user off the team. Returns sql.ErrNoRows if they
+// were not a member.
+func RemoveMember(ctx context.Context, db *sqlx.DB, teamId, userId uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(deleteMemberSql), teamId, userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "RemoveMember",
+			"TeamID":    teamId,
+			"UserID":    userId,
+		}).WithError(err).Error("Failed to delete team membership")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
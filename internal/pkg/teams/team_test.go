@@ -0,0 +1,29 @@
+package teams
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTeam_Validate(t *testing.T) {
+	if errSet := (Team{OrganizationId: 1, Name: "Tax Prep"}).Validate(); errSet != nil {
+		t.Errorf("Expected team to be valid, got %v", errSet)
+	}
+
+	testCases := map[string]struct {
+		team     Team
+		expected int
+	}{
+		"no organization": {Team{Name: "Tax Prep"}, 1},
+		"no name":         {Team{OrganizationId: 1, Name: "  "}, 1},
+		"only dashes":     {Team{OrganizationId: 1, Name: "--"}, 1},
+		"long name":       {Team{OrganizationId: 1, Name: strings.Repeat("a", MaxNameLength+1)}, 1},
+		"empty":           {Team{}, 2},
+	}
+	for name, tc := range testCases {
+		errSet := tc.team.Validate()
+		if errSet == nil || len(errSet.Errors) != tc.expected {
+			t.Errorf("%s: expected %d errors, got %v", name, tc.expected, errSet)
+		}
+	}
+}
@@ -18,6 +18,7 @@ func GetStandardConfig() config.ServiceConfig {
 		LogLevel:            "debug",
 		LogStyle:            "prettyjson",
 		Port:                8080,
+		PublicBaseURL:       "http://localhost:8080",
 		StaticContentPath:   "/web",
 		SwaggerFilePath:     "/apidocs.json",
 		APIPath:             "",
@@ -24,6 +24,40 @@ func CleanupTestDb(db *sqlx.DB) error {
 		"sites",
 		"site_coordinators",
 		"daily_schedules",
+		"shifts",
+		"shift_signups",
+		"user_availability_windows",
+		"user_blackout_dates",
+		"user_preferred_sites",
+		"work_logs",
+		"work_log_events",
+		"site_checkin_keys",
+		"kiosk_devices",
+		"certificates",
+		"suggestions",
+		"organization_blocked_terms",
+		"site_subscriptions",
+		"notifications",
+		"push_devices",
+		"undeliverable_emails",
+		"outbox_events",
+		"scheduled_jobs",
+		"shift_reminders",
+		"notification_preferences",
+		"notification_quiet_hours",
+		"notification_digests",
+		"broadcasts",
+		"broadcast_recipients",
+		"site_features",
+		"team_members",
+		"teams",
+		"webhook_deliveries",
+		"webhooks",
+		"organization_emergency_contacts",
+		"organization_settings",
+		"organization_memberships",
+		"impersonation_requests",
+		"impersonation_sessions",
 	}
 	//sqlStmt := db.Rebind("DROP TABLE ?")
 	for _, tableName := range tables {
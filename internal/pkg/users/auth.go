@@ -13,6 +13,54 @@ import (
 type Claims struct {
 	jwt.StandardClaims
 	Roles map[uint64][]RoleType `json:"orgs"`
+
+	// Act names who is really making requests with an impersonation token,
+	// as in RFC 8693. Subject and Roles are those of the impersonated user.
+	Act *Actor `json:"act,omitempty"`
+}
+
+// Actor is the real user behind an impersonation token.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// IsImpersonation reports whether the claims were issued for a site admin to
+// act as another user.
+func (c *Claims) IsImpersonation() bool {
+	return c != nil && c.Act != nil
+}
+
+// IsSiteAdmin reports whether the claims grant Volunteer-Savvy-wide admin
+// permissions. SiteAdmin roles are always granted on organization 0.
+func (c *Claims) IsSiteAdmin() bool {
+	if c == nil {
+		return false
+	}
+	for _, role := range c.Roles[0] {
+		if role == SiteAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the claims grant any of the given roles on the
+// organization. SiteAdmins are treated as holding every role.
+func (c *Claims) HasRole(orgId uint64, roles ...RoleType) bool {
+	if c == nil {
+		return false
+	}
+	if c.IsSiteAdmin() {
+		return true
+	}
+	for _, claimed := range c.Roles[orgId] {
+		for _, wanted := range roles {
+			if claimed == wanted {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func HashPassword(pwd []byte, cost int) (hash []byte, err error) {
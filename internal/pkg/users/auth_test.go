@@ -32,3 +32,35 @@ func TestCreateJWT(t *testing.T) {
 		t.Errorf("Expected 1 role on org 1. Got %d instead", len(claims.Roles[1]))
 	}
 }
+
+func TestClaims_HasRole(t *testing.T) {
+	claims := &Claims{
+		Roles: map[uint64][]RoleType{
+			1: {Volunteer},
+			2: {OrgAdmin},
+		},
+	}
+	if !claims.HasRole(2, OrgAdmin, SiteManager) {
+		t.Error("Expected OrgAdmin on org 2 to be granted")
+	}
+	if claims.HasRole(1, OrgAdmin) {
+		t.Error("Expected Volunteer on org 1 not to be granted OrgAdmin")
+	}
+	if claims.HasRole(3, Volunteer) {
+		t.Error("Expected no roles on org 3")
+	}
+
+	superAdmin := &Claims{
+		Roles: map[uint64][]RoleType{
+			0: {SiteAdmin},
+		},
+	}
+	if !superAdmin.HasRole(3, OrgAdmin) {
+		t.Error("Expected SiteAdmin to be granted every role")
+	}
+
+	var noClaims *Claims
+	if noClaims.HasRole(1, Volunteer) {
+		t.Error("Expected nil claims to be granted nothing")
+	}
+}
@@ -0,0 +1,387 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownSite is returned when saving preferences that name a site slug
+// that does not exist.
+var ErrUnknownSite = errors.New("unknown site")
+
+// AvailabilityWindow is a recurring weekly block of time when a volunteer is
+// willing to work.
+type AvailabilityWindow struct {
+	UserId uint64 `json:"-" db:"user_id"`
+	Dotw   string `json:"dotw" db:"dotw"`        // sunday, monday, ... saturday
+	Start  string `json:"start" db:"start_time"` // Expected format: HH:MM
+	End    string `json:"end" db:"end_time"`     // Expected format: HH:MM. "24:00" means end of day.
+}
+
+// Availability describes when and where a volunteer is willing to work.
+type Availability struct {
+	UserGuid string `json:"user_guid"`
+
+	// If no windows are set, the volunteer is treated as always available.
+	Windows          []AvailabilityWindow `json:"windows"`
+	BlackoutDates    []string             `json:"blackout_dates"`  // Expected format: YYYY-MM-DD
+	PreferredSites   []string             `json:"preferred_sites"` // site slugs
+	PreferredSiteIds []uint64             `json:"-"`
+	MaxHoursPerWeek  float64              `json:"max_hours_per_week"` // 0 means no cap
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// ParseDotw converts a day of the week name, as stored in dotw_type columns,
+// to a time.Weekday.
+func ParseDotw(dotw string) (time.Weekday, error) {
+	day, ok := weekdays[strings.ToLower(dotw)]
+	if !ok {
+		return 0, fmt.Errorf("invalid day of the week %q", dotw)
+	}
+	return day, nil
+}
+
+// ParseClock converts an "HH:MM" string to minutes after midnight. "24:00" is
+// accepted as the end of the day.
+func ParseClock(hhmm string) (int, error) {
+	parts := strings.Split(hhmm, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", hhmm)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %v", hhmm, err)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: %v", hhmm, err)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q: out of range", hhmm)
+	}
+	return h*60 + m, nil
+}
+
+// FormatClock converts minutes after midnight back to zero-padded "HH:MM".
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// Validate checks that the window names a real day and a non-empty time range.
+func (w AvailabilityWindow) Validate() error {
+	if _, err := ParseDotw(w.Dotw); err != nil {
+		return err
+	}
+	start, err := ParseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := ParseClock(w.End)
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return fmt.Errorf("window end %s must be after start %s", w.End, w.Start)
+	}
+	return nil
+}
+
+func (a Availability) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	for _, w := range a.Windows {
+		if err := w.Validate(); err != nil {
+			errSet = append(errSet, err)
+		}
+	}
+	for _, d := range a.BlackoutDates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			errSet = append(errSet, fmt.Errorf("invalid blackout date %q: expected YYYY-MM-DD", d))
+		}
+	}
+	if a.MaxHoursPerWeek < 0 {
+		errSet = append(errSet, errors.New("max_hours_per_week must not be negative"))
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+type blackoutRow struct {
+	UserId uint64 `db:"user_id"`
+	Date   string `db:"blackout_date"`
+}
+
+type preferredSiteRow struct {
+	UserId   uint64 `db:"user_id"`
+	SiteId   uint64 `db:"site_id"`
+	SiteSlug string `db:"slug"`
+}
+
+type maxHoursRow struct {
+	UserId          uint64  `db:"id"`
+	UserGuid        string  `db:"user_guid"`
+	MaxHoursPerWeek float64 `db:"max_hours_per_week"`
+}
+
+// ListAvailability loads the availability of every user in the set. Users
+// who have not saved any preferences are included with empty Availability.
+func ListAvailability(ctx context.Context, db *sqlx.DB, userIds []uint64) (map[uint64]*Availability, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListAvailability",
+	})
+
+	result := make(map[uint64]*Availability, len(userIds))
+	if len(userIds) == 0 {
+		return result, nil
+	}
+
+	var maxHours []maxHoursRow
+	sqlStmt, args, err := sqlx.In(`SELECT id, user_guid, max_hours_per_week FROM users WHERE id IN (?)`, userIds)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compile IN query")
+		return nil, err
+	}
+	if err = db.SelectContext(ctx, &maxHours, db.Rebind(sqlStmt), args...); err != nil {
+		logger.WithError(err).Error("Failed to select max hours")
+		return nil, err
+	}
+	for _, row := range maxHours {
+		result[row.UserId] = &Availability{
+			UserGuid:         row.UserGuid,
+			Windows:          make([]AvailabilityWindow, 0),
+			BlackoutDates:    make([]string, 0),
+			PreferredSites:   make([]string, 0),
+			PreferredSiteIds: make([]uint64, 0),
+			MaxHoursPerWeek:  row.MaxHoursPerWeek,
+		}
+	}
+
+	var windows []AvailabilityWindow
+	sqlStmt, args, err = sqlx.In(`
+		SELECT user_id, dotw, start_time, end_time FROM user_availability_windows
+		WHERE user_id IN (?) ORDER BY user_id, dotw, start_time`, userIds)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compile IN query")
+		return nil, err
+	}
+	if err = db.SelectContext(ctx, &windows, db.Rebind(sqlStmt), args...); err != nil {
+		logger.WithError(err).Error("Failed to select availability windows")
+		return nil, err
+	}
+	for _, w := range windows {
+		if a, ok := result[w.UserId]; ok {
+			a.Windows = append(a.Windows, w)
+		}
+	}
+
+	var blackouts []blackoutRow
+	sqlStmt, args, err = sqlx.In(`
+		SELECT user_id, to_char(blackout_date, 'YYYY-MM-DD') AS blackout_date FROM user_blackout_dates
+		WHERE user_id IN (?) ORDER BY user_id, blackout_date`, userIds)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compile IN query")
+		return nil, err
+	}
+	if err = db.SelectContext(ctx, &blackouts, db.Rebind(sqlStmt), args...); err != nil {
+		logger.WithError(err).Error("Failed to select blackout dates")
+		return nil, err
+	}
+	for _, b := range blackouts {
+		if a, ok := result[b.UserId]; ok {
+			a.BlackoutDates = append(a.BlackoutDates, b.Date)
+		}
+	}
+
+	var preferred []preferredSiteRow
+	sqlStmt, args, err = sqlx.In(`
+		SELECT user_preferred_sites.user_id, user_preferred_sites.site_id, sites.slug
+		FROM user_preferred_sites JOIN sites ON sites.id = user_preferred_sites.site_id
+		WHERE user_preferred_sites.user_id IN (?) ORDER BY user_preferred_sites.user_id, sites.slug`, userIds)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compile IN query")
+		return nil, err
+	}
+	if err = db.SelectContext(ctx, &preferred, db.Rebind(sqlStmt), args...); err != nil {
+		logger.WithError(err).Error("Failed to select preferred sites")
+		return nil, err
+	}
+	for _, p := range preferred {
+		if a, ok := result[p.UserId]; ok {
+			a.PreferredSites = append(a.PreferredSites, p.SiteSlug)
+			a.PreferredSiteIds = append(a.PreferredSiteIds, p.SiteId)
+		}
+	}
+
+	return result, nil
+}
+
+// GetAvailability loads a single user's availability.
+func (u *User) GetAvailability(ctx context.Context, db *sqlx.DB) (*Availability, error) {
+	set, err := ListAvailability(ctx, db, []uint64{u.Id})
+	if err != nil {
+		return nil, err
+	}
+	a, ok := set[u.Id]
+	if !ok {
+		return nil, fmt.Errorf("user %d not found", u.Id)
+	}
+	return a, nil
+}
+
+// SaveAvailability replaces the user's availability preferences. Preferred
+// sites are given by slug; unknown slugs are an error.
+func (u *User) SaveAvailability(ctx context.Context, db *sqlx.DB, a *Availability) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "User.SaveAvailability",
+		"UserGuid":  u.Guid,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+
+	statements := []string{
+		`DELETE FROM user_availability_windows WHERE user_id = ?`,
+		`DELETE FROM user_blackout_dates WHERE user_id = ?`,
+		`DELETE FROM user_preferred_sites WHERE user_id = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err = tx.ExecContext(ctx, tx.Rebind(stmt), u.Id); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("Failed to clear availability")
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, tx.Rebind(`UPDATE users SET max_hours_per_week = ? WHERE id = ?`), a.MaxHoursPerWeek, u.Id); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Error("Failed to update max hours")
+		return err
+	}
+
+	for i, w := range a.Windows {
+		// Normalize so that the stored strings compare correctly in SQL
+		start, _ := ParseClock(w.Start)
+		end, _ := ParseClock(w.End)
+		a.Windows[i].Dotw = strings.ToLower(w.Dotw)
+		a.Windows[i].Start = FormatClock(start)
+		a.Windows[i].End = FormatClock(end)
+		_, err = tx.ExecContext(ctx,
+			tx.Rebind(`INSERT INTO user_availability_windows (user_id, dotw, start_time, end_time) VALUES (?, ?, ?, ?)`),
+			u.Id, a.Windows[i].Dotw, a.Windows[i].Start, a.Windows[i].End)
+		if err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("Failed to insert availability window")
+			return err
+		}
+	}
+
+	for _, d := range a.BlackoutDates {
+		_, err = tx.ExecContext(ctx,
+			tx.Rebind(`INSERT INTO user_blackout_dates (user_id, blackout_date) VALUES (?, ?) ON CONFLICT DO NOTHING`),
+			u.Id, d)
+		if err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("Failed to insert blackout date")
+			return err
+		}
+	}
+
+	a.PreferredSiteIds = make([]uint64, 0, len(a.PreferredSites))
+	for _, slug := range a.PreferredSites {
+		var siteId uint64
+		err = tx.GetContext(ctx, &siteId, tx.Rebind(`SELECT id FROM sites WHERE slug = ?`), slug)
+		if err != nil {
+			tx.Rollback()
+			logger.WithField("SiteSlug", slug).WithError(err).Debug("Failed to find preferred site")
+			return fmt.Errorf("%w %q", ErrUnknownSite, slug)
+		}
+		_, err = tx.ExecContext(ctx,
+			tx.Rebind(`INSERT INTO user_preferred_sites (user_id, site_id) VALUES (?, ?) ON CONFLICT DO NOTHING`),
+			u.Id, siteId)
+		if err != nil {
+			tx.Rollback()
+			logger.WithError(err).Error("Failed to insert preferred site")
+			return err
+		}
+		a.PreferredSiteIds = append(a.PreferredSiteIds, siteId)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit availability")
+		return err
+	}
+
+	// Success!
+	a.UserGuid = u.Guid
+	return nil
+}
+
+// AvailableUser is a result row for ListAvailableUsers.
+type AvailableUser struct {
+	User
+	PrefersSite bool `json:"prefers_site" db:"prefers_site"`
+}
+
+const listAvailableUsersSql = `
+	SELECT
+		users.id, users.user_guid, users.email,
+		EXISTS (SELECT 1 FROM user_preferred_sites p WHERE p.user_id = users.id AND p.site_id = ?) AS prefers_site
+	FROM users JOIN organization_memberships m ON m.user_id = users.id
+	WHERE m.organization_id = ? AND m.status = 'active'
+		AND (
+			NOT EXISTS (SELECT 1 FROM user_availability_windows w WHERE w.user_id = users.id)
+			OR EXISTS (
+				SELECT 1 FROM user_availability_windows w
+				WHERE w.user_id = users.id AND w.dotw = ?::dotw_type AND w.start_time <= ? AND w.end_time >= ?
+			)
+		)
+		AND NOT EXISTS (SELECT 1 FROM user_blackout_dates b WHERE b.user_id = users.id AND b.blackout_date = ?)
+	ORDER BY prefers_site DESC, users.user_guid
+`
+
+// ListAvailableUsers finds the active members of an organization who are
+// willing to work at the site on the given day for the whole of [start, end),
+// given in minutes after midnight. Volunteers who listed the site as a
+// preference are sorted first, but volunteers who prefer other sites are
+// still included.
+func ListAvailableUsers(ctx context.Context, db *sqlx.DB, orgId, siteId uint64, day time.Time, start, end int) ([]AvailableUser, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "ListAvailableUsers",
+		"OrganizationID": orgId,
+		"SiteID":         siteId,
+	})
+
+	userSet := make([]AvailableUser, 0)
+	err := db.SelectContext(ctx, &userSet, db.Rebind(listAvailableUsersSql),
+		siteId, orgId, strings.ToLower(day.Weekday().String()), FormatClock(start), FormatClock(end), day.Format("2006-01-02"))
+	if err != nil {
+		logger.WithError(err).Error("Failed to select available users")
+		return nil, err
+	}
+	return userSet, nil
+}
@@ -0,0 +1,77 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	cases := map[string]int{
+		"00:00": 0,
+		"9:30":  570,
+		"09:30": 570,
+		"24:00": 1440,
+	}
+	for input, expected := range cases {
+		actual, err := ParseClock(input)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", input, err)
+		}
+		if actual != expected {
+			t.Errorf("Expected %s to parse to %d, got %d", input, expected, actual)
+		}
+	}
+	for _, input := range []string{"", "9", "25:00", "12:60", "24:30", "ab:cd"} {
+		if _, err := ParseClock(input); err == nil {
+			t.Errorf("Expected an error parsing %q", input)
+		}
+	}
+
+	if FormatClock(570) != "09:30" {
+		t.Errorf("Expected 570 to format as 09:30, got %s", FormatClock(570))
+	}
+}
+
+func TestAvailability_Validate(t *testing.T) {
+	valid := Availability{
+		Windows: []AvailabilityWindow{
+			{Dotw: "Monday", Start: "09:00", End: "17:00"},
+			{Dotw: "saturday", Start: "10:00", End: "24:00"},
+		},
+		BlackoutDates:   []string{"2020-02-14"},
+		MaxHoursPerWeek: 20,
+	}
+	if errs := valid.Validate(); errs != nil {
+		t.Errorf("Expected availability to be valid, got %v", errs)
+	}
+
+	invalid := Availability{
+		Windows: []AvailabilityWindow{
+			{Dotw: "someday", Start: "09:00", End: "17:00"},
+			{Dotw: "monday", Start: "17:00", End: "09:00"},
+		},
+		BlackoutDates:   []string{"02/14/2020"},
+		MaxHoursPerWeek: -1,
+	}
+	errs := invalid.Validate()
+	if errs == nil || len(errs.Errors) != 4 {
+		t.Errorf("Expected 4 validation errors, got %v", errs)
+	}
+}
+
+func (suite *UsersTestSuite) TestListAvailableUsers() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+	// A role left behind after user2 left testorg2 does not make them a member
+	_, err := db.Exec(`INSERT INTO roles (org_id, user_id, name) VALUES (2, 2, 2)`)
+	suite.Require().Nil(err)
+
+	available, err := ListAvailableUsers(ctx, db, 2, 0, time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC), 9*60, 12*60)
+	suite.Require().Nil(err)
+	guids := make([]string, 0, len(available))
+	for _, u := range available {
+		guids = append(guids, u.Guid)
+	}
+	suite.Equal([]string{"kit", "user3"}, guids)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"github.com/emicklei/go-restful"
 	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	log "github.com/sirupsen/logrus"
 	"net/http"
 	"strings"
 )
@@ -76,9 +77,13 @@ func (authConfig AuthConfig) ValidJwtFilter(req *restful.Request, resp *restful.
 		resp.WriteHeader(http.StatusForbidden)
 		return
 	}
+	logger = markImpersonation(req, claims, logger)
 	// Update the request context with the logged-in user ID
 	ctx = context.WithValue(ctx, "logger", logger)
 	req.SetAttribute("ctx", ctx)
+	if !impersonationAllowed(req, resp, claims, logger) {
+		return
+	}
 	req.SetAttribute("jwt", token)
 	req.SetAttribute("jwt.claims", claims)
 	req.SetAttribute("jwt.sub", claims.Subject)
@@ -86,6 +91,70 @@ func (authConfig AuthConfig) ValidJwtFilter(req *restful.Request, resp *restful.
 	chain.ProcessFilter(req, resp)
 }
 
+// OptionalJwtFilter attaches the caller's claims to the request when it
+// carries a valid bearer token, and otherwise lets it through anonymously.
+// Use it on endpoints that anyone may call but that behave differently for
+// logged-in users.
+func (authConfig AuthConfig) OptionalJwtFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	claims := authConfig.extractJWT(req)
+	if claims != nil {
+		ctx := filters.GetRequestContext(req)
+		logger := filters.GetContextLogger(ctx).WithField("jwt.sub", claims.Subject)
+		logger = markImpersonation(req, claims, logger)
+		ctx = context.WithValue(ctx, "logger", logger)
+		req.SetAttribute("ctx", ctx)
+		if !impersonationAllowed(req, resp, claims, logger) {
+			return
+		}
+		req.SetAttribute("jwt.claims", claims)
+		req.SetAttribute("jwt.sub", claims.Subject)
+	}
+	chain.ProcessFilter(req, resp)
+}
+
+// AllowImpersonation lets impersonation tokens through to a route that makes
+// changes, which they are otherwise refused. Add it before the JWT filter,
+// and only on routes that support staff may safely use as the user.
+func AllowImpersonation(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	req.SetAttribute("jwt.act.allowed", true)
+	chain.ProcessFilter(req, resp)
+}
+
+// markImpersonation records the real actor behind an impersonation token on
+// the request, for the request log and the audit trail, and in the logger's
+// fields.
+func markImpersonation(req *restful.Request, claims *Claims, logger *log.Entry) *log.Entry {
+	if !claims.IsImpersonation() {
+		return logger
+	}
+	req.SetAttribute("jwt.sub", claims.Subject)
+	req.SetAttribute("jwt.act", claims.Act.Subject)
+	req.SetAttribute("jwt.jti", claims.Id)
+	return logger.WithFields(log.Fields{
+		"jwt.act": claims.Act.Subject,
+		"jwt.jti": claims.Id,
+	})
+}
+
+// impersonationAllowed refuses impersonation tokens on routes that make
+// changes, unless the route allows them with AllowImpersonation. Only safe
+// methods are taken to be read-only. On refusal it writes the response.
+func impersonationAllowed(req *restful.Request, resp *restful.Response, claims *Claims, logger *log.Entry) bool {
+	if !claims.IsImpersonation() {
+		return true
+	}
+	switch req.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if allowed, _ := req.Attribute("jwt.act.allowed").(bool); allowed {
+		return true
+	}
+	logger.Warn("Refused impersonation token on a route that makes changes")
+	resp.WriteErrorString(http.StatusForbidden, "impersonation tokens may only be used to look, not to make changes")
+	return false
+}
+
 // RequiresSuperAdminFilter ensures that the logged-in user has SuperAdmin permissions.
 // You should add ValidJwtFilter before this one in the chain.
 func (authConfig AuthConfig) RequiresSuperAdminFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
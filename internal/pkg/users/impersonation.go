@@ -0,0 +1,176 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// ImpersonationDuration is how long an impersonation token lasts. It cannot
+// be renewed; support staff ask for another one, giving a reason again.
+const ImpersonationDuration = 15 * time.Minute
+
+const (
+	MaxImpersonationReasonLength = 512
+	maxAuditedPathLength         = 512
+)
+
+var ErrCannotImpersonate = errors.New("site admins may not be impersonated")
+
+// ImpersonationSession is the audit record of one impersonation token.
+type ImpersonationSession struct {
+	Id         string    `json:"id" db:"id"` // the token's jti
+	ActorGuid  string    `json:"actor_guid" db:"actor_guid"`
+	TargetGuid string    `json:"target_guid" db:"target_guid"`
+	Reason     string    `json:"reason" db:"reason"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Requests   int       `json:"requests" db:"requests"` // made with the token, including refused ones
+}
+
+// ImpersonatedRequest is the audit record of one request made with an
+// impersonation token.
+type ImpersonatedRequest struct {
+	Method     string    `json:"method" db:"method"`
+	Path       string    `json:"path" db:"path"`
+	StatusCode int       `json:"status_code" db:"status_code"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+const insertImpersonationSessionSql = `
+	INSERT INTO impersonation_sessions (id, actor_user_id, target_user_id, reason, expires_at)
+	SELECT ?, users.id, ?, ?, ? FROM users WHERE users.user_guid = ?
+	RETURNING created_at
+`
+const insertImpersonatedRequestSql = `
+	INSERT INTO impersonation_requests (session_id, method, path, status_code) VALUES (?, ?, ?, ?)
+`
+
+// Without a target user, every session is listed.
+const listImpersonationSessionsSql = `
+	SELECT
+		impersonation_sessions.id, actors.user_guid AS actor_guid, targets.user_guid AS target_guid,
+		impersonation_sessions.reason, impersonation_sessions.created_at, impersonation_sessions.expires_at,
+		(SELECT COUNT(*) FROM impersonation_requests WHERE impersonation_requests.session_id = impersonation_sessions.id) AS requests
+	FROM impersonation_sessions
+		INNER JOIN users AS actors ON actors.id = impersonation_sessions.actor_user_id
+		INNER JOIN users AS targets ON targets.id = impersonation_sessions.target_user_id
+	WHERE (? = '' OR targets.user_guid = ?)
+	ORDER BY impersonation_sessions.created_at DESC
+	LIMIT ?
+`
+const listImpersonatedRequestsSql = `
+	SELECT method, path, status_code, created_at FROM impersonation_requests
+	WHERE session_id = ?
+	ORDER BY id
+`
+
+// StartImpersonation records that the actor, a site admin, is about to act as
+// the target user, and returns the claims for a token that lets them. The
+// token carries the target's roles, and names the actor in its act claim.
+// Returns ErrCannotImpersonate if the target is a site admin too.
+func StartImpersonation(ctx context.Context, db *sqlx.DB, actorGuid string, target *User, reason string) (*ImpersonationSession, *Claims, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":  "StartImpersonation",
+		"ActorGuid":  actorGuid,
+		"TargetGuid": target.Guid,
+	})
+
+	roles, err := target.GetRoles(ctx, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, role := range roles[0] {
+		if role.Role == SiteAdmin {
+			return nil, nil, ErrCannotImpersonate
+		}
+	}
+
+	session := ImpersonationSession{
+		Id:         uuid.NewV4().String(),
+		ActorGuid:  actorGuid,
+		TargetGuid: target.Guid,
+		Reason:     reason,
+		ExpiresAt:  time.Now().Add(ImpersonationDuration),
+	}
+	err = db.GetContext(ctx, &session.CreatedAt, db.Rebind(insertImpersonationSessionSql),
+		session.Id, target.Id, reason, session.ExpiresAt, actorGuid)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record impersonation session")
+		return nil, nil, err
+	}
+
+	claims := CreateJWT(target, ImpersonationDuration)
+	claims.Id = session.Id
+	claims.ExpiresAt = session.ExpiresAt.Unix()
+	claims.Act = &Actor{Subject: actorGuid}
+
+	logger.WithField("SessionID", session.Id).Warn("Started impersonation")
+	return &session, claims, nil
+}
+
+// ListImpersonationSessions fetches the most recent impersonation sessions,
+// newest first, optionally only those acting as one user.
+func ListImpersonationSessions(ctx context.Context, db *sqlx.DB, targetGuid string, limit int) ([]ImpersonationSession, error) {
+	sessions := make([]ImpersonationSession, 0)
+	err := db.SelectContext(ctx, &sessions, db.Rebind(listImpersonationSessionsSql), targetGuid, targetGuid, limit)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("operation", "ListImpersonationSessions").WithError(err).Error("Failed to select impersonation sessions")
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// ListImpersonatedRequests fetches every request made during the session, in
+// the order they were made.
+func ListImpersonatedRequests(ctx context.Context, db *sqlx.DB, sessionId string) ([]ImpersonatedRequest, error) {
+	requests := make([]ImpersonatedRequest, 0)
+	err := db.SelectContext(ctx, &requests, db.Rebind(listImpersonatedRequestsSql), sessionId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ListImpersonatedRequests",
+			"SessionID": sessionId,
+		}).WithError(err).Error("Failed to select impersonated requests")
+		return nil, err
+	}
+	return requests, nil
+}
+
+// ImpersonationAuditor records every request made with an impersonation
+// token, along with how it was answered.
+type ImpersonationAuditor struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationAuditor(db *sqlx.DB) *ImpersonationAuditor {
+	return &ImpersonationAuditor{db: db}
+}
+
+// Filter records the request after it has been handled. Add it to every web
+// service, so that it runs around the routes' JWT filters and sees the
+// requests they refuse too.
+func (a *ImpersonationAuditor) Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	chain.ProcessFilter(req, resp)
+
+	sessionId, ok := req.Attribute("jwt.jti").(string)
+	if !ok || req.Attribute("jwt.act") == nil {
+		return
+	}
+	path := req.Request.URL.Path
+	if len(path) > maxAuditedPathLength {
+		path = path[:maxAuditedPathLength]
+	}
+	ctx := filters.GetRequestContext(req)
+	_, err := a.db.ExecContext(ctx, a.db.Rebind(insertImpersonatedRequestSql), sessionId, req.Request.Method, path, resp.StatusCode())
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ImpersonationAuditor.Filter",
+			"SessionID": sessionId,
+		}).WithError(err).Error("Failed to record impersonated request")
+	}
+}
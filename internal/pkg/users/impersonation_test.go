@@ -0,0 +1,68 @@
+package users
+
+import (
+	"encoding/json"
+	"github.com/emicklei/go-restful"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClaims_Act(t *testing.T) {
+	claims := CreateJWT(&User{Guid: "volunteer"}, ImpersonationDuration)
+	if claims.IsImpersonation() {
+		t.Error("Expected a login token not to be an impersonation")
+	}
+	claims.Act = &Actor{Subject: "support"}
+
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to encode claims: %v", err)
+	}
+	var raw map[string]interface{}
+	json.Unmarshal(encoded, &raw)
+	act, ok := raw["act"].(map[string]interface{})
+	if !ok || act["sub"] != "support" {
+		t.Errorf("Expected the actor in an RFC 8693 act claim, got %s", encoded)
+	}
+
+	var decoded Claims
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode claims: %v", err)
+	}
+	if !decoded.IsImpersonation() || decoded.Act.Subject != "support" || decoded.Subject != "volunteer" {
+		t.Errorf("Expected the impersonation to survive a round trip, got %+v", decoded)
+	}
+}
+
+func TestImpersonationAllowed(t *testing.T) {
+	impersonation := &Claims{Act: &Actor{Subject: "support"}}
+	logger := logrus.NewEntry(logrus.New())
+	testCases := []struct {
+		method   string
+		claims   *Claims
+		allowed  bool // by AllowImpersonation
+		expected bool
+	}{
+		{http.MethodGet, impersonation, false, true},
+		{http.MethodPost, impersonation, false, false},
+		{http.MethodDelete, impersonation, false, false},
+		{http.MethodPost, impersonation, true, true},
+		{http.MethodDelete, &Claims{}, false, true},
+	}
+	for _, tc := range testCases {
+		req := restful.NewRequest(httptest.NewRequest(tc.method, "/", nil))
+		if tc.allowed {
+			AllowImpersonation(req, nil, &restful.FilterChain{Target: func(*restful.Request, *restful.Response) {}})
+		}
+		recorder := httptest.NewRecorder()
+		resp := restful.NewResponse(recorder)
+		if got := impersonationAllowed(req, resp, tc.claims, logger); got != tc.expected {
+			t.Errorf("%s (impersonation: %t, allowed: %t): expected %t, got %t", tc.method, tc.claims.IsImpersonation(), tc.allowed, tc.expected, got)
+		}
+		if !tc.expected && recorder.Code != http.StatusForbidden {
+			t.Errorf("%s: expected a refused request to be forbidden, got %d", tc.method, recorder.Code)
+		}
+	}
+}
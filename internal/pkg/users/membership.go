@@ -0,0 +1,228 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Membership states. A user who leaves an organization keeps the record of
+// having been a member, so that its history still makes sense.
+const (
+	MembershipActive = "active"
+	MembershipLeft   = "left"
+)
+
+var ErrLastAdmin = errors.New("the last admin of an organization may not leave it")
+
+// Membership is a user's place in one organization.
+type Membership struct {
+	OrganizationId   uint64        `json:"organization_id" db:"organization_id"`
+	OrganizationName string        `json:"organization_name" db:"organization_name"`
+	OrganizationSlug string        `json:"organization_slug" db:"organization_slug"`
+	Status           string        `json:"status" db:"status"`
+	Roles            pq.Int64Array `json:"roles" db:"roles"` // RoleTypes, empty once they have left
+	JoinedAt         time.Time     `json:"joined_at" db:"joined_at"`
+	LeftAt           *time.Time    `json:"left_at,omitempty" db:"left_at"`
+}
+
+// Deleted organizations are left out.
+const listMembershipsSql = `
+	SELECT
+		organization_memberships.organization_id, organizations.name AS organization_name,
+		organizations.slug AS organization_slug, organization_memberships.status,
+		ARRAY(SELECT roles.name FROM roles
+			WHERE roles.org_id = organization_memberships.organization_id AND roles.user_id = organization_memberships.user_id
+			ORDER BY roles.name) AS roles,
+		organization_memberships.joined_at, organization_memberships.left_at
+	FROM organization_memberships
+		INNER JOIN organizations ON organizations.id = organization_memberships.organization_id
+	WHERE organization_memberships.user_id = ? AND organizations.deleted_at IS NULL
+	ORDER BY organization_memberships.status, organization_memberships.joined_at
+`
+
+// Rejoining after leaving starts a new membership.
+const upsertMembershipSql = `
+	INSERT INTO organization_memberships (organization_id, user_id) VALUES (?, ?)
+	ON CONFLICT (organization_id, user_id) DO UPDATE SET status = 'active', joined_at = now(), left_at = NULL
+		WHERE organization_memberships.status <> 'active'
+`
+const grantVolunteerSql = `
+	INSERT INTO roles (org_id, user_id, name) VALUES (?, ?, ?)
+	ON CONFLICT (user_id, org_id, name) DO NOTHING
+`
+const setDefaultOrganizationSql = `UPDATE users SET organization_id = ? WHERE id = ? AND organization_id IS NULL`
+
+const lockMembershipSql = `
+	SELECT status FROM organization_memberships WHERE organization_id = ? AND user_id = ? FOR UPDATE
+`
+
+const isActiveMemberSql = `
+	SELECT EXISTS (SELECT 1 FROM organization_memberships WHERE organization_id = ? AND user_id = ? AND status = 'active')
+`
+
+const hasRoleSql = `SELECT EXISTS (SELECT 1 FROM roles WHERE org_id = ? AND user_id = ? AND name = ?)`
+
+// Admins are counted among the organization's active members only.
+const countOtherAdminsSql = `
+	SELECT COUNT(*) FROM roles
+		INNER JOIN organization_memberships ON organization_memberships.organization_id = roles.org_id
+			AND organization_memberships.user_id = roles.user_id
+	WHERE roles.org_id = ? AND roles.user_id <> ? AND roles.name = ? AND organization_memberships.status = 'active'
+`
+
+// Each statement takes the organization ID and then the user ID.
+var leaveOrganizationSql = []string{
+	`UPDATE organization_memberships SET status = 'left', left_at = now() WHERE organization_id = ? AND user_id = ?`,
+	`DELETE FROM roles WHERE org_id = ? AND user_id = ?`,
+	`DELETE FROM team_members WHERE team_id IN (SELECT id FROM teams WHERE organization_id = ?) AND user_id = ?`,
+	// Fall back to whichever of their other organizations they joined first
+	`UPDATE users SET organization_id = (
+		SELECT organization_memberships.organization_id FROM organization_memberships
+		WHERE organization_memberships.user_id = users.id AND organization_memberships.status = 'active'
+		ORDER BY organization_memberships.joined_at LIMIT 1)
+	WHERE organization_id = ? AND id = ?`,
+}
+
+// ListMemberships fetches every organization the user belongs to, or used
+// to, with their roles in each. Active memberships come first.
+func ListMemberships(ctx context.Context, db *sqlx.DB, userId uint64) ([]Membership, error) {
+	memberships := make([]Membership, 0)
+	err := db.SelectContext(ctx, &memberships, db.Rebind(listMembershipsSql), userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ListMemberships",
+			"UserID":    userId,
+		}).WithError(err).Error("Failed to select memberships")
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// IsActiveMember reports whether the user currently belongs to the
+// organization.
+func IsActiveMember(ctx context.Context, db *sqlx.DB, orgId, userId uint64) (bool, error) {
+	var isMember bool
+	err := db.GetContext(ctx, &isMember, db.Rebind(isActiveMemberSql), orgId, userId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation":      "IsActiveMember",
+			"OrganizationID": orgId,
+			"UserID":         userId,
+		}).WithError(err).Error("Failed to check membership")
+		return false, err
+	}
+	return isMember, nil
+}
+
+// AddMembership makes the user an active member of the organization, as a
+// Volunteer, if they are not one already. Someone who left and comes back
+// starts a new membership. Each new membership records EventUserCreated.
+func AddMembership(ctx context.Context, tx *sqlx.Tx, orgId, userId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "AddMembership",
+		"OrganizationID": orgId,
+		"UserID":         userId,
+	})
+
+	res, err := tx.ExecContext(ctx, tx.Rebind(upsertMembershipSql), orgId, userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to add membership")
+		return err
+	}
+	joined, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if joined > 0 {
+		err = outbox.Enqueue(ctx, tx, EventUserCreated, UserEvent{
+			UserId:         userId,
+			OrganizationId: orgId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(grantVolunteerSql), orgId, userId, Volunteer)
+	if err != nil {
+		logger.WithError(err).Error("Failed to grant volunteer role")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(setDefaultOrganizationSql), orgId, userId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to set default organization")
+		return err
+	}
+	return nil
+}
+
+// LeaveOrganization ends the user's membership of the organization, and
+// takes away their roles and teams in it. Their work logs and signups are
+// kept. Returns sql.ErrNoRows if they are not an active member, or
+// ErrLastAdmin if nobody else could administer the organization after them.
+func LeaveOrganization(ctx context.Context, db *sqlx.DB, orgId, userId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "LeaveOrganization",
+		"OrganizationID": orgId,
+		"UserID":         userId,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.GetContext(ctx, &status, tx.Rebind(lockMembershipSql), orgId, userId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.WithError(err).Error("Failed to lock membership")
+		}
+		return err
+	}
+	if status != MembershipActive {
+		return sql.ErrNoRows
+	}
+
+	var isAdmin bool
+	err = tx.GetContext(ctx, &isAdmin, tx.Rebind(hasRoleSql), orgId, userId, OrgAdmin)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check roles")
+		return err
+	}
+	if isAdmin {
+		var otherAdmins int
+		err = tx.GetContext(ctx, &otherAdmins, tx.Rebind(countOtherAdminsSql), orgId, userId, OrgAdmin)
+		if err != nil {
+			logger.WithError(err).Error("Failed to count admins")
+			return err
+		}
+		if otherAdmins == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	for _, stmt := range leaveOrganizationSql {
+		_, err = tx.ExecContext(ctx, tx.Rebind(stmt), orgId, userId)
+		if err != nil {
+			logger.WithError(err).WithField("SQL", stmt).Error("Failed to leave organization")
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit leaving organization")
+		return err
+	}
+
+	// Success!
+	return nil
+}
@@ -0,0 +1,67 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (suite *UsersTestSuite) TestListMemberships() {
+	memberships, err := ListMemberships(context.Background(), suite.Config.GetDbConn(), 2)
+	suite.Require().Nilf(err, "Expected no error from ListMemberships. Got %+v", err)
+	suite.Require().Len(memberships, 2, "Expected user2's current and past memberships")
+	suite.Equal(uint64(1), memberships[0].OrganizationId, "Expected the active membership first")
+	suite.Equal(MembershipActive, memberships[0].Status)
+	suite.Equal([]int64{int64(Volunteer)}, []int64(memberships[0].Roles))
+	suite.Equal(MembershipLeft, memberships[1].Status)
+}
+
+func (suite *UsersTestSuite) TestIsActiveMember() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+
+	isMember, err := IsActiveMember(ctx, db, 1, 2)
+	suite.Nil(err)
+	suite.True(isMember, "Expected user2 to be a member of testorg1")
+	isMember, err = IsActiveMember(ctx, db, 2, 2)
+	suite.Nil(err)
+	suite.False(isMember, "Expected user2 not to be a member of testorg2 after leaving it")
+}
+
+func (suite *UsersTestSuite) TestLeaveOrganization() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+
+	suite.Equal(ErrLastAdmin, LeaveOrganization(ctx, db, 1, 1), "Expected the only admin of testorg1 not to be allowed to leave")
+	suite.Equal(sql.ErrNoRows, LeaveOrganization(ctx, db, 2, 2), "Expected a former member not to be able to leave again")
+
+	suite.Nil(LeaveOrganization(ctx, db, 1, 2), "Expected a volunteer to be able to leave")
+	u := User{Id: 2, Guid: "user2"}
+	roles, err := u.GetRoles(ctx, db)
+	suite.Nil(err)
+	suite.Empty(roles, "Expected user2's roles to be taken away")
+
+	claims := Claims{Roles: map[uint64][]RoleType{1: {OrgAdmin}}}
+	userSet, err := ListUsersInSameOrgs(ctx, &claims, db)
+	suite.Nil(err)
+	suite.False(userInSet("user2", userSet), "Expected user2 not to be listed with testorg1 after leaving it")
+}
+
+func (suite *UsersTestSuite) TestAddMembership() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+	countEvents := func() int {
+		var n int
+		err := db.GetContext(ctx, &n, db.Rebind(`SELECT COUNT(*) FROM outbox_events WHERE event_type = ? AND payload->>'user_id' = '2'`), EventUserCreated)
+		suite.Require().Nil(err)
+		return n
+	}
+	before := countEvents()
+
+	for i := 0; i < 2; i++ {
+		tx, err := db.BeginTxx(ctx, nil)
+		suite.Require().Nil(err)
+		suite.Nil(AddMembership(ctx, tx, 2, 2), "Expected user2 to be able to rejoin testorg2")
+		suite.Require().Nil(tx.Commit())
+	}
+	suite.Equal(before+1, countEvents(), "Expected one event for rejoining, and none for joining again while a member")
+}
@@ -18,3 +18,22 @@ type Role struct {
 	UserGuid string   `json:"user_guid"`
 	Role     RoleType `json:"name" db:"name"`
 }
+
+// MemberRoles are the roles that make a user a member of an Organization.
+var MemberRoles = []RoleType{OrgAdmin, Volunteer, SiteManager, BackOffice, Mobile}
+
+var roleNames = map[RoleType]string{
+	SiteAdmin:   "SiteAdmin",
+	OrgAdmin:    "OrgAdmin",
+	Volunteer:   "Volunteer",
+	SiteManager: "SiteManager",
+	BackOffice:  "BackOffice",
+	Mobile:      "Mobile",
+}
+
+func (r RoleType) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "Unknown"
+}
@@ -15,6 +15,8 @@ func (server *UserServer) GetAuthAPI() *restful.WebService {
 
 	service := new(restful.WebService)
 	service.Path(server.Config.BasePath + "/auth").ApiVersion(server.ApiVersion).Doc("Volunteer-Savvy Backend")
+	_, publicKey := server.Config.GetJWTKeys()
+	authConfig := users.AuthConfig{PublicKey: publicKey}
 
 	//
 	// Auth APIs
@@ -28,6 +30,40 @@ func (server *UserServer) GetAuthAPI() *restful.WebService {
 			Writes(AccessTokenResponse{}).
 			Returns(http.StatusOK, "Successfully logged in.", AccessTokenResponse{}).
 			Returns(http.StatusUnauthorized, "Email/password combination did not match.", nil))
+	service.Route(
+		service.POST("/impersonate").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ImpersonateHandler).
+			Doc("Site admins only. Returns a short-lived token acting as another user, for support. It may only be used to look, except on routes that allow it, and everything done with it is audited").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(ImpersonateRequest{}).
+			Writes(ImpersonateResponse{}).
+			Returns(http.StatusOK, "Impersonation token issued", ImpersonateResponse{}).
+			Returns(http.StatusBadRequest, "A reason must be given, and site admins may not be impersonated", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a site admin", nil).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.GET("/impersonations").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListImpersonationsHandler).
+			Doc("Site admins only. List impersonation tokens issued, newest first").
+			Param(restful.QueryParameter("user_guid", "Only those acting as this user")).
+			Param(restful.QueryParameter("limit", "At most this many. Defaults to 50")).
+			Produces(restful.MIME_JSON).
+			Writes(ListImpersonationsResponse{}).
+			Returns(http.StatusOK, "Fetched impersonation sessions", ListImpersonationsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a site admin", nil))
+	service.Route(
+		service.GET("/impersonations/{sessionId}/requests").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListImpersonatedRequestsHandler).
+			Doc("Site admins only. List every request made with an impersonation token, including refused ones").
+			Param(restful.PathParameter("sessionId", "ID taken from ListImpersonations")).
+			Produces(restful.MIME_JSON).
+			Writes(ListImpersonatedRequestsResponse{}).
+			Returns(http.StatusOK, "Fetched impersonated requests", ListImpersonatedRequestsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user is not a site admin", nil))
 
 	return service
 }
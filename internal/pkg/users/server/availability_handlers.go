@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type ListAvailableUsersResponse struct {
+	Users []users.AvailableUser `json:"users"`
+}
+
+// canManageUser reports whether the logged-in user may read and edit the
+// target user's profile: either it is their own, or they are an OrgAdmin in
+// one of the target's organizations.
+func (server *UserServer) canManageUser(ctx context.Context, claims *users.Claims, target *users.User) (bool, error) {
+	if claims == nil {
+		return false, nil
+	}
+	if claims.Subject == target.Guid || claims.IsSiteAdmin() {
+		return true, nil
+	}
+	roles, err := target.GetRoles(ctx, server.Config.GetDbConn())
+	if err != nil {
+		return false, err
+	}
+	for orgId := range roles {
+		if claims.HasRole(orgId, users.OrgAdmin) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findManageableUser loads the user named in the userGuid path parameter and
+// checks that the logged-in user may manage them. On failure it writes the
+// response and returns nil.
+func (server *UserServer) findManageableUser(request *restful.Request, response *restful.Response, logger *log.Entry) *users.User {
+	ctx := filters.GetRequestContext(request)
+	target, err := users.GetUserByGuid(ctx, request.PathParameter("userGuid"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if target == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	allowed, err := server.canManageUser(ctx, users.GetRequestJWTClaims(request), target)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check permissions")
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if !allowed {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return target
+}
+
+func (server *UserServer) GetAvailabilityHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "GetAvailabilityHandler",
+		"UserGuid":  request.PathParameter("userGuid"),
+	})
+
+	target := server.findManageableUser(request, response, logger)
+	if target == nil {
+		return
+	}
+
+	availability, err := target.GetAvailability(ctx, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(availability)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize availability")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *UserServer) UpdateAvailabilityHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "UpdateAvailabilityHandler",
+		"UserGuid":  request.PathParameter("userGuid"),
+	})
+
+	target := server.findManageableUser(request, response, logger)
+	if target == nil {
+		return
+	}
+
+	var availability users.Availability
+	err := request.ReadEntity(&availability)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize availability")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	errorSet := availability.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Availability is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+
+	err = target.SaveAvailability(ctx, server.Config.GetDbConn(), &availability)
+	if err != nil {
+		if errors.Is(err, users.ErrUnknownSite) {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(availability)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize availability")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *UserServer) ListAvailableUsersHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListAvailableUsersHandler",
+		"SiteSlug":  request.QueryParameter("site"),
+	})
+
+	// Validate the query before touching the database
+	day, err := time.Parse("2006-01-02", request.QueryParameter("date"))
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "date must be given as YYYY-MM-DD")
+		return
+	}
+	window := users.AvailabilityWindow{
+		Dotw:  day.Weekday().String(),
+		Start: request.QueryParameter("start"),
+		End:   request.QueryParameter("end"),
+	}
+	if err = window.Validate(); err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+	start, _ := users.ParseClock(window.Start)
+	end, _ := users.ParseClock(window.End)
+
+	site, err := sites.FindSite(ctx, request.QueryParameter("site"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.HasRole(site.OrganizationId, users.OrgAdmin, users.SiteManager) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	userSet, err := users.ListAvailableUsers(ctx, server.Config.GetDbConn(), site.OrganizationId, site.Id, day, start, end)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListAvailableUsersResponse{Users: userSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize users")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
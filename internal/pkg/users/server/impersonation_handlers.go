@@ -0,0 +1,166 @@
+package server
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultImpersonationLimit = 50
+	maxImpersonationLimit     = 500
+)
+
+type ImpersonateRequest struct {
+	UserGuid string `json:"user_guid"`
+	Reason   string `json:"reason"` // such as the support ticket, kept in the audit trail
+}
+
+type ImpersonateResponse struct {
+	AccessTokenResponse
+	Session users.ImpersonationSession `json:"session"`
+}
+
+type ListImpersonationsResponse struct {
+	Sessions []users.ImpersonationSession `json:"sessions"`
+}
+
+type ListImpersonatedRequestsResponse struct {
+	Requests []users.ImpersonatedRequest `json:"requests"`
+}
+
+func (server *UserServer) ImpersonateHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ImpersonateHandler",
+	})
+
+	claims := users.GetRequestJWTClaims(request)
+	if !claims.IsSiteAdmin() || claims.IsImpersonation() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var req ImpersonateRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) == 0 || len(req.Reason) > users.MaxImpersonationReasonLength {
+		response.WriteErrorString(http.StatusBadRequest, "reason must be present, and at most 512 characters")
+		return
+	}
+	logger = logger.WithField("TargetGuid", req.UserGuid)
+
+	target, err := users.GetUserByGuid(ctx, req.UserGuid, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	session, impersonationClaims, err := users.StartImpersonation(ctx, server.Config.GetDbConn(), claims.Subject, target, req.Reason)
+	if err != nil {
+		if err == users.ErrCannotImpersonate {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	privateKey, _ := server.Config.GetJWTKeys()
+	if privateKey == nil {
+		logger.Error("Failed to load JWT Keys")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodRS512, impersonationClaims).SignedString(privateKey)
+	if err != nil {
+		logger.WithError(err).Error("Failed to sign JWT")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ImpersonateResponse{
+		AccessTokenResponse: AccessTokenResponse{
+			AccessToken: tokenString,
+			ExpiresIn:   uint(users.ImpersonationDuration.Seconds()),
+			Permissions: target.Roles,
+		},
+		Session: *session,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize response body")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *UserServer) ListImpersonationsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "ListImpersonationsHandler",
+		"UserGuid.input": request.QueryParameter("user_guid"),
+	})
+
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	limit := defaultImpersonationLimit
+	if param := request.QueryParameter("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxImpersonationLimit {
+			response.WriteErrorString(http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+
+	sessions, err := users.ListImpersonationSessions(ctx, server.Config.GetDbConn(), request.QueryParameter("user_guid"), limit)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListImpersonationsResponse{Sessions: sessions})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize impersonation sessions")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *UserServer) ListImpersonatedRequestsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "ListImpersonatedRequestsHandler",
+		"SessionID.input": request.PathParameter("sessionId"),
+	})
+
+	if !users.GetRequestJWTClaims(request).IsSiteAdmin() {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	requests, err := users.ListImpersonatedRequests(ctx, server.Config.GetDbConn(), request.PathParameter("sessionId"))
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListImpersonatedRequestsResponse{Requests: requests})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize impersonated requests")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
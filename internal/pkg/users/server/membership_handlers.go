@@ -0,0 +1,139 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+type ListMembershipsResponse struct {
+	Memberships []users.Membership `json:"memberships"`
+}
+
+type JoinOrganizationRequest struct {
+	Authcode string `json:"authcode"`
+}
+
+// findSelf loads the user named in the userGuid path parameter and checks
+// that it is the logged-in user, or that they are a site admin. On failure it
+// writes the response and returns nil.
+func (server *UserServer) findSelf(request *restful.Request, response *restful.Response, allowSiteAdmin bool) *users.User {
+	ctx := filters.GetRequestContext(request)
+	claims := users.GetRequestJWTClaims(request)
+	guid := request.PathParameter("userGuid")
+	if claims == nil || (claims.Subject != guid && !(allowSiteAdmin && claims.IsSiteAdmin())) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	target, err := users.GetUserByGuid(ctx, guid, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if target == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	return target
+}
+
+func (server *UserServer) writeMemberships(request *restful.Request, response *restful.Response, logger *log.Entry, userId uint64) {
+	memberships, err := users.ListMemberships(filters.GetRequestContext(request), server.Config.GetDbConn(), userId)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListMembershipsResponse{Memberships: memberships})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize memberships")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *UserServer) ListMembershipsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListMembershipsHandler",
+		"UserGuid":  request.PathParameter("userGuid"),
+	})
+
+	target := server.findManageableUser(request, response, logger)
+	if target == nil {
+		return
+	}
+	server.writeMemberships(request, response, logger, target.Id)
+}
+
+func (server *UserServer) JoinOrganizationHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "JoinOrganizationHandler",
+		"UserGuid":  request.PathParameter("userGuid"),
+	})
+
+	target := server.findSelf(request, response, false)
+	if target == nil {
+		return
+	}
+
+	var req JoinOrganizationRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Authcode) == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "authcode must be present")
+		return
+	}
+
+	_, err = organizations.JoinOrganization(ctx, server.Config.GetDbConn(), target.Id, req.Authcode)
+	if err != nil {
+		if err == organizations.ErrInvalidAuthcode {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	server.writeMemberships(request, response, logger, target.Id)
+}
+
+func (server *UserServer) LeaveOrganizationHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "LeaveOrganizationHandler",
+		"UserGuid":             request.PathParameter("userGuid"),
+		"OrganizationID.input": request.PathParameter("organizationID"),
+	})
+
+	orgId, err := strconv.ParseUint(request.PathParameter("organizationID"), 10, 64)
+	if err != nil || orgId == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	target := server.findSelf(request, response, true)
+	if target == nil {
+		return
+	}
+
+	err = users.LeaveOrganization(ctx, server.Config.GetDbConn(), orgId, target.Id)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			response.WriteErrorString(http.StatusNotFound, "not a member of this organization")
+		case users.ErrLastAdmin:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	server.writeMemberships(request, response, logger, target.Id)
+}
@@ -36,6 +36,82 @@ func (server *UserServer) GetUsersAPI() *restful.WebService {
 			Produces(restful.MIME_JSON).
 			Writes(ListUsersResponse{}).
 			Returns(http.StatusOK, "Got list of users", ListUsersResponse{}))
+	service.Route(
+		service.GET("/available").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListAvailableUsersHandler).
+			Doc("Find volunteers available to work at a site on a date between two times").
+			Param(restful.QueryParameter("site", "Site slug")).
+			Param(restful.QueryParameter("date", "YYYY-MM-DD")).
+			Param(restful.QueryParameter("start", "HH:MM")).
+			Param(restful.QueryParameter("end", "HH:MM")).
+			Produces(restful.MIME_JSON).
+			Writes(ListAvailableUsersResponse{}).
+			Returns(http.StatusOK, "Got list of available users", ListAvailableUsersResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user does not coordinate the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.GET("/{userGuid}/availability").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.GetAvailabilityHandler).
+			Doc("Fetch a user's availability preferences").
+			Param(restful.PathParameter("userGuid", "User GUID")).
+			Produces(restful.MIME_JSON).
+			Writes(users.Availability{}).
+			Returns(http.StatusOK, "Fetched availability", users.Availability{}).
+			Returns(http.StatusForbidden, "Logged-in user may not view this user", nil).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.PUT("/{userGuid}/availability").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UpdateAvailabilityHandler).
+			Doc("Replace a user's availability preferences").
+			Param(restful.PathParameter("userGuid", "User GUID")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(users.Availability{}).
+			Writes(users.Availability{}).
+			Returns(http.StatusOK, "Availability updated", users.Availability{}).
+			Returns(http.StatusBadRequest, "Invalid availability", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not edit this user", nil).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.GET("/{userGuid}/organizations").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListMembershipsHandler).
+			Doc("List the organizations a user belongs to, or used to, with their roles in each").
+			Param(restful.PathParameter("userGuid", "User GUID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListMembershipsResponse{}).
+			Returns(http.StatusOK, "Fetched memberships", ListMembershipsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user may not view this user", nil).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.POST("/{userGuid}/organizations").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.JoinOrganizationHandler).
+			Doc("Join the organization an authcode belongs to, as a Volunteer. Log in again for the new role to be in the token").
+			Param(restful.PathParameter("userGuid", "User GUID of the logged-in user")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(JoinOrganizationRequest{}).
+			Writes(ListMembershipsResponse{}).
+			Returns(http.StatusOK, "Joined organization", ListMembershipsResponse{}).
+			Returns(http.StatusBadRequest, "The authcode is wrong, expired or used up", nil).
+			Returns(http.StatusForbidden, "Users may only join organizations themselves", nil))
+	service.Route(
+		service.DELETE("/{userGuid}/organizations/{organizationID}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.LeaveOrganizationHandler).
+			Doc("Leave an organization, giving up the roles and teams in it. Work logs and signups are kept").
+			Param(restful.PathParameter("userGuid", "User GUID of the logged-in user")).
+			Param(restful.PathParameter("organizationID", "Organization ID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListMembershipsResponse{}).
+			Returns(http.StatusOK, "Left organization", ListMembershipsResponse{}).
+			Returns(http.StatusForbidden, "Users may only leave organizations themselves, unless a site admin", nil).
+			Returns(http.StatusNotFound, "Not a member of the organization", nil).
+			Returns(http.StatusConflict, "The last admin of an organization may not leave it", nil))
 	//service.Route(
 	//	service.GET("/{userGuid}").
 	//		Filter(filters.ValidJwtFilter).
@@ -6,10 +6,10 @@ INSERT INTO users (id, user_guid, email, password_digest) VALUES
     , (4, 'user4', 'user4@example.org', '$2a$04$tGTAu2Rit8j6QAjyVeshg.rrX3rDulbXxsErP3eEOMfla1/g//p6C')
 ;
 
-INSERT INTO organizations (id, name, slug, authcode) VALUES
-    (1, 'testorg1', 'testorg1', 'testorg1')
-    , (2, 'testorg2', 'testorg2', 'testorg2')
-    , (3, 'testorg3', 'testorg3', 'testorg3')
+INSERT INTO organizations (id, name, slug, authcode_hash) VALUES
+    (1, 'testorg1', 'testorg1', sha256('testorg1'))
+    , (2, 'testorg2', 'testorg2', sha256('testorg2'))
+    , (3, 'testorg3', 'testorg3', sha256('testorg3'))
 ;
 
 INSERT INTO roles (id, org_id, user_id, name) VALUES
@@ -18,4 +18,12 @@ INSERT INTO roles (id, org_id, user_id, name) VALUES
     , (3, 1, 2, 2) -- user2, testorg1, Volunteer
     , (4, 2, 3, 2) -- user3, testorg2, Volunteer
     , (5, 3, 4, 2) -- user4, testorg3, Volunteer
-;
\ No newline at end of file
+;
+INSERT INTO organization_memberships (organization_id, user_id, status) VALUES
+    (1, 1, 'active') -- kit, testorg1
+    , (2, 1, 'active') -- kit, testorg2
+    , (1, 2, 'active') -- user2, testorg1
+    , (2, 3, 'active') -- user3, testorg2
+    , (3, 4, 'active') -- user4, testorg3
+    , (2, 2, 'left') -- user2 used to be in testorg2
+;
@@ -18,6 +18,16 @@ type User struct {
 	Roles map[uint64][]Role `json:"roles"` // the map key is the organization ID
 }
 
+// EventUserCreated is the type of the outbox event recorded when a user
+// joins an organization, so that its admins hear about it.
+const EventUserCreated = "user.created"
+
+// UserEvent is the payload of EventUserCreated.
+type UserEvent struct {
+	UserId         uint64 `json:"user_id"`
+	OrganizationId uint64 `json:"organization_id"`
+}
+
 // FindUser queries the database for the user and all other data needed to
 // display their profile.
 func FindUser(ctx context.Context, email string, db *sqlx.DB) (*User, error) {
@@ -50,6 +60,29 @@ func GetUserForLogin(ctx context.Context, email string, db *sqlx.DB) (*User, err
 	return &u, nil
 }
 
+// GetUserByGuid looks up a user by their public GUID. Returns nil if no such
+// user exists.
+func GetUserByGuid(ctx context.Context, guid string, db *sqlx.DB) (*User, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "GetUserByGuid",
+		"UserGuid":  guid,
+	})
+
+	var u User
+	sqlStmt := db.Rebind(`SELECT id, user_guid, email FROM users WHERE user_guid = ?`)
+	err := db.Get(&u, sqlStmt, guid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.WithError(err).Error("Failed to select user with guid")
+		return nil, err
+	}
+
+	// Success!
+	return &u, nil
+}
+
 // GetUserRoles fetches all permissions granted to the user, sorted by the
 // Organization ID they are granted on. If an Organization ID is not found
 // among the keys, the user does not have any access to that org.
@@ -112,12 +145,13 @@ func ListUsersInSameOrgs(ctx context.Context, jwtClaims *Claims, db *sqlx.DB) ([
 	logger = logger.WithField("OrgIdSet", orgIdSet)
 	logger.Debug("Generated Org ID list for user")
 
+	// Members who have left an organization are not listed with it
 	sqlStmt, args, err := sqlx.In(`
 SELECT DISTINCT
 	u.id, u.user_guid, u.email
-FROM users AS u JOIN roles AS r 
-	ON u.id = r.user_id
-WHERE r.org_id IN (?)`, orgIdSet.GetItems())
+FROM users AS u JOIN organization_memberships AS m
+	ON u.id = m.user_id
+WHERE m.organization_id IN (?) AND m.status = 'active'`, orgIdSet.GetItems())
 	if err != nil {
 		logger.WithError(err).Error("Failed to compile IN query")
 		return []User{}, err
@@ -140,10 +174,10 @@ WHERE r.org_id IN (?)`, orgIdSet.GetItems())
 
 	// Load those user's Roles
 	// OPTIMIZATION: make this a JOIN query with the users SELECT
-	for _, user := range users {
-		_, err := user.GetRoles(ctx, db)
+	for i := range users {
+		_, err := users[i].GetRoles(ctx, db)
 		if err != nil {
-			logger.WithField("UserGUID", user.Guid).WithError(err).Error("Failed to load roles for user")
+			logger.WithField("UserGUID", users[i].Guid).WithError(err).Error("Failed to load roles for user")
 			// don't block return on a failure here, just return what we do have
 		}
 	}
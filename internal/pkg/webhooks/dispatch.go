@@ -0,0 +1,374 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults for a new Dispatcher.
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultLease        = 2 * DefaultTimeout
+	DefaultMaxAttempts  = 8
+	DefaultBackoff      = 30 * time.Second
+	DefaultMaxBackoff   = 6 * time.Hour
+	DefaultDisableAfter = 20
+)
+
+// Body is what is POSTed to a webhook.
+type Body struct {
+	Id             uint64          `json:"id"` // the delivery ID, also sent as HeaderDelivery
+	EventType      string          `json:"event_type"`
+	OrganizationId uint64          `json:"organization_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Data           json.RawMessage `json:"data"` // the event's payload
+}
+
+// Dispatcher queues a delivery to each webhook subscribed to an event, and
+// sends them. Each delivery is retried on its own schedule, so that one
+// failing endpoint cannot hold up the others.
+type Dispatcher struct {
+	db *sqlx.DB
+
+	Client       *http.Client
+	Lease        time.Duration // how long a claimed delivery is left to its sender before it may be sent again
+	MaxAttempts  int           // per delivery
+	Backoff      time.Duration // before the first retry, doubled for each one after
+	MaxBackoff   time.Duration
+	DisableAfter int // consecutive failed attempts, across deliveries, before the webhook is disabled
+}
+
+// ErrForbiddenAddress is returned for a webhook URL that resolves to an
+// address on our own network, rather than the public internet.
+var ErrForbiddenAddress = errors.New("webhooks may not be sent to private, loopback or link-local addresses")
+
+// privateNetworks are the ranges, beyond loopback and link-local ones, that
+// are not reachable from the public internet.
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPublicIP reports whether ip is a unicast address on the public internet.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl refuses connections to anything but public addresses. It runs
+// after the host name has been resolved, so that a name which resolves to a
+// public address when the webhook is saved cannot be pointed elsewhere later.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// newClient makes an HTTP client that only connects to public addresses,
+// and does not follow redirects. A redirect is the endpoint's response, and
+// is treated as a failure like any other non-2xx status.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: DefaultTimeout,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func NewDispatcher(db *sqlx.DB) *Dispatcher {
+	return &Dispatcher{
+		db:           db,
+		Client:       newClient(),
+		Lease:        DefaultLease,
+		MaxAttempts:  DefaultMaxAttempts,
+		Backoff:      DefaultBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		DisableAfter: DefaultDisableAfter,
+	}
+}
+
+// retryDelay is how long to wait before the next attempt, after the given
+// number of failed attempts.
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+// eventOwner is the part of each event's payload that names its
+// organization. Site changes only name the site.
+type eventOwner struct {
+	OrganizationId uint64 `json:"organization_id"`
+	SiteId         uint64 `json:"site_id"`
+}
+
+// Queue handles each of EventTypes by queueing a delivery to every active
+// webhook of the event's organization that subscribes to it, for SendDue to
+// send.
+func (d *Dispatcher) Queue(ctx context.Context, tx *sqlx.Tx, event outbox.Event) error {
+	var owner eventOwner
+	if err := event.Decode(&owner); err != nil {
+		return err
+	}
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Dispatcher.Queue",
+		"EventID":   event.Id,
+		"EventType": event.EventType,
+	})
+
+	orgId := owner.OrganizationId
+	if orgId == 0 && owner.SiteId != 0 {
+		err := tx.GetContext(ctx, &orgId, tx.Rebind(selectSiteOrgSql), owner.SiteId)
+		if err == sql.ErrNoRows {
+			logger.WithField("SiteID", owner.SiteId).Debug("Site no longer exists")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if orgId == 0 {
+		logger.Warn("Event does not name an organization")
+		return nil
+	}
+
+	data, err := json.Marshal(Body{
+		EventType:      event.EventType,
+		OrganizationId: orgId,
+		CreatedAt:      event.CreatedAt,
+		Data:           json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(queueDeliveriesSql), event.EventType, string(data), orgId, event.EventType)
+	if err != nil {
+		logger.WithError(err).Error("Failed to queue deliveries")
+		return err
+	}
+	return nil
+}
+
+// post sends the body, signed with the webhook's secret, and returns the
+// endpoint's response status, if it answered. Anything but a 2xx is an error.
+func (d *Dispatcher) post(ctx context.Context, hook Webhook, deliveryId uint64, eventType string, body []byte) (int, error) {
+	// Webhooks saved before https was required are not sent in the clear
+	if !strings.HasPrefix(hook.Url, "https://") {
+		return 0, errors.New("webhook url must be an https URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(deliveryId, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, time.Now(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SendDue makes one attempt at each delivery that is due. It is run by the
+// jobs runner. Each delivery is claimed in one short transaction, sent with
+// no transaction open, and its result recorded in another, so that no lock
+// is held while waiting on an endpoint.
+func (d *Dispatcher) SendDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		sent, err := d.sendOne(ctx)
+		if err != nil || !sent {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// sendOne claims the next due delivery and makes one attempt at it. It
+// reports whether there was one. Failures are recorded in the delivery log
+// and retried later, rather than returned.
+func (d *Dispatcher) sendOne(ctx context.Context) (bool, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Dispatcher.SendDue",
+	})
+
+	var delivery Delivery
+	err := d.db.GetContext(ctx, &delivery, d.db.Rebind(claimDeliverySql), time.Now().Add(d.Lease))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to claim delivery")
+		return false, err
+	}
+	logger = logger.WithField("DeliveryID", delivery.Id)
+
+	var hook Webhook
+	err = d.db.GetContext(ctx, &hook, d.db.Rebind(describeWebhookSql), delivery.WebhookId)
+	if err == sql.ErrNoRows {
+		// The organization has been deleted since the delivery was queued
+		return true, d.giveUp(ctx, delivery, "organization has been deleted")
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to select webhook")
+		return true, err
+	}
+	if !hook.Active {
+		return true, d.giveUp(ctx, delivery, "webhook is disabled")
+	}
+
+	var body Body
+	if err = json.Unmarshal(delivery.Payload, &body); err != nil {
+		return true, err
+	}
+	body.Id = delivery.Id
+	sent, err := json.Marshal(body)
+	if err != nil {
+		return true, err
+	}
+
+	responseStatus, postErr := d.post(ctx, hook, delivery.Id, delivery.EventType, sent)
+	err = d.record(ctx, hook, delivery, responseStatus, postErr)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record delivery attempt")
+	}
+	return true, err
+}
+
+// giveUp fails the delivery without sending it.
+func (d *Dispatcher) giveUp(ctx context.Context, delivery Delivery, reason string) error {
+	_, err := d.db.ExecContext(ctx, d.db.Rebind(markAttemptFailedSql), StatusFailed, nil, reason, nil, delivery.Id)
+	return err
+}
+
+// record saves the result of an attempt at the delivery. A failed one is
+// retried after a backoff, unless the delivery has run out of attempts. A
+// webhook that fails DisableAfter times in a row is disabled, and its
+// pending deliveries are dropped as they come due.
+func (d *Dispatcher) record(ctx context.Context, hook Webhook, delivery Delivery, responseStatus int, postErr error) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":  "Dispatcher.record",
+		"DeliveryID": delivery.Id,
+		"WebhookID":  hook.Id,
+	})
+	var responseStatusValue *int
+	if responseStatus != 0 {
+		responseStatusValue = &responseStatus
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	if postErr == nil {
+		_, err = tx.ExecContext(ctx, tx.Rebind(markSucceededSql), responseStatusValue, delivery.Id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(resetFailuresSql), hook.Id)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	logger = logger.WithError(postErr).WithField("Attempts", delivery.Attempts)
+	var failures int
+	err = tx.GetContext(ctx, &failures, tx.Rebind(recordFailureSql), hook.Id)
+	if err != nil {
+		return err
+	}
+	status := StatusPending
+	var nextAttemptAt *time.Time
+	if failures >= d.DisableAfter {
+		logger.WithField("Failures", failures).Warn("Disabling failing webhook")
+		_, err = tx.ExecContext(ctx, tx.Rebind(disableWebhookSql), hook.Id)
+		if err != nil {
+			return err
+		}
+		status = StatusFailed
+	} else if delivery.Attempts >= d.MaxAttempts {
+		logger.Warn("Giving up on delivery")
+		status = StatusFailed
+	} else {
+		logger.Info("Failed to deliver webhook, will retry")
+		at := time.Now().Add(d.retryDelay(delivery.Attempts))
+		nextAttemptAt = &at
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(markAttemptFailedSql), status, responseStatusValue, postErr.Error(), nextAttemptAt, delivery.Id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RegisterHandlers sets up the worker to queue deliveries for each of
+// EventTypes. Schedule SendDue to send them.
+func RegisterHandlers(worker *outbox.Worker, dispatcher *Dispatcher) {
+	for _, eventType := range EventTypes {
+		worker.Handle(eventType, dispatcher.Queue)
+	}
+}
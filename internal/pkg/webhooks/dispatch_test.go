@@ -0,0 +1,244 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_retryDelay(t *testing.T) {
+	d := NewDispatcher(nil)
+	d.Backoff = 30 * time.Second
+	d.MaxBackoff = 5 * time.Minute
+
+	expected := map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+		9: 5 * time.Minute,
+	}
+	for attempts, delay := range expected {
+		if got := d.retryDelay(attempts); got != delay {
+			t.Errorf("After %d attempts: expected %v, got %v", attempts, delay, got)
+		}
+	}
+}
+
+func TestDispatcher_post(t *testing.T) {
+	hook := Webhook{Secret: "s3cret"}
+	body := []byte(`{"id":7,"event_type":"worklog.approved","organization_id":1,"data":{}}`)
+
+	var verifyErr error
+	var gotEvent, gotDelivery string
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read body: %v", err)
+		}
+		verifyErr = Verify(hook.Secret, r.Header.Get(HeaderSignature), received, DefaultTolerance, time.Now())
+		gotEvent = r.Header.Get(HeaderEvent)
+		gotDelivery = r.Header.Get(HeaderDelivery)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// The receiver is on loopback, so use its own client rather than one
+	// that only connects to public addresses
+	d := NewDispatcher(nil)
+	d.Client = receiver.Client()
+	hook.Url = receiver.URL + "/hooks"
+	status, err := d.post(context.Background(), hook, 7, "worklog.approved", body)
+	if err != nil || status != http.StatusNoContent {
+		t.Errorf("Expected a 204 and no error, got %d and %v", status, err)
+	}
+	if verifyErr != nil {
+		t.Errorf("Expected the receiver to verify the signature, got %v", verifyErr)
+	}
+	if gotEvent != "worklog.approved" || gotDelivery != "7" {
+		t.Errorf("Expected event and delivery headers, got %q and %q", gotEvent, gotDelivery)
+	}
+
+	hook.Url = receiver.URL + "/broken"
+	status, err = d.post(context.Background(), hook, 7, "worklog.approved", body)
+	if err == nil || status != http.StatusInternalServerError {
+		t.Errorf("Expected a 500 to be an error, got %d and %v", status, err)
+	}
+
+	hook.Url = strings.Replace(receiver.URL, "https://", "http://", 1) + "/hooks"
+	status, err = d.post(context.Background(), hook, 7, "worklog.approved", body)
+	if err == nil || status != 0 {
+		t.Errorf("Expected an http endpoint to be refused, got %d and %v", status, err)
+	}
+
+	hook.Url = receiver.URL
+	receiver.Close()
+	status, err = d.post(context.Background(), hook, 7, "worklog.approved", body)
+	if err == nil || status != 0 {
+		t.Errorf("Expected an unreachable endpoint to be an error with no status, got %d and %v", status, err)
+	}
+}
+
+func TestDispatcher_postRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request to reach a loopback receiver")
+	}))
+	defer receiver.Close()
+
+	d := NewDispatcher(nil)
+	hook := Webhook{Secret: "s3cret", Url: receiver.URL}
+	status, err := d.post(context.Background(), hook, 7, "worklog.approved", []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), ErrForbiddenAddress.Error()) || status != 0 {
+		t.Errorf("Expected the loopback address to be refused, got %d and %v", status, err)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	expected := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.0.0.5":         false,
+		"172.20.1.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, public := range expected {
+		if got := isPublicIP(net.ParseIP(addr)); got != public {
+			t.Errorf("%s: expected %v, got %v", addr, public, got)
+		}
+	}
+}
+
+func (suite *WebhooksTestSuite) TestDispatcher_SendDue() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+
+	var received int
+	failing := true
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	webhookId := suite.seedWebhook(receiver.URL, "worklog.approved")
+
+	var deliveryId uint64
+	err := db.Get(&deliveryId, `INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at) VALUES ($1, 'worklog.approved', '{"organization_id":2,"data":{}}', now()) RETURNING id`, webhookId)
+	suite.Require().Nil(err)
+
+	d := NewDispatcher(db)
+	d.Client = receiver.Client()
+
+	// A failed attempt is put off until its retry
+	suite.Require().Nil(d.SendDue(ctx))
+	suite.Equal(1, received)
+	deliveries, err := ListDeliveries(ctx, db, webhookId, "", 10)
+	suite.Require().Nil(err)
+	suite.Require().Len(deliveries, 1)
+	suite.Equal(StatusPending, deliveries[0].Status)
+	suite.Equal(1, deliveries[0].Attempts)
+	suite.Require().NotNil(deliveries[0].NextAttemptAt)
+	suite.True(deliveries[0].NextAttemptAt.After(time.Now()), "Expected the retry to be put off")
+
+	suite.Require().Nil(d.SendDue(ctx))
+	suite.Equal(1, received, "Expected the delivery not to be retried before it is due")
+
+	// A delivery someone else has claimed is not sent while their lease lasts
+	_, err = db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = now() WHERE id = $1`, deliveryId)
+	suite.Require().Nil(err)
+	var leased Delivery
+	suite.Require().Nil(db.Get(&leased, db.Rebind(claimDeliverySql), time.Now().Add(time.Minute)))
+	suite.Require().Nil(d.SendDue(ctx))
+	suite.Equal(1, received, "Expected a claimed delivery not to be sent again")
+
+	// Once it is due again, it is retried
+	_, err = db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = now() WHERE id = $1`, deliveryId)
+	suite.Require().Nil(err)
+	failing = false
+	claimed, err := d.sendOne(ctx)
+	suite.Require().Nil(err)
+	suite.True(claimed)
+	suite.Equal(2, received)
+
+	deliveries, err = ListDeliveries(ctx, db, webhookId, "", 10)
+	suite.Require().Nil(err)
+	suite.Equal(StatusSucceeded, deliveries[0].Status)
+	suite.Equal(3, deliveries[0].Attempts)
+	suite.Nil(deliveries[0].NextAttemptAt)
+
+	// Deliveries to a disabled webhook are dropped without being sent
+	_, err = db.Exec(`UPDATE webhooks SET active = FALSE WHERE id = $1`, webhookId)
+	suite.Require().Nil(err)
+	_, err = db.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at) VALUES ($1, 'worklog.approved', '{}', now())`, webhookId)
+	suite.Require().Nil(err)
+	suite.Require().Nil(d.SendDue(ctx))
+	suite.Equal(2, received)
+	failed, err := ListDeliveries(ctx, db, webhookId, StatusFailed, 10)
+	suite.Require().Nil(err)
+	suite.Require().Len(failed, 1)
+	suite.Equal("webhook is disabled", failed[0].LastError)
+}
+
+// Joining an organization records user.created, which reaches the
+// organization's webhooks.
+func (suite *WebhooksTestSuite) TestUserCreatedIsDelivered() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+
+	var got Body
+	var gotEvent string
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEvent = r.Header.Get(HeaderEvent)
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			suite.T().Errorf("Failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	suite.seedWebhook(receiver.URL, users.EventUserCreated)
+
+	orgId, err := organizations.JoinOrganization(ctx, db, 2, "testorg2")
+	suite.Require().Nil(err)
+	suite.Require().Equal(uint64(2), orgId)
+
+	d := NewDispatcher(db)
+	d.Client = receiver.Client()
+	worker := outbox.NewWorker(db)
+	RegisterHandlers(worker, d)
+	processed, err := worker.ProcessOne(ctx)
+	suite.Require().Nil(err)
+	suite.Require().True(processed, "Expected joining to have recorded an event")
+	suite.Require().Nil(d.SendDue(ctx))
+
+	suite.Equal(users.EventUserCreated, gotEvent)
+	suite.Equal(users.EventUserCreated, got.EventType)
+	suite.Equal(uint64(2), got.OrganizationId)
+	var payload users.UserEvent
+	suite.Require().Nil(json.Unmarshal(got.Data, &payload))
+	suite.Equal(uint64(2), payload.UserId)
+}
@@ -0,0 +1,113 @@
+package webhooks
+
+const selectWebhookColumns = `
+	SELECT
+		webhooks.id, webhooks.organization_id, webhooks.url, webhooks.secret, webhooks.event_types,
+		webhooks.active, webhooks.consecutive_failures, webhooks.disabled_at, webhooks.created_at
+	FROM webhooks
+		JOIN organizations ON organizations.id = webhooks.organization_id AND organizations.deleted_at IS NULL
+`
+
+const listWebhooksSql = selectWebhookColumns + `
+	WHERE webhooks.organization_id = ?
+	ORDER BY webhooks.id
+`
+
+const describeWebhookSql = selectWebhookColumns + `
+	WHERE webhooks.id = ?
+`
+
+const insertWebhookSql = `
+	INSERT INTO webhooks (organization_id, url, secret, event_types) VALUES (?, ?, ?, ?)
+	RETURNING id, active, created_at
+`
+
+// Re-enabling a webhook gives it a clean slate.
+const updateWebhookSql = `
+	UPDATE webhooks SET
+		url = ?,
+		event_types = ?,
+		active = ?,
+		consecutive_failures = CASE WHEN ? AND NOT active THEN 0 ELSE consecutive_failures END,
+		disabled_at = CASE WHEN ? THEN NULL ELSE disabled_at END
+	WHERE id = ?
+`
+
+const deleteWebhookSql = `
+	DELETE FROM webhooks WHERE id = ?
+`
+
+const selectSiteOrgSql = `
+	SELECT organization_id FROM sites WHERE id = ?
+`
+
+// Each active webhook of the organization subscribed to the event type gets
+// its own delivery.
+const queueDeliveriesSql = `
+	INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at)
+	SELECT id, ?, ?::jsonb, now()
+	FROM webhooks
+	WHERE organization_id = ?
+		AND active
+		AND ? = ANY(event_types)
+		AND EXISTS (SELECT 1 FROM organizations WHERE organizations.id = webhooks.organization_id AND organizations.deleted_at IS NULL)
+	RETURNING id
+`
+
+// A delivery is claimed by putting its next attempt off by the lease, so
+// that nobody else sends it meanwhile. The attempt is counted up front, so
+// that a delivery which keeps crashing its sender still runs out of them.
+const claimDeliverySql = `
+	UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?
+	WHERE id = (
+		SELECT id FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= now()
+		ORDER BY next_attempt_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, webhook_id, event_type, payload::text AS payload, status, attempts, created_at
+`
+
+const markSucceededSql = `
+	UPDATE webhook_deliveries SET
+		status = 'succeeded',
+		response_status = ?,
+		last_error = '',
+		next_attempt_at = NULL,
+		delivered_at = now()
+	WHERE id = ?
+`
+
+const markAttemptFailedSql = `
+	UPDATE webhook_deliveries SET
+		status = ?,
+		response_status = ?,
+		last_error = ?,
+		next_attempt_at = ?
+	WHERE id = ?
+`
+
+const resetFailuresSql = `
+	UPDATE webhooks SET consecutive_failures = 0 WHERE id = ?
+`
+
+const recordFailureSql = `
+	UPDATE webhooks SET consecutive_failures = consecutive_failures + 1 WHERE id = ?
+	RETURNING consecutive_failures
+`
+
+const disableWebhookSql = `
+	UPDATE webhooks SET active = FALSE, disabled_at = now() WHERE id = ?
+`
+
+const listDeliveriesSql = `
+	SELECT
+		id, webhook_id, event_type, payload::text AS payload, status, attempts,
+		response_status, last_error, next_attempt_at, created_at, delivered_at
+	FROM webhook_deliveries
+	WHERE webhook_id = ?
+		AND (?::text IS NULL OR status = ?)
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+`
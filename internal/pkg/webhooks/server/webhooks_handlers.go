@@ -0,0 +1,363 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/webhooks"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhooksServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *WebhooksServer {
+	return &WebhooksServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []webhooks.Webhook `json:"webhooks"`
+}
+
+type UpdateWebhookRequest struct {
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"` // set to re-enable a webhook disabled for failing
+}
+
+type ListDeliveriesResponse struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+func (server *WebhooksServer) GetWebhooksAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/webhooks").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.GET("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListWebhooksHandler).
+			Doc("List an organization's webhooks").
+			Param(restful.QueryParameter("organization_id", "Organization ID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListWebhooksResponse{}).
+			Returns(http.StatusOK, "Fetched webhooks", ListWebhooksResponse{}).
+			Returns(http.StatusBadRequest, "Invalid organization ID", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CreateWebhookHandler).
+			Doc("Create a webhook. The response carries the secret its deliveries are signed with, which is not shown again").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(webhooks.Webhook{}).
+			Writes(webhooks.Webhook{}).
+			Returns(http.StatusOK, "Webhook created", webhooks.Webhook{}).
+			Returns(http.StatusBadRequest, "Invalid webhook", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil))
+	service.Route(
+		service.GET("/{webhookId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DescribeWebhookHandler).
+			Doc("Fetch a webhook").
+			Param(restful.PathParameter("webhookId", "Webhook ID")).
+			Produces(restful.MIME_JSON).
+			Writes(webhooks.Webhook{}).
+			Returns(http.StatusOK, "Fetched webhook", webhooks.Webhook{}).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Webhook not found", nil))
+	service.Route(
+		service.PUT("/{webhookId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.UpdateWebhookHandler).
+			Doc("Change a webhook's URL or event types, or disable or re-enable it").
+			Param(restful.PathParameter("webhookId", "Webhook ID")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(UpdateWebhookRequest{}).
+			Writes(webhooks.Webhook{}).
+			Returns(http.StatusOK, "Webhook updated", webhooks.Webhook{}).
+			Returns(http.StatusBadRequest, "Invalid webhook", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Webhook not found", nil))
+	service.Route(
+		service.DELETE("/{webhookId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.DeleteWebhookHandler).
+			Doc("Delete a webhook and its delivery log").
+			Param(restful.PathParameter("webhookId", "Webhook ID")).
+			Returns(http.StatusOK, "Webhook deleted", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Webhook not found", nil))
+	service.Route(
+		service.GET("/{webhookId}/deliveries").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListDeliveriesHandler).
+			Doc("List a webhook's deliveries, newest first").
+			Param(restful.PathParameter("webhookId", "Webhook ID")).
+			Param(restful.QueryParameter("status", "Only deliveries with this status: pending, succeeded or failed")).
+			Param(service.QueryParameter("limit", "At most this many deliveries, up to 500").DataType("integer")).
+			Produces(restful.MIME_JSON).
+			Writes(ListDeliveriesResponse{}).
+			Returns(http.StatusOK, "Fetched deliveries", ListDeliveriesResponse{}).
+			Returns(http.StatusBadRequest, "Invalid status or limit", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not an admin of the organization", nil).
+			Returns(http.StatusNotFound, "Webhook not found", nil))
+
+	return service
+}
+
+func (server *WebhooksServer) ListWebhooksHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "ListWebhooksHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid organization ID")
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(orgId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	webhookSet, err := webhooks.ListWebhooks(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListWebhooksResponse{Webhooks: webhookSet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize webhooks")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WebhooksServer) CreateWebhookHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CreateWebhookHandler",
+	})
+
+	var webhook webhooks.Webhook
+	err := request.ReadEntity(&webhook)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	errorSet := webhook.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Webhook is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(webhook.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), webhook.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = webhook.Create(ctx, server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(webhook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize webhook")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// findWebhook loads the webhook named in the webhookId path parameter, and
+// checks that the logged-in user is an admin of its organization. On failure
+// it writes the response and returns nil.
+func (server *WebhooksServer) findWebhook(request *restful.Request, response *restful.Response) *webhooks.Webhook {
+	ctx := filters.GetRequestContext(request)
+	webhookId, err := strconv.ParseUint(request.PathParameter("webhookId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid webhook ID")
+		return nil
+	}
+	webhook, err := webhooks.DescribeWebhook(ctx, server.Config.GetDbConn(), webhookId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(webhook.OrganizationId, users.OrgAdmin) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return webhook
+}
+
+func (server *WebhooksServer) DescribeWebhookHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "DescribeWebhookHandler",
+		"WebhookID.input": request.PathParameter("webhookId"),
+	})
+
+	webhook := server.findWebhook(request, response)
+	if webhook == nil {
+		return
+	}
+	err := response.WriteEntity(webhook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize webhook")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WebhooksServer) UpdateWebhookHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "UpdateWebhookHandler",
+		"WebhookID.input": request.PathParameter("webhookId"),
+	})
+
+	var req UpdateWebhookRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	webhook := server.findWebhook(request, response)
+	if webhook == nil {
+		return
+	}
+	webhook.Url = req.Url
+	webhook.EventTypes = req.EventTypes
+	errorSet := webhook.Validate()
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Webhook is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+	webhook.Active = req.Active
+
+	err = webhook.Update(ctx, server.Config.GetDbConn())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	webhook, err = webhooks.DescribeWebhook(ctx, server.Config.GetDbConn(), webhook.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(webhook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize webhook")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WebhooksServer) DeleteWebhookHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+
+	webhook := server.findWebhook(request, response)
+	if webhook == nil {
+		return
+	}
+	err := webhooks.DeleteWebhook(ctx, server.Config.GetDbConn(), webhook.Id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Success!
+	response.WriteHeader(http.StatusOK)
+}
+
+func (server *WebhooksServer) ListDeliveriesHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "ListDeliveriesHandler",
+		"WebhookID.input": request.PathParameter("webhookId"),
+	})
+
+	var err error
+	status := request.QueryParameter("status")
+	switch status {
+	case "", webhooks.StatusPending, webhooks.StatusSucceeded, webhooks.StatusFailed:
+	default:
+		response.WriteErrorString(http.StatusBadRequest, "status must be pending, succeeded or failed")
+		return
+	}
+	limit := defaultDeliveryLimit
+	if param := request.QueryParameter("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxDeliveryLimit {
+			response.WriteErrorString(http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+	webhook := server.findWebhook(request, response)
+	if webhook == nil {
+		return
+	}
+
+	deliverySet, err := webhooks.ListDeliveries(ctx, server.Config.GetDbConn(), webhook.Id, status, limit)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = response.WriteEntity(ListDeliveriesResponse{Deliveries: deliverySet})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize deliveries")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,44 @@
+package webhooks
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret := "s3cret"
+	body := []byte(`{"id":1,"event_type":"site.updated"}`)
+	sentAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	header := Sign(secret, sentAt, body)
+
+	if err := Verify(secret, header, body, DefaultTolerance, sentAt.Add(time.Minute)); err != nil {
+		t.Errorf("Expected signature to verify, got %v", err)
+	}
+
+	// Moving the timestamp forward must not let an old signature through.
+	forged := fmt.Sprintf("t=%d,%s", sentAt.Add(time.Hour).Unix(), header[strings.Index(header, ",")+1:])
+
+	testCases := map[string]struct {
+		secret   string
+		header   string
+		body     []byte
+		now      time.Time
+		expected error
+	}{
+		"wrong secret":     {"other", header, body, sentAt, ErrInvalidSignature},
+		"altered body":     {secret, header, []byte(`{"id":2,"event_type":"site.updated"}`), sentAt, ErrInvalidSignature},
+		"replayed later":   {secret, header, body, sentAt.Add(DefaultTolerance + time.Second), ErrStaleSignature},
+		"from the future":  {secret, header, body, sentAt.Add(-DefaultTolerance - time.Second), ErrStaleSignature},
+		"forged timestamp": {secret, forged, body, sentAt.Add(time.Hour), ErrInvalidSignature},
+		"no signature":     {secret, fmt.Sprintf("t=%d", sentAt.Unix()), body, sentAt, ErrInvalidSignature},
+		"garbage":          {secret, "nonsense", body, sentAt, ErrInvalidSignature},
+		"empty":            {secret, "", body, sentAt, ErrInvalidSignature},
+	}
+	for name, tc := range testCases {
+		if err := Verify(tc.secret, tc.header, tc.body, DefaultTolerance, tc.now); err != tc.expected {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package webhooks
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type WebhooksTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestWebhooksTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(WebhooksTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping WebhooksTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+// seedWebhook subscribes the URL to the event type for testorg2, and
+// returns the webhook's ID.
+func (suite *WebhooksTestSuite) seedWebhook(url, eventType string) uint64 {
+	var id uint64
+	err := suite.Config.GetDbConn().Get(&id, `INSERT INTO webhooks (organization_id, url, secret, event_types) VALUES (2, $1, 's3cret', ARRAY[$2]) RETURNING id`, url, eventType)
+	suite.Require().Nil(err)
+	return id
+}
@@ -0,0 +1,228 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/subscriptions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/suggestions"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/worklogs"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EventTypes are the outbox events a webhook may subscribe to.
+var EventTypes = []string{
+	subscriptions.EventSiteUpdated,
+	users.EventUserCreated,
+	worklogs.EventWorkLogApproved,
+	suggestions.EventSuggestionCreated,
+}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed" // gave up after MaxAttempts, or the webhook was disabled
+)
+
+const (
+	MaxUrlLength = 2048
+	secretBytes  = 32
+)
+
+// Webhook is an endpoint an Organization's admins want sent some kinds of
+// event as they happen.
+type Webhook struct {
+	Id                  uint64         `json:"id" db:"id"`
+	OrganizationId      uint64         `json:"organization_id" db:"organization_id"`
+	Url                 string         `json:"url" db:"url"`
+	Secret              string         `json:"secret,omitempty" db:"secret"` // only shown when the webhook is created
+	EventTypes          pq.StringArray `json:"event_types" db:"event_types"`
+	Active              bool           `json:"active" db:"active"`
+	ConsecutiveFailures int            `json:"consecutive_failures" db:"consecutive_failures"`
+	DisabledAt          *time.Time     `json:"disabled_at,omitempty" db:"disabled_at"` // when it was disabled for failing
+	CreatedAt           time.Time      `json:"created_at" db:"created_at"`
+}
+
+// Delivery is one event sent, or being sent, to a webhook.
+type Delivery struct {
+	Id             uint64          `json:"id" db:"id"`
+	WebhookId      uint64          `json:"webhook_id" db:"webhook_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty" db:"response_status"` // of the last attempt
+	LastError      string          `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+}
+
+func isEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the fields an admin controls.
+func (w Webhook) Validate() *config.ErrorSet {
+	errSet := make([]error, 0)
+	if w.OrganizationId == 0 {
+		errSet = append(errSet, errors.New("organization_id must be present"))
+	}
+	if len(w.Url) > MaxUrlLength {
+		errSet = append(errSet, fmt.Errorf("url may be at most %d characters", MaxUrlLength))
+	} else if u, err := url.Parse(w.Url); err != nil || u.Scheme != "https" || u.Host == "" {
+		errSet = append(errSet, errors.New("url must be an absolute https URL"))
+	} else if ip := net.ParseIP(u.Hostname()); (ip != nil && !isPublicIP(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+		errSet = append(errSet, ErrForbiddenAddress)
+	}
+	if len(w.EventTypes) == 0 {
+		errSet = append(errSet, errors.New("event_types must list at least one event type"))
+	}
+	for _, eventType := range w.EventTypes {
+		if !isEventType(eventType) {
+			errSet = append(errSet, fmt.Errorf("unknown event type %q, expected one of %s", eventType, strings.Join(EventTypes, ", ")))
+		}
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+// dedupe drops repeated event types, keeping the first of each.
+func dedupe(eventTypes []string) pq.StringArray {
+	seen := make(map[string]bool)
+	deduped := make(pq.StringArray, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		if !seen[eventType] {
+			seen[eventType] = true
+			deduped = append(deduped, eventType)
+		}
+	}
+	return deduped
+}
+
+// Create saves a new webhook with a random signing secret.
+func (w *Webhook) Create(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":      "Webhook.Create",
+		"OrganizationID": w.OrganizationId,
+	})
+
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		logger.WithError(err).Error("Failed to generate secret")
+		return err
+	}
+	w.Secret = hex.EncodeToString(secret)
+	w.EventTypes = dedupe(w.EventTypes)
+	err := db.QueryRowxContext(ctx, db.Rebind(insertWebhookSql), w.OrganizationId, w.Url, w.Secret, w.EventTypes).
+		Scan(&w.Id, &w.Active, &w.CreatedAt)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert webhook")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// Update saves the webhook's URL, event types and whether it is active.
+// Re-activating a disabled webhook resets its failure count. Returns
+// sql.ErrNoRows if it does not exist.
+func (w *Webhook) Update(ctx context.Context, db *sqlx.DB) error {
+	w.EventTypes = dedupe(w.EventTypes)
+	result, err := db.ExecContext(ctx, db.Rebind(updateWebhookSql), w.Url, w.EventTypes, w.Active, w.Active, w.Active, w.Id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("WebhookID", w.Id).WithError(err).Error("Failed to update webhook")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListWebhooks fetches the organization's webhooks, without their secrets.
+func ListWebhooks(ctx context.Context, db *sqlx.DB, orgId uint64) ([]Webhook, error) {
+	webhookSet := make([]Webhook, 0)
+	err := db.SelectContext(ctx, &webhookSet, db.Rebind(listWebhooksSql), orgId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("OrganizationID", orgId).WithError(err).Error("Failed to select webhooks")
+		return nil, err
+	}
+	for i := range webhookSet {
+		webhookSet[i].Secret = ""
+	}
+	return webhookSet, nil
+}
+
+// DescribeWebhook fetches a single webhook, without its secret. Returns
+// sql.ErrNoRows if it does not exist.
+func DescribeWebhook(ctx context.Context, db *sqlx.DB, id uint64) (*Webhook, error) {
+	var w Webhook
+	err := db.GetContext(ctx, &w, db.Rebind(describeWebhookSql), id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			filters.GetContextLogger(ctx).WithField("WebhookID", id).WithError(err).Error("Failed to select webhook")
+		}
+		return nil, err
+	}
+	w.Secret = ""
+	return &w, nil
+}
+
+// DeleteWebhook deletes the webhook and its delivery log. Returns
+// sql.ErrNoRows if it does not exist.
+func DeleteWebhook(ctx context.Context, db *sqlx.DB, id uint64) error {
+	result, err := db.ExecContext(ctx, db.Rebind(deleteWebhookSql), id)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("WebhookID", id).WithError(err).Error("Failed to delete webhook")
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListDeliveries fetches the webhook's newest deliveries, optionally only
+// those with the given status.
+func ListDeliveries(ctx context.Context, db *sqlx.DB, webhookId uint64, status string, limit int) ([]Delivery, error) {
+	var statusFilter *string
+	if status != "" {
+		statusFilter = &status
+	}
+	deliverySet := make([]Delivery, 0)
+	err := db.SelectContext(ctx, &deliverySet, db.Rebind(listDeliveriesSql), webhookId, statusFilter, statusFilter, limit)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithFields(log.Fields{
+			"operation": "ListDeliveries",
+			"WebhookID": webhookId,
+		}).WithError(err).Error("Failed to select deliveries")
+		return nil, err
+	}
+	return deliverySet, nil
+}
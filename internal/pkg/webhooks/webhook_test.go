@@ -0,0 +1,45 @@
+package webhooks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWebhook_Validate(t *testing.T) {
+	valid := Webhook{OrganizationId: 1, Url: "https://example.org/hooks", EventTypes: []string{"site.updated"}}
+	if errSet := valid.Validate(); errSet != nil {
+		t.Errorf("Expected webhook to be valid, got %v", errSet)
+	}
+
+	testCases := map[string]struct {
+		webhook  Webhook
+		expected int
+	}{
+		"no organization":    {Webhook{Url: "https://example.org", EventTypes: []string{"site.updated"}}, 1},
+		"relative url":       {Webhook{OrganizationId: 1, Url: "/hooks", EventTypes: []string{"site.updated"}}, 1},
+		"ftp url":            {Webhook{OrganizationId: 1, Url: "ftp://example.org", EventTypes: []string{"site.updated"}}, 1},
+		"http url":           {Webhook{OrganizationId: 1, Url: "http://example.org", EventTypes: []string{"site.updated"}}, 1},
+		"private address":    {Webhook{OrganizationId: 1, Url: "https://10.1.2.3/hooks", EventTypes: []string{"site.updated"}}, 1},
+		"metadata address":   {Webhook{OrganizationId: 1, Url: "https://169.254.169.254/latest", EventTypes: []string{"site.updated"}}, 1},
+		"localhost":          {Webhook{OrganizationId: 1, Url: "https://localhost:8080", EventTypes: []string{"site.updated"}}, 1},
+		"long url":           {Webhook{OrganizationId: 1, Url: "https://example.org/" + strings.Repeat("a", MaxUrlLength), EventTypes: []string{"site.updated"}}, 1},
+		"no event types":     {Webhook{OrganizationId: 1, Url: "https://example.org"}, 1},
+		"unknown event type": {Webhook{OrganizationId: 1, Url: "https://example.org", EventTypes: []string{"site.updated", "site.deleted"}}, 1},
+		"empty":              {Webhook{}, 3},
+	}
+	for name, tc := range testCases {
+		errSet := tc.webhook.Validate()
+		if errSet == nil || len(errSet.Errors) != tc.expected {
+			t.Errorf("%s: expected %d errors, got %v", name, tc.expected, errSet)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	got := dedupe([]string{"user.created", "site.updated", "user.created"})
+	expected := []string{"user.created", "site.updated"}
+	if !reflect.DeepEqual([]string(got), expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,390 @@
+package worklogs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/outbox"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Review states of a WorkLog. New logs are submitted; editing a log that is
+// not approved marks it amended, which needs review again.
+const (
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusAmended   = "amended"
+)
+
+// Actions recorded in a WorkLog's audit trail.
+const (
+	ActionApproved = "approved"
+	ActionRejected = "rejected"
+	ActionAmended  = "amended"
+	ActionReopened = "reopened"
+)
+
+// EventWorkLogApproved is the type of the outbox event recorded when a work
+// log is approved.
+const EventWorkLogApproved = "worklog.approved"
+
+// WorkLogApprovedEvent is the payload of EventWorkLogApproved.
+type WorkLogApprovedEvent struct {
+	WorkLogId      uint64     `json:"work_log_id"`
+	OrganizationId uint64     `json:"organization_id"`
+	SiteSlug       string     `json:"site_slug"`
+	UserGuid       string     `json:"user_guid"`
+	ReviewerGuid   string     `json:"reviewer_guid,omitempty"` // unset if approval is not required
+	ClockIn        time.Time  `json:"clock_in"`
+	ClockOut       *time.Time `json:"clock_out"`
+}
+
+var (
+	ErrLocked        = errors.New("approved work logs are locked from edits until they are reopened")
+	ErrStillOpen     = errors.New("work log is still clocked in")
+	ErrNotReviewable = errors.New("work log is not awaiting review")
+	ErrNotReopenable = errors.New("only approved or rejected work logs can be reopened")
+)
+
+// WorkLogEvent is one entry in a WorkLog's audit trail.
+type WorkLogEvent struct {
+	Id        uint64    `json:"id" db:"id"`
+	WorkLogId uint64    `json:"work_log_id" db:"work_log_id"`
+	ActorGuid string    `json:"actor_guid" db:"actor_guid"`
+	Action    string    `json:"action" db:"action"`
+	Reason    string    `json:"reason,omitempty" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Reviewer is a user approving or rejecting work logs. OrgAdmins may review
+// any log in their organizations; SiteManagers only those at the sites they
+// coordinate. Nobody reviews their own work.
+type Reviewer struct {
+	UserId             uint64
+	Claims             *users.Claims
+	CoordinatedSiteIds map[uint64]bool
+}
+
+// LoadReviewer looks up the logged-in user and the sites they coordinate.
+func LoadReviewer(ctx context.Context, db *sqlx.DB, claims *users.Claims) (*Reviewer, error) {
+	if claims == nil {
+		return nil, errors.New("no JWT claims available")
+	}
+	u, err := users.GetUserByGuid(ctx, claims.Subject, db)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	siteIds, err := sites.ListCoordinatedSiteIds(ctx, db, u.Id)
+	if err != nil {
+		return nil, err
+	}
+	reviewer := Reviewer{
+		UserId:             u.Id,
+		Claims:             claims,
+		CoordinatedSiteIds: make(map[uint64]bool, len(siteIds)),
+	}
+	for _, id := range siteIds {
+		reviewer.CoordinatedSiteIds[id] = true
+	}
+	return &reviewer, nil
+}
+
+// CanReview reports whether the reviewer may approve, reject or reopen the
+// work log.
+func (r Reviewer) CanReview(w WorkLog) bool {
+	if w.UserId == r.UserId {
+		return false
+	}
+	if r.Claims.HasRole(w.OrganizationId, users.OrgAdmin) {
+		return true
+	}
+	return r.Claims.HasRole(w.OrganizationId, users.SiteManager) && r.CoordinatedSiteIds[w.SiteId]
+}
+
+// DescribeWorkLog fetches a single work log. Returns sql.ErrNoRows if it does
+// not exist.
+func DescribeWorkLog(ctx context.Context, db *sqlx.DB, workLogId uint64) (*WorkLog, error) {
+	var w WorkLog
+	err := db.GetContext(ctx, &w, db.Rebind(describeWorkLogSql), workLogId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			filters.GetContextLogger(ctx).WithField("WorkLogID", workLogId).WithError(err).Error("Failed to select work log")
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SkippedWorkLog explains why a bulk review left a work log alone.
+type SkippedWorkLog struct {
+	Id     uint64 `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type ReviewResult struct {
+	Updated []uint64         `json:"updated"`
+	Skipped []SkippedWorkLog `json:"skipped"`
+}
+
+// Review approves or rejects each of the work logs the reviewer is allowed
+// to, recording EventWorkLogApproved for each one approved. Logs which cannot
+// be reviewed are skipped and reported rather than failing the whole batch.
+func Review(ctx context.Context, db *sqlx.DB, reviewer *Reviewer, workLogIds []uint64, status, reason string) (*ReviewResult, error) {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "Review",
+		"Status":    status,
+	})
+
+	action := ActionApproved
+	if status == StatusRejected {
+		action = ActionRejected
+	} else {
+		reason = ""
+	}
+
+	result := ReviewResult{
+		Updated: make([]uint64, 0, len(workLogIds)),
+		Skipped: make([]SkippedWorkLog, 0),
+	}
+	if len(workLogIds) == 0 {
+		return &result, nil
+	}
+
+	query, args, err := sqlx.In(listWorkLogsByIdSql, workLogIds)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]WorkLog, 0, len(workLogIds))
+	err = db.SelectContext(ctx, &logs, db.Rebind(query), args...)
+	if err != nil {
+		logger.WithError(err).Error("Failed to select work logs")
+		return nil, err
+	}
+	byId := make(map[uint64]WorkLog, len(logs))
+	for _, w := range logs {
+		byId[w.Id] = w
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return nil, err
+	}
+	for _, id := range workLogIds {
+		w, ok := byId[id]
+		if !ok {
+			result.Skipped = append(result.Skipped, SkippedWorkLog{Id: id, Reason: "work log not found"})
+			continue
+		}
+		if !reviewer.CanReview(w) {
+			result.Skipped = append(result.Skipped, SkippedWorkLog{Id: id, Reason: "not permitted to review this work log"})
+			continue
+		}
+
+		res, err := tx.ExecContext(ctx, tx.Rebind(reviewWorkLogSql), status, reason, id)
+		if err != nil {
+			tx.Rollback()
+			logger.WithField("WorkLogID", id).WithError(err).Error("Failed to update work log")
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			result.Skipped = append(result.Skipped, SkippedWorkLog{Id: id, Reason: ErrNotReviewable.Error()})
+			continue
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(insertWorkLogEventSql), id, reviewer.UserId, action, reason)
+		if err != nil {
+			tx.Rollback()
+			logger.WithField("WorkLogID", id).WithError(err).Error("Failed to record work log event")
+			return nil, err
+		}
+		if status == StatusApproved {
+			err = outbox.Enqueue(ctx, tx, EventWorkLogApproved, WorkLogApprovedEvent{
+				WorkLogId:      w.Id,
+				OrganizationId: w.OrganizationId,
+				SiteSlug:       w.SiteSlug,
+				UserGuid:       w.UserGuid,
+				ReviewerGuid:   reviewer.Claims.Subject,
+				ClockIn:        w.ClockIn,
+				ClockOut:       w.ClockOut,
+			})
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		result.Updated = append(result.Updated, id)
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit review")
+		return nil, err
+	}
+
+	// Success!
+	return &result, nil
+}
+
+// Amend saves edits to the work log's times, shift and note, and marks it as
+// needing review again. Returns ErrLocked if it has been approved. If its
+// organization does not require approval, it is approved again straight away.
+func (w *WorkLog) Amend(ctx context.Context, db *sqlx.DB, actorId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.Amend",
+		"WorkLogID": w.Id,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockUser(ctx, tx, w.UserId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to lock user")
+		return err
+	}
+	var overlapping int
+	err = tx.GetContext(ctx, &overlapping, tx.Rebind(countOverlappingWorkLogsSql), w.UserId, w.Id, w.ClockOut, w.ClockIn)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check for overlapping work logs")
+		return err
+	}
+	if overlapping > 0 {
+		return ErrOverlapping
+	}
+
+	err = w.transitionTx(ctx, tx, amendWorkLogSql, []interface{}{w.ShiftId, w.ClockIn, w.ClockOut, w.Note, w.Id},
+		actorId, ActionAmended, "", StatusAmended, ErrLocked)
+	if err != nil {
+		return err
+	}
+	err = w.settleApproval(ctx, tx, actorId)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit work log")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// Reopen returns an approved or rejected work log to review, unlocking it for
+// edits.
+func (w *WorkLog) Reopen(ctx context.Context, db *sqlx.DB, actorId uint64, reason string) error {
+	return w.transition(ctx, db, reopenWorkLogSql, []interface{}{w.Id},
+		actorId, ActionReopened, reason, StatusSubmitted, ErrNotReopenable)
+}
+
+// settleApproval approves the closed work log without review, within the
+// transaction, if its organization does not require a manager's approval.
+func (w *WorkLog) settleApproval(ctx context.Context, tx *sqlx.Tx, actorId uint64) error {
+	settings, err := organizations.GetSettingsTx(ctx, tx, w.OrganizationId)
+	if err != nil {
+		return err
+	}
+	if settings.WorkLogApproval {
+		return nil
+	}
+	return w.transitionTx(ctx, tx, autoApproveWorkLogSql, []interface{}{w.Id},
+		actorId, ActionApproved, "approval not required", StatusApproved, ErrNotReviewable)
+}
+
+// transition runs a status-changing update in its own transaction. See
+// transitionTx.
+func (w *WorkLog) transition(ctx context.Context, db *sqlx.DB, updateSql string, args []interface{}, actorId uint64, action, reason, status string, notAllowed error) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.transition",
+		"WorkLogID": w.Id,
+		"Action":    action,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = w.transitionTx(ctx, tx, updateSql, args, actorId, action, reason, status, notAllowed)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit work log")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// transitionTx runs a status-changing update and records it in the audit
+// trail. The update must return updated_at, and match no rows if the
+// transition is not allowed, in which case notAllowed is returned.
+func (w *WorkLog) transitionTx(ctx context.Context, tx *sqlx.Tx, updateSql string, args []interface{}, actorId uint64, action, reason, status string, notAllowed error) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.transition",
+		"WorkLogID": w.Id,
+		"Action":    action,
+	})
+
+	err := tx.QueryRowxContext(ctx, tx.Rebind(updateSql), args...).Scan(&w.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return notAllowed
+		}
+		logger.WithError(err).Error("Failed to update work log")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, tx.Rebind(insertWorkLogEventSql), w.Id, actorId, action, reason)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record work log event")
+		return err
+	}
+	if status == StatusApproved {
+		err = outbox.Enqueue(ctx, tx, EventWorkLogApproved, WorkLogApprovedEvent{
+			WorkLogId:      w.Id,
+			OrganizationId: w.OrganizationId,
+			SiteSlug:       w.SiteSlug,
+			UserGuid:       w.UserGuid,
+			ClockIn:        w.ClockIn,
+			ClockOut:       w.ClockOut,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Status = status
+	w.RejectReason = ""
+
+	// Success!
+	return nil
+}
+
+// ListWorkLogEvents fetches the work log's audit trail, oldest first.
+func ListWorkLogEvents(ctx context.Context, db *sqlx.DB, workLogId uint64) ([]WorkLogEvent, error) {
+	events := make([]WorkLogEvent, 0)
+	err := db.SelectContext(ctx, &events, db.Rebind(listWorkLogEventsSql), workLogId)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("WorkLogID", workLogId).WithError(err).Error("Failed to select work log events")
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,74 @@
+package worklogs
+
+import (
+	"errors"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"math"
+)
+
+var ErrOutsideGeofence = errors.New("clock-in is too far from the site")
+
+const earthRadiusMeters = 6371000
+
+// Coordinates is a device's reported location.
+type Coordinates struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+func (c Coordinates) Validate() error {
+	if c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180 {
+		return errors.New("coordinates are out of range")
+	}
+	return nil
+}
+
+// DistanceMeters is the great-circle distance between two points, using the
+// haversine formula.
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// ApplyGeofence records where the work log was clocked in from, and applies
+// the organization's policy if that was outside the site's radius. A punch
+// without coordinates counts as out of range, since it cannot be checked.
+// Sites without a location set are not geofenced.
+func (w *WorkLog) ApplyGeofence(site *sites.Site, policy string, at *Coordinates) error {
+	w.GeofenceFlagged = false
+	w.DistanceMeters = nil
+	w.ClockInLat, w.ClockInLon = nil, nil
+	if at != nil {
+		w.ClockInLat = &at.Latitude
+		w.ClockInLon = &at.Longitude
+	}
+
+	siteLat, siteLon, ok := site.Coordinates()
+	if !ok || policy == organizations.GeofenceAllow {
+		if ok && at != nil {
+			distance := DistanceMeters(siteLat, siteLon, at.Latitude, at.Longitude)
+			w.DistanceMeters = &distance
+		}
+		return nil
+	}
+
+	inRange := false
+	if at != nil {
+		distance := DistanceMeters(siteLat, siteLon, at.Latitude, at.Longitude)
+		w.DistanceMeters = &distance
+		inRange = distance <= float64(site.GeofenceRadius)
+	}
+	if inRange {
+		return nil
+	}
+	if policy == organizations.GeofenceReject {
+		return ErrOutsideGeofence
+	}
+	w.GeofenceFlagged = true
+	return nil
+}
@@ -0,0 +1,53 @@
+package worklogs
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"math"
+	"testing"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	// One degree of latitude is about 111.2km
+	d := DistanceMeters(0, 0, 1, 0)
+	if math.Abs(d-111195) > 10 {
+		t.Errorf("Expected one degree of latitude to be about 111195m, got %f", d)
+	}
+	if DistanceMeters(47.6, -122.3, 47.6, -122.3) != 0 {
+		t.Error("Expected zero distance between identical points")
+	}
+}
+
+func TestWorkLog_ApplyGeofence(t *testing.T) {
+	site := &sites.Site{
+		Location:       sites.Location{Latitude: "47.6062", Longitude: "-122.3321"},
+		GeofenceRadius: 200,
+	}
+	near := &Coordinates{Latitude: 47.6070, Longitude: -122.3321} // ~90m away
+	far := &Coordinates{Latitude: 47.6162, Longitude: -122.3321}  // ~1.1km away
+
+	var w WorkLog
+	if err := w.ApplyGeofence(site, organizations.GeofenceReject, near); err != nil || w.GeofenceFlagged {
+		t.Errorf("Expected nearby punch to be accepted, got %v flagged=%v", err, w.GeofenceFlagged)
+	}
+	if w.DistanceMeters == nil || *w.DistanceMeters > 200 {
+		t.Errorf("Expected distance to be recorded, got %v", w.DistanceMeters)
+	}
+	if err := w.ApplyGeofence(site, organizations.GeofenceReject, far); err != ErrOutsideGeofence {
+		t.Errorf("Expected distant punch to be rejected, got %v", err)
+	}
+	if err := w.ApplyGeofence(site, organizations.GeofenceFlag, far); err != nil || !w.GeofenceFlagged {
+		t.Errorf("Expected distant punch to be flagged, got %v flagged=%v", err, w.GeofenceFlagged)
+	}
+	if err := w.ApplyGeofence(site, organizations.GeofenceFlag, nil); err != nil || !w.GeofenceFlagged {
+		t.Errorf("Expected punch without coordinates to be flagged, got %v flagged=%v", err, w.GeofenceFlagged)
+	}
+	if err := w.ApplyGeofence(site, organizations.GeofenceAllow, far); err != nil || w.GeofenceFlagged {
+		t.Errorf("Expected distant punch to be allowed, got %v flagged=%v", err, w.GeofenceFlagged)
+	}
+
+	unlocated := &sites.Site{GeofenceRadius: 200}
+	if err := w.ApplyGeofence(unlocated, organizations.GeofenceReject, far); err != nil || w.GeofenceFlagged {
+		t.Errorf("Expected sites without a location not to be geofenced, got %v flagged=%v", err, w.GeofenceFlagged)
+	}
+}
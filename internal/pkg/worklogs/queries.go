@@ -0,0 +1,109 @@
+package worklogs
+
+const selectWorkLogColumns = `
+	SELECT
+		work_logs.id, work_logs.organization_id,
+		work_logs.user_id, users.user_guid,
+		work_logs.site_id, sites.slug AS site_slug,
+		work_logs.shift_id, work_logs.clock_in, work_logs.clock_out,
+		work_logs.is_manual, work_logs.note,
+		work_logs.status, work_logs.rejection_reason,
+		work_logs.clock_in_lat, work_logs.clock_in_lon,
+		work_logs.clock_in_distance_m, work_logs.geofence_flagged,
+		work_logs.created_at, work_logs.updated_at
+	FROM work_logs
+		JOIN users ON users.id = work_logs.user_id
+		JOIN sites ON sites.id = work_logs.site_id
+		JOIN organizations ON organizations.id = work_logs.organization_id AND organizations.deleted_at IS NULL
+`
+
+const listSiteWorkLogsSql = selectWorkLogColumns + `
+	WHERE work_logs.site_id = ? AND work_logs.clock_in >= ? AND work_logs.clock_in < ?
+	ORDER BY work_logs.clock_in, work_logs.id
+`
+
+const listUserWorkLogsSql = selectWorkLogColumns + `
+	WHERE work_logs.user_id = ? AND work_logs.clock_in >= ? AND work_logs.clock_in < ?
+	ORDER BY work_logs.clock_in, work_logs.id
+`
+
+const listFlaggedWorkLogsSql = selectWorkLogColumns + `
+	WHERE work_logs.organization_id = ? AND work_logs.geofence_flagged
+		AND work_logs.clock_in >= ? AND work_logs.clock_in < ?
+	ORDER BY work_logs.clock_in, work_logs.id
+`
+
+const selectOpenWorkLogSql = selectWorkLogColumns + `
+	WHERE work_logs.user_id = ? AND work_logs.clock_out IS NULL
+`
+
+const insertWorkLogSql = `
+	INSERT INTO work_logs (
+		organization_id, user_id, site_id, shift_id, clock_in, clock_out, is_manual, note,
+		clock_in_lat, clock_in_lon, clock_in_distance_m, geofence_flagged
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id, status, created_at, updated_at
+`
+
+const clockOutSql = `
+	UPDATE work_logs SET clock_out = ?, updated_at = now()
+	WHERE id = ? AND clock_out IS NULL
+	RETURNING updated_at
+`
+
+// Taken before checking for overlaps, so that two of a user's work logs
+// cannot be written at once.
+const lockWorkLogUserSql = `SELECT id FROM users WHERE id = ? FOR UPDATE`
+
+// Counts the user's logs that overlap [clock_in, clock_out). Open logs are
+// treated as running until now.
+const countOverlappingWorkLogsSql = `
+	SELECT COUNT(*) FROM work_logs
+	WHERE user_id = ? AND id <> ? AND clock_in < ? AND COALESCE(clock_out, now()) > ?
+`
+
+const describeWorkLogSql = selectWorkLogColumns + `
+	WHERE work_logs.id = ?
+`
+
+const listWorkLogsByIdSql = selectWorkLogColumns + `
+	WHERE work_logs.id IN (?)
+`
+
+const reviewWorkLogSql = `
+	UPDATE work_logs SET status = ?, rejection_reason = ?, updated_at = now()
+	WHERE id = ? AND status IN ('submitted', 'amended') AND clock_out IS NOT NULL
+`
+
+const autoApproveWorkLogSql = `
+	UPDATE work_logs SET status = 'approved', updated_at = now()
+	WHERE id = ? AND status IN ('submitted', 'amended') AND clock_out IS NOT NULL
+	RETURNING updated_at
+`
+
+const amendWorkLogSql = `
+	UPDATE work_logs SET
+		shift_id = ?, clock_in = ?, clock_out = ?, note = ?,
+		status = 'amended', rejection_reason = '', updated_at = now()
+	WHERE id = ? AND status <> 'approved' AND clock_out IS NOT NULL
+	RETURNING updated_at
+`
+
+const reopenWorkLogSql = `
+	UPDATE work_logs SET status = 'submitted', rejection_reason = '', updated_at = now()
+	WHERE id = ? AND status IN ('approved', 'rejected')
+	RETURNING updated_at
+`
+
+const insertWorkLogEventSql = `
+	INSERT INTO work_log_events (work_log_id, actor_id, action, reason) VALUES (?, ?, ?, ?)
+`
+
+const listWorkLogEventsSql = `
+	SELECT
+		work_log_events.id, work_log_events.work_log_id, users.user_guid AS actor_guid,
+		work_log_events.action, work_log_events.reason, work_log_events.created_at
+	FROM work_log_events JOIN users ON users.id = work_log_events.actor_id
+	WHERE work_log_events.work_log_id = ?
+	ORDER BY work_log_events.created_at, work_log_events.id
+`
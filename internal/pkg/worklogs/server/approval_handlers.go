@@ -0,0 +1,264 @@
+package server
+
+import (
+	"database/sql"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/worklogs"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ReviewRequest struct {
+	WorkLogIds []uint64 `json:"work_log_ids"`
+	Reason     string   `json:"reason"` // required when rejecting
+}
+
+type AmendWorkLogRequest struct {
+	ShiftId  *uint64   `json:"shift_id,omitempty"`
+	ClockIn  time.Time `json:"clock_in"`
+	ClockOut time.Time `json:"clock_out"`
+	Note     string    `json:"note"`
+}
+
+type ReopenRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ListWorkLogEventsResponse struct {
+	Events []worklogs.WorkLogEvent `json:"events"`
+}
+
+func (server *WorkLogsServer) ApproveWorkLogsHandler(request *restful.Request, response *restful.Response) {
+	server.review(request, response, worklogs.StatusApproved)
+}
+
+func (server *WorkLogsServer) RejectWorkLogsHandler(request *restful.Request, response *restful.Response) {
+	server.review(request, response, worklogs.StatusRejected)
+}
+
+func (server *WorkLogsServer) review(request *restful.Request, response *restful.Response, status string) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ReviewWorkLogsHandler",
+		"Status":    status,
+	})
+
+	var req ReviewRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if len(req.WorkLogIds) == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "work_log_ids must be present")
+		return
+	}
+	if status == worklogs.StatusRejected && req.Reason == "" {
+		response.WriteErrorString(http.StatusBadRequest, "a reason must be given when rejecting work logs")
+		return
+	}
+
+	reviewer, err := worklogs.LoadReviewer(ctx, server.Config.GetDbConn(), users.GetRequestJWTClaims(request))
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up reviewer")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	result, err := worklogs.Review(ctx, server.Config.GetDbConn(), reviewer, req.WorkLogIds, status, req.Reason)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(result)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize review result")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// findWorkLog loads the work log named in the workLogId path parameter. On
+// failure it writes the response and returns nil.
+func (server *WorkLogsServer) findWorkLog(request *restful.Request, response *restful.Response) *worklogs.WorkLog {
+	ctx := filters.GetRequestContext(request)
+	workLogId, err := strconv.ParseUint(request.PathParameter("workLogId"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "invalid work log ID")
+		return nil
+	}
+	workLog, err := worklogs.DescribeWorkLog(ctx, server.Config.GetDbConn(), workLogId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return nil
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	return workLog
+}
+
+// AmendWorkLogHandler lets a volunteer fix their own work log, or a reviewer
+// correct one, so long as it has not been approved.
+func (server *WorkLogsServer) AmendWorkLogHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "AmendWorkLogHandler",
+		"WorkLogID.input": request.PathParameter("workLogId"),
+	})
+
+	var req AmendWorkLogRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	workLog := server.findWorkLog(request, response)
+	if workLog == nil {
+		return
+	}
+
+	reviewer, err := worklogs.LoadReviewer(ctx, server.Config.GetDbConn(), users.GetRequestJWTClaims(request))
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if workLog.UserId != reviewer.UserId && !reviewer.CanReview(*workLog) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if workLog.Status == worklogs.StatusApproved {
+		response.WriteErrorString(http.StatusConflict, worklogs.ErrLocked.Error())
+		return
+	}
+	if workLog.ClockOut == nil {
+		response.WriteErrorString(http.StatusConflict, worklogs.ErrStillOpen.Error())
+		return
+	}
+
+	workLog.ShiftId = req.ShiftId
+	workLog.ClockIn = req.ClockIn
+	workLog.ClockOut = &req.ClockOut
+	workLog.Note = req.Note
+	errorSet := workLog.Validate(time.Now())
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Work log is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+	if server.prepareWorkLog(request, response, logger, workLog, users.MemberRoles...) == nil {
+		return
+	}
+
+	err = workLog.Amend(ctx, server.Config.GetDbConn(), reviewer.UserId)
+	if err != nil {
+		switch err {
+		case worklogs.ErrLocked, worklogs.ErrOverlapping:
+			response.WriteErrorString(http.StatusConflict, err.Error())
+		default:
+			response.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WorkLogsServer) ReopenWorkLogHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "ReopenWorkLogHandler",
+		"WorkLogID.input": request.PathParameter("workLogId"),
+	})
+
+	var req ReopenRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	workLog := server.findWorkLog(request, response)
+	if workLog == nil {
+		return
+	}
+
+	reviewer, err := worklogs.LoadReviewer(ctx, server.Config.GetDbConn(), users.GetRequestJWTClaims(request))
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up reviewer")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !reviewer.CanReview(*workLog) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = workLog.Reopen(ctx, server.Config.GetDbConn(), reviewer.UserId, req.Reason)
+	if err != nil {
+		if err == worklogs.ErrNotReopenable {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListWorkLogEventsHandler returns a work log's audit trail to its owner and
+// to anyone who may review it.
+func (server *WorkLogsServer) ListWorkLogEventsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":       "ListWorkLogEventsHandler",
+		"WorkLogID.input": request.PathParameter("workLogId"),
+	})
+
+	workLog := server.findWorkLog(request, response)
+	if workLog == nil {
+		return
+	}
+
+	reviewer, err := worklogs.LoadReviewer(ctx, server.Config.GetDbConn(), users.GetRequestJWTClaims(request))
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if workLog.UserId != reviewer.UserId && !reviewer.CanReview(*workLog) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	events, err := worklogs.ListWorkLogEvents(ctx, server.Config.GetDbConn(), workLog.Id)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListWorkLogEventsResponse{Events: events})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log events")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,604 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/organizations"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/shifts"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/version"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/worklogs"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type WorkLogsServer struct {
+	ApiVersion string
+	Config     *config.ServiceConfig
+}
+
+func New(cfg *config.ServiceConfig) *WorkLogsServer {
+	return &WorkLogsServer{
+		ApiVersion: version.Version,
+		Config:     cfg,
+	}
+}
+
+func (server *WorkLogsServer) GetWorkLogsAPI() *restful.WebService {
+	service := new(restful.WebService)
+	service.Path(server.Config.BasePath + "/worklogs").ApiVersion(server.ApiVersion)
+	authConfig := users.AuthConfig{PublicKey: server.Config.GetPublicKey()}
+
+	service.Route(
+		service.POST("/clock-in").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ClockInHandler).
+			Doc("Clock the logged-in user in at a site").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(ClockInRequest{}).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Clocked in", worklogs.WorkLog{}).
+			Returns(http.StatusBadRequest, "Invalid request, the site is not open, or the device is too far from the site", nil).
+			Returns(http.StatusForbidden, "Logged-in user is not a member of the site's organization", nil).
+			Returns(http.StatusConflict, "User is already clocked in", nil))
+	service.Route(
+		service.POST("/clock-out").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ClockOutHandler).
+			Doc("Clock the logged-in user out").
+			Produces(restful.MIME_JSON).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Clocked out", worklogs.WorkLog{}).
+			Returns(http.StatusConflict, "User is not clocked in", nil))
+	service.Route(
+		service.POST("/").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.CreateWorkLogHandler).
+			Doc("Manually enter a work log for a forgotten punch. Site managers may enter logs for other users.").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(worklogs.WorkLog{}).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Work log created", worklogs.WorkLog{}).
+			Returns(http.StatusBadRequest, "Invalid work log, or outside the site's open hours", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not log work for this user at this site", nil).
+			Returns(http.StatusConflict, "Work log overlaps one of the user's existing work logs", nil))
+	service.Route(
+		service.GET("/site/{siteSlug}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListSiteWorkLogsHandler).
+			Doc("List the work logged at a site between two dates").
+			Param(restful.PathParameter("siteSlug", "Site slug")).
+			Param(restful.QueryParameter("from", "First date to include, YYYY-MM-DD, in the site's time zone")).
+			Param(restful.QueryParameter("to", "Last date to include, YYYY-MM-DD, in the site's time zone")).
+			Produces(restful.MIME_JSON).
+			Writes(ListWorkLogsResponse{}).
+			Returns(http.StatusOK, "Fetched work logs", ListWorkLogsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the site's organization", nil).
+			Returns(http.StatusNotFound, "Site not found", nil))
+	service.Route(
+		service.GET("/user/{userGuid}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListUserWorkLogsHandler).
+			Doc("List the work a user logged between two dates").
+			Param(restful.PathParameter("userGuid", "User GUID")).
+			Param(restful.QueryParameter("from", "First date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("to", "Last date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("timezone", "Time zone to interpret the dates in. Defaults to UTC.")).
+			Produces(restful.MIME_JSON).
+			Writes(ListWorkLogsResponse{}).
+			Returns(http.StatusOK, "Fetched work logs", ListWorkLogsResponse{}).
+			Returns(http.StatusNotFound, "User not found", nil))
+	service.Route(
+		service.GET("/flagged").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListFlaggedWorkLogsHandler).
+			Doc("List an organization's clock-ins punched from outside their site's geofence").
+			Param(restful.QueryParameter("organization_id", "Organization to list work logs for")).
+			Param(restful.QueryParameter("from", "First date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("to", "Last date to include, YYYY-MM-DD")).
+			Param(restful.QueryParameter("timezone", "Time zone to interpret the dates in. Defaults to UTC.")).
+			Produces(restful.MIME_JSON).
+			Writes(ListWorkLogsResponse{}).
+			Returns(http.StatusOK, "Fetched work logs", ListWorkLogsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user does not manage the organization", nil))
+	service.Route(
+		service.POST("/approve").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ApproveWorkLogsHandler).
+			Doc("Approve work logs in bulk. Logs the reviewer may not approve are skipped.").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(ReviewRequest{}).
+			Writes(worklogs.ReviewResult{}).
+			Returns(http.StatusOK, "Reviewed work logs", worklogs.ReviewResult{}).
+			Returns(http.StatusBadRequest, "No work logs given", nil))
+	service.Route(
+		service.POST("/reject").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.RejectWorkLogsHandler).
+			Doc("Reject work logs in bulk, giving a reason. Logs the reviewer may not reject are skipped.").
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(ReviewRequest{}).
+			Writes(worklogs.ReviewResult{}).
+			Returns(http.StatusOK, "Reviewed work logs", worklogs.ReviewResult{}).
+			Returns(http.StatusBadRequest, "No work logs or no reason given", nil))
+	service.Route(
+		service.PUT("/{workLogId}").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.AmendWorkLogHandler).
+			Doc("Amend a work log's times, shift or note. The log will need review again.").
+			Param(restful.PathParameter("workLogId", "Work log ID")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(AmendWorkLogRequest{}).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Work log amended", worklogs.WorkLog{}).
+			Returns(http.StatusBadRequest, "Invalid work log, or outside the site's open hours", nil).
+			Returns(http.StatusForbidden, "Logged-in user may not edit this work log", nil).
+			Returns(http.StatusNotFound, "Work log not found", nil).
+			Returns(http.StatusConflict, "Work log is approved, still open, or overlaps another", nil))
+	service.Route(
+		service.POST("/{workLogId}/reopen").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ReopenWorkLogHandler).
+			Doc("Return an approved or rejected work log to review, unlocking it for edits").
+			Param(restful.PathParameter("workLogId", "Work log ID")).
+			Consumes(restful.MIME_JSON).
+			Produces(restful.MIME_JSON).
+			Reads(ReopenRequest{}).
+			Writes(worklogs.WorkLog{}).
+			Returns(http.StatusOK, "Work log reopened", worklogs.WorkLog{}).
+			Returns(http.StatusForbidden, "Logged-in user may not review this work log", nil).
+			Returns(http.StatusNotFound, "Work log not found", nil).
+			Returns(http.StatusConflict, "Work log is not approved or rejected", nil))
+	service.Route(
+		service.GET("/{workLogId}/history").
+			Filter(authConfig.ValidJwtFilter).
+			To(server.ListWorkLogEventsHandler).
+			Doc("Fetch a work log's audit trail").
+			Param(restful.PathParameter("workLogId", "Work log ID")).
+			Produces(restful.MIME_JSON).
+			Writes(ListWorkLogEventsResponse{}).
+			Returns(http.StatusOK, "Fetched audit trail", ListWorkLogEventsResponse{}).
+			Returns(http.StatusForbidden, "Logged-in user may not view this work log", nil).
+			Returns(http.StatusNotFound, "Work log not found", nil))
+
+	return service
+}
+
+// Roles which may enter work logs on behalf of other volunteers, and manage
+// a site's work logs.
+var managerRoles = []users.RoleType{users.OrgAdmin, users.SiteManager}
+
+// Roles which may read other volunteers' work logs. BackOffice staff see
+// them for reporting, but may not change them.
+var readerRoles = []users.RoleType{users.OrgAdmin, users.SiteManager, users.BackOffice}
+
+// parseTimezone loads the named time zone, defaulting to UTC.
+func parseTimezone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// loggedInUser resolves the JWT subject to the user's database record.
+func (server *WorkLogsServer) loggedInUser(request *restful.Request) (*users.User, error) {
+	claims := users.GetRequestJWTClaims(request)
+	if claims == nil {
+		return nil, errors.New("no JWT claims available on request")
+	}
+	u, err := users.GetUserByGuid(filters.GetRequestContext(request), claims.Subject, server.Config.GetDbConn())
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+// prepareWorkLog fills in the work log's site and organization, checks that
+// its shift (if any) is at that site, and checks it against the site's open
+// hours. It returns the site, or on failure writes the response and returns
+// nil.
+func (server *WorkLogsServer) prepareWorkLog(request *restful.Request, response *restful.Response, logger *log.Entry, workLog *worklogs.WorkLog, roles ...users.RoleType) *sites.Site {
+	ctx := filters.GetRequestContext(request)
+	db := server.Config.GetDbConn()
+
+	site, err := sites.FindSite(ctx, workLog.SiteSlug, db)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	if site == nil {
+		response.WriteErrorString(http.StatusBadRequest, "site not found")
+		return nil
+	}
+	if site.OrganizationId == 0 {
+		response.WriteErrorString(http.StatusBadRequest, "site does not belong to an organization")
+		return nil
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(site.OrganizationId, roles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	workLog.SiteId = site.Id
+	workLog.OrganizationId = site.OrganizationId
+
+	if workLog.ShiftId != nil {
+		shift, err := shifts.DescribeShift(ctx, db, *workLog.ShiftId)
+		if err != nil && err != sql.ErrNoRows {
+			response.WriteHeader(http.StatusInternalServerError)
+			return nil
+		}
+		if shift == nil || shift.SiteId != site.Id {
+			response.WriteErrorString(http.StatusBadRequest, "shift is not at the site")
+			return nil
+		}
+	}
+
+	err = workLog.CheckOpenHours(ctx, db, site)
+	if err != nil {
+		if err == worklogs.ErrSiteClosed || err == worklogs.ErrOutsideOpenHours {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return nil
+		}
+		logger.WithError(err).Error("Failed to check site schedule")
+		response.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+	return site
+}
+
+type ClockInRequest struct {
+	SiteSlug string                `json:"site_slug"`
+	ShiftId  *uint64               `json:"shift_id,omitempty"`
+	Note     string                `json:"note"`
+	Location *worklogs.Coordinates `json:"location,omitempty"` // the device's location, if it can report one
+}
+
+func (server *WorkLogsServer) ClockInHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ClockInHandler",
+	})
+
+	var req ClockInRequest
+	err := request.ReadEntity(&req)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize request")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	if req.Location != nil {
+		if err = req.Location.Validate(); err != nil {
+			response.WriteErrorString(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	user, err := server.loggedInUser(request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	workLog := worklogs.WorkLog{
+		UserId:   user.Id,
+		UserGuid: user.Guid,
+		SiteSlug: req.SiteSlug,
+		ShiftId:  req.ShiftId,
+		ClockIn:  time.Now(),
+		Note:     req.Note,
+	}
+	site := server.prepareWorkLog(request, response, logger, &workLog, users.MemberRoles...)
+	if site == nil {
+		return
+	}
+
+	settings, err := organizations.GetSettings(ctx, server.Config.GetDbConn(), workLog.OrganizationId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logger.WithError(err).Error("Failed to look up organization settings")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = workLog.ApplyGeofence(site, settings.GeofencePolicy, req.Location)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = workLog.Open(ctx, server.Config.GetDbConn())
+	if err != nil {
+		if err == worklogs.ErrAlreadyClockedIn {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ClockOutHandler closes the logged-in user's open work log. Clocking out is
+// never refused for running past the site's hours, since that would leave
+// the volunteer stuck on the clock; reviewers see the times on approval.
+func (server *WorkLogsServer) ClockOutHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ClockOutHandler",
+	})
+
+	user, err := server.loggedInUser(request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	workLog, err := worklogs.FindOpenWorkLog(ctx, server.Config.GetDbConn(), user.Id)
+	if err == nil {
+		err = workLog.Close(ctx, server.Config.GetDbConn(), time.Now(), user.Id)
+	}
+	if err != nil {
+		if err == worklogs.ErrNotClockedIn {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WorkLogsServer) CreateWorkLogHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "CreateWorkLogHandler",
+	})
+
+	var workLog worklogs.WorkLog
+	err := request.ReadEntity(&workLog)
+	if err != nil {
+		logger.WithError(err).Debug("Failed to deserialize work log")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	errorSet := workLog.Validate(time.Now())
+	if errorSet != nil {
+		logger.WithError(errorSet.Errors[0]).Debugf("Work log is not valid - %s", errorSet.Error())
+		response.WriteError(http.StatusBadRequest, errorSet)
+		return
+	}
+
+	// Volunteers enter their own forgotten punches; managers may enter them
+	// on a volunteer's behalf.
+	roles := users.MemberRoles
+	claims := users.GetRequestJWTClaims(request)
+	user, err := server.loggedInUser(request)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up logged-in user")
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if workLog.UserGuid == "" || workLog.UserGuid == claims.Subject {
+		workLog.UserId = user.Id
+		workLog.UserGuid = user.Guid
+	} else {
+		target, err := users.GetUserByGuid(ctx, workLog.UserGuid, server.Config.GetDbConn())
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if target == nil {
+			response.WriteErrorString(http.StatusBadRequest, "user not found")
+			return
+		}
+		workLog.UserId = target.Id
+		roles = managerRoles
+	}
+
+	if server.prepareWorkLog(request, response, logger, &workLog, roles...) == nil {
+		return
+	}
+	if workLog.UserGuid != claims.Subject {
+		isMember, err := users.IsActiveMember(ctx, server.Config.GetDbConn(), workLog.OrganizationId, workLog.UserId)
+		if err != nil {
+			response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !isMember {
+			response.WriteErrorString(http.StatusBadRequest, "user is not a member of the site's organization")
+			return
+		}
+	}
+
+	err = workLog.Create(ctx, server.Config.GetDbConn(), user.Id)
+	if err != nil {
+		if err == worklogs.ErrOverlapping {
+			response.WriteErrorString(http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(workLog)
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work log")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type ListWorkLogsResponse struct {
+	WorkLogs []worklogs.WorkLog `json:"work_logs"`
+}
+
+func (server *WorkLogsServer) ListSiteWorkLogsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListSiteWorkLogsHandler",
+		"SiteSlug":  request.PathParameter("siteSlug"),
+	})
+
+	site, err := sites.FindSite(ctx, request.PathParameter("siteSlug"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !users.GetRequestJWTClaims(request).HasRole(site.OrganizationId, managerRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	from, to, err := filters.ParseDateRange(request.QueryParameter("from"), request.QueryParameter("to"), site.TimeLocation())
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "from and to must be given as YYYY-MM-DD")
+		return
+	}
+
+	logs, err := worklogs.ListSiteWorkLogs(ctx, server.Config.GetDbConn(), site.Id, from, to)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListWorkLogsResponse{WorkLogs: logs})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work logs")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListUserWorkLogsHandler returns all of a user's work logs to the user
+// themselves. Anyone else only sees the logs from organizations they manage.
+func (server *WorkLogsServer) ListUserWorkLogsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "ListUserWorkLogsHandler",
+		"UserGuid":  request.PathParameter("userGuid"),
+	})
+
+	loc, err := parseTimezone(request.QueryParameter("timezone"))
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "unknown timezone")
+		return
+	}
+	from, to, err := filters.ParseDateRange(request.QueryParameter("from"), request.QueryParameter("to"), loc)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "from and to must be given as YYYY-MM-DD")
+		return
+	}
+
+	target, err := users.GetUserByGuid(ctx, request.PathParameter("userGuid"), server.Config.GetDbConn())
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	logs, err := worklogs.ListUserWorkLogs(ctx, server.Config.GetDbConn(), target.Id, from, to)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claims := users.GetRequestJWTClaims(request)
+	if claims.Subject != target.Guid {
+		visible := make([]worklogs.WorkLog, 0, len(logs))
+		for _, w := range logs {
+			if claims.HasRole(w.OrganizationId, readerRoles...) {
+				visible = append(visible, w)
+			}
+		}
+		logs = visible
+	}
+
+	err = response.WriteEntity(ListWorkLogsResponse{WorkLogs: logs})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work logs")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (server *WorkLogsServer) ListFlaggedWorkLogsHandler(request *restful.Request, response *restful.Response) {
+	ctx := filters.GetRequestContext(request)
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation":            "ListFlaggedWorkLogsHandler",
+		"OrganizationID.input": request.QueryParameter("organization_id"),
+	})
+
+	orgId, err := strconv.ParseUint(request.QueryParameter("organization_id"), 10, 64)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "organization_id must be given")
+		return
+	}
+	loc, err := parseTimezone(request.QueryParameter("timezone"))
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "unknown timezone")
+		return
+	}
+	from, to, err := filters.ParseDateRange(request.QueryParameter("from"), request.QueryParameter("to"), loc)
+	if err != nil {
+		response.WriteErrorString(http.StatusBadRequest, "from and to must be given as YYYY-MM-DD")
+		return
+	}
+
+	if !users.GetRequestJWTClaims(request).HasRole(orgId, readerRoles...) {
+		response.WriteHeader(http.StatusForbidden)
+		return
+	}
+	err = organizations.CheckActive(ctx, server.Config.GetDbConn(), orgId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logs, err := worklogs.ListFlaggedWorkLogs(ctx, server.Config.GetDbConn(), orgId, from, to)
+	if err != nil {
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = response.WriteEntity(ListWorkLogsResponse{WorkLogs: logs})
+	if err != nil {
+		logger.WithError(err).Error("Failed to serialize work logs")
+		response.WriteHeader(http.StatusInternalServerError)
+	}
+}
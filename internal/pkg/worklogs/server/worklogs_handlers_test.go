@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/emicklei/go-restful"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type WorkLogsServerTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+	Container *restful.Container
+}
+
+// TestWorkLogsHandlerTestSuite is the "main" entry point for the suite.
+func TestWorkLogsHandlerTestSuite(t *testing.T) {
+	// Initialize the webservice
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../../users/testdata/"
+	testSuite := new(WorkLogsServerTestSuite)
+	testSuite.Config = &cfg
+	server := New(&cfg)
+	testSuite.Container = restful.NewContainer()
+	testSuite.Container.Add(server.GetWorkLogsAPI())
+	if testing.Short() {
+		t.Skip("Skipping WorkLogs Handlers tests in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+func getAuthHeader(email string, config *config.ServiceConfig) (string, error) {
+	user, err := users.FindUser(context.Background(), email, config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("no user returned")
+	}
+
+	_, err = user.GetRoles(context.Background(), config.GetDbConn())
+	if err != nil {
+		return "", err
+	}
+
+	claims := users.CreateJWT(user, config.GetTokenExpirationDuration())
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	privateKey, _ := config.GetJWTKeys()
+	if privateKey == nil {
+		return "", errors.New("failed to load private key")
+	}
+	tokenString, err := token.SignedString(privateKey)
+	return fmt.Sprintf("Bearer %s", tokenString), err
+}
+
+func (suite *WorkLogsServerTestSuite) dispatch(method, path, email string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		suite.Require().Nil(json.NewEncoder(&payload).Encode(body))
+	}
+	req, err := http.NewRequest(method, path, &payload)
+	suite.Require().Nil(err)
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	tokenStr, err := getAuthHeader(email, suite.Config)
+	suite.Require().Nil(err)
+	req.Header.Set("Authorization", tokenStr)
+
+	resp := httptest.NewRecorder()
+	suite.Container.Dispatch(resp, req)
+	return resp
+}
+
+// BackOffice staff may read other volunteers' work logs, but not enter or
+// manage them.
+func (suite *WorkLogsServerTestSuite) TestBackOfficeIsReadOnly() {
+	db := suite.Config.GetDbConn()
+	_, err := db.Exec(`UPDATE roles SET name = 4 WHERE id = 4`) // user3 is BackOffice in testorg2
+	suite.Require().Nil(err)
+	var siteId uint64
+	err = db.Get(&siteId, `INSERT INTO sites (organization_id, slug, name_l10n, locale) VALUES (2, 'testsite2', 'Test Site 2', 'en') RETURNING id`)
+	suite.Require().Nil(err)
+	_, err = db.Exec(`INSERT INTO work_logs (organization_id, user_id, site_id, clock_in, clock_out) VALUES (2, 1, $1, '2020-02-03T09:00:00Z', '2020-02-03T11:00:00Z')`, siteId)
+	suite.Require().Nil(err)
+
+	resp := suite.dispatch(http.MethodPost, "/vs/worklogs/", "user3@example.org", map[string]string{
+		"user_guid": "kit",
+		"site_slug": "testsite2",
+		"clock_in":  "2020-02-04T09:00:00Z",
+		"clock_out": "2020-02-04T11:00:00Z",
+	})
+	suite.Equal(http.StatusForbidden, resp.Code, "Expected BackOffice not to be able to log work for others")
+
+	resp = suite.dispatch(http.MethodGet, "/vs/worklogs/site/testsite2?from=2020-02-01&to=2020-02-29", "user3@example.org", nil)
+	suite.Equal(http.StatusForbidden, resp.Code, "Expected BackOffice not to be able to manage a site's work logs")
+
+	resp = suite.dispatch(http.MethodGet, "/vs/worklogs/user/kit?from=2020-02-01&to=2020-02-29", "user3@example.org", nil)
+	suite.Require().Equal(http.StatusOK, resp.Code)
+	var listResponse ListWorkLogsResponse
+	suite.Require().Nil(json.Unmarshal(resp.Body.Bytes(), &listResponse))
+	suite.Len(listResponse.WorkLogs, 1, "Expected BackOffice to see the work logs in their organization")
+}
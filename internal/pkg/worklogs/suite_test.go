@@ -0,0 +1,32 @@
+package worklogs
+
+import (
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type WorkLogsTestSuite struct {
+	testhelpers.DatabaseTestingSuite
+}
+
+func TestWorkLogsTestSuite(t *testing.T) {
+	cfg := testhelpers.GetStandardConfig()
+	cfg.FixturesPath = "../users/testdata/"
+	cfg.MigrationsPath = "file://../../../db/migrations/"
+	testSuite := new(WorkLogsTestSuite)
+	testSuite.Config = &cfg
+	if testing.Short() {
+		t.Skip("Skipping WorkLogsTestSuite in short mode")
+	} else {
+		suite.Run(t, testSuite)
+	}
+}
+
+// seedSite adds a site to testorg1, and returns its ID.
+func (suite *WorkLogsTestSuite) seedSite() uint64 {
+	var siteId uint64
+	err := suite.Config.GetDbConn().Get(&siteId, `INSERT INTO sites (organization_id, slug, name_l10n, locale) VALUES (1, 'testsite1', 'Test Site 1', 'en') RETURNING id`)
+	suite.Require().Nil(err)
+	return siteId
+}
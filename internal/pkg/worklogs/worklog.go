@@ -0,0 +1,339 @@
+package worklogs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/config"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/filters"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ErrAlreadyClockedIn = errors.New("user is already clocked in")
+	ErrNotClockedIn     = errors.New("user is not clocked in")
+	ErrOverlapping      = errors.New("work log overlaps another of the user's work logs")
+	ErrSiteClosed       = errors.New("site is closed on that date")
+	ErrOutsideOpenHours = errors.New("work log falls outside the site's open hours")
+)
+
+// ScheduleGracePeriod is how far outside a site's open hours a volunteer may
+// still log work, to allow for setting up and closing down.
+const ScheduleGracePeriod = 30 * time.Minute
+
+// WorkLog is a block of time a volunteer spent working at a Site, optionally
+// against one of the Site's Shifts.
+type WorkLog struct {
+	Id             uint64     `json:"id" db:"id"`
+	OrganizationId uint64     `json:"organization_id" db:"organization_id"`
+	UserId         uint64     `json:"-" db:"user_id"`
+	UserGuid       string     `json:"user_guid" db:"user_guid"`
+	SiteId         uint64     `json:"-" db:"site_id"`
+	SiteSlug       string     `json:"site_slug" db:"site_slug"`
+	ShiftId        *uint64    `json:"shift_id,omitempty" db:"shift_id"`
+	ClockIn        time.Time  `json:"clock_in" db:"clock_in"`
+	ClockOut       *time.Time `json:"clock_out,omitempty" db:"clock_out"` // nil while still on the clock
+	IsManual       bool       `json:"is_manual" db:"is_manual"`
+	Note           string     `json:"note" db:"note"`
+	Status         string     `json:"status" db:"status"`
+	RejectReason   string     `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Where the clock-in was punched from, if the device reported it
+	ClockInLat      *float64 `json:"clock_in_lat,omitempty" db:"clock_in_lat"`
+	ClockInLon      *float64 `json:"clock_in_lon,omitempty" db:"clock_in_lon"`
+	DistanceMeters  *float64 `json:"clock_in_distance_m,omitempty" db:"clock_in_distance_m"`
+	GeofenceFlagged bool     `json:"geofence_flagged" db:"geofence_flagged"`
+}
+
+// Hours is the length of the work log, or zero if it is still open.
+func (w WorkLog) Hours() float64 {
+	if w.ClockOut == nil {
+		return 0
+	}
+	return w.ClockOut.Sub(w.ClockIn).Hours()
+}
+
+// Validate checks a manually-entered work log. Manual entries must be
+// complete, and may not be in the future.
+func (w WorkLog) Validate(now time.Time) *config.ErrorSet {
+	errSet := make([]error, 0)
+	if len(w.SiteSlug) == 0 {
+		errSet = append(errSet, errors.New("site_slug must be present"))
+	}
+	if w.ClockIn.IsZero() || w.ClockOut == nil || w.ClockOut.IsZero() {
+		errSet = append(errSet, errors.New("clock_in and clock_out must be present"))
+	} else {
+		if !w.ClockOut.After(w.ClockIn) {
+			errSet = append(errSet, errors.New("clock_out must be after clock_in"))
+		}
+		if w.ClockOut.After(now) {
+			errSet = append(errSet, errors.New("work logs may not be entered for the future"))
+		}
+	}
+
+	if len(errSet) == 0 {
+		return nil
+	}
+	return &config.ErrorSet{
+		Errors: errSet,
+	}
+}
+
+// ValidateAgainstSchedule checks that [in, out) falls within the site's open
+// hours for the day, give or take the grace period. The schedule's times are
+// interpreted in loc. A zero out only checks the clock-in time.
+func ValidateAgainstSchedule(schedule *sites.DailySchedule, loc *time.Location, in, out time.Time, grace time.Duration) error {
+	if schedule == nil || !schedule.IsOpen {
+		return ErrSiteClosed
+	}
+	openMinutes, err := users.ParseClock(schedule.OpenTime)
+	if err != nil {
+		return err
+	}
+	closeMinutes, err := users.ParseClock(schedule.CloseTime)
+	if err != nil {
+		return err
+	}
+
+	localIn := in.In(loc)
+	midnight := time.Date(localIn.Year(), localIn.Month(), localIn.Day(), 0, 0, 0, 0, loc)
+	opens := midnight.Add(time.Duration(openMinutes) * time.Minute)
+	closes := midnight.Add(time.Duration(closeMinutes) * time.Minute)
+
+	if in.Before(opens.Add(-grace)) || !in.Before(closes.Add(grace)) {
+		return ErrOutsideOpenHours
+	}
+	if !out.IsZero() && out.After(closes.Add(grace)) {
+		return ErrOutsideOpenHours
+	}
+	return nil
+}
+
+// CheckOpenHours looks up the site's schedule for the day the work log
+// starts on and validates the log against it.
+func (w *WorkLog) CheckOpenHours(ctx context.Context, db *sqlx.DB, site *sites.Site) error {
+	loc := site.TimeLocation()
+	schedule, err := site.GetScheduleForDate(ctx, db, w.ClockIn.In(loc))
+	if err != nil {
+		return err
+	}
+	var out time.Time
+	if w.ClockOut != nil {
+		out = *w.ClockOut
+	}
+	return ValidateAgainstSchedule(schedule, loc, w.ClockIn, out, ScheduleGracePeriod)
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// lockUser holds the user's row until the transaction ends, so that
+// concurrent writes of their work logs cannot both pass the overlap check.
+func lockUser(ctx context.Context, tx *sqlx.Tx, userId uint64) error {
+	var id uint64
+	return tx.GetContext(ctx, &id, tx.Rebind(lockWorkLogUserSql), userId)
+}
+
+// Open inserts the work log as a clock-in punch. Returns ErrAlreadyClockedIn
+// if the user already has one open.
+func (w *WorkLog) Open(ctx context.Context, db *sqlx.DB) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.Open",
+		"UserID":    w.UserId,
+		"SiteSlug":  w.SiteSlug,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockUser(ctx, tx, w.UserId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to lock user")
+		return err
+	}
+	w.ClockOut = nil
+	w.IsManual = false
+	err = w.insert(ctx, tx)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrAlreadyClockedIn
+		}
+		logger.WithError(err).Error("Failed to insert work log")
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit work log")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// Create inserts a manually-entered work log on the actor's say-so. Returns
+// ErrOverlapping if the user has already logged any of the time. A manual
+// entry was not punched from anywhere, so it has no location and is never
+// flagged by the geofence. If its organization does not require approval,
+// it is approved straight away.
+func (w *WorkLog) Create(ctx context.Context, db *sqlx.DB, actorId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.Create",
+		"UserID":    w.UserId,
+		"SiteSlug":  w.SiteSlug,
+	})
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockUser(ctx, tx, w.UserId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to lock user")
+		return err
+	}
+	var overlapping int
+	err = tx.GetContext(ctx, &overlapping, tx.Rebind(countOverlappingWorkLogsSql), w.UserId, w.Id, w.ClockOut, w.ClockIn)
+	if err != nil {
+		logger.WithError(err).Error("Failed to check for overlapping work logs")
+		return err
+	}
+	if overlapping > 0 {
+		return ErrOverlapping
+	}
+
+	w.IsManual = true
+	w.ClockInLat, w.ClockInLon, w.DistanceMeters = nil, nil, nil
+	w.GeofenceFlagged = false
+	err = w.insert(ctx, tx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert work log")
+		return err
+	}
+	err = w.settleApproval(ctx, tx, actorId)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit work log")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+func (w *WorkLog) insert(ctx context.Context, tx *sqlx.Tx) error {
+	row := tx.QueryRowxContext(ctx, tx.Rebind(insertWorkLogSql),
+		w.OrganizationId, w.UserId, w.SiteId, w.ShiftId, w.ClockIn, w.ClockOut, w.IsManual, w.Note,
+		w.ClockInLat, w.ClockInLon, w.DistanceMeters, w.GeofenceFlagged)
+	return row.Scan(&w.Id, &w.Status, &w.CreatedAt, &w.UpdatedAt)
+}
+
+// FindOpenWorkLog fetches the user's open work log. Returns ErrNotClockedIn
+// if they are not clocked in.
+func FindOpenWorkLog(ctx context.Context, db *sqlx.DB, userId uint64) (*WorkLog, error) {
+	var w WorkLog
+	err := db.GetContext(ctx, &w, db.Rebind(selectOpenWorkLogSql), userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotClockedIn
+		}
+		filters.GetContextLogger(ctx).WithField("UserID", userId).WithError(err).Error("Failed to select open work log")
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Close clocks the work log out on the actor's say-so. Returns
+// ErrNotClockedIn if it was already closed. If its organization does not
+// require approval, it is approved straight away.
+func (w *WorkLog) Close(ctx context.Context, db *sqlx.DB, at time.Time, actorId uint64) error {
+	logger := filters.GetContextLogger(ctx).WithFields(log.Fields{
+		"operation": "WorkLog.Close",
+		"WorkLogID": w.Id,
+	})
+
+	if !at.After(w.ClockIn) {
+		return errors.New("clock_out must be after clock_in")
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowxContext(ctx, tx.Rebind(clockOutSql), at, w.Id).Scan(&w.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotClockedIn
+		}
+		logger.WithError(err).Error("Failed to clock out")
+		return err
+	}
+	w.ClockOut = &at
+	err = w.settleApproval(ctx, tx, actorId)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.WithError(err).Error("Failed to commit work log")
+		return err
+	}
+
+	// Success!
+	return nil
+}
+
+// ListSiteWorkLogs fetches the work logs at a site starting in [from, to).
+func ListSiteWorkLogs(ctx context.Context, db *sqlx.DB, siteId uint64, from, to time.Time) ([]WorkLog, error) {
+	logs := make([]WorkLog, 0)
+	err := db.SelectContext(ctx, &logs, db.Rebind(listSiteWorkLogsSql), siteId, from, to)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("SiteID", siteId).WithError(err).Error("Failed to select work logs")
+		return nil, err
+	}
+	return logs, nil
+}
+
+// ListUserWorkLogs fetches a user's work logs starting in [from, to).
+func ListUserWorkLogs(ctx context.Context, db *sqlx.DB, userId uint64, from, to time.Time) ([]WorkLog, error) {
+	logs := make([]WorkLog, 0)
+	err := db.SelectContext(ctx, &logs, db.Rebind(listUserWorkLogsSql), userId, from, to)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("UserID", userId).WithError(err).Error("Failed to select work logs")
+		return nil, err
+	}
+	return logs, nil
+}
+
+// ListFlaggedWorkLogs fetches the organization's work logs starting in
+// [from, to) which were clocked in from outside their site's geofence.
+func ListFlaggedWorkLogs(ctx context.Context, db *sqlx.DB, orgId uint64, from, to time.Time) ([]WorkLog, error) {
+	logs := make([]WorkLog, 0)
+	err := db.SelectContext(ctx, &logs, db.Rebind(listFlaggedWorkLogsSql), orgId, from, to)
+	if err != nil {
+		filters.GetContextLogger(ctx).WithField("OrganizationID", orgId).WithError(err).Error("Failed to select flagged work logs")
+		return nil, err
+	}
+	return logs, nil
+}
@@ -0,0 +1,166 @@
+package worklogs
+
+import (
+	"context"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/sites"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/testhelpers"
+	"github.com/klaital/volunteer-savvy-backend/internal/pkg/users"
+	"testing"
+	"time"
+)
+
+func TestValidateAgainstSchedule(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	schedule := &sites.DailySchedule{OpenTime: "09:00", CloseTime: "17:00", IsOpen: true}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2020, time.February, 3, hour, minute, 0, 0, loc)
+	}
+
+	cases := []struct {
+		name     string
+		in, out  time.Time
+		expected error
+	}{
+		{"within hours", at(9, 0), at(17, 0), nil},
+		{"early within grace", at(8, 30), at(12, 0), nil},
+		{"late within grace", at(13, 0), at(17, 30), nil},
+		{"still on the clock", at(10, 0), time.Time{}, nil},
+		{"too early", at(8, 29), at(12, 0), ErrOutsideOpenHours},
+		{"too late", at(13, 0), at(17, 31), ErrOutsideOpenHours},
+		{"clocking in after close", at(17, 30), time.Time{}, ErrOutsideOpenHours},
+		// 14:00 UTC is 09:00 in New York
+		{"other time zone", time.Date(2020, time.February, 3, 14, 0, 0, 0, time.UTC), time.Time{}, nil},
+	}
+	for _, c := range cases {
+		actual := ValidateAgainstSchedule(schedule, loc, c.in, c.out, ScheduleGracePeriod)
+		if actual != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, actual)
+		}
+	}
+
+	closed := &sites.DailySchedule{OpenTime: "09:00", CloseTime: "17:00", IsOpen: false}
+	if err := ValidateAgainstSchedule(closed, loc, at(10, 0), at(11, 0), ScheduleGracePeriod); err != ErrSiteClosed {
+		t.Errorf("Expected closed site to be rejected, got %v", err)
+	}
+	if err := ValidateAgainstSchedule(nil, loc, at(10, 0), at(11, 0), ScheduleGracePeriod); err != ErrSiteClosed {
+		t.Errorf("Expected missing schedule to be rejected, got %v", err)
+	}
+}
+
+func TestWorkLog_Validate(t *testing.T) {
+	now := time.Date(2020, time.February, 3, 18, 0, 0, 0, time.UTC)
+	out := now.Add(-time.Hour)
+	valid := WorkLog{SiteSlug: "site", ClockIn: now.Add(-4 * time.Hour), ClockOut: &out}
+	if errs := valid.Validate(now); errs != nil {
+		t.Errorf("Expected work log to be valid, got %v", errs)
+	}
+
+	future := now.Add(time.Hour)
+	invalid := WorkLog{ClockIn: future.Add(time.Hour), ClockOut: &future}
+	errs := invalid.Validate(now)
+	if errs == nil || len(errs.Errors) != 3 {
+		t.Errorf("Expected 3 validation errors, got %v", errs)
+	}
+
+	open := WorkLog{SiteSlug: "site", ClockIn: now.Add(-time.Hour)}
+	if errs := open.Validate(now); errs == nil {
+		t.Error("Expected manual entry without clock_out to be invalid")
+	}
+}
+
+func TestReviewer_CanReview(t *testing.T) {
+	w := WorkLog{UserId: 1, OrganizationId: 10, SiteId: 100}
+
+	orgAdmin := Reviewer{UserId: 2, Claims: &users.Claims{Roles: map[uint64][]users.RoleType{10: {users.OrgAdmin}}}}
+	if !orgAdmin.CanReview(w) {
+		t.Error("Expected OrgAdmin to review any log in their org")
+	}
+
+	otherOrgAdmin := Reviewer{UserId: 2, Claims: &users.Claims{Roles: map[uint64][]users.RoleType{11: {users.OrgAdmin}}}}
+	if otherOrgAdmin.CanReview(w) {
+		t.Error("Expected OrgAdmin of another org to be refused")
+	}
+
+	coordinator := Reviewer{
+		UserId:             3,
+		Claims:             &users.Claims{Roles: map[uint64][]users.RoleType{10: {users.SiteManager}}},
+		CoordinatedSiteIds: map[uint64]bool{100: true},
+	}
+	if !coordinator.CanReview(w) {
+		t.Error("Expected SiteManager to review logs at a site they coordinate")
+	}
+	coordinator.CoordinatedSiteIds = map[uint64]bool{101: true}
+	if coordinator.CanReview(w) {
+		t.Error("Expected SiteManager to be refused at a site they do not coordinate")
+	}
+
+	self := Reviewer{UserId: 1, Claims: &users.Claims{Roles: map[uint64][]users.RoleType{10: {users.OrgAdmin}}}}
+	if self.CanReview(w) {
+		t.Error("Expected users to be refused reviewing their own work")
+	}
+}
+
+func (suite *WorkLogsTestSuite) TestWorkLog_CreateApprovedByActor() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+	siteId := suite.seedSite()
+	_, err := db.Exec(`INSERT INTO organization_settings (organization_id, work_log_approval) VALUES (1, false)`)
+	suite.Require().Nil(err)
+
+	clockIn := time.Date(2020, time.February, 3, 9, 0, 0, 0, time.UTC)
+	clockOut := clockIn.Add(2 * time.Hour)
+	w := WorkLog{
+		OrganizationId: 1,
+		UserId:         2,
+		UserGuid:       "user2",
+		SiteId:         siteId,
+		SiteSlug:       "testsite1",
+		ClockIn:        clockIn,
+		ClockOut:       &clockOut,
+	}
+	// kit enters the work log on user2's behalf
+	suite.Require().Nil(w.Create(ctx, db, 1))
+	suite.Equal(StatusApproved, w.Status)
+
+	events, err := ListWorkLogEvents(ctx, db, w.Id)
+	suite.Require().Nil(err)
+	suite.Require().Len(events, 1)
+	suite.Equal(ActionApproved, events[0].Action)
+	suite.Equal("kit", events[0].ActorGuid, "Expected the manager who entered the work log to have approved it")
+}
+
+func (suite *WorkLogsTestSuite) TestWorkLog_CreateConcurrently() {
+	db := suite.Config.GetDbConn()
+	ctx := context.Background()
+	siteId := suite.seedSite()
+	clockIn := time.Date(2020, time.February, 3, 9, 0, 0, 0, time.UTC)
+	clockOut := clockIn.Add(2 * time.Hour)
+
+	// Both start before either has been inserted, and overlap each other
+	start := make(chan struct{})
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		w := WorkLog{
+			OrganizationId: 1,
+			UserId:         2,
+			UserGuid:       "user2",
+			SiteId:         siteId,
+			SiteSlug:       "testsite1",
+			ClockIn:        clockIn.Add(time.Duration(i) * 30 * time.Minute),
+			ClockOut:       &clockOut,
+		}
+		go func() {
+			<-start
+			results <- w.Create(ctx, db, 2)
+		}()
+	}
+	close(start)
+
+	errs := []error{<-results, <-results}
+	suite.Contains(errs, nil, "Expected one of the work logs to be created")
+	suite.Contains(errs, ErrOverlapping, "Expected the other work log to be refused")
+	suite.Equal(1, testhelpers.CountTable("work_logs", db))
+}
@@ -1,4 +1,4 @@
 INSERT INTO organizations
-        (name, slug, authcode, contact_user_id, lat, lon)
+        (name, slug, authcode_hash, contact_user_id, lat, lon)
     VALUES
-        ('Test Organization #1', 'test-organization-1', 'secretcode1234', null, 0.0, 0.0);
+        ('Test Organization #1', 'test-organization-1', sha256('secretcode1234'), null, 0.0, 0.0);